@@ -2,24 +2,30 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"expvar"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/gorilla/mux"
-	"github.com/jackc/pgx/v4/pgxpool"
 
 	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/grpcserver"
 	"github.com/janson/usermicroservice/internal/handler"
+	"github.com/janson/usermicroservice/internal/mailer"
+	"github.com/janson/usermicroservice/internal/migration"
+	"github.com/janson/usermicroservice/internal/outbox"
+	"github.com/janson/usermicroservice/internal/repository"
+	"github.com/janson/usermicroservice/internal/repository/cache"
 	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/requestinfo"
 	"github.com/janson/usermicroservice/internal/service"
+	"github.com/janson/usermicroservice/internal/tenant"
+	"github.com/janson/usermicroservice/internal/webhook"
 )
 
 func main() {
@@ -28,6 +34,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Ошибка загрузки конфигурации: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Некорректная конфигурация: %v", err)
+	}
 
 	// Настройка логгера для записи в файл
 	logFile, err := os.OpenFile(cfg.Logging.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
@@ -39,31 +48,182 @@ func main() {
 	logger := log.New(logFile, "", log.LstdFlags)
 	logger.Printf("Запуск микросервиса пользователей...")
 
-	// Запуск миграций базы данных для создания таблиц
-	runMigrations(cfg, logger)
-
 	// Подключение к базе данных PostgreSQL
-	dbpool, err := pgxpool.Connect(context.Background(), cfg.Database.ConnectionString())
+	// Подключение повторяется, пока сервер базы данных запускается
+	dbpool, err := postgres.Connect(context.Background(), cfg.Database, logger)
 	if err != nil {
 		logger.Fatalf("Невозможно подключиться к базе данных: %v", err)
 	}
 	defer dbpool.Close()
 
+	// Применение и проверка миграций базы данных
+	// Сервис не запускается на схеме в состоянии dirty или отстающей от встроенных миграций
+	if err := migration.Run(context.Background(), cfg, logger); err != nil {
+		logger.Fatalf("Ошибка миграций базы данных: %v", err)
+	}
+
+	// Подключение к репликам для чтения, если они настроены
+	replicaPools, err := postgres.OpenReplicas(cfg.Database)
+	if err != nil {
+		logger.Fatalf("Некорректная строка подключения к реплике: %v", err)
+	}
+	defer func() {
+		for _, pool := range replicaPools {
+			pool.Close()
+		}
+	}()
+
+	// Политики row-level security действуют, только если включены для таблиц (см. readme.md)
+	if cfg.Database.RowLevelSecurity {
+		enabled, err := postgres.RowLevelSecurityEnabled(context.Background(), dbpool)
+		if err != nil {
+			logger.Printf("Не удалось проверить row-level security: %v", err)
+		} else if !enabled {
+			logger.Printf("database.row_level_security включен, но row-level security для users и user_audit выключена")
+		}
+	}
+
+	// Определение арендатора запросов, если разделение по арендаторам включено
+	var tenantResolver *tenant.Resolver
+	if cfg.Tenancy.Enabled {
+		tenantResolver, err = tenant.NewResolver(cfg.Tenancy)
+		if err != nil {
+			logger.Fatalf("Некорректные настройки арендаторов: %v", err)
+		}
+		logger.Printf("Разделение пользователей по арендаторам включено")
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	var replicaRouter *postgres.ReplicaRouter
+	if len(replicaPools) > 0 {
+		replicaRouter = postgres.NewReplicaRouter(replicaPools, cfg.Database, logger)
+		go replicaRouter.Run(backgroundCtx)
+		logger.Printf("Чтение пользователей распределяется на реплики: %d", len(replicaPools))
+	}
+
 	// Инициализация репозитория, сервиса и обработчика для работы с пользователями
-	userRepo := postgres.NewUserRepository(dbpool)
-	userService := service.NewUserService(userRepo)
+	var userRepo repository.UserRepository = postgres.NewUserRepository(dbpool, replicaRouter)
+	if cfg.Cache.Enabled {
+		userRepo = cache.NewUserRepository(userRepo, cache.NewStore(cfg.Cache),
+			cfg.Cache.TTL.Duration, cfg.Cache.NegativeTTL.Duration, logger)
+		logger.Printf("Кэширование пользователей включено (хранилище: %s)", cfg.Cache.Backend)
+	}
+	groupRepo := postgres.NewGroupRepository(dbpool)
+	userService := service.NewUserService(userRepo, postgres.NewAuditRepository(dbpool), groupRepo,
+		postgres.NewTxManager(dbpool, cfg.Database))
 	userHandler := handler.NewUserHandler(userService, logger)
+	groupHandler := handler.NewGroupHandler(service.NewGroupService(groupRepo, userRepo), logger)
+
+	// Инициализация отправителя писем и сервиса приглашений
+	mail, err := mailer.New(cfg.Mailer, logger)
+	if err != nil {
+		logger.Fatalf("Ошибка настройки отправки писем: %v", err)
+	}
+	credentialRepo := postgres.NewCredentialRepository(dbpool)
+	invitationService := service.NewInvitationService(postgres.NewInvitationRepository(dbpool), userService,
+		credentialRepo, postgres.NewTxManager(dbpool, cfg.Database), mail, cfg.Invitations)
+	invitationHandler := handler.NewInvitationHandler(invitationService, logger)
+
+	// Инициализация входа по паролю с защитой от перебора паролей и двухфакторной аутентификацией
+	mfaService, err := service.NewMFAService(userService, postgres.NewMFARepository(dbpool), cfg.Auth)
+	if err != nil {
+		logger.Fatalf("Ошибка настройки двухфакторной аутентификации: %v", err)
+	}
+	authService := service.NewAuthService(userService, credentialRepo, mfaService, cfg.Auth, cfg.Tenancy.JWTClaim,
+		logger)
+	authHandler := handler.NewAuthHandler(authService, mfaService, logger)
+	if cfg.Auth.JWTSecret == "" {
+		logger.Printf("Вход по паролю выключен: не задан auth.jwt_secret")
+	}
+	if cfg.Auth.MFAEncryptionKey == "" {
+		logger.Printf("Подключение двухфакторной аутентификации выключено: не задан auth.mfa_encryption_key")
+	}
+
+	// Инициализация входа через внешних поставщиков удостоверений
+	identityService, err := service.NewIdentityService(postgres.NewIdentityRepository(dbpool), userService,
+		authService, cfg.Auth.Providers)
+	if err != nil {
+		logger.Fatalf("Ошибка настройки внешних поставщиков удостоверений: %v", err)
+	}
+	identityHandler := handler.NewIdentityHandler(identityService, logger)
+	for _, provider := range cfg.Auth.Providers {
+		logger.Printf("Вход через внешнего поставщика %s включен (издатель: %s)", provider.Name, provider.Issuer)
+	}
+
+	// Инициализация ключей API для доступа сервисов без пароля пользователя
+	apiKeyService := service.NewAPIKeyService(postgres.NewAPIKeyRepository(dbpool))
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService, logger)
+
+	// Инициализация провайдера OpenID Connect для входа других приложений по учетным записям сервиса
+	oidcService, err := service.NewOIDCService(postgres.NewOIDCRepository(dbpool), userService, authService, cfg.OIDC,
+		cfg.Tenancy.JWTClaim, logger)
+	if err != nil {
+		logger.Fatalf("Ошибка настройки провайдера OpenID Connect: %v", err)
+	}
+	oidcHandler := handler.NewOIDCHandler(oidcService, logger)
+	if oidcService.Enabled() {
+		go oidcService.Run(backgroundCtx)
+		logger.Printf("Провайдер OpenID Connect включен (издатель: %s)", cfg.OIDC.Issuer)
+	}
+
+	webhookRepo := postgres.NewWebhookRepository(dbpool)
+	webhookService := service.NewWebhookService(webhookRepo, cfg.Webhooks)
+	webhookHandler := handler.NewWebhookHandler(webhookService, logger)
+
+	// Запуск ретранслятора доменных событий из таблицы outbox
+	if cfg.Outbox.Enabled {
+		var publishers outbox.MultiPublisher
+		if cfg.Outbox.Publisher != "" {
+			publisher, err := outbox.NewPublisher(cfg.Outbox)
+			if err != nil {
+				logger.Fatalf("Ошибка настройки публикатора событий: %v", err)
+			}
+			publishers = append(publishers, publisher)
+		}
+		if cfg.Webhooks.Enabled {
+			// Ретранслятор ставит события в очередь вебхуков, доставку выполняет диспетчер в отдельной горутине
+			dispatcher := webhook.NewDispatcher(webhookRepo, cfg.Webhooks, logger)
+			publishers = append(publishers, dispatcher)
+			go dispatcher.Run(backgroundCtx)
+		}
+
+		relay := outbox.NewRelay(postgres.NewOutboxRepository(dbpool), publishers, cfg.Outbox, logger)
+		go relay.Run(backgroundCtx)
+		logger.Printf("Ретранслятор событий запущен (публикатор: %q, вебхуки: %t)", cfg.Outbox.Publisher, cfg.Webhooks.Enabled)
+	}
 
 	// Настройка маршрутизатора и регистрация маршрутов API
-	router := mux.NewRouter()
-	userHandler.RegisterRoutes(router)
+	var tenantMiddleware mux.MiddlewareFunc
+	if tenantResolver != nil {
+		tenantMiddleware = handler.TenantMiddleware(tenantResolver)
+	}
+	router := handler.NewRouter(handler.Handlers{
+		User:       userHandler,
+		Group:      groupHandler,
+		Invitation: invitationHandler,
+		Auth:       authHandler,
+		Identity:   identityHandler,
+		APIKey:     apiKeyHandler,
+		OIDC:       oidcHandler,
+		Webhook:    webhookHandler,
+		Docs:       handler.NewDocsHandler(),
+	}, handler.AuthMiddleware(authService, apiKeyService, logger), tenantMiddleware)
+
+	// Добавление middleware для сохранения ID запроса, инициатора и IP-адреса клиента
+	router.Use(handler.RequestInfoMiddleware(cfg.Server.TrustedProxies))
+
+	// Добавление middleware для заголовков Cache-Control по маршрутам
+	router.Use(handler.CacheControlMiddleware(cfg.Server.CacheControl))
 
 	// Добавление middleware для логирования всех запросов
 	router.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			next.ServeHTTP(w, r)
-			logger.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
+			logger.Printf("%s %s %s request_id=%s", r.Method, r.RequestURI, time.Since(start),
+				requestinfo.FromContext(r.Context()).RequestID)
 		})
 	})
 
@@ -80,47 +240,73 @@ func main() {
 		}
 	}()
 
+	// Счетчики expvar (в том числе кэша пользователей и запросов по арендаторам) отдаются отдельным сервером
+	// без проверки учетных данных, поэтому его адрес не должен быть доступен снаружи (по умолчанию 127.0.0.1)
+	var debugServer *http.Server
+	if cfg.Server.DebugAddr != "" {
+		debugMux := http.NewServeMux()
+		debugMux.Handle("/debug/vars", expvar.Handler())
+		debugServer = &http.Server{
+			Addr:    cfg.Server.DebugAddr,
+			Handler: debugMux,
+		}
+
+		go func() {
+			logger.Printf("Служебный сервер запущен на %s", cfg.Server.DebugAddr)
+			if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatalf("Ошибка служебного сервера: %v", err)
+			}
+		}()
+	}
+
+	// Запуск gRPC сервера на отдельном порту с общим сервисом пользователей
+	grpcServer, grpcHealth := grpcserver.New(userService, authService, apiKeyService, tenantResolver, logger)
+	if cfg.GRPC.Enabled {
+		listener, err := net.Listen("tcp", ":"+cfg.GRPC.Port)
+		if err != nil {
+			logger.Fatalf("Ошибка открытия порта gRPC сервера: %v", err)
+		}
+
+		go func() {
+			logger.Printf("gRPC сервер запущен на порту %s", cfg.GRPC.Port)
+			if err := grpcServer.Serve(listener); err != nil {
+				logger.Fatalf("Ошибка gRPC сервера: %v", err)
+			}
+		}()
+	}
+
 	// Обработка сигналов для корректного завершения работы
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	logger.Println("Завершение работы сервера...")
+	stopBackground()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Fatalf("Сервер принудительно закрыт: %v", err)
+	if cfg.GRPC.Enabled {
+		// Клиенты проверки здоровья узнают о завершении до закрытия соединений
+		grpcHealth.Shutdown()
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
 	}
 
-	logger.Println("Сервер корректно завершил работу")
-}
-
-// runMigrations применяет миграции для создания необходимых таблиц в базе данных
-func runMigrations(cfg *config.Config, logger *log.Logger) {
-	// Путь к миграциям и строка подключения к базе данных
-	migrationsPath := "file://migrations"
-	connString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.DBName,
-		cfg.Database.SSLMode,
-	)
-
-	// Создание экземпляра для управления миграциями
-	m, err := migrate.New(migrationsPath, connString)
-	if err != nil {
-		logger.Printf("Ошибка инициализации миграций: %v", err)
-		return
+	if debugServer != nil {
+		debugServer.Shutdown(ctx)
 	}
-
-	// Применение миграций
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		logger.Printf("Ошибка применения миграций: %v", err)
-		return
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Fatalf("Сервер принудительно закрыт: %v", err)
 	}
 
-	logger.Println("Миграции базы данных успешно применены")
+	logger.Println("Сервер корректно завершил работу")
 }
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/janson/usermicroservice/internal/config"
+)
+
+// runConfig выполняет подкоманду config validate
+func runConfig(cfg *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "validate" {
+		return errUsage
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("конфигурация некорректна:\n%w", err)
+	}
+
+	fmt.Println("конфигурация корректна")
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/repository"
+	"github.com/janson/usermicroservice/internal/repository/cache"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/service"
+	"github.com/janson/usermicroservice/internal/tenant"
+)
+
+// usage - справка по командам утилиты
+const usage = `userctl - утилита администрирования микросервиса пользователей
+
+Использование:
+  userctl [-config config.json] [-tenant <арендатор>] <команда> [аргументы]
+
+Команды users и seed выполняются в пределах арендатора -tenant (по умолчанию default)
+
+Команды:
+  migrate up [N]            применить все миграции или N следующих
+  migrate down [N]          откатить все миграции или N последних
+  migrate goto <версия>     перейти к указанной версии схемы
+  migrate version           показать текущую версию схемы
+  migrate force <версия>    установить версию без выполнения миграций (после сбоя)
+  seed [-profile dev|test]  применить встроенный профиль фикстур (повторный запуск безопасен)
+  seed -file <файл>         применить фикстуру из YAML или JSON файла
+  users list [-json]        вывести список пользователей
+  users get <id>            вывести пользователя в формате JSON
+  users create -name <имя> -email <email> [-role admin|member]
+  users password <id>       установить пароль, прочитанный из стандартного ввода
+  users delete <id>         удалить пользователя
+  users suspend [-reason <причина>] <id>
+                            приостановить учетную запись
+  users reactivate [-reason <причина>] <id>
+                            активировать учетную запись
+  users import <файл|->     создать пользователей из JSON массива, существующие email пропускаются
+  users export [файл|-]     выгрузить пользователей в JSON массив
+  config validate           проверить файл конфигурации
+`
+
+// errUsage возвращается при некорректных аргументах командной строки
+var errUsage = errors.New("некорректные аргументы, см. userctl -h")
+
+func main() {
+	configPath := flag.String("config", "config.json", "путь к файлу конфигурации")
+	tenantID := flag.String("tenant", requestinfo.DefaultTenant, "арендатор команд users и seed")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+	}
+	flag.Parse()
+
+	if err := run(*configPath, *tenantID, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "userctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run выполняет команду, указанную в аргументах
+func run(configPath, tenantID string, args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		return errUsage
+	}
+	if !tenant.Valid(tenantID) {
+		return fmt.Errorf("некорректный арендатор %q: %w", tenantID, errUsage)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("загрузка конфигурации: %w", err)
+	}
+
+	ctx := requestinfo.WithInfo(context.Background(), requestinfo.Info{Actor: actor(), TenantID: tenantID})
+
+	switch args[0] {
+	case "migrate":
+		return runMigrate(ctx, cfg, args[1:])
+	case "seed":
+		return runSeed(ctx, cfg, args[1:])
+	case "users":
+		return withService(ctx, cfg, func(svc *service.UserService, auth *service.AuthService) error {
+			return runUsers(ctx, svc, auth, args[1:])
+		})
+	case "config":
+		return runConfig(cfg, args[1:])
+	default:
+		return fmt.Errorf("неизвестная команда %q: %w", args[0], errUsage)
+	}
+}
+
+// withService подключается к базе данных и передает в fn сервис пользователей и сервис входа (для установки паролей)
+// Используются те же сервисы, что и в API, поэтому изменения попадают в журнал аудита и outbox
+// При общем кэше redis изменения сбрасывают записи кэша сервиса; кэш memory находится в памяти процессов
+// сервиса, и изменения userctl становятся видны в нем по истечении cache.ttl
+func withService(ctx context.Context, cfg *config.Config,
+	fn func(svc *service.UserService, auth *service.AuthService) error) error {
+	logger := log.New(os.Stderr, "userctl: ", 0)
+	dbpool, err := postgres.Connect(ctx, cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("подключение к базе данных: %w", err)
+	}
+	defer dbpool.Close()
+
+	var users repository.UserRepository = postgres.NewUserRepository(dbpool, nil)
+	if cfg.Cache.Enabled && cfg.Cache.Backend == "redis" {
+		users = cache.NewUserRepository(users, cache.NewStore(cfg.Cache), cfg.Cache.TTL.Duration,
+			cfg.Cache.NegativeTTL.Duration, logger)
+	}
+
+	svc := service.NewUserService(users, postgres.NewAuditRepository(dbpool),
+		postgres.NewGroupRepository(dbpool), postgres.NewTxManager(dbpool, cfg.Database))
+	auth := service.NewAuthService(svc, postgres.NewCredentialRepository(dbpool), nil, cfg.Auth, cfg.Tenancy.JWTClaim,
+		logger)
+	return fn(svc, auth)
+}
+
+// actor возвращает инициатора изменений для журнала аудита
+func actor() string {
+	if u, err := user.Current(); err == nil {
+		return "userctl:" + u.Username
+	}
+	return "userctl"
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// fakeUsers - хранилище пользователей в памяти для команд users
+type fakeUsers struct {
+	users []*model.User
+}
+
+func (r *fakeUsers) Create(ctx context.Context, user model.UserCreate) (*model.User, error) {
+	created := &model.User{ID: int64(len(r.users) + 1), Name: user.Name, Email: user.Email,
+		DisplayName: user.DisplayName, Phone: user.Phone, Locale: user.Locale, Timezone: user.Timezone,
+		AvatarURL: user.AvatarURL, Metadata: user.Metadata, Role: user.Role, Status: user.Status,
+		TenantID: requestinfo.FromContext(ctx).Tenant()}
+	r.users = append(r.users, created)
+	return created, nil
+}
+
+func (r *fakeUsers) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeUsers) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeUsers) GetAll(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	users := make([]model.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+func (r *fakeUsers) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	return len(r.users), nil
+}
+
+func (r *fakeUsers) Update(ctx context.Context, id int64, update model.UserUpdate) (*model.User, error) {
+	return nil, errors.New("не используется")
+}
+
+func (r *fakeUsers) ChangeStatus(ctx context.Context, id int64, change model.UserStatusChange) (*model.User, error) {
+	user, _ := r.GetByID(ctx, id)
+	if user != nil {
+		user.Status = change.Status
+	}
+	return user, nil
+}
+
+func (r *fakeUsers) Delete(ctx context.Context, id int64) error {
+	return errors.New("не используется")
+}
+
+// fakeTransactor выполняет функцию без транзакции
+type fakeTransactor struct{}
+
+func (fakeTransactor) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// TestRunArguments проверяет отказ при некорректных командах и аргументах до изменения данных
+func TestRunArguments(t *testing.T) {
+	if err := run("config.json", requestinfo.DefaultTenant, nil); !errors.Is(err, errUsage) {
+		t.Errorf("Без команды: ожидалась ошибка %v, получено %v", errUsage, err)
+	}
+	if err := run("../../config.json", requestinfo.DefaultTenant, []string{"frobnicate"}); !errors.Is(err, errUsage) {
+		t.Errorf("Неизвестная команда: ожидалась ошибка %v, получено %v", errUsage, err)
+	}
+
+	// Аргументы users проверяются до обращения к сервису, поэтому сервисы не нужны
+	tests := [][]string{
+		{},
+		{"frobnicate"},
+		{"get"},
+		{"get", "abc"},
+		{"get", "1", "2"},
+		{"delete", "-1x"},
+		{"suspend", "-reason", "отпуск"},
+		{"import"},
+		{"import", "a.json", "b.json"},
+		{"export", "a.json", "b.json"},
+	}
+	for _, args := range tests {
+		if err := runUsers(context.Background(), nil, nil, args); !errors.Is(err, errUsage) {
+			t.Errorf("users %s: ожидалась ошибка %v, получено %v", strings.Join(args, " "), errUsage, err)
+		}
+	}
+}
+
+// TestRunRejectsInvalidTenant проверяет, что некорректный -tenant отклоняется до загрузки конфигурации
+func TestRunRejectsInvalidTenant(t *testing.T) {
+	for _, tenantID := range []string{"", "Acme", "acme corp", "../acme", strings.Repeat("a", 65)} {
+		err := run("missing.json", tenantID, []string{"users", "list"})
+		if !errors.Is(err, errUsage) {
+			t.Errorf("Арендатор %q: ожидалась ошибка %v, получено %v", tenantID, errUsage, err)
+		}
+	}
+}
+
+// TestImportExportRoundTrip проверяет, что выгрузка импортируется в пустой арендатор с теми же данными
+// пользователей, включая приостановленных, а повторный импорт ничего не создает
+func TestImportExportRoundTrip(t *testing.T) {
+	ctx := requestinfo.WithInfo(context.Background(), requestinfo.Info{Actor: "userctl:test", TenantID: "acme"})
+	source := &fakeUsers{}
+	sourceService := service.NewUserService(source, nil, nil, fakeTransactor{})
+	for _, u := range []model.UserCreate{
+		{Name: "Иван", Email: "ivan@example.com", DisplayName: "Иван П.", Locale: "ru", Role: model.UserRoleAdmin,
+			Metadata: map[string]interface{}{"team": "core"}},
+		{Name: "Мария", Email: "maria@example.com", Status: model.UserStatusPending},
+		{Name: "Петр", Email: "petr@example.com"},
+	} {
+		if _, err := sourceService.Create(ctx, u); err != nil {
+			t.Fatalf("Ошибка создания %s: %v", u.Email, err)
+		}
+	}
+	if _, err := sourceService.Suspend(ctx, 3, "отпуск"); err != nil {
+		t.Fatalf("Ошибка приостановки: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := usersExport(ctx, sourceService, path); err != nil {
+		t.Fatalf("Ошибка выгрузки: %v", err)
+	}
+
+	target := &fakeUsers{}
+	targetService := service.NewUserService(target, nil, nil, fakeTransactor{})
+	for i := 0; i < 2; i++ {
+		if err := usersImport(ctx, targetService, path); err != nil {
+			t.Fatalf("Ошибка импорта: %v", err)
+		}
+	}
+
+	if len(target.users) != len(source.users) {
+		t.Fatalf("Ожидалось %d пользователей после повторного импорта, получено %d", len(source.users), len(target.users))
+	}
+	for i, want := range source.users {
+		got := target.users[i]
+		if got.Name != want.Name || got.Email != want.Email || got.DisplayName != want.DisplayName ||
+			got.Locale != want.Locale || got.Role != want.Role || got.Status != want.Status ||
+			got.TenantID != "acme" || !reflect.DeepEqual(got.Metadata, want.Metadata) {
+			t.Errorf("Пользователь %s импортирован как %+v, ожидалось %+v", want.Email, got, want)
+		}
+	}
+}
+
+// TestMain подавляет вывод команд в стандартный поток
+func TestMain(m *testing.M) {
+	stdout := os.Stdout
+	if devNull, err := os.Open(os.DevNull); err == nil {
+		os.Stdout = devNull
+	}
+	code := m.Run()
+	os.Stdout = stdout
+	os.Exit(code)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/migration"
+)
+
+// runMigrate выполняет подкоманды migrate up|down|goto|version|force
+// Изменяющие схему подкоманды выполняются под той же блокировкой, что и миграции при запуске сервиса
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	if args[0] != "version" {
+		unlock, err := migration.Lock(ctx, cfg.Database)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	m, err := migration.New(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("инициализация миграций: %w", err)
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		steps, err := optionalNumber(args[1:])
+		if err != nil {
+			return err
+		}
+		if steps > 0 {
+			err = m.Steps(steps)
+		} else {
+			err = m.Up()
+		}
+		if err := ignoreNoChange(err); err != nil {
+			return err
+		}
+	case "down":
+		steps, err := optionalNumber(args[1:])
+		if err != nil {
+			return err
+		}
+		if steps > 0 {
+			err = m.Steps(-steps)
+		} else {
+			err = m.Down()
+		}
+		if err := ignoreNoChange(err); err != nil {
+			return err
+		}
+	case "goto":
+		version, err := requiredNumber(args[1:])
+		if err != nil {
+			return err
+		}
+		if err := ignoreNoChange(m.Migrate(uint(version))); err != nil {
+			return err
+		}
+	case "force":
+		// Версия -1 сбрасывает схему в состояние "миграции не применялись"
+		if len(args) != 2 {
+			return errUsage
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < -1 {
+			return fmt.Errorf("некорректная версия %q: %w", args[1], errUsage)
+		}
+		if err := m.Force(version); err != nil {
+			return err
+		}
+	case "version":
+	default:
+		return fmt.Errorf("неизвестная подкоманда migrate %q: %w", args[0], errUsage)
+	}
+
+	return printVersion(m)
+}
+
+// printVersion выводит текущую версию схемы, последнюю встроенную миграцию
+// и признак незавершенной миграции
+func printVersion(m *migrate.Migrate) error {
+	latest, err := migration.LatestVersion()
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Printf("версия: нет примененных миграций (последняя: %d)\n", latest)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		fmt.Printf("версия: %d (dirty - миграция завершилась с ошибкой, исправьте схему и выполните migrate force)\n", version)
+		return nil
+	}
+	fmt.Printf("версия: %d (последняя: %d)\n", version, latest)
+	return nil
+}
+
+// ignoreNoChange считает отсутствие изменений успешным результатом
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// optionalNumber разбирает необязательный положительный числовой аргумент
+func optionalNumber(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+	return requiredNumber(args)
+}
+
+// requiredNumber разбирает обязательный неотрицательный числовой аргумент
+func requiredNumber(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errUsage
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("ожидалось неотрицательное число, получено %q: %w", args[0], errUsage)
+	}
+	return n, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/seed"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// runSeed применяет встроенный профиль фикстур (-profile) или фикстуру из файла (-file)
+// Фикстура проверяется до подключения к базе данных
+func runSeed(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	profile := flags.String("profile", "dev", "встроенный профиль фикстур")
+	file := flags.String("file", "", "файл фикстуры в формате YAML или JSON (вместо -profile)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		fixture *seed.Fixture
+		err     error
+	)
+	if *file != "" {
+		fixture, err = seed.Load(*file)
+	} else {
+		fixture, err = seed.Profile(*profile)
+	}
+	if err != nil {
+		return err
+	}
+
+	return withService(ctx, cfg, func(svc *service.UserService, _ *service.AuthService) error {
+		result, err := seed.NewSeeder(svc, cfg.Environment).Apply(ctx, fixture)
+		fmt.Printf("создано: %d, обновлено: %d, без изменений: %d\n", result.Created, result.Updated, result.Unchanged)
+		return err
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// runUsers выполняет подкоманды users list|get|create|password|delete|suspend|reactivate|import|export
+func runUsers(ctx context.Context, svc *service.UserService, auth *service.AuthService, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return usersList(ctx, svc, args[1:])
+	case "get":
+		id, err := parseUserID(args[1:])
+		if err != nil {
+			return err
+		}
+		user, err := svc.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return writeJSON(os.Stdout, user)
+	case "create":
+		return usersCreate(ctx, svc, args[1:])
+	case "password":
+		id, err := parseUserID(args[1:])
+		if err != nil {
+			return err
+		}
+		return usersPassword(ctx, auth, id, os.Stdin)
+	case "delete":
+		id, err := parseUserID(args[1:])
+		if err != nil {
+			return err
+		}
+		if err := svc.Delete(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("пользователь %d удален\n", id)
+		return nil
+	case "suspend", "reactivate":
+		return usersChangeStatus(ctx, svc, args[0], args[1:])
+	case "import":
+		if len(args) != 2 {
+			return errUsage
+		}
+		return usersImport(ctx, svc, args[1])
+	case "export":
+		path := "-"
+		if len(args) == 2 {
+			path = args[1]
+		} else if len(args) > 2 {
+			return errUsage
+		}
+		return usersExport(ctx, svc, path)
+	default:
+		return fmt.Errorf("неизвестная подкоманда users %q: %w", args[0], errUsage)
+	}
+}
+
+// usersList выводит пользователей таблицей или JSON массивом
+func usersList(ctx context.Context, svc *service.UserService, args []string) error {
+	flags := flag.NewFlagSet("users list", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "вывести в формате JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	users, _, err := svc.GetAll(ctx, model.UserFilter{})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(os.Stdout, users)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tИМЯ\tEMAIL\tСОСТОЯНИЕ\tСОЗДАН")
+	for _, u := range users {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", u.ID, u.Name, u.Email, u.Status, u.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// usersCreate создает пользователя из флагов -name, -email и -role
+// Так создается первый администратор арендатора, который затем управляет остальными через API
+func usersCreate(ctx context.Context, svc *service.UserService, args []string) error {
+	flags := flag.NewFlagSet("users create", flag.ContinueOnError)
+	name := flags.String("name", "", "имя пользователя")
+	email := flags.String("email", "", "электронная почта")
+	role := flags.String("role", "", "роль: admin или member (по умолчанию member)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	user, err := svc.Create(ctx, model.UserCreate{Name: *name, Email: *email, Role: *role})
+	if err != nil {
+		return err
+	}
+	return writeJSON(os.Stdout, user)
+}
+
+// usersPassword устанавливает пароль пользователя, прочитанный из первой строки input
+// Пароль не передается аргументом, чтобы не попасть в историю команд и список процессов
+func usersPassword(ctx context.Context, auth *service.AuthService, id int64, input io.Reader) error {
+	password, err := bufio.NewReader(input).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if err := auth.SetPassword(ctx, id, strings.TrimRight(password, "\r\n")); err != nil {
+		return err
+	}
+	fmt.Printf("пароль пользователя %d установлен\n", id)
+	return nil
+}
+
+// usersChangeStatus приостанавливает (suspend) или активирует (reactivate) учетную запись
+// Причина из флага -reason записывается в журнал аудита
+func usersChangeStatus(ctx context.Context, svc *service.UserService, command string, args []string) error {
+	flags := flag.NewFlagSet("users "+command, flag.ContinueOnError)
+	reason := flags.String("reason", "", "причина для журнала аудита")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	id, err := parseUserID(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	change := svc.Suspend
+	if command == "reactivate" {
+		change = svc.Reactivate
+	}
+	user, err := change(ctx, id, *reason)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("пользователь %d: %s\n", user.ID, user.Status)
+	return nil
+}
+
+// usersImport создает пользователей из JSON массива объектов {"name": ..., "email": ...}
+// Пользователи с уже существующим email пропускаются, поэтому повторный импорт безопасен
+// path - путь к файлу или "-" для стандартного ввода
+func usersImport(ctx context.Context, svc *service.UserService, path string) error {
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	var users []model.UserCreate
+	if err := json.NewDecoder(input).Decode(&users); err != nil {
+		return fmt.Errorf("разбор файла импорта: %w", err)
+	}
+
+	created, skipped, err := createMissing(ctx, svc, users)
+	fmt.Printf("создано: %d, пропущено (email уже существует): %d\n", created, skipped)
+	return err
+}
+
+// usersExport выгружает всех пользователей в JSON массив
+// path - путь к файлу или "-" для стандартного вывода
+func usersExport(ctx context.Context, svc *service.UserService, path string) error {
+	users, _, err := svc.GetAll(ctx, model.UserFilter{})
+	if err != nil {
+		return err
+	}
+
+	if path == "-" {
+		return writeJSON(os.Stdout, users)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(file, users); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "выгружено пользователей: %d\n", len(users))
+	return nil
+}
+
+// createMissing создает пользователей, email которых еще не занят
+// Выгрузка содержит и приостановленные или заблокированные учетные записи, а создать можно только активную
+// или ожидающую активации, поэтому такие пользователи создаются активными и сразу приостанавливаются
+// Возвращает количество созданных и пропущенных пользователей
+func createMissing(ctx context.Context, svc *service.UserService, users []model.UserCreate) (int, int, error) {
+	created, skipped := 0, 0
+	for _, u := range users {
+		_, err := svc.GetByEmail(ctx, u.Email)
+		if err == nil {
+			skipped++
+			continue
+		}
+		if !errors.Is(err, service.ErrUserNotFound) {
+			return created, skipped, err
+		}
+
+		status := u.Status
+		if status == model.UserStatusSuspended || status == model.UserStatusLocked {
+			u.Status = model.UserStatusActive
+		}
+		user, err := svc.Create(ctx, u)
+		if err != nil {
+			return created, skipped, fmt.Errorf("создание пользователя %q: %w", u.Email, err)
+		}
+		if u.Status != status {
+			if _, err := svc.Suspend(ctx, user.ID, "импорт: исходное состояние "+status); err != nil {
+				return created, skipped, fmt.Errorf("приостановка пользователя %q: %w", u.Email, err)
+			}
+		}
+		created++
+	}
+	return created, skipped, nil
+}
+
+// parseUserID разбирает единственный аргумент - ID пользователя
+func parseUserID(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, errUsage
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("некорректный ID пользователя %q: %w", args[0], errUsage)
+	}
+	return id, nil
+}
+
+// writeJSON записывает значение в формате JSON с отступами
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
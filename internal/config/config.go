@@ -1,21 +1,50 @@
 package config
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config содержит все настройки для сервиса
 // Используется для загрузки конфигурации из JSON файла
 type Config struct {
-	Server   ServerConfig   `json:"server"`   // Настройки HTTP сервера
-	Database DatabaseConfig `json:"database"` // Настройки базы данных
-	Logging  LoggingConfig  `json:"logging"`  // Настройки логирования
+	Environment string            `json:"environment"` // Окружение: production, staging, development или test (пусто - production)
+	Server      ServerConfig      `json:"server"`      // Настройки HTTP сервера
+	GRPC        GRPCConfig        `json:"grpc"`        // Настройки gRPC сервера
+	Database    DatabaseConfig    `json:"database"`    // Настройки базы данных
+	Migrations  MigrationsConfig  `json:"migrations"`  // Настройки миграций схемы при запуске
+	Cache       CacheConfig       `json:"cache"`       // Настройки кэширования пользователей
+	Tenancy     TenancyConfig     `json:"tenancy"`     // Настройки разделения пользователей по арендаторам
+	Logging     LoggingConfig     `json:"logging"`     // Настройки логирования
+	Outbox      OutboxConfig      `json:"outbox"`      // Настройки публикации доменных событий
+	Webhooks    WebhooksConfig    `json:"webhooks"`    // Настройки доставки вебхуков партнерам
+	Mailer      MailerConfig      `json:"mailer"`      // Настройки отправки писем
+	Invitations InvitationsConfig `json:"invitations"` // Настройки приглашений пользователей
+	Auth        AuthConfig        `json:"auth"`        // Настройки входа по паролю
+	OIDC        OIDCConfig        `json:"oidc"`        // Настройки провайдера OpenID Connect
 }
 
 // ServerConfig содержит настройки HTTP сервера
 type ServerConfig struct {
-	Port string `json:"port"` // Порт, на котором будет работать сервер
+	Port           string            `json:"port"`            // Порт, на котором будет работать сервер
+	CacheControl   map[string]string `json:"cache_control"`   // Значения Cache-Control по маршрутам ("GET /users/{id}": "private, no-cache")
+	DebugAddr      string            `json:"debug_addr"`      // Адрес служебного сервера со счетчиками /debug/vars (пусто - выключен)
+	TrustedProxies []string          `json:"trusted_proxies"` // Подсети (CIDR) прокси, которым доверяют X-Forwarded-For и X-Real-IP
+}
+
+// GRPCConfig содержит настройки gRPC сервера
+type GRPCConfig struct {
+	Enabled bool   `json:"enabled"` // Включает gRPC API
+	Port    string `json:"port"`    // Порт gRPC сервера (должен отличаться от порта HTTP сервера)
 }
 
 // DatabaseConfig содержит настройки подключения к базе данных
@@ -26,6 +55,54 @@ type DatabaseConfig struct {
 	Password string `json:"password"` // Пароль для подключения к БД
 	DBName   string `json:"dbname"`   // Имя базы данных
 	SSLMode  string `json:"sslmode"`  // Режим SSL (обычно disable для локальной разработки)
+
+	MaxConns          int32    `json:"max_conns"`           // Максимальное число соединений в пуле (0 - по умолчанию pgxpool)
+	MinConns          int32    `json:"min_conns"`           // Минимальное число открытых соединений
+	MaxConnLifetime   Duration `json:"max_conn_lifetime"`   // Максимальное время жизни соединения
+	MaxConnIdleTime   Duration `json:"max_conn_idle_time"`  // Время простоя, после которого соединение закрывается
+	HealthCheckPeriod Duration `json:"health_check_period"` // Период проверки простаивающих соединений
+	StatementTimeout  Duration `json:"statement_timeout"`   // Максимальное время выполнения запроса (пусто - без ограничения)
+	ConnectTimeout    Duration `json:"connect_timeout"`     // Таймаут установки соединения
+	ConnectAttempts   int      `json:"connect_attempts"`    // Число попыток подключения при запуске (0 - 10)
+
+	IsolationLevel string `json:"isolation_level"` // Уровень изоляции транзакций: read_committed, repeatable_read, serializable (пусто - read_committed)
+	TxMaxAttempts  int    `json:"tx_max_attempts"` // Число попыток транзакции при конфликте сериализации (0 - 3)
+
+	Replicas             []string `json:"replicas"`               // Строки подключения к репликам для чтения (пусто - чтение с основного сервера)
+	MaxReplicaLag        Duration `json:"max_replica_lag"`        // Допустимая задержка реплики (пусто - 5s)
+	ReplicaStickiness    Duration `json:"replica_stickiness"`     // Время чтения с основного сервера после записи в той же сессии (пусто - 5s)
+	ReplicaCheckInterval Duration `json:"replica_check_interval"` // Интервал проверки доступности и задержки реплик (пусто - 5s)
+
+	RowLevelSecurity bool `json:"row_level_security"` // Передавать арендатора в параметре сеанса app.tenant_id для политик RLS
+}
+
+// MigrationsConfig содержит настройки миграций схемы базы данных при запуске сервиса
+type MigrationsConfig struct {
+	Mode        string   `json:"mode"`         // Режим: auto (применить и проверить), verify (только проверить), off (пусто - auto)
+	LockTimeout Duration `json:"lock_timeout"` // Время ожидания блокировки миграций другим экземпляром (пусто - 1m)
+}
+
+// CacheConfig содержит настройки кэша получения пользователя по ID
+type CacheConfig struct {
+	Enabled       bool     `json:"enabled"`        // Включает кэширование
+	Backend       string   `json:"backend"`        // Хранилище: memory (LRU в памяти процесса) или redis
+	Size          int      `json:"size"`           // Максимальное число записей для memory (0 - 10000)
+	TTL           Duration `json:"ttl"`            // Время жизни найденного пользователя (пусто - 1m)
+	NegativeTTL   Duration `json:"negative_ttl"`   // Время жизни записи об отсутствии пользователя (пусто - 10s)
+	RedisAddr     string   `json:"redis_addr"`     // Адрес сервера для redis (host:port)
+	RedisPassword string   `json:"redis_password"` // Пароль сервера для redis
+	RedisDB       int      `json:"redis_db"`       // Номер базы данных для redis
+}
+
+// TenancyConfig содержит настройки определения арендатора запроса
+// Если разделение выключено, все пользователи принадлежат арендатору "default"
+type TenancyConfig struct {
+	Enabled       bool   `json:"enabled"`        // Включает определение арендатора для каждого запроса
+	Header        string `json:"header"`         // Заголовок с ID арендатора (пусто - X-Tenant-ID)
+	TrustHeader   bool   `json:"trust_header"`   // Принимать арендатора из заголовка без токена (за доверенным шлюзом)
+	JWTSecret     string `json:"jwt_secret"`     // Секрет HS256 для проверки токенов Authorization: Bearer (пусто - токены не проверяются)
+	JWTClaim      string `json:"jwt_claim"`      // Утверждение токена с ID арендатора (пусто - tenant_id)
+	DefaultTenant string `json:"default_tenant"` // Арендатор запросов без токена и заголовка (пусто - такие запросы отклоняются)
 }
 
 // LoggingConfig содержит настройки логирования
@@ -34,6 +111,126 @@ type LoggingConfig struct {
 	Level    string `json:"level"`     // Уровень логирования (info, debug, error и т.д.)
 }
 
+// OutboxConfig содержит настройки ретранслятора событий из таблицы outbox
+type OutboxConfig struct {
+	Enabled        bool     `json:"enabled"`         // Включает фоновую публикацию событий
+	Publisher      string   `json:"publisher"`       // Тип публикатора: file, webhook или пусто (только вебхуки по подпискам)
+	FilePath       string   `json:"file_path"`       // Путь к файлу для публикатора file
+	WebhookURL     string   `json:"webhook_url"`     // URL получателя для публикатора webhook
+	PollInterval   Duration `json:"poll_interval"`   // Интервал опроса таблицы outbox (например, "1s")
+	BatchSize      int      `json:"batch_size"`      // Максимальное число событий за один проход
+	MaxAttempts    int      `json:"max_attempts"`    // Число неудачных попыток публикации, после которого событие откладывается
+	InitialBackoff Duration `json:"initial_backoff"` // Задержка перед первым повтором
+	MaxBackoff     Duration `json:"max_backoff"`     // Максимальная задержка между повторами
+}
+
+// WebhooksConfig содержит настройки доставки вебхуков по подпискам
+// События ставятся в очередь доставки ретранслятором outbox, поэтому вебхуки требуют включенного outbox
+type WebhooksConfig struct {
+	Enabled              bool     `json:"enabled"`                // Включает рассылку вебхуков
+	PollInterval         Duration `json:"poll_interval"`          // Интервал опроса очереди доставки
+	BatchSize            int      `json:"batch_size"`             // Максимальное число доставок, выполняемых одновременно
+	MaxAttempts          int      `json:"max_attempts"`           // Максимальное число попыток доставки одного события
+	InitialBackoff       Duration `json:"initial_backoff"`        // Задержка перед первым повтором
+	MaxBackoff           Duration `json:"max_backoff"`            // Максимальная задержка между повторами
+	FailureThreshold     int      `json:"failure_threshold"`      // Число неудачных доставок подряд до отключения подписки
+	Timeout              Duration `json:"timeout"`                // Таймаут одного HTTP запроса
+	AllowInsecureTargets bool     `json:"allow_insecure_targets"` // Разрешает получателей по http и во внутренних сетях (для разработки и тестов)
+}
+
+// MailerConfig содержит настройки отправки писем (приглашений пользователей)
+type MailerConfig struct {
+	Backend  string `json:"backend"`   // Способ отправки: log (письмо записывается в лог) или smtp (пусто - log)
+	SMTPHost string `json:"smtp_host"` // Хост SMTP сервера
+	SMTPPort string `json:"smtp_port"` // Порт SMTP сервера
+	Username string `json:"username"`  // Имя пользователя SMTP (пусто - без аутентификации)
+	Password string `json:"password"`  // Пароль SMTP
+	From     string `json:"from"`      // Адрес отправителя
+}
+
+// InvitationsConfig содержит настройки приглашений пользователей
+type InvitationsConfig struct {
+	TTL       Duration `json:"ttl"`        // Срок действия приглашения (пусто - 72h)
+	AcceptURL string   `json:"accept_url"` // Адрес страницы принятия приглашения, токен добавляется параметром token (пусто - в письме только токен)
+}
+
+// AuthConfig содержит настройки входа пользователей по паролю и защиты от перебора паролей
+type AuthConfig struct {
+	JWTSecret string        `json:"jwt_secret"` // Секрет HS256 для подписи выдаваемых токенов (пусто - вход выключен)
+	TokenTTL  Duration      `json:"token_ttl"`  // Срок действия токена (пусто - 1h)
+	Lockout   LockoutConfig `json:"lockout"`    // Настройки защиты от перебора паролей
+
+	MFAEncryptionKey string   `json:"mfa_encryption_key"` // Ключ AES-256 в Base64 для шифрования секретов TOTP (пусто - двухфакторная аутентификация выключена)
+	MFAIssuer        string   `json:"mfa_issuer"`         // Название сервиса в приложении-аутентификаторе (пусто - UserService)
+	MFATokenTTL      Duration `json:"mfa_token_ttl"`      // Срок действия токена второго шага входа (пусто - 5m)
+
+	Providers []IdentityProviderConfig `json:"providers"` // Внешние поставщики удостоверений для входа (OpenID Connect)
+}
+
+// IdentityProviderConfig содержит настройки внешнего поставщика удостоверений (например, корпоративного)
+// Пользователь входит у поставщика и связывается с учетной записью сервиса по подтвержденной электронной почте
+type IdentityProviderConfig struct {
+	Name         string   `json:"name"`          // Имя поставщика в адресах /auth/providers/{name}/... (строчные латинские буквы, цифры и "-")
+	Type         string   `json:"type"`          // Тип поставщика: oidc (пусто - oidc)
+	Issuer       string   `json:"issuer"`        // Адрес издателя; адреса конечных точек читаются из {issuer}/.well-known/openid-configuration
+	ClientID     string   `json:"client_id"`     // Идентификатор клиента, зарегистрированного у поставщика
+	ClientSecret string   `json:"client_secret"` // Секрет клиента (пусто - публичный клиент)
+	RedirectURL  string   `json:"redirect_url"`  // Внешний адрес /auth/providers/{name}/callback этого сервиса
+	Scopes       []string `json:"scopes"`        // Запрашиваемые области (пусто - openid email profile)
+	CreateUsers  bool     `json:"create_users"`  // Создавать пользователя при первом входе, если учетной записи с такой почтой нет
+}
+
+// LockoutConfig содержит настройки защиты входа от перебора паролей
+// Неудачные попытки учитываются отдельно для учетной записи и для IP-адреса клиента
+type LockoutConfig struct {
+	Window           Duration `json:"window"`            // Окно учета неудачных попыток подряд (пусто - 15m)
+	DelayAfter       int      `json:"delay_after"`       // Число неудачных попыток, после которого вводится задержка (0 - 3)
+	BaseDelay        Duration `json:"base_delay"`        // Первая задержка, удваивается с каждой следующей неудачей (пусто - 1s)
+	MaxDelay         Duration `json:"max_delay"`         // Максимальная задержка между попытками (пусто - 1m)
+	AccountThreshold int      `json:"account_threshold"` // Число неудачных попыток до блокировки учетной записи (0 - 10)
+	IPThreshold      int      `json:"ip_threshold"`      // Число неудачных попыток до блокировки IP-адреса (0 - 100)
+	Duration         Duration `json:"duration"`          // Длительность временной блокировки (пусто - 15m)
+}
+
+// OIDCConfig содержит настройки провайдера OpenID Connect для входа других приложений
+// Провайдер использует вход по паролю и требует auth.jwt_secret
+type OIDCConfig struct {
+	Issuer           string   `json:"issuer"`             // Внешний адрес сервиса, идентификатор издателя токенов (пусто - провайдер выключен)
+	KeyEncryptionKey string   `json:"key_encryption_key"` // Ключ AES-256 в Base64 для шифрования ключей подписи в базе данных
+	KeyRotation      Duration `json:"key_rotation"`       // Интервал смены ключа подписи (пусто - 720h)
+	CodeTTL          Duration `json:"code_ttl"`           // Срок действия кода авторизации (пусто - 1m)
+	TokenTTL         Duration `json:"token_ttl"`          // Срок действия токена доступа и ID-токена (пусто - 1h)
+}
+
+// Duration - обертка над time.Duration, которая читается из JSON строки вида "5s" или "1m30s"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON разбирает длительность из строки в формате time.ParseDuration
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("длительность должна быть строкой: %w", err)
+	}
+	if s == "" {
+		d.Duration = 0
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalJSON записывает длительность в виде строки
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
+
 // ConnectionString возвращает строку подключения к PostgreSQL
 // Используется для подключения к базе данных через pgxpool
 func (c DatabaseConfig) ConnectionString() string {
@@ -45,6 +242,255 @@ func (c DatabaseConfig) ConnectionString() string {
 		" sslmode=" + c.SSLMode
 }
 
+// URL возвращает строку подключения к PostgreSQL в формате URL
+// Используется библиотекой миграций
+func (c DatabaseConfig) URL() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   c.Host + ":" + c.Port,
+		Path:   "/" + c.DBName,
+	}
+
+	query := url.Values{}
+	query.Set("sslmode", c.SSLMode)
+	if c.ConnectTimeout.Duration > 0 {
+		// connect_timeout задается в целых секундах, неполная секунда округляется вверх
+		query.Set("connect_timeout", strconv.Itoa(int((c.ConnectTimeout.Duration+time.Second-1)/time.Second)))
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Environment {
+	case "", "production", "staging", "development", "test":
+	default:
+		errs = append(errs, fmt.Errorf("environment: неизвестное окружение %q (production, staging, development, test)", c.Environment))
+	}
+
+	if !validPort(c.Server.Port) {
+		errs = append(errs, fmt.Errorf("server.port: некорректный порт %q", c.Server.Port))
+	}
+	for route := range c.Server.CacheControl {
+		if method, path, ok := strings.Cut(route, " "); !ok || method == "" || !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Errorf("server.cache_control: ключ %q должен иметь вид \"МЕТОД /путь\"", route))
+		}
+	}
+	for i, cidr := range c.Server.TrustedProxies {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies[%d]: некорректная подсеть %q (ожидается CIDR, например 10.0.0.0/8)", i, cidr))
+		}
+	}
+	if c.GRPC.Enabled {
+		if !validPort(c.GRPC.Port) {
+			errs = append(errs, fmt.Errorf("grpc.port: некорректный порт %q", c.GRPC.Port))
+		} else if c.GRPC.Port == c.Server.Port {
+			errs = append(errs, errors.New("grpc.port: должен отличаться от server.port"))
+		}
+	}
+
+	if c.Database.Host == "" {
+		errs = append(errs, errors.New("database.host: не указан хост"))
+	}
+	if !validPort(c.Database.Port) {
+		errs = append(errs, fmt.Errorf("database.port: некорректный порт %q", c.Database.Port))
+	}
+	if c.Database.User == "" {
+		errs = append(errs, errors.New("database.user: не указан пользователь"))
+	}
+	if c.Database.DBName == "" {
+		errs = append(errs, errors.New("database.dbname: не указано имя базы данных"))
+	}
+	if c.Database.MaxConns < 0 || c.Database.MinConns < 0 || c.Database.ConnectAttempts < 0 {
+		errs = append(errs, errors.New("database: число соединений и попыток подключения не может быть отрицательным"))
+	} else if c.Database.MaxConns > 0 && c.Database.MinConns > c.Database.MaxConns {
+		errs = append(errs, errors.New("database.min_conns: не может превышать max_conns"))
+	}
+	if c.Database.MaxConnLifetime.Duration < 0 || c.Database.MaxConnIdleTime.Duration < 0 || c.Database.HealthCheckPeriod.Duration < 0 ||
+		c.Database.StatementTimeout.Duration < 0 || c.Database.ConnectTimeout.Duration < 0 {
+		errs = append(errs, errors.New("database: длительности пула и таймауты не могут быть отрицательными"))
+	}
+	switch c.Database.IsolationLevel {
+	case "", "read_committed", "repeatable_read", "serializable":
+	default:
+		errs = append(errs, fmt.Errorf("database.isolation_level: неизвестный уровень изоляции %q", c.Database.IsolationLevel))
+	}
+	if c.Database.TxMaxAttempts < 0 {
+		errs = append(errs, errors.New("database.tx_max_attempts: не может быть отрицательным"))
+	}
+	for i, dsn := range c.Database.Replicas {
+		if dsn == "" {
+			errs = append(errs, fmt.Errorf("database.replicas[%d]: пустая строка подключения", i))
+		}
+	}
+	if c.Database.MaxReplicaLag.Duration < 0 || c.Database.ReplicaStickiness.Duration < 0 || c.Database.ReplicaCheckInterval.Duration < 0 {
+		errs = append(errs, errors.New("database: длительности для реплик не могут быть отрицательными"))
+	}
+
+	switch c.Migrations.Mode {
+	case "", "auto", "verify", "off":
+	default:
+		errs = append(errs, fmt.Errorf("migrations.mode: неизвестный режим %q (auto, verify, off)", c.Migrations.Mode))
+	}
+	if c.Migrations.LockTimeout.Duration < 0 {
+		errs = append(errs, errors.New("migrations.lock_timeout: длительность не может быть отрицательной"))
+	}
+
+	if c.Cache.Enabled {
+		switch c.Cache.Backend {
+		case "memory":
+		case "redis":
+			if c.Cache.RedisAddr == "" {
+				errs = append(errs, errors.New("cache.redis_addr: обязателен для хранилища redis"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("cache.backend: неизвестное хранилище %q (memory, redis)", c.Cache.Backend))
+		}
+	}
+	if c.Cache.Size < 0 || c.Cache.TTL.Duration < 0 || c.Cache.NegativeTTL.Duration < 0 {
+		errs = append(errs, errors.New("cache: размер и длительности не могут быть отрицательными"))
+	}
+
+	if c.Tenancy.Enabled && c.Tenancy.JWTSecret == "" && !c.Tenancy.TrustHeader && c.Tenancy.DefaultTenant == "" {
+		errs = append(errs, errors.New("tenancy: не задан ни один способ определения арендатора (jwt_secret, trust_header, default_tenant)"))
+	}
+
+	if c.Logging.FilePath == "" {
+		errs = append(errs, errors.New("logging.file_path: не указан путь к файлу логов"))
+	}
+
+	if c.Outbox.Enabled {
+		switch c.Outbox.Publisher {
+		case "":
+		case "file":
+			if c.Outbox.FilePath == "" {
+				errs = append(errs, errors.New("outbox.file_path: обязателен для публикатора file"))
+			}
+		case "webhook":
+			if u, err := url.Parse(c.Outbox.WebhookURL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("outbox.webhook_url: некорректный URL %q", c.Outbox.WebhookURL))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("outbox.publisher: неизвестный тип %q", c.Outbox.Publisher))
+		}
+	}
+	if c.Outbox.PollInterval.Duration < 0 || c.Outbox.BatchSize < 0 || c.Outbox.MaxAttempts < 0 ||
+		c.Outbox.InitialBackoff.Duration < 0 || c.Outbox.MaxBackoff.Duration < 0 {
+		errs = append(errs, errors.New("outbox: числовые параметры и длительности не могут быть отрицательными"))
+	}
+
+	if c.Webhooks.Enabled && !c.Outbox.Enabled {
+		errs = append(errs, errors.New("webhooks.enabled: события ставятся в очередь вебхуков ретранслятором и требуют outbox.enabled"))
+	}
+	if c.Webhooks.MaxAttempts < 0 || c.Webhooks.FailureThreshold < 0 || c.Webhooks.BatchSize < 0 ||
+		c.Webhooks.PollInterval.Duration < 0 || c.Webhooks.InitialBackoff.Duration < 0 ||
+		c.Webhooks.MaxBackoff.Duration < 0 || c.Webhooks.Timeout.Duration < 0 {
+		errs = append(errs, errors.New("webhooks: числовые параметры и длительности не могут быть отрицательными"))
+	}
+	if (c.Environment == "" || c.Environment == "production") && c.Webhooks.AllowInsecureTargets {
+		errs = append(errs, errors.New("webhooks.allow_insecure_targets: внутренние адреса получателей нельзя разрешать в production"))
+	}
+
+	switch c.Mailer.Backend {
+	case "", "log":
+	case "smtp":
+		if c.Mailer.SMTPHost == "" || !validPort(c.Mailer.SMTPPort) {
+			errs = append(errs, errors.New("mailer: для способа smtp обязательны smtp_host и корректный smtp_port"))
+		}
+		if c.Mailer.From == "" {
+			errs = append(errs, errors.New("mailer.from: обязателен для способа smtp"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mailer.backend: неизвестный способ отправки %q (log, smtp)", c.Mailer.Backend))
+	}
+
+	if c.Invitations.TTL.Duration < 0 {
+		errs = append(errs, errors.New("invitations.ttl: длительность не может быть отрицательной"))
+	}
+	if c.Invitations.AcceptURL != "" {
+		if u, err := url.Parse(c.Invitations.AcceptURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invitations.accept_url: некорректный URL %q", c.Invitations.AcceptURL))
+		}
+	}
+
+	if c.Auth.TokenTTL.Duration < 0 {
+		errs = append(errs, errors.New("auth.token_ttl: длительность не может быть отрицательной"))
+	}
+	if c.Auth.MFATokenTTL.Duration < 0 {
+		errs = append(errs, errors.New("auth.mfa_token_ttl: длительность не может быть отрицательной"))
+	}
+	if c.Auth.MFAEncryptionKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(c.Auth.MFAEncryptionKey); err != nil || len(key) != 32 {
+			errs = append(errs, errors.New("auth.mfa_encryption_key: должен содержать 32 байта в Base64"))
+		}
+	}
+	providers := make(map[string]bool, len(c.Auth.Providers))
+	for i, p := range c.Auth.Providers {
+		if !providerNamePattern.MatchString(p.Name) || providers[p.Name] {
+			errs = append(errs, fmt.Errorf("auth.providers[%d].name: имя %q некорректно или повторяется", i, p.Name))
+		}
+		providers[p.Name] = true
+		if p.Type != "" && p.Type != "oidc" {
+			errs = append(errs, fmt.Errorf("auth.providers[%d].type: неизвестный тип %q (oidc)", i, p.Type))
+		}
+		if u, err := url.Parse(p.Issuer); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("auth.providers[%d].issuer: некорректный URL %q", i, p.Issuer))
+		}
+		if u, err := url.Parse(p.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("auth.providers[%d].redirect_url: некорректный URL %q", i, p.RedirectURL))
+		}
+		if p.ClientID == "" {
+			errs = append(errs, fmt.Errorf("auth.providers[%d].client_id: не задан", i))
+		}
+	}
+	if (c.Environment == "" || c.Environment == "production") && c.Auth.JWTSecret == devJWTSecret {
+		errs = append(errs, errors.New("auth.jwt_secret: секрет для разработки из config.json нельзя использовать в production"))
+	}
+	if len(c.Auth.Providers) > 0 && c.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("auth.providers: вход через внешних поставщиков требует auth.jwt_secret"))
+	}
+	if c.OIDC.Issuer != "" {
+		if u, err := url.Parse(c.OIDC.Issuer); err != nil || u.Scheme == "" || u.Host == "" || u.RawQuery != "" ||
+			u.Fragment != "" || strings.HasSuffix(c.OIDC.Issuer, "/") {
+			errs = append(errs, fmt.Errorf("oidc.issuer: некорректный URL %q (без параметров и завершающего /)", c.OIDC.Issuer))
+		}
+		if key, err := base64.StdEncoding.DecodeString(c.OIDC.KeyEncryptionKey); err != nil || len(key) != 32 {
+			errs = append(errs, errors.New("oidc.key_encryption_key: должен содержать 32 байта в Base64"))
+		}
+		if c.Auth.JWTSecret == "" {
+			errs = append(errs, errors.New("oidc.issuer: провайдер OpenID Connect требует auth.jwt_secret"))
+		}
+	}
+	if c.OIDC.KeyRotation.Duration < 0 || c.OIDC.CodeTTL.Duration < 0 || c.OIDC.TokenTTL.Duration < 0 {
+		errs = append(errs, errors.New("oidc: длительности не могут быть отрицательными"))
+	}
+
+	lockout := c.Auth.Lockout
+	if lockout.DelayAfter < 0 || lockout.AccountThreshold < 0 || lockout.IPThreshold < 0 ||
+		lockout.Window.Duration < 0 || lockout.BaseDelay.Duration < 0 || lockout.MaxDelay.Duration < 0 || lockout.Duration.Duration < 0 {
+		errs = append(errs, errors.New("auth.lockout: числовые параметры и длительности не могут быть отрицательными"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// providerNamePattern - допустимый формат имени внешнего поставщика удостоверений (длина соответствует столбцу provider)
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// devJWTSecret - секрет подписи токенов из config.json для разработки и интеграционных тестов
+const devJWTSecret = "dev-only-jwt-secret-change-me"
+
+// validPort проверяет, что строка содержит номер TCP порта
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
 // Load читает конфигурацию из файла и возвращает структуру Config
 // path - путь к JSON файлу конфигурации
 func Load(path string) (*Config, error) {
@@ -0,0 +1,218 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	userv1 "github.com/janson/usermicroservice/api/user/v1"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/service"
+	"github.com/janson/usermicroservice/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// New создает gRPC сервер с зарегистрированными сервисами:
+// user.v1.UserService, стандартным сервисом проверки здоровья и рефлексией
+// Возвращает сервер и сервис здоровья, статус которого переключается при завершении работы
+// userService - сервис пользователей, общий с REST API
+// auth - сервис входа, выдающий токены доступа
+// keys - сервис ключей API
+// tenants - определитель арендатора или nil, если разделение по арендаторам выключено
+// logger - логгер для записи запросов и ошибок
+func New(userService *service.UserService, auth *service.AuthService, keys *service.APIKeyService,
+	tenants *tenant.Resolver, logger *log.Logger) (*grpc.Server, *health.Server) {
+	// Вызовы, отклоненные при проверке учетных данных и определении арендатора, тоже записываются в лог
+	interceptors := []grpc.UnaryServerInterceptor{requestInfoInterceptor, loggingInterceptor(logger),
+		authInterceptor(auth, keys, logger)}
+	if tenants != nil {
+		interceptors = append(interceptors, tenantInterceptor(tenants))
+	}
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors...),
+	)
+
+	userv1.RegisterUserServiceServer(server, NewUserServer(userService, logger))
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(userv1.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+
+	return server, healthServer
+}
+
+// requestInfoInterceptor сохраняет в контексте ID запроса, инициатора и IP-адрес клиента
+// Значения читаются из метаданных x-request-id и x-actor, как заголовки в REST API:
+// некорректный ID запроса не сохраняется, а инициатор обрезается до длины колонки журнала аудита
+func requestInfoInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var reqInfo requestinfo.Info
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if requestID := firstValue(md, "x-request-id"); requestinfo.ValidRequestID(requestID) {
+			reqInfo.RequestID = requestID
+		}
+		reqInfo.Actor = requestinfo.TruncateActor(firstValue(md, "x-actor"))
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			reqInfo.IP = host
+		}
+	}
+
+	return handler(requestinfo.WithInfo(ctx, reqInfo), req)
+}
+
+// authInterceptor проверяет учетные данные вызовов user.v1.UserService из метаданных authorization,
+// как AuthMiddleware в REST API: ключ API ("ApiKey <ключ>") с разрешением users:read для чтения
+// и users:write для изменений или токен доступа ("Bearer <токен>")
+// Инициатор проверенного вызова - ключ ("api-key:<префикс>") или электронная почта пользователя токена, метаданные
+// x-actor не учитываются. Вызов без учетных данных, с неверными или с токеном пользователя, учетная запись которого
+// не активна, отклоняется с кодом UNAUTHENTICATED,
+// с ключом без нужного разрешения - PERMISSION_DENIED
+// Служебные сервисы (проверка здоровья, рефлексия) вызываются без учетных данных
+func authInterceptor(auth *service.AuthService, keys *service.APIKeyService, logger *log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !isUserService(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		authorization := firstValue(md, "authorization")
+		reqInfo := requestinfo.FromContext(ctx)
+
+		if key, ok := authorizationValue(authorization, "ApiKey"); ok {
+			apiKey, err := keys.Authenticate(ctx, key)
+			switch {
+			case errors.Is(err, service.ErrInvalidAPIKey):
+				return nil, status.Error(codes.Unauthenticated, "некорректный ключ API")
+			case err != nil:
+				logger.Printf("Ошибка проверки ключа API: %v", err)
+				return nil, status.Error(codes.Internal, "внутренняя ошибка сервиса")
+			}
+			if !apiKey.Allows(methodScope(info.FullMethod)) {
+				return nil, status.Error(codes.PermissionDenied, "ключ API не дает доступа к этому вызову")
+			}
+
+			reqInfo.TenantID = apiKey.TenantID
+			reqInfo.APIKey = apiKey.Prefix
+			reqInfo.Actor = "api-key:" + apiKey.Prefix
+			return handler(requestinfo.WithInfo(ctx, reqInfo), req)
+		}
+
+		token, ok := authorizationValue(authorization, "Bearer")
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "требуется токен доступа или ключ API")
+		}
+		claims, err := auth.AuthenticateToken(ctx, token)
+		switch {
+		case errors.Is(err, service.ErrInvalidAccessToken), errors.Is(err, service.ErrLoginDisabled):
+			return nil, status.Error(codes.Unauthenticated, "некорректный или истекший токен доступа")
+		case err != nil:
+			logger.Printf("Ошибка проверки токена доступа: %v", err)
+			return nil, status.Error(codes.Internal, "внутренняя ошибка сервиса")
+		}
+
+		reqInfo.UserID = claims.UserID
+		reqInfo.Role = claims.Role
+		reqInfo.TenantID = claims.TenantID
+		reqInfo.Actor = claims.Email
+		return handler(requestinfo.WithInfo(ctx, reqInfo), req)
+	}
+}
+
+// tenantInterceptor определяет арендатора вызовов user.v1.UserService по метаданным authorization
+// и заголовку арендатора (в нижнем регистре), как TenantMiddleware в REST API
+// Если арендатор уже определен ключом API или токеном доступа, проверяется только совпадение с заголовком
+// Служебные сервисы (проверка здоровья, рефлексия) вызываются без арендатора
+func tenantInterceptor(resolver *tenant.Resolver) grpc.UnaryServerInterceptor {
+	header := strings.ToLower(resolver.Header())
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !isUserService(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		if reqInfo := requestinfo.FromContext(ctx); reqInfo.TenantID != "" {
+			if value := firstValue(md, header); value != "" && value != reqInfo.TenantID {
+				return nil, status.Error(codes.PermissionDenied, "арендатор в метаданных не совпадает с арендатором ключа API или токена")
+			}
+			tenant.RecordRequest(reqInfo.TenantID)
+			return handler(ctx, req)
+		}
+
+		tenantID, err := resolver.Resolve(firstValue(md, "authorization"), firstValue(md, header))
+		switch {
+		case errors.Is(err, tenant.ErrInvalidToken):
+			return nil, status.Error(codes.Unauthenticated, "некорректный токен доступа")
+		case errors.Is(err, tenant.ErrMismatch):
+			return nil, status.Error(codes.PermissionDenied, "арендатор в метаданных не совпадает с арендатором токена")
+		case err != nil:
+			return nil, status.Error(codes.InvalidArgument, "не указан или некорректен арендатор")
+		}
+		tenant.RecordRequest(tenantID)
+
+		reqInfo := requestinfo.FromContext(ctx)
+		reqInfo.TenantID = tenantID
+		return handler(requestinfo.WithInfo(ctx, reqInfo), req)
+	}
+}
+
+// loggingInterceptor записывает в лог метод, код ответа и длительность каждого вызова
+func loggingInterceptor(logger *log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logger.Printf("gRPC %s %s %s request_id=%s", info.FullMethod, status.Code(err), time.Since(start),
+			requestinfo.FromContext(ctx).RequestID)
+		return resp, err
+	}
+}
+
+// isUserService сообщает, что метод относится к сервису user.v1.UserService
+func isUserService(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+userv1.UserService_ServiceDesc.ServiceName+"/")
+}
+
+// methodScope возвращает разрешение ключа API, необходимое для вызова метода user.v1.UserService:
+// методы чтения требуют users:read, остальные - users:write
+func methodScope(fullMethod string) string {
+	switch fullMethod {
+	case userv1.UserService_GetUser_FullMethodName, userv1.UserService_ListUsers_FullMethodName,
+		userv1.UserService_GetUserHistory_FullMethodName:
+		return model.ScopeUsersRead
+	default:
+		return model.ScopeUsersWrite
+	}
+}
+
+// authorizationValue извлекает учетные данные из значения authorization вида "<схема> <значение>"
+// Схема сравнивается без учета регистра
+func authorizationValue(authorization, scheme string) (string, bool) {
+	prefix, value, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(prefix, scheme) || value == "" {
+		return "", false
+	}
+	return value, true
+}
+
+// firstValue возвращает первое значение ключа метаданных или пустую строку
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,286 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	userv1 "github.com/janson/usermicroservice/api/user/v1"
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/service"
+	"github.com/janson/usermicroservice/internal/tenant"
+)
+
+// testSecret - секрет подписи токенов доступа в тестах
+const testSecret = "secret"
+
+// fakeUserRepository - репозиторий пользователей, возвращающий заданные пользователя и ошибку
+// и запоминающий сведения о запросе последнего вызова
+type fakeUserRepository struct {
+	user     *model.User           // Пользователь, возвращаемый GetByID
+	err      error                 // Ошибка, возвращаемая GetByID
+	accounts map[int64]*model.User // Учетные записи пользователей токенов, GetByID возвращает их до user и err
+	info     requestinfo.Info      // Сведения о запросе последнего вызова
+}
+
+func (r *fakeUserRepository) Create(ctx context.Context, user model.UserCreate) (*model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeUserRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	r.info = requestinfo.FromContext(ctx)
+	if account, ok := r.accounts[id]; ok {
+		return account, nil
+	}
+	return r.user, r.err
+}
+
+func (r *fakeUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return nil, nil
+}
+
+func (r *fakeUserRepository) GetAll(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	return nil, nil
+}
+
+func (r *fakeUserRepository) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	return 0, nil
+}
+
+func (r *fakeUserRepository) Update(ctx context.Context, id int64, user model.UserUpdate) (*model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeUserRepository) ChangeStatus(ctx context.Context, id int64, change model.UserStatusChange) (*model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeUserRepository) Delete(ctx context.Context, id int64) error {
+	return errors.New("not implemented")
+}
+
+// newTestConn запускает gRPC сервер в памяти и возвращает соединение с ним
+// Если учетные записи репозитория не заданы, в нем создаются активные администратор (ID 1)
+// и участник (ID 2), которым выдает токены withToken
+// tenants - определитель арендатора или nil, если разделение по арендаторам выключено
+func newTestConn(t *testing.T, repo *fakeUserRepository, tenants *tenant.Resolver) *grpc.ClientConn {
+	if repo.accounts == nil {
+		repo.accounts = map[int64]*model.User{
+			1: {ID: 1, Email: "admin@example.com", Role: model.UserRoleAdmin, Status: model.UserStatusActive},
+			2: {ID: 2, Name: "Иван", Email: "ivan@example.com", Role: model.UserRoleMember, Status: model.UserStatusActive},
+		}
+	}
+	logger := log.New(io.Discard, "", 0)
+	users := service.NewUserService(repo, nil, nil, nil)
+	auth := service.NewAuthService(users, nil, nil, config.AuthConfig{JWTSecret: testSecret}, "", logger)
+	server, _ := New(users, auth, nil, tenants, logger)
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Ошибка подключения: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// withToken возвращает контекст вызова с токеном доступа и дополнительными метаданными
+// claims дополняют утверждения администратора арендатора default
+func withToken(t *testing.T, claims jwt.MapClaims, pairs ...string) context.Context {
+	base := jwt.MapClaims{
+		"sub":       "1",
+		"tenant_id": "default",
+		"email":     "admin@example.com",
+		"role":      model.UserRoleAdmin,
+		"token_use": "access",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}
+	for name, value := range claims {
+		base[name] = value
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, base).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("Ошибка подписи токена: %v", err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), append(pairs, "authorization", "Bearer "+signed)...)
+}
+
+// TestAuthInterceptor проверяет проверку учетных данных и прав вызовов и сведения о запросе,
+// передаваемые сервису
+func TestAuthInterceptor(t *testing.T) {
+	repo := &fakeUserRepository{user: &model.User{ID: 2, Name: "Иван", Email: "ivan@example.com"}}
+	conn := newTestConn(t, repo, nil)
+	client := userv1.NewUserServiceClient(conn)
+
+	if _, err := client.GetUser(context.Background(), &userv1.GetUserRequest{Id: 2}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Вызов без токена: получен %v, ожидался UNAUTHENTICATED", err)
+	}
+	expired := withToken(t, jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})
+	if _, err := client.GetUser(expired, &userv1.GetUserRequest{Id: 2}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Вызов с истекшим токеном: получен %v, ожидался UNAUTHENTICATED", err)
+	}
+
+	// Служебные сервисы доступны без учетных данных
+	health, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || health.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Проверка здоровья: %v, %v", health, err)
+	}
+
+	member := jwt.MapClaims{"sub": "2", "role": model.UserRoleMember, "email": "ivan@example.com"}
+	ctx := withToken(t, member, "x-request-id", "req-1", "x-actor", "someone-else")
+	user, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: 2})
+	if err != nil {
+		t.Fatalf("Ошибка получения пользователя: %v", err)
+	}
+	if user.GetEmail() != "ivan@example.com" {
+		t.Errorf("Неожиданный пользователь: %v", user)
+	}
+	// Инициатор вызова с токеном - пользователь токена, а не метаданные x-actor
+	if repo.info.RequestID != "req-1" || repo.info.Actor != "ivan@example.com" || repo.info.UserID != 2 ||
+		repo.info.TenantID != "default" {
+		t.Errorf("Неожиданные сведения о запросе: %+v", repo.info)
+	}
+
+	denied := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{"удаление участником", func(ctx context.Context) error {
+			_, err := client.DeleteUser(ctx, &userv1.DeleteUserRequest{Id: 3})
+			return err
+		}},
+		{"создание пользователя участником", func(ctx context.Context) error {
+			_, err := client.CreateUser(ctx, &userv1.CreateUserRequest{Name: "a", Email: "a@example.com"})
+			return err
+		}},
+		{"изменение своей роли", func(ctx context.Context) error {
+			role := model.UserRoleAdmin
+			_, err := client.UpdateUser(ctx, &userv1.UpdateUserRequest{Id: 2, Role: &role})
+			return err
+		}},
+		{"чужая история", func(ctx context.Context) error {
+			_, err := client.GetUserHistory(ctx, &userv1.GetUserHistoryRequest{Id: 3})
+			return err
+		}},
+		{"приостановка участником", func(ctx context.Context) error {
+			_, err := client.SuspendUser(ctx, &userv1.ChangeUserStatusRequest{Id: 3})
+			return err
+		}},
+	}
+	for _, tt := range denied {
+		if err := tt.call(withToken(t, member)); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("%s: получен %v, ожидался PERMISSION_DENIED", tt.name, err)
+		}
+	}
+}
+
+// TestAuthInterceptorChecksAccount проверяет, что токен пользователя, учетная запись которого больше не активна,
+// отклоняется до истечения срока, а права вызова определяются текущей ролью пользователя, а не ролью из токена
+func TestAuthInterceptorChecksAccount(t *testing.T) {
+	repo := &fakeUserRepository{user: &model.User{ID: 3, Email: "petr@example.com"}}
+	client := userv1.NewUserServiceClient(newTestConn(t, repo, nil))
+	token := withToken(t, jwt.MapClaims{"sub": "2", "role": model.UserRoleMember, "email": "ivan@example.com"})
+
+	if _, err := client.GetUser(token, &userv1.GetUserRequest{Id: 3}); err != nil {
+		t.Fatalf("Ошибка получения пользователя активным участником: %v", err)
+	}
+
+	for _, state := range []string{model.UserStatusSuspended, model.UserStatusLocked} {
+		repo.accounts[2].Status = state
+		if _, err := client.GetUser(token, &userv1.GetUserRequest{Id: 3}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Токен пользователя в состоянии %s: получен %v, ожидался UNAUTHENTICATED", state, err)
+		}
+	}
+	delete(repo.accounts, 2)
+	if _, err := client.GetUser(token, &userv1.GetUserRequest{Id: 3}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Токен удаленного пользователя: получен %v, ожидался UNAUTHENTICATED", err)
+	}
+
+	// Токен администратора, которого понизили до участника, не дает прав администратора
+	repo.accounts[1].Role = model.UserRoleMember
+	if _, err := client.DeleteUser(withToken(t, nil), &userv1.DeleteUserRequest{Id: 3}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Удаление пониженным администратором: получен %v, ожидался PERMISSION_DENIED", err)
+	}
+}
+
+// TestTenantInterceptor проверяет, что вызов выполняется в пределах арендатора токена,
+// а метаданные с другим арендатором отклоняются
+func TestTenantInterceptor(t *testing.T) {
+	tenants, err := tenant.NewResolver(config.TenancyConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("Ошибка создания определителя арендатора: %v", err)
+	}
+	repo := &fakeUserRepository{user: &model.User{ID: 1}}
+	client := userv1.NewUserServiceClient(newTestConn(t, repo, tenants))
+
+	acme := jwt.MapClaims{"tenant_id": "acme"}
+	if _, err := client.GetUser(withToken(t, acme, "x-tenant-id", "acme"), &userv1.GetUserRequest{Id: 1}); err != nil {
+		t.Fatalf("Ошибка получения пользователя: %v", err)
+	}
+	if repo.info.TenantID != "acme" {
+		t.Errorf("Вызов выполнен в пределах арендатора %q, ожидался acme", repo.info.TenantID)
+	}
+
+	_, err = client.GetUser(withToken(t, acme, "x-tenant-id", "globex"), &userv1.GetUserRequest{Id: 1})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Вызов с другим арендатором в метаданных: получен %v, ожидался PERMISSION_DENIED", err)
+	}
+}
+
+// TestToStatus проверяет преобразование ошибок сервиса в коды gRPC
+// Внутренние ошибки не раскрываются клиенту
+func TestToStatus(t *testing.T) {
+	repo := &fakeUserRepository{}
+	client := userv1.NewUserServiceClient(newTestConn(t, repo, nil))
+
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"пользователь не найден", nil, codes.NotFound},
+		{"некорректные данные", service.ErrInvalidInput, codes.InvalidArgument},
+		{"почта занята", service.ErrEmailTaken, codes.AlreadyExists},
+		{"недопустимый переход", service.ErrInvalidStatusTransition, codes.FailedPrecondition},
+		{"истек срок", context.DeadlineExceeded, codes.DeadlineExceeded},
+		{"внутренняя ошибка", errors.New("connection refused"), codes.Internal},
+	}
+	for _, tt := range tests {
+		repo.err = tt.err
+		_, err := client.GetUser(withToken(t, nil), &userv1.GetUserRequest{Id: 3})
+		if status.Code(err) != tt.want {
+			t.Errorf("%s: получен %v, ожидался %s", tt.name, err, tt.want)
+		}
+		if tt.want == codes.Internal && status.Convert(err).Message() != "внутренняя ошибка сервиса" {
+			t.Errorf("%s: клиенту раскрыта ошибка %q", tt.name, status.Convert(err).Message())
+		}
+	}
+
+	// Проверка входных данных выполняется до обращения к базе данных
+	_, err := client.CreateUser(withToken(t, nil), &userv1.CreateUserRequest{Email: "a@example.com"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Создание без имени: получен %v, ожидался INVALID_ARGUMENT", err)
+	}
+}
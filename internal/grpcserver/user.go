@@ -0,0 +1,303 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	userv1 "github.com/janson/usermicroservice/api/user/v1"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Параметры постраничной выборки по умолчанию (совпадают с REST API)
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// UserServer реализует gRPC сервис user.v1.UserService
+// Этот тип преобразует gRPC запросы в вызовы того же сервиса, что использует REST API
+type UserServer struct {
+	userv1.UnimplementedUserServiceServer
+
+	service *service.UserService // Сервис для выполнения бизнес-логики
+	logger  *log.Logger          // Логгер для записи внутренних ошибок
+}
+
+// NewUserServer создает новый gRPC сервер пользователей
+// service - сервис пользователей
+// logger - логгер для записи событий
+func NewUserServer(service *service.UserService, logger *log.Logger) *UserServer {
+	return &UserServer{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// CreateUser создает нового пользователя
+// Создать администратора может только администратор арендатора по токену доступа
+func (s *UserServer) CreateUser(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.User, error) {
+	if err := authorize(ctx, 0, req.GetRole()); err != nil {
+		return nil, err
+	}
+
+	user, err := s.service.Create(ctx, model.UserCreate{
+		Name:        req.GetName(),
+		Email:       req.GetEmail(),
+		DisplayName: req.GetDisplayName(),
+		Phone:       req.GetPhone(),
+		Locale:      req.GetLocale(),
+		Timezone:    req.GetTimezone(),
+		AvatarURL:   req.GetAvatarUrl(),
+		Metadata:    req.GetMetadata().AsMap(),
+		Role:        req.GetRole(),
+		Status:      req.GetStatus(),
+	})
+	if err != nil {
+		return nil, s.toStatus(err, "Ошибка создания пользователя")
+	}
+
+	return toProtoUser(user), nil
+}
+
+// GetUser возвращает пользователя по ID
+func (s *UserServer) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.User, error) {
+	user, err := s.service.GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, s.toStatus(err, "Ошибка получения пользователя")
+	}
+
+	return toProtoUser(user), nil
+}
+
+// ListUsers возвращает страницу пользователей
+func (s *UserServer) ListUsers(ctx context.Context, req *userv1.ListUsersRequest) (*userv1.ListUsersResponse, error) {
+	filter := model.UserFilter{
+		Limit:        int(req.GetLimit()),
+		Offset:       int(req.GetOffset()),
+		Sort:         req.GetSort(),
+		Metadata:     req.GetMetadata(),
+		MetadataKeys: req.GetHasMetadata(),
+		Status:       req.GetStatus(),
+	}
+	if req.UpdatedSince != nil {
+		filter.UpdatedSince = req.GetUpdatedSince().AsTime()
+	}
+	if filter.Limit > maxPageLimit {
+		return nil, status.Error(codes.InvalidArgument, "некорректные параметры пагинации")
+	}
+
+	users, total, err := s.service.GetAll(ctx, filter)
+	if err != nil {
+		return nil, s.toStatus(err, "Ошибка получения пользователей")
+	}
+
+	resp := &userv1.ListUsersResponse{
+		Users: make([]*userv1.User, 0, len(users)),
+		Total: int32(total),
+	}
+	for i := range users {
+		resp.Users = append(resp.Users, toProtoUser(&users[i]))
+	}
+
+	return resp, nil
+}
+
+// UpdateUser обновляет переданные поля пользователя
+// Пользователь может изменить свои данные, кроме роли; роль администратора назначает только администратор
+func (s *UserServer) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.User, error) {
+	if err := authorize(ctx, req.GetId(), req.GetRole()); err != nil {
+		return nil, err
+	}
+
+	update := model.UserUpdate{
+		Name:        req.GetName(),
+		Email:       req.GetEmail(),
+		DisplayName: req.DisplayName,
+		Phone:       req.Phone,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+		AvatarURL:   req.AvatarUrl,
+		Role:        req.GetRole(),
+	}
+	if req.Metadata != nil {
+		update.Metadata = req.Metadata.AsMap()
+	}
+
+	user, err := s.service.Update(ctx, req.GetId(), update)
+	if err != nil {
+		return nil, s.toStatus(err, "Ошибка обновления пользователя")
+	}
+
+	return toProtoUser(user), nil
+}
+
+// DeleteUser удаляет пользователя
+func (s *UserServer) DeleteUser(ctx context.Context, req *userv1.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := authorize(ctx, 0, ""); err != nil {
+		return nil, err
+	}
+	if err := s.service.Delete(ctx, req.GetId()); err != nil {
+		return nil, s.toStatus(err, "Ошибка удаления пользователя")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// SuspendUser приостанавливает активную учетную запись
+func (s *UserServer) SuspendUser(ctx context.Context, req *userv1.ChangeUserStatusRequest) (*userv1.User, error) {
+	if err := authorize(ctx, 0, ""); err != nil {
+		return nil, err
+	}
+	user, err := s.service.Suspend(ctx, req.GetId(), req.GetReason())
+	if err != nil {
+		return nil, s.toStatus(err, "Ошибка приостановки пользователя")
+	}
+
+	return toProtoUser(user), nil
+}
+
+// ReactivateUser активирует учетную запись
+func (s *UserServer) ReactivateUser(ctx context.Context, req *userv1.ChangeUserStatusRequest) (*userv1.User, error) {
+	if err := authorize(ctx, 0, ""); err != nil {
+		return nil, err
+	}
+	user, err := s.service.Reactivate(ctx, req.GetId(), req.GetReason())
+	if err != nil {
+		return nil, s.toStatus(err, "Ошибка активации пользователя")
+	}
+
+	return toProtoUser(user), nil
+}
+
+// GetUserHistory возвращает страницу журнала аудита пользователя
+func (s *UserServer) GetUserHistory(ctx context.Context, req *userv1.GetUserHistoryRequest) (*userv1.GetUserHistoryResponse, error) {
+	if err := authorize(ctx, req.GetId(), ""); err != nil {
+		return nil, err
+	}
+
+	limit, offset := int(req.GetLimit()), int(req.GetOffset())
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit < 0 || limit > maxPageLimit || offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "некорректные параметры пагинации")
+	}
+
+	entries, total, err := s.service.History(ctx, req.GetId(), limit, offset)
+	if err != nil {
+		return nil, s.toStatus(err, "Ошибка получения истории пользователя")
+	}
+
+	resp := &userv1.GetUserHistoryResponse{
+		Entries: make([]*userv1.AuditEntry, 0, len(entries)),
+		Total:   int32(total),
+	}
+	for _, entry := range entries {
+		protoEntry, err := toProtoAuditEntry(entry)
+		if err != nil {
+			return nil, s.toStatus(err, "Ошибка преобразования записи аудита")
+		}
+		resp.Entries = append(resp.Entries, protoEntry)
+	}
+
+	return resp, nil
+}
+
+// authorize проверяет права на изменение пользователя по правилам REST API: изменять чужие учетные записи могут
+// администратор арендатора по токену доступа и сервисы по ключу API, свою учетную запись (self, 0 - нельзя) -
+// сам пользователь; назначаемую роль role проверяет requestinfo.Info.CanGrantRole
+// Возвращает ошибку с кодом PERMISSION_DENIED, если прав нет
+func authorize(ctx context.Context, self int64, role string) error {
+	info := requestinfo.FromContext(ctx)
+	if !info.CanManageUsers() && !info.IsSelf(self) {
+		return status.Error(codes.PermissionDenied, "операция доступна только администратору")
+	}
+	if !info.CanGrantRole(role) {
+		return status.Error(codes.PermissionDenied, "роль может изменить только администратор")
+	}
+	return nil
+}
+
+// toStatus преобразует ошибку сервиса в статус gRPC
+// Неизвестные ошибки записываются в лог и скрываются от клиента за кодом INTERNAL
+func (s *UserServer) toStatus(err error, logMessage string) error {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		return status.Error(codes.NotFound, "пользователь не найден")
+	case errors.Is(err, service.ErrInvalidInput):
+		return status.Error(codes.InvalidArgument, "некорректные входные данные")
+	case errors.Is(err, service.ErrEmailTaken):
+		return status.Error(codes.AlreadyExists, "электронная почта уже используется")
+	case errors.Is(err, service.ErrInvalidStatusTransition):
+		return status.Error(codes.FailedPrecondition, "недопустимое изменение состояния учетной записи")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		s.logger.Printf("%s: %v", logMessage, err)
+		return status.Error(codes.Internal, "внутренняя ошибка сервиса")
+	}
+}
+
+// toProtoUser преобразует модель пользователя в protobuf сообщение
+func toProtoUser(user *model.User) *userv1.User {
+	// Метаданные читаются из JSONB и содержат только JSON значения, поэтому преобразование не завершается ошибкой
+	metadata, _ := structpb.NewStruct(user.Metadata)
+
+	return &userv1.User{
+		Id:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		CreatedAt:     timestamppb.New(user.CreatedAt),
+		UpdatedAt:     timestamppb.New(user.UpdatedAt),
+		UpdatedBy:     user.UpdatedBy,
+		DisplayName:   user.DisplayName,
+		Phone:         user.Phone,
+		Locale:        user.Locale,
+		Timezone:      user.Timezone,
+		AvatarUrl:     user.AvatarURL,
+		Metadata:      metadata,
+		TenantId:      user.TenantID,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+		Status:        user.Status,
+	}
+}
+
+// toProtoAuditEntry преобразует запись журнала аудита в protobuf сообщение
+func toProtoAuditEntry(entry model.AuditEntry) (*userv1.AuditEntry, error) {
+	diff := make(map[string]*userv1.FieldChange, len(entry.Diff))
+	for field, change := range entry.Diff {
+		before, err := structpb.NewValue(change.Before)
+		if err != nil {
+			return nil, err
+		}
+		after, err := structpb.NewValue(change.After)
+		if err != nil {
+			return nil, err
+		}
+		diff[field] = &userv1.FieldChange{Before: before, After: after}
+	}
+
+	return &userv1.AuditEntry{
+		Id:        entry.ID,
+		UserId:    entry.UserID,
+		Action:    entry.Action,
+		Actor:     entry.Actor,
+		RequestId: entry.RequestID,
+		Ip:        entry.IP,
+		Diff:      diff,
+		CreatedAt: timestamppb.New(entry.CreatedAt),
+		TenantId:  entry.TenantID,
+		Reason:    entry.Reason,
+	}, nil
+}
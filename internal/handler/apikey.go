@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// APIKeyHandler обрабатывает HTTP запросы управления ключами API
+type APIKeyHandler struct {
+	service *service.APIKeyService // Сервис ключей API
+	logger  *log.Logger            // Логгер для записи информации о запросах
+}
+
+// NewAPIKeyHandler создает новый обработчик ключей API
+// service - сервис ключей API
+// logger - логгер для записи событий
+func NewAPIKeyHandler(service *service.APIKeyService, logger *log.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes регистрирует маршруты управления ключами API, выполняемые в пределах арендатора
+// Маршруты доступны только администратору арендатора по токену доступа
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *APIKeyHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api-keys", h.GetAPIKeys).Methods(http.MethodGet)           // GET /api-keys - неотозванные ключи
+	r.HandleFunc("/api-keys", h.CreateAPIKey).Methods(http.MethodPost)        // POST /api-keys - создать ключ
+	r.HandleFunc("/api-keys/{id}", h.RevokeAPIKey).Methods(http.MethodDelete) // DELETE /api-keys/{id} - отозвать ключ
+}
+
+// GetAPIKeys обрабатывает GET /api-keys
+// Возвращает страницу неотозванных ключей без самих ключей, общее количество передается в заголовке X-Total-Count
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры пагинации", http.StatusBadRequest)
+		return
+	}
+
+	keys, total, err := h.service.List(r.Context(), limit, offset)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения ключей API", "Не удалось получить ключи API")
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+// CreateAPIKey обрабатывает POST /api-keys
+// Создает ключ API; ключ возвращается только в этом ответе
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var create model.APIKeyCreate
+	if err := json.NewDecoder(r.Body).Decode(&create); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.service.Create(r.Context(), create)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка создания ключа API", "Не удалось создать ключ API")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// RevokeAPIKey обрабатывает DELETE /api-keys/{id}
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID ключа API", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Revoke(r.Context(), id); err != nil {
+		h.respondWithError(w, err, "Ошибка отзыва ключа API", "Не удалось отозвать ключ API")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondWithError преобразует ошибку сервиса в HTTP ответ
+// Неизвестные ошибки записываются в лог с logMessage, клиент получает userMessage
+func (h *APIKeyHandler) respondWithError(w http.ResponseWriter, err error, logMessage, userMessage string) {
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		http.Error(w, "Ключ API не найден", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidInput):
+		http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+	default:
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, userMessage, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// AuthHandler обрабатывает HTTP запросы входа по паролю, управления паролями пользователей
+// и двухфакторной аутентификации
+type AuthHandler struct {
+	service *service.AuthService // Сервис входа
+	mfa     *service.MFAService  // Сервис двухфакторной аутентификации
+	logger  *log.Logger          // Логгер для записи информации о запросах
+}
+
+// NewAuthHandler создает новый обработчик входа
+// service - сервис входа
+// mfa - сервис двухфакторной аутентификации
+// logger - логгер для записи событий
+func NewAuthHandler(service *service.AuthService, mfa *service.MFAService, logger *log.Logger) *AuthHandler {
+	return &AuthHandler{
+		service: service,
+		mfa:     mfa,
+		logger:  logger,
+	}
+}
+
+// RegisterLoginRoutes регистрирует маршруты входа, выполняемые в пределах арендатора без токена доступа
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *AuthHandler) RegisterLoginRoutes(r *mux.Router) {
+	r.HandleFunc("/auth/login", h.Login).Methods(http.MethodPost)        // POST /auth/login - вход по паролю
+	r.HandleFunc("/auth/login/mfa", h.LoginMFA).Methods(http.MethodPost) // POST /auth/login/mfa - второй шаг входа
+}
+
+// RegisterRoutes регистрирует маршруты управления паролями и двухфакторной аутентификацией,
+// выполняемые в пределах арендатора
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *AuthHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/users/{id}/password", h.SetPassword).Methods(http.MethodPut)    // PUT /users/{id}/password - установить пароль
+	r.HandleFunc("/users/{id}/unlock", h.UnlockUser).Methods(http.MethodPost)      // POST /users/{id}/unlock - снять блокировку входа
+	r.HandleFunc("/users/{id}/mfa", h.GetMFA).Methods(http.MethodGet)              // GET /users/{id}/mfa - состояние двухфакторной аутентификации
+	r.HandleFunc("/users/{id}/mfa", h.EnrollMFA).Methods(http.MethodPost)          // POST /users/{id}/mfa - начать подключение
+	r.HandleFunc("/users/{id}/mfa/confirm", h.ConfirmMFA).Methods(http.MethodPost) // POST /users/{id}/mfa/confirm - подтвердить подключение
+	r.HandleFunc("/users/{id}/mfa", h.ResetMFA).Methods(http.MethodDelete)         // DELETE /users/{id}/mfa - сбросить двухфакторную аутентификацию
+}
+
+// Login обрабатывает POST /auth/login
+// Проверяет электронную почту и пароль и возвращает токен доступа
+// Если у пользователя включена двухфакторная аутентификация, возвращает токен второго шага (mfa_required)
+// Если вход временно ограничен после неудачных попыток, возвращает 429 с заголовком Retry-After
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req model.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.service.Login(r.Context(), req)
+	if err != nil {
+		h.respondWithLoginError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, token)
+}
+
+// LoginMFA обрабатывает POST /auth/login/mfa
+// Обменивает токен второго шага и код из приложения-аутентификатора (или код восстановления) на токен доступа
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req model.MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.service.LoginMFA(r.Context(), req)
+	if err != nil {
+		h.respondWithLoginError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, token)
+}
+
+// GetMFA обрабатывает GET /users/{id}/mfa
+// Возвращает состояние двухфакторной аутентификации пользователя
+// Доступен самому пользователю и администратору арендатора по токену доступа
+func (h *AuthHandler) GetMFA(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	if !requireSelfOrAdmin(w, r, id) {
+		return
+	}
+
+	status, err := h.mfa.Status(r.Context(), id)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения состояния двухфакторной аутентификации",
+			"Не удалось получить состояние двухфакторной аутентификации")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, status)
+}
+
+// EnrollMFA обрабатывает POST /users/{id}/mfa
+// Начинает подключение двухфакторной аутентификации и возвращает секрет и адрес otpauth:// для QR-кода
+// Доступен только самому пользователю: секрет не должен попадать к администратору или сервису
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	if !requireSelf(w, r, id) {
+		return
+	}
+
+	enrollment, err := h.mfa.Enroll(r.Context(), id)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка подключения двухфакторной аутентификации",
+			"Не удалось подключить двухфакторную аутентификацию")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusCreated, enrollment)
+}
+
+// ConfirmMFA обрабатывает POST /users/{id}/mfa/confirm
+// Подтверждает подключение кодом из приложения и возвращает коды восстановления (показываются один раз)
+// Доступен только самому пользователю
+func (h *AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	if !requireSelf(w, r, id) {
+		return
+	}
+
+	var body model.MFAConfirm
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.mfa.Confirm(r.Context(), id, body.Code)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMFACode) {
+			http.Error(w, "Неверный код подтверждения", http.StatusBadRequest)
+			return
+		}
+		h.respondWithError(w, err, "Ошибка подтверждения двухфакторной аутентификации",
+			"Не удалось подтвердить двухфакторную аутентификацию")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, codes)
+}
+
+// ResetMFA обрабатывает DELETE /users/{id}/mfa
+// Сбрасывает двухфакторную аутентификацию пользователя; тело запроса с причиной необязательно
+// Доступен только администратору арендатора по токену доступа
+func (h *AuthHandler) ResetMFA(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var body model.UserStatusChange
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfa.Reset(r.Context(), id, body.Reason); err != nil {
+		h.respondWithError(w, err, "Ошибка сброса двухфакторной аутентификации",
+			"Не удалось сбросить двухфакторную аутентификацию")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetPassword обрабатывает PUT /users/{id}/password
+// Устанавливает пароль пользователя, смена пароля записывается в журнал аудита
+// Доступен самому пользователю и администратору арендатора по токену доступа
+func (h *AuthHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+
+	if !requireSelfOrAdmin(w, r, id) {
+		return
+	}
+
+	var body model.PasswordSet
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.SetPassword(r.Context(), id, body.Password); err != nil {
+		h.respondWithError(w, err, "Ошибка установки пароля", "Не удалось установить пароль")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockUser обрабатывает POST /users/{id}/unlock
+// Сбрасывает учет неудачных попыток входа и активирует заблокированную учетную запись
+// Доступен только администратору арендатора по токену доступа
+// Тело запроса с причиной необязательно
+func (h *AuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var body model.UserStatusChange
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.Unlock(r.Context(), id, body.Reason)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка разблокировки пользователя", "Не удалось разблокировать пользователя")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// respondWithLoginError преобразует ошибку входа в HTTP ответ
+// Если вход временно ограничен, устанавливает заголовок Retry-After в целых секундах
+func (h *AuthHandler) respondWithLoginError(w http.ResponseWriter, err error) {
+	var throttled *service.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int((throttled.RetryAfter+time.Second-1)/time.Second)))
+		http.Error(w, "Слишком много неудачных попыток входа, повторите позже", http.StatusTooManyRequests)
+	case errors.Is(err, service.ErrInvalidCredentials):
+		http.Error(w, "Неверная электронная почта или пароль", http.StatusUnauthorized)
+	case errors.Is(err, service.ErrInvalidMFAToken):
+		http.Error(w, "Токен второго шага входа недействителен или истек", http.StatusUnauthorized)
+	case errors.Is(err, service.ErrInvalidMFACode):
+		http.Error(w, "Неверный код двухфакторной аутентификации", http.StatusUnauthorized)
+	case errors.Is(err, service.ErrAccountInactive):
+		http.Error(w, "Учетная запись не активна", http.StatusForbidden)
+	case errors.Is(err, service.ErrInvalidInput):
+		http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+	case errors.Is(err, service.ErrLoginDisabled), errors.Is(err, service.ErrMFADisabled):
+		http.Error(w, "Вход по паролю не настроен", http.StatusNotImplemented)
+	default:
+		h.logger.Printf("Ошибка входа: %v", err)
+		http.Error(w, "Не удалось выполнить вход", http.StatusInternalServerError)
+	}
+}
+
+// respondWithError преобразует ошибку сервиса в HTTP ответ
+// Неизвестные ошибки записываются в лог с logMessage, клиент получает userMessage
+func (h *AuthHandler) respondWithError(w http.ResponseWriter, err error, logMessage, userMessage string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidInput):
+		http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidStatusTransition):
+		http.Error(w, "Недопустимое изменение состояния учетной записи", http.StatusConflict)
+	case errors.Is(err, service.ErrMFADisabled):
+		http.Error(w, "Двухфакторная аутентификация выключена в конфигурации", http.StatusNotImplemented)
+	case errors.Is(err, service.ErrMFAEnabled):
+		http.Error(w, "Двухфакторная аутентификация уже включена", http.StatusConflict)
+	case errors.Is(err, service.ErrMFANotEnrolled):
+		http.Error(w, "Двухфакторная аутентификация не подключена", http.StatusNotFound)
+	default:
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, userMessage, http.StatusInternalServerError)
+	}
+}
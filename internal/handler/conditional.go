@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// respondConditional отправляет JSON ответ на запрос чтения с заголовками ETag и Last-Modified
+// Если ответ не изменился относительно версии клиента (If-None-Match или If-Modified-Since),
+// отправляется 304 Not Modified без тела
+// payload - данные ответа
+// lastModified - время последнего изменения данных (нулевое значение - без Last-Modified)
+// validators - дополнительные значения, входящие в ETag, но не в тело (например, общее количество записей)
+func respondConditional(w http.ResponseWriter, r *http.Request, payload interface{}, lastModified time.Time, validators ...string) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		http.Error(w, "Не удалось сформировать ответ", http.StatusInternalServerError)
+		return
+	}
+
+	hash := sha256.New()
+	hash.Write(body)
+	for _, v := range validators {
+		hash.Write([]byte{0})
+		hash.Write([]byte(v))
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// notModified проверяет условия запроса по правилам RFC 9110:
+// If-None-Match имеет приоритет, If-Modified-Since учитывается только без него
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, etag)
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		// Last-Modified передается с точностью до секунды
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// etagMatches сравнивает ETag ответа со списком из If-None-Match (слабое сравнение)
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
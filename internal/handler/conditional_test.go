@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// TestRespondConditional проверяет ответ 304 по If-None-Match и If-Modified-Since
+func TestRespondConditional(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	payload := map[string]string{"name": "Test User"}
+
+	first := httptest.NewRecorder()
+	respondConditional(first, httptest.NewRequest(http.MethodGet, "/users/1", nil), payload, modified)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.Len() == 0 {
+		t.Fatalf("Ожидался ответ 200 с ETag и телом, получено %d %q", first.Code, etag)
+	}
+	if got := first.Header().Get("Last-Modified"); got != "Wed, 01 May 2024 12:00:00 GMT" {
+		t.Errorf("Некорректный Last-Modified: %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"совпадающий ETag", "If-None-Match", etag, http.StatusNotModified},
+		{"слабый ETag в списке", "If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"другой ETag", "If-None-Match", `"other"`, http.StatusOK},
+		{"не изменялся с даты", "If-Modified-Since", "Wed, 01 May 2024 12:00:00 GMT", http.StatusNotModified},
+		{"изменен после даты", "If-Modified-Since", "Wed, 01 May 2024 11:59:59 GMT", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set(tt.header, tt.value)
+		rec := httptest.NewRecorder()
+		respondConditional(rec, req, payload, modified)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: ожидался код %d, получен %d", tt.name, tt.want, rec.Code)
+		}
+		if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("%s: ответ 304 не должен содержать тело", tt.name)
+		}
+	}
+
+	// Дополнительные значения меняют ETag при том же теле
+	rec := httptest.NewRecorder()
+	respondConditional(rec, httptest.NewRequest(http.MethodGet, "/users", nil), payload, time.Time{}, "42")
+	if rec.Header().Get("ETag") == etag || rec.Header().Get("Last-Modified") != "" {
+		t.Errorf("Ожидался другой ETag без Last-Modified, получено %v", rec.Header())
+	}
+}
+
+// TestCacheControlMiddleware проверяет заголовок Cache-Control по шаблону маршрута и коду ответа
+func TestCacheControlMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "0" {
+			http.Error(w, "Пользователь не найден", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("{}"))
+	}).Methods(http.MethodGet)
+	router.Use(CacheControlMiddleware(map[string]string{"GET /users/{id}": "private, max-age=60"}))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+	if got := rec.Header().Get("Cache-Control"); got != "private, max-age=60" {
+		t.Errorf("Ожидался Cache-Control из правила, получен %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/0", nil))
+	if got := rec.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("Ответ с ошибкой не должен кэшироваться, получен Cache-Control %q", got)
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"bytes"
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+//go:generate sh docs/fetch-swagger-ui.sh
+
+// openAPISpec - спецификация OpenAPI 3.1, встроенная в бинарный файл
+// При добавлении маршрутов спецификацию нужно обновить, иначе упадет TestOpenAPIMatchesRoutes
+//
+//go:embed docs/openapi.json
+var openAPISpec []byte
+
+// swaggerUIPage - шаблон страницы Swagger UI, которая загружает спецификацию с /openapi.json
+// Вместо {{ASSETS}} подставляется адрес стилей и скриптов Swagger UI
+//
+//go:embed docs/swagger.html
+var swaggerUIPage []byte
+
+// swaggerUIFiles - стили и скрипты Swagger UI версии из docs/swagger-ui/VERSION,
+// загружаемые в репозиторий командой go generate ./internal/handler
+//
+//go:embed docs/swagger-ui
+var swaggerUIFiles embed.FS
+
+// swaggerUIAssets - адрес, с которого страница /docs загружает встроенные файлы Swagger UI
+const swaggerUIAssets = "/docs/assets"
+
+// DocsHandler отдает спецификацию API и страницу Swagger UI
+type DocsHandler struct {
+	page   []byte       // Страница Swagger UI с адресом файлов
+	assets http.Handler // Встроенные файлы Swagger UI
+}
+
+// NewDocsHandler создает новый обработчик документации
+// Если файлы Swagger UI не загружены в репозиторий, страница берет ту же версию с unpkg.com
+func NewDocsHandler() *DocsHandler {
+	files, _ := fs.Sub(swaggerUIFiles, "docs/swagger-ui")
+
+	assets := swaggerUIAssets
+	if _, err := fs.Stat(files, "swagger-ui-bundle.js"); err != nil {
+		version, _ := fs.ReadFile(files, "VERSION")
+		assets = "https://unpkg.com/swagger-ui-dist@" + strings.TrimSpace(string(version))
+	}
+
+	return &DocsHandler{
+		page:   bytes.ReplaceAll(swaggerUIPage, []byte("{{ASSETS}}"), []byte(assets)),
+		assets: http.StripPrefix(swaggerUIAssets+"/", http.FileServer(http.FS(files))),
+	}
+}
+
+// RegisterRoutes регистрирует маршруты документации
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *DocsHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/openapi.json", h.GetOpenAPI).Methods(http.MethodGet)             // GET /openapi.json - спецификация OpenAPI
+	r.HandleFunc("/docs", h.GetDocs).Methods(http.MethodGet)                        // GET /docs - Swagger UI
+	r.HandleFunc(swaggerUIAssets+"/{file}", h.GetDocsAsset).Methods(http.MethodGet) // GET /docs/assets/{file} - файлы Swagger UI
+}
+
+// GetOpenAPI обрабатывает GET /openapi.json
+func (h *DocsHandler) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// GetDocs обрабатывает GET /docs
+func (h *DocsHandler) GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(h.page)
+}
+
+// GetDocsAsset обрабатывает GET /docs/assets/{file}
+func (h *DocsHandler) GetDocsAsset(w http.ResponseWriter, r *http.Request) {
+	h.assets.ServeHTTP(w, r)
+}
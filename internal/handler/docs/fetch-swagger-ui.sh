@@ -0,0 +1,25 @@
+#!/bin/sh
+# Загружает файлы Swagger UI версии из swagger-ui/VERSION в каталог swagger-ui
+# Файлы хранятся в репозитории и встраиваются в бинарный файл, поэтому /docs не обращается к внешним CDN
+# Запуск: go generate ./internal/handler (нужен доступ к registry.npmjs.org)
+set -eu
+
+dir="$(dirname "$0")/swagger-ui"
+version="$(cat "$dir/VERSION")"
+tmp="$(mktemp -d)"
+trap 'rm -rf "$tmp"' EXIT
+
+curl -fsSL "https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-$version.tgz" -o "$tmp/dist.tgz"
+
+# Архив сверяется с контрольной суммой, опубликованной в реестре для этой версии
+expected="$(curl -fsSL "https://registry.npmjs.org/swagger-ui-dist/$version" | sed -n 's/.*"integrity":"sha512-\([^"]*\)".*/\1/p')"
+actual="$(openssl dgst -sha512 -binary "$tmp/dist.tgz" | base64 | tr -d '\n')"
+if [ -z "$expected" ] || [ "$expected" != "$actual" ]; then
+    echo "Контрольная сумма swagger-ui-dist $version не совпадает с реестром" >&2
+    exit 1
+fi
+
+tar -xzf "$tmp/dist.tgz" -C "$tmp"
+for file in swagger-ui.css swagger-ui-bundle.js LICENSE; do
+    cp "$tmp/package/$file" "$dir/$file"
+done
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestRouter создает маршрутизатор сервиса без сервисов и middleware проверки учетных данных
+// Обработчики не вызываются, проверяются только зарегистрированные маршруты
+func newTestRouter() *mux.Router {
+	return NewRouter(Handlers{
+		User:       NewUserHandler(nil, nil),
+		Group:      NewGroupHandler(nil, nil),
+		Invitation: NewInvitationHandler(nil, nil),
+		Auth:       NewAuthHandler(nil, nil, nil),
+		Identity:   NewIdentityHandler(nil, nil),
+		APIKey:     NewAPIKeyHandler(nil, nil),
+		OIDC:       NewOIDCHandler(nil, nil),
+		Webhook:    NewWebhookHandler(nil, nil),
+		Docs:       NewDocsHandler(),
+	}, nil, nil)
+}
+
+// TestOpenAPIMatchesRoutes проверяет, что спецификация и зарегистрированные маршруты совпадают
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("Ошибка разбора спецификации: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.1") {
+		t.Errorf("Ожидалась версия OpenAPI 3.1, получена %s", spec.OpenAPI)
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	registered := make(map[string]bool)
+	err := newTestRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil // Подмаршрутизаторы входа и маршрутов арендатора без собственного пути
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			registered[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Ошибка обхода маршрутов: %v", err)
+	}
+
+	for _, route := range missing(registered, documented) {
+		t.Errorf("Маршрут %s не описан в docs/openapi.json", route)
+	}
+	for _, route := range missing(documented, registered) {
+		t.Errorf("Маршрут %s описан в docs/openapi.json, но не зарегистрирован", route)
+	}
+}
+
+// TestOpenAPIServed проверяет, что спецификация отдается как JSON
+func TestOpenAPIServed(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался код состояния %d, получен %d", http.StatusOK, rec.Code)
+	}
+	if !json.Valid(rec.Body.Bytes()) {
+		t.Error("Ответ /openapi.json не является корректным JSON")
+	}
+}
+
+// TestSwaggerUIPage проверяет, что страница /docs загружает Swagger UI закрепленной версии:
+// встроенные файлы, если они загружены в репозиторий, иначе ту же версию с CDN
+func TestSwaggerUIPage(t *testing.T) {
+	router := newTestRouter()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	page := get("/docs")
+	if page.Code != http.StatusOK || strings.Contains(page.Body.String(), "{{ASSETS}}") {
+		t.Fatalf("Некорректная страница Swagger UI (код %d): %s", page.Code, page.Body.String())
+	}
+
+	if get(swaggerUIAssets+"/swagger-ui-bundle.js").Code == http.StatusNotFound {
+		version, err := swaggerUIFiles.ReadFile("docs/swagger-ui/VERSION")
+		if err != nil {
+			t.Fatalf("Не указана версия Swagger UI: %v", err)
+		}
+		pinned := "https://unpkg.com/swagger-ui-dist@" + strings.TrimSpace(string(version)) + "/swagger-ui-bundle.js"
+		if !strings.Contains(page.Body.String(), pinned) {
+			t.Errorf("Без встроенных файлов страница должна загружать %s", pinned)
+		}
+		t.Skip("Файлы Swagger UI не загружены, выполните go generate ./internal/handler")
+	}
+
+	for _, file := range []string{"swagger-ui.css", "swagger-ui-bundle.js"} {
+		if !strings.Contains(page.Body.String(), `"`+swaggerUIAssets+"/"+file+`"`) {
+			t.Errorf("Страница должна загружать встроенный файл %s", file)
+		}
+		if rec := get(swaggerUIAssets + "/" + file); rec.Code != http.StatusOK {
+			t.Errorf("Файл %s: ожидался код состояния %d, получен %d", file, http.StatusOK, rec.Code)
+		}
+	}
+	if strings.Contains(page.Body.String(), "https://") {
+		t.Error("Страница со встроенными файлами не должна обращаться к внешним адресам")
+	}
+}
+
+// missing возвращает отсортированные ключи from, отсутствующие в to
+func missing(from, to map[string]bool) []string {
+	var result []string
+	for key := range from {
+		if !to[key] {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
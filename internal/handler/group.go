@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// GroupHandler обрабатывает HTTP запросы для управления группами пользователей и участием в них
+type GroupHandler struct {
+	service *service.GroupService // Сервис групп
+	logger  *log.Logger           // Логгер для записи информации о запросах
+}
+
+// NewGroupHandler создает новый обработчик групп
+// service - сервис групп
+// logger - логгер для записи событий
+func NewGroupHandler(service *service.GroupService, logger *log.Logger) *GroupHandler {
+	return &GroupHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes регистрирует маршруты для работы с группами
+// Чтение доступно любому проверенному запросу, изменения - администратору арендатора и сервисам по ключу API
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *GroupHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/groups", h.GetAllGroups).Methods(http.MethodGet)                                // GET /groups - получить группы
+	r.HandleFunc("/groups/{id}", h.GetGroup).Methods(http.MethodGet)                               // GET /groups/{id} - получить группу по ID
+	r.HandleFunc("/groups", h.CreateGroup).Methods(http.MethodPost)                                // POST /groups - создать группу
+	r.HandleFunc("/groups/{id}", h.UpdateGroup).Methods(http.MethodPut)                            // PUT /groups/{id} - обновить группу
+	r.HandleFunc("/groups/{id}", h.DeleteGroup).Methods(http.MethodDelete)                         // DELETE /groups/{id} - удалить группу
+	r.HandleFunc("/groups/{id}/members", h.GetGroupMembers).Methods(http.MethodGet)                // GET /groups/{id}/members - участники группы
+	r.HandleFunc("/groups/{id}/members", h.AddGroupMember).Methods(http.MethodPost)                // POST /groups/{id}/members - добавить участника
+	r.HandleFunc("/groups/{id}/members/{user_id}", h.UpdateGroupMember).Methods(http.MethodPut)    // PUT /groups/{id}/members/{user_id} - изменить роль
+	r.HandleFunc("/groups/{id}/members/{user_id}", h.RemoveGroupMember).Methods(http.MethodDelete) // DELETE /groups/{id}/members/{user_id} - исключить участника
+	r.HandleFunc("/users/{id}/groups", h.GetUserGroups).Methods(http.MethodGet)                    // GET /users/{id}/groups - группы пользователя
+}
+
+// GetAllGroups обрабатывает GET /groups
+// Возвращает страницу групп, общее количество групп передается в заголовке X-Total-Count
+func (h *GroupHandler) GetAllGroups(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры пагинации", http.StatusBadRequest)
+		return
+	}
+
+	groups, total, err := h.service.GetAll(r.Context(), limit, offset)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения групп", "Не удалось получить группы")
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondWithJSON(w, http.StatusOK, groups)
+}
+
+// GetGroup обрабатывает GET /groups/{id}
+func (h *GroupHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID группы", http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.service.GetByID(r.Context(), id)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения группы", "Не удалось получить группу")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, group)
+}
+
+// CreateGroup обрабатывает POST /groups
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	var create model.GroupCreate
+	if err := json.NewDecoder(r.Body).Decode(&create); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.service.Create(r.Context(), create)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка создания группы", "Не удалось создать группу")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, group)
+}
+
+// UpdateGroup обрабатывает PUT /groups/{id}
+// Обновляет только переданные поля группы
+func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID группы", http.StatusBadRequest)
+		return
+	}
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	var update model.GroupUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.service.Update(r.Context(), id, update)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка обновления группы", "Не удалось обновить группу")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, group)
+}
+
+// DeleteGroup обрабатывает DELETE /groups/{id}
+// Удаляет группу вместе с участием в ней, пользователи не удаляются
+func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID группы", http.StatusBadRequest)
+		return
+	}
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id); err != nil {
+		h.respondWithError(w, err, "Ошибка удаления группы", "Не удалось удалить группу")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetGroupMembers обрабатывает GET /groups/{id}/members
+// Возвращает страницу участников группы, общее количество участников передается в заголовке X-Total-Count
+func (h *GroupHandler) GetGroupMembers(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID группы", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры пагинации", http.StatusBadRequest)
+		return
+	}
+
+	members, total, err := h.service.Members(r.Context(), id, limit, offset)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения участников группы", "Не удалось получить участников группы")
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondWithJSON(w, http.StatusOK, members)
+}
+
+// AddGroupMember обрабатывает POST /groups/{id}/members
+// Добавляет пользователя арендатора в группу; без роли пользователь становится участником (member)
+func (h *GroupHandler) AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID группы", http.StatusBadRequest)
+		return
+	}
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	var add model.GroupMemberAdd
+	if err := json.NewDecoder(r.Body).Decode(&add); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.service.AddMember(r.Context(), id, add)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка добавления участника группы", "Не удалось добавить участника группы")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, member)
+}
+
+// UpdateGroupMember обрабатывает PUT /groups/{id}/members/{user_id}
+// Изменяет роль участника группы
+func (h *GroupHandler) UpdateGroupMember(w http.ResponseWriter, r *http.Request) {
+	id, userID, err := parseMemberFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID группы или пользователя", http.StatusBadRequest)
+		return
+	}
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	var update model.GroupMemberUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.service.UpdateMember(r.Context(), id, userID, update)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка изменения роли участника группы", "Не удалось изменить роль участника группы")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, member)
+}
+
+// RemoveGroupMember обрабатывает DELETE /groups/{id}/members/{user_id}
+// Исключает пользователя из группы
+func (h *GroupHandler) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	id, userID, err := parseMemberFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID группы или пользователя", http.StatusBadRequest)
+		return
+	}
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	if err := h.service.RemoveMember(r.Context(), id, userID); err != nil {
+		h.respondWithError(w, err, "Ошибка исключения участника группы", "Не удалось исключить участника группы")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUserGroups обрабатывает GET /users/{id}/groups
+// Возвращает группы, в которых состоит пользователь, вместе с его ролью в каждой группе
+func (h *GroupHandler) GetUserGroups(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+
+	groups, err := h.service.UserGroups(r.Context(), id)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения групп пользователя", "Не удалось получить группы пользователя")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, groups)
+}
+
+// respondWithError преобразует ошибку сервиса в HTTP ответ
+// logMessage - префикс для записи неожиданной ошибки в лог
+// userMessage - текст ответа клиенту при внутренней ошибке
+func (h *GroupHandler) respondWithError(w http.ResponseWriter, err error, logMessage, userMessage string) {
+	switch {
+	case errors.Is(err, service.ErrGroupNotFound):
+		http.Error(w, "Группа не найдена", http.StatusNotFound)
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+	case errors.Is(err, service.ErrMemberNotFound):
+		http.Error(w, "Пользователь не состоит в группе", http.StatusNotFound)
+	case errors.Is(err, service.ErrGroupExists):
+		http.Error(w, "Группа с таким названием уже существует", http.StatusConflict)
+	case errors.Is(err, service.ErrAlreadyMember):
+		http.Error(w, "Пользователь уже состоит в группе", http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidInput):
+		http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+	default:
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, userMessage, http.StatusInternalServerError)
+	}
+}
+
+// parseMemberFromRequest извлекает ID группы и ID участника из параметров запроса
+func parseMemberFromRequest(r *http.Request) (int64, int64, error) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	userID, err := strconv.ParseInt(mux.Vars(r)["user_id"], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, userID, nil
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// IdentityHandler обрабатывает HTTP запросы входа через внешних поставщиков удостоверений
+// и управления привязанными учетными записями поставщиков
+type IdentityHandler struct {
+	service *service.IdentityService // Сервис входа через внешних поставщиков
+	logger  *log.Logger              // Логгер для записи информации о запросах
+}
+
+// NewIdentityHandler создает новый обработчик входа через внешних поставщиков
+// service - сервис входа через внешних поставщиков
+// logger - логгер для записи событий
+func NewIdentityHandler(service *service.IdentityService, logger *log.Logger) *IdentityHandler {
+	return &IdentityHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterLoginRoutes регистрирует маршруты начала входа, выполняемые в пределах арендатора без токена доступа
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *IdentityHandler) RegisterLoginRoutes(r *mux.Router) {
+	r.HandleFunc("/auth/providers", h.GetProviders).Methods(http.MethodGet)                 // GET /auth/providers - настроенные поставщики
+	r.HandleFunc("/auth/providers/{provider}/login", h.StartLogin).Methods(http.MethodPost) // POST /auth/providers/{provider}/login - начать вход
+}
+
+// RegisterRoutes регистрирует маршруты управления привязками, выполняемые в пределах арендатора
+// Привязки доступны самому пользователю и администратору арендатора по токену доступа
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *IdentityHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/users/{id}/identities", h.GetIdentities).Methods(http.MethodGet)                   // GET /users/{id}/identities - привязанные учетные записи
+	r.HandleFunc("/users/{id}/identities/{identity_id}", h.UnlinkIdentity).Methods(http.MethodDelete) // DELETE /users/{id}/identities/{identity_id} - отвязать учетную запись
+}
+
+// RegisterCallbackRoute регистрирует маршрут возврата от поставщика
+// Арендатор определяется по параметру state, поэтому маршрут регистрируется вне маршрутизатора арендатора
+// r - маршрутизатор, в который будет добавлен маршрут
+func (h *IdentityHandler) RegisterCallbackRoute(r *mux.Router) {
+	r.HandleFunc("/auth/providers/{provider}/callback", h.CompleteLogin).Methods(http.MethodGet) // GET /auth/providers/{provider}/callback - завершить вход
+}
+
+// GetProviders обрабатывает GET /auth/providers
+// Возвращает настроенных поставщиков с адресами начала входа
+func (h *IdentityHandler) GetProviders(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, h.service.Providers())
+}
+
+// StartLogin обрабатывает POST /auth/providers/{provider}/login
+// Возвращает адрес страницы входа поставщика, на который клиент перенаправляет пользователя
+func (h *IdentityHandler) StartLogin(w http.ResponseWriter, r *http.Request) {
+	start, err := h.service.StartLogin(r.Context(), mux.Vars(r)["provider"])
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка начала входа через поставщика", "Не удалось начать вход")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, start)
+}
+
+// CompleteLogin обрабатывает GET /auth/providers/{provider}/callback
+// Обменивает код от поставщика на токен доступа; если у пользователя включена двухфакторная
+// аутентификация, возвращает токен второго шага (mfa_required)
+func (h *IdentityHandler) CompleteLogin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	token, err := h.service.CompleteLogin(r.Context(), mux.Vars(r)["provider"], model.IdentityCallback{
+		Code:             query.Get("code"),
+		State:            query.Get("state"),
+		Error:            query.Get("error"),
+		ErrorDescription: query.Get("error_description"),
+	})
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка входа через поставщика", "Не удалось выполнить вход")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, token)
+}
+
+// GetIdentities обрабатывает GET /users/{id}/identities
+// Возвращает учетные записи поставщиков, привязанные к пользователю
+func (h *IdentityHandler) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	if !requireSelfOrAdmin(w, r, id) {
+		return
+	}
+
+	identities, err := h.service.ListIdentities(r.Context(), id)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения привязанных учетных записей",
+			"Не удалось получить привязанные учетные записи")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, identities)
+}
+
+// UnlinkIdentity обрабатывает DELETE /users/{id}/identities/{identity_id}
+// Отвязывает учетную запись поставщика, отвязка записывается в журнал аудита
+func (h *IdentityHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	id, identityID, err := parseIdentityFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID пользователя или привязки", http.StatusBadRequest)
+		return
+	}
+	if !requireSelfOrAdmin(w, r, id) {
+		return
+	}
+
+	if err := h.service.Unlink(r.Context(), id, identityID); err != nil {
+		h.respondWithError(w, err, "Ошибка отвязки учетной записи", "Не удалось отвязать учетную запись")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondWithError преобразует ошибку сервиса в HTTP ответ
+// Неизвестные ошибки записываются в лог с logMessage, клиент получает userMessage
+func (h *IdentityHandler) respondWithError(w http.ResponseWriter, err error, logMessage, userMessage string) {
+	switch {
+	case errors.Is(err, service.ErrIdentityProviderNotFound):
+		http.Error(w, "Поставщик не найден", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidLoginState):
+		http.Error(w, "Вход не начат, истек или уже завершен", http.StatusBadRequest)
+	case errors.Is(err, service.ErrExternalLoginDenied):
+		http.Error(w, "Поставщик отклонил вход", http.StatusUnauthorized)
+	case errors.Is(err, service.ErrExternalLogin):
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, "Поставщик недоступен или его ответ не прошел проверку", http.StatusBadGateway)
+	case errors.Is(err, service.ErrEmailNotVerified):
+		http.Error(w, "Электронная почта не подтверждена", http.StatusForbidden)
+	case errors.Is(err, service.ErrExternalUserNotFound):
+		http.Error(w, "Пользователь с электронной почтой от поставщика не найден", http.StatusForbidden)
+	case errors.Is(err, service.ErrAccountInactive):
+		http.Error(w, "Учетная запись не активна", http.StatusForbidden)
+	case errors.Is(err, service.ErrIdentityConflict):
+		http.Error(w, "К пользователю уже привязана другая учетная запись этого поставщика", http.StatusConflict)
+	case errors.Is(err, service.ErrIdentityUnlinked):
+		http.Error(w, "Учетная запись поставщика отвязана от пользователя и не привязывается автоматически", http.StatusForbidden)
+	case errors.Is(err, service.ErrIdentityNotFound):
+		http.Error(w, "Привязка не найдена", http.StatusNotFound)
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidInput):
+		http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+	case errors.Is(err, service.ErrLoginDisabled):
+		http.Error(w, "Вход не настроен", http.StatusNotImplemented)
+	default:
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, userMessage, http.StatusInternalServerError)
+	}
+}
+
+// parseIdentityFromRequest извлекает ID пользователя и ID привязки из параметров запроса
+func parseIdentityFromRequest(r *http.Request) (int64, int64, error) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	identityID, err := strconv.ParseInt(mux.Vars(r)["identity_id"], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, identityID, nil
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// InvitationHandler обрабатывает HTTP запросы для приглашения пользователей
+type InvitationHandler struct {
+	service *service.InvitationService // Сервис приглашений
+	logger  *log.Logger                // Логгер для записи информации о запросах
+}
+
+// NewInvitationHandler создает новый обработчик приглашений
+// service - сервис приглашений
+// logger - логгер для записи событий
+func NewInvitationHandler(service *service.InvitationService, logger *log.Logger) *InvitationHandler {
+	return &InvitationHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes регистрирует маршруты управления приглашениями, выполняемые в пределах арендатора
+// Приглашения доступны администратору арендатора и сервисам по ключу API
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *InvitationHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/invitations", h.GetPendingInvitations).Methods(http.MethodGet)    // GET /invitations - действующие приглашения
+	r.HandleFunc("/invitations", h.CreateInvitation).Methods(http.MethodPost)        // POST /invitations - пригласить пользователя
+	r.HandleFunc("/invitations/{id}", h.RevokeInvitation).Methods(http.MethodDelete) // DELETE /invitations/{id} - отозвать приглашение
+}
+
+// RegisterAcceptRoute регистрирует маршрут принятия приглашения
+// Арендатор определяется по токену приглашения, поэтому маршрут регистрируется вне маршрутизатора арендатора
+// r - маршрутизатор, в который будет добавлен маршрут
+func (h *InvitationHandler) RegisterAcceptRoute(r *mux.Router) {
+	r.HandleFunc("/invitations/accept", h.AcceptInvitation).Methods(http.MethodPost) // POST /invitations/accept - принять приглашение
+}
+
+// GetPendingInvitations обрабатывает GET /invitations
+// Возвращает страницу действующих приглашений, общее количество передается в заголовке X-Total-Count
+func (h *InvitationHandler) GetPendingInvitations(w http.ResponseWriter, r *http.Request) {
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры пагинации", http.StatusBadRequest)
+		return
+	}
+
+	invitations, total, err := h.service.ListPending(r.Context(), limit, offset)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения приглашений", "Не удалось получить приглашения")
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondWithJSON(w, http.StatusOK, invitations)
+}
+
+// CreateInvitation обрабатывает POST /invitations
+// Создает приглашение и отправляет ссылку на указанную электронную почту
+// Пригласить администратора может только администратор арендатора по токену доступа
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	var create model.InvitationCreate
+	if err := json.NewDecoder(r.Body).Decode(&create); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+	if !requireRoleGrant(w, r, create.Role) {
+		return
+	}
+
+	invitation, err := h.service.Create(r.Context(), create)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка создания приглашения", "Не удалось создать приглашение")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, invitation)
+}
+
+// RevokeInvitation обрабатывает DELETE /invitations/{id}
+func (h *InvitationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID приглашения", http.StatusBadRequest)
+		return
+	}
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	if err := h.service.Revoke(r.Context(), id); err != nil {
+		h.respondWithError(w, err, "Ошибка отзыва приглашения", "Не удалось отозвать приглашение")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptInvitation обрабатывает POST /invitations/accept
+// Создает пользователя с электронной почтой и ролью из приглашения
+func (h *InvitationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var accept model.InvitationAccept
+	if err := json.NewDecoder(r.Body).Decode(&accept); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.Accept(r.Context(), accept)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка принятия приглашения", "Не удалось принять приглашение")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, user)
+}
+
+// respondWithError преобразует ошибку сервиса в HTTP ответ
+// Неизвестные ошибки записываются в лог с logMessage, клиент получает userMessage
+func (h *InvitationHandler) respondWithError(w http.ResponseWriter, err error, logMessage, userMessage string) {
+	switch {
+	case errors.Is(err, service.ErrInvitationNotFound):
+		http.Error(w, "Приглашение не найдено", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvitationInactive):
+		http.Error(w, "Приглашение уже принято, отозвано или истекло", http.StatusGone)
+	case errors.Is(err, service.ErrEmailTaken):
+		http.Error(w, "Электронная почта уже используется", http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidInput):
+		http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvitationNotSent):
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, "Не удалось отправить приглашение", http.StatusBadGateway)
+	default:
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, userMessage, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,402 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/service"
+	"github.com/janson/usermicroservice/internal/tenant"
+)
+
+// Заголовки, из которых читаются сведения о запросе
+const (
+	headerRequestID = "X-Request-ID" // Идентификатор запроса, сквозной между сервисами
+	headerActor     = "X-Actor"      // Инициатор изменения, передаваемый вызывающей стороной
+)
+
+// RequestInfoMiddleware сохраняет в контексте запроса его ID, инициатора и IP-адрес клиента
+// Если клиент не передал X-Request-ID или передал некорректный (см. requestinfo.ValidRequestID),
+// идентификатор генерируется и возвращается в ответе; X-Actor обрезается до requestinfo.MaxActorLength байт
+// IP-адрес из X-Forwarded-For и X-Real-IP принимается только от доверенных прокси (см. clientIP)
+// trustedProxies - подсети доверенных прокси в формате CIDR
+func RequestInfoMiddleware(trustedProxies []string) mux.MiddlewareFunc {
+	proxies := parseTrustedProxies(trustedProxies)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(headerRequestID)
+			if !requestinfo.ValidRequestID(requestID) {
+				requestID = generateRequestID()
+			}
+			w.Header().Set(headerRequestID, requestID)
+
+			info := requestinfo.Info{
+				RequestID: requestID,
+				Actor:     requestinfo.TruncateActor(r.Header.Get(headerActor)),
+				IP:        clientIP(r, proxies),
+			}
+
+			next.ServeHTTP(w, r.WithContext(requestinfo.WithInfo(r.Context(), info)))
+		})
+	}
+}
+
+// AuthMiddleware проверяет учетные данные запроса из заголовка Authorization и сохраняет их в сведениях о запросе
+// Принимаются ключ API ("ApiKey <ключ>") и токен доступа, выданный при входе ("Bearer <токен>"):
+//   - запрос с ключом выполняется в пределах арендатора ключа, инициатор - ключ ("api-key:<префикс>");
+//     ключ дает доступ только к маршрутам, разрешения на которые у него есть (см. routeScope)
+//   - запрос с токеном выполняется от имени пользователя токена в пределах его арендатора, если его учетная
+//     запись активна; роль и инициатор (электронная почта) берутся из учетной записи, а не из токена
+//
+// Заголовок X-Actor для проверенных запросов не учитывается, права на операцию проверяют обработчики
+// Должен выполняться после RequestInfoMiddleware и до TenantMiddleware
+// Запрос без учетных данных, с неверным, истекшим или отозванным ключом или токеном, а также с токеном
+// приостановленного, заблокированного или удаленного пользователя отклоняется с кодом 401,
+// запрос с ключом без нужного разрешения - 403
+// auth - сервис входа, выдающий токены доступа
+// keys - сервис ключей API
+// logger - логгер для записи ошибок проверки
+func AuthMiddleware(auth *service.AuthService, keys *service.APIKeyService, logger *log.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get("Authorization")
+			info := requestinfo.FromContext(r.Context())
+
+			if key, ok := authorizationValue(authorization, "ApiKey"); ok {
+				apiKey, err := keys.Authenticate(r.Context(), key)
+				switch {
+				case errors.Is(err, service.ErrInvalidAPIKey):
+					respondUnauthorized(w, "Некорректный ключ API")
+					return
+				case err != nil:
+					logger.Printf("Ошибка проверки ключа API: %v", err)
+					http.Error(w, "Не удалось проверить ключ API", http.StatusInternalServerError)
+					return
+				}
+
+				var template string
+				if route := mux.CurrentRoute(r); route != nil {
+					template, _ = route.GetPathTemplate()
+				}
+				scope, ok := routeScope(r.Method, template)
+				if !ok || !apiKey.Allows(scope) {
+					http.Error(w, "Ключ API не дает доступа к этому запросу", http.StatusForbidden)
+					return
+				}
+
+				info.TenantID = apiKey.TenantID
+				info.APIKey = apiKey.Prefix
+				info.Actor = "api-key:" + apiKey.Prefix
+				next.ServeHTTP(w, r.WithContext(requestinfo.WithInfo(r.Context(), info)))
+				return
+			}
+
+			token, ok := authorizationValue(authorization, "Bearer")
+			if !ok {
+				respondUnauthorized(w, "Требуется токен доступа или ключ API")
+				return
+			}
+			claims, err := auth.AuthenticateToken(r.Context(), token)
+			switch {
+			case errors.Is(err, service.ErrInvalidAccessToken), errors.Is(err, service.ErrLoginDisabled):
+				respondUnauthorized(w, "Некорректный или истекший токен доступа")
+				return
+			case err != nil:
+				logger.Printf("Ошибка проверки токена доступа: %v", err)
+				http.Error(w, "Не удалось проверить токен доступа", http.StatusInternalServerError)
+				return
+			}
+
+			info.UserID = claims.UserID
+			info.Role = claims.Role
+			info.TenantID = claims.TenantID
+			info.Actor = claims.Email
+			next.ServeHTTP(w, r.WithContext(requestinfo.WithInfo(r.Context(), info)))
+		})
+	}
+}
+
+// TenantMiddleware определяет арендатора запроса и сохраняет его в сведениях о запросе
+// Должен выполняться после RequestInfoMiddleware и AuthMiddleware, если он есть у маршрутизатора
+// Если арендатор уже определен ключом API или токеном доступа, проверяется только совпадение с заголовком арендатора
+// Запрос без арендатора отклоняется с кодом 400, с некорректным токеном - 401,
+// с заголовком арендатора, не совпадающим с токеном или ключом, - 403
+// resolver - определитель арендатора
+func TenantMiddleware(resolver *tenant.Resolver) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if info := requestinfo.FromContext(r.Context()); info.TenantID != "" {
+				if header := r.Header.Get(resolver.Header()); header != "" && header != info.TenantID {
+					http.Error(w, "Арендатор в заголовке не совпадает с арендатором ключа API или токена", http.StatusForbidden)
+					return
+				}
+				tenant.RecordRequest(info.TenantID)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tenantID, err := resolver.Resolve(r.Header.Get("Authorization"), r.Header.Get(resolver.Header()))
+			switch {
+			case errors.Is(err, tenant.ErrInvalidToken):
+				http.Error(w, "Некорректный токен доступа", http.StatusUnauthorized)
+				return
+			case errors.Is(err, tenant.ErrMismatch):
+				http.Error(w, "Арендатор в заголовке не совпадает с арендатором токена", http.StatusForbidden)
+				return
+			case err != nil:
+				http.Error(w, "Не указан или некорректен арендатор", http.StatusBadRequest)
+				return
+			}
+			tenant.RecordRequest(tenantID)
+
+			info := requestinfo.FromContext(r.Context())
+			info.TenantID = tenantID
+			next.ServeHTTP(w, r.WithContext(requestinfo.WithInfo(r.Context(), info)))
+		})
+	}
+}
+
+// CacheControlMiddleware задает заголовок Cache-Control для маршрутов из конфигурации
+// Ключ правила - метод и шаблон пути маршрута, например "GET /users/{id}"
+// Заголовок добавляется только к ответам 200 и 304, ошибки не кэшируются
+// rules - значения Cache-Control по маршрутам
+func CacheControlMiddleware(rules map[string]string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			template, err := route.GetPathTemplate()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			value, ok := rules[r.Method+" "+template]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, value: value}, r)
+		})
+	}
+}
+
+// cacheControlWriter добавляет Cache-Control при отправке успешного ответа
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string // Значение Cache-Control
+	wroteHeader bool   // Код ответа уже отправлен
+}
+
+// WriteHeader добавляет Cache-Control к ответам 200 и 304, если обработчик не задал его сам
+func (w *cacheControlWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if (code == http.StatusOK || code == http.StatusNotModified) && w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", w.value)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write отправляет тело ответа, при необходимости с кодом 200
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// routeScope возвращает разрешение ключа API, необходимое для запроса с методом method к маршруту template
+// Ресурс определяется по первому сегменту шаблона маршрута, запросы GET требуют разрешения на чтение,
+// остальные - на запись. Возвращает false для маршрутов, недоступных по ключу API (вход, управление ключами)
+func routeScope(method, template string) (string, bool) {
+	resource, _, _ := strings.Cut(strings.TrimPrefix(template, "/"), "/")
+	switch resource {
+	case "users", "groups", "invitations":
+	default:
+		return "", false
+	}
+
+	if method == http.MethodGet || method == http.MethodHead {
+		return resource + ":read", true
+	}
+	return resource + ":write", true
+}
+
+// authorizationValue извлекает учетные данные из значения заголовка Authorization вида "<схема> <значение>"
+// Схема сравнивается без учета регистра
+func authorizationValue(authorization, scheme string) (string, bool) {
+	got, value, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(got, scheme) || value == "" {
+		return "", false
+	}
+	return value, true
+}
+
+// respondUnauthorized отправляет ответ 401 со схемами, которыми можно пройти проверку
+func respondUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer, ApiKey`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// requireAdmin проверяет, что запрос выполняет администратор арендатора по токену доступа
+// Иначе отправляет ответ 401 (запрос без токена и ключа API, если маршрут доступен без них) или 403
+// и возвращает false
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	info := requestinfo.FromContext(r.Context())
+	switch {
+	case info.IsAdmin():
+		return true
+	case !info.Authenticated():
+		respondUnauthorized(w, "Требуется токен доступа")
+	default:
+		http.Error(w, "Операция доступна только администратору", http.StatusForbidden)
+	}
+	return false
+}
+
+// requireSelf проверяет, что запрос выполняет по токену доступа сам пользователь id
+// Иначе отправляет ответ 401 или 403 и возвращает false
+func requireSelf(w http.ResponseWriter, r *http.Request, id int64) bool {
+	info := requestinfo.FromContext(r.Context())
+	switch {
+	case info.IsSelf(id):
+		return true
+	case !info.Authenticated():
+		respondUnauthorized(w, "Требуется токен доступа")
+	default:
+		http.Error(w, "Операция доступна только самому пользователю", http.StatusForbidden)
+	}
+	return false
+}
+
+// requireSelfOrAdmin проверяет, что запрос выполняет по токену доступа сам пользователь id
+// или администратор арендатора
+// Иначе отправляет ответ 401 или 403 и возвращает false
+func requireSelfOrAdmin(w http.ResponseWriter, r *http.Request, id int64) bool {
+	if requestinfo.FromContext(r.Context()).IsSelf(id) {
+		return true
+	}
+	return requireAdmin(w, r)
+}
+
+// requireUserManager проверяет, что запрос выполняет администратор арендатора по токену доступа
+// или сервис по ключу API (см. requestinfo.Info.CanManageUsers)
+// Иначе отправляет ответ 401 или 403 и возвращает false
+func requireUserManager(w http.ResponseWriter, r *http.Request) bool {
+	info := requestinfo.FromContext(r.Context())
+	switch {
+	case info.CanManageUsers():
+		return true
+	case !info.Authenticated():
+		respondUnauthorized(w, "Требуется токен доступа или ключ API")
+	default:
+		http.Error(w, "Операция доступна только администратору", http.StatusForbidden)
+	}
+	return false
+}
+
+// requireSelfOrUserManager проверяет, что запрос выполняет по токену доступа сам пользователь id,
+// администратор арендатора или сервис по ключу API
+// Иначе отправляет ответ 401 или 403 и возвращает false
+func requireSelfOrUserManager(w http.ResponseWriter, r *http.Request, id int64) bool {
+	if requestinfo.FromContext(r.Context()).IsSelf(id) {
+		return true
+	}
+	return requireUserManager(w, r)
+}
+
+// requireRoleGrant проверяет, что запрос может назначить пользователю роль role
+// (см. requestinfo.Info.CanGrantRole), иначе отправляет ответ 403 и возвращает false
+// Должна вызываться после проверки, что запрос вообще может изменять пользователя
+func requireRoleGrant(w http.ResponseWriter, r *http.Request, role string) bool {
+	if requestinfo.FromContext(r.Context()).CanGrantRole(role) {
+		return true
+	}
+	if role == model.UserRoleAdmin {
+		http.Error(w, "Роль администратора может назначить только администратор", http.StatusForbidden)
+	} else {
+		http.Error(w, "Роль может изменить только администратор", http.StatusForbidden)
+	}
+	return false
+}
+
+// clientIP определяет IP-адрес клиента с учетом доверенных прокси
+// Заголовкам X-Forwarded-For и X-Real-IP доверяют, только если соединение пришло от доверенного прокси:
+// адреса X-Forwarded-For просматриваются справа налево, пока они принадлежат доверенным прокси, и берется первый
+// недоверенный (адреса левее него мог подставить сам клиент). Без доверенных прокси используется адрес соединения
+func clientIP(r *http.Request, proxies []netip.Prefix) string {
+	client := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client = host
+	}
+	remote, err := netip.ParseAddr(client)
+	if err != nil || !trustedProxy(remote, proxies) {
+		return client
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		addrs := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			// Некорректный адрес прерывает цепочку: левее него доверять уже нечему
+			addr, err := netip.ParseAddr(strings.TrimSpace(addrs[i]))
+			if err != nil {
+				break
+			}
+			client = addr.Unmap().String()
+			if !trustedProxy(addr, proxies) {
+				break
+			}
+		}
+		return client
+	}
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return client
+}
+
+// trustedProxy сообщает, что адрес принадлежит одной из подсетей доверенных прокси
+func trustedProxy(addr netip.Addr, proxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies разбирает подсети доверенных прокси в формате CIDR
+// Некорректные значения пропускаются: они отклоняются при проверке конфигурации
+func parseTrustedProxies(cidrs []string) []netip.Prefix {
+	proxies := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			proxies = append(proxies, prefix.Masked())
+		}
+	}
+	return proxies
+}
+
+// generateRequestID генерирует случайный идентификатор запроса
+func generateRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,377 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// TestRouteScope проверяет разрешения ключа API, необходимые для маршрутов
+func TestRouteScope(t *testing.T) {
+	router := newTestRouter()
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+		ok     bool
+	}{
+		{http.MethodGet, "/users/1", "users:read", true},
+		{http.MethodPut, "/users/1", "users:write", true},
+		{http.MethodPut, "/users/1/password", "users:write", true},
+		{http.MethodGet, "/groups/1/members", "groups:read", true},
+		{http.MethodDelete, "/invitations/1", "invitations:write", true},
+		{http.MethodPost, "/auth/login", "", false},
+		{http.MethodPost, "/api-keys", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		var match mux.RouteMatch
+		if !router.Match(req, &match) {
+			t.Fatalf("Маршрут %s %s не найден", tt.method, tt.path)
+		}
+
+		template, err := match.Route.GetPathTemplate()
+		if err != nil {
+			t.Fatalf("Ошибка получения шаблона маршрута: %v", err)
+		}
+
+		got, ok := routeScope(tt.method, template)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s %s: получено %q, %v, ожидалось %q, %v", tt.method, tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// signAccessToken подписывает токен доступа с утверждениями, как при входе
+func signAccessToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	base := jwt.MapClaims{
+		"sub":       "1",
+		"tenant_id": "default",
+		"email":     "admin@example.com",
+		"role":      model.UserRoleAdmin,
+		"token_use": "access",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}
+	for name, value := range claims {
+		base[name] = value
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, base).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Ошибка подписи токена: %v", err)
+	}
+	return signed
+}
+
+// fakeAccounts - репозиторий учетных записей пользователей токенов по ID
+// Используется только для проверки состояния пользователя токена, остальные методы не вызываются
+type fakeAccounts map[int64]*model.User
+
+func (r fakeAccounts) Create(ctx context.Context, user model.UserCreate) (*model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r fakeAccounts) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	return r[id], nil
+}
+
+func (r fakeAccounts) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r fakeAccounts) GetAll(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r fakeAccounts) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (r fakeAccounts) Update(ctx context.Context, id int64, user model.UserUpdate) (*model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r fakeAccounts) ChangeStatus(ctx context.Context, id int64, change model.UserStatusChange) (*model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r fakeAccounts) Delete(ctx context.Context, id int64) error {
+	return errors.New("not implemented")
+}
+
+// newTestAuth создает сервис входа с активными администратором (ID 1) и участником (ID 2),
+// которым выдает токены signAccessToken
+func newTestAuth() (*service.AuthService, fakeAccounts) {
+	accounts := fakeAccounts{
+		1: {ID: 1, Email: "admin@example.com", Role: model.UserRoleAdmin, Status: model.UserStatusActive},
+		2: {ID: 2, Email: "member@example.com", Role: model.UserRoleMember, Status: model.UserStatusActive},
+	}
+	users := service.NewUserService(accounts, nil, nil, nil)
+	return service.NewAuthService(users, nil, nil, config.AuthConfig{JWTSecret: "secret"}, "", nil), accounts
+}
+
+// TestAuthMiddleware проверяет проверку токена доступа и права на операции администратора
+// и самого пользователя
+func TestAuthMiddleware(t *testing.T) {
+	auth, _ := newTestAuth()
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}/password", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := parseIDFromRequest(r)
+		if requireSelfOrAdmin(w, r, id) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	router.HandleFunc("/users/{id}/unlock", func(w http.ResponseWriter, r *http.Request) {
+		if requireAdmin(w, r) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	router.HandleFunc("/users/{id}/mfa", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := parseIDFromRequest(r)
+		if requireSelf(w, r, id) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(requestinfo.FromContext(r.Context()).Actor))
+	})
+	router.Use(AuthMiddleware(auth, nil, log.New(io.Discard, "", 0)))
+
+	member := jwt.MapClaims{"sub": "2", "role": model.UserRoleMember, "email": "member@example.com"}
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"без токена", "/users/2/password", "", http.StatusUnauthorized},
+		{"сам пользователь", "/users/2/password", "Bearer " + signAccessToken(t, "secret", member), http.StatusNoContent},
+		{"другой пользователь", "/users/3/password", "Bearer " + signAccessToken(t, "secret", member), http.StatusForbidden},
+		{"администратор", "/users/3/password", "Bearer " + signAccessToken(t, "secret", nil), http.StatusNoContent},
+		{"разблокировка не администратором", "/users/2/unlock", "Bearer " + signAccessToken(t, "secret", member), http.StatusForbidden},
+		{"разблокировка администратором", "/users/2/unlock", "Bearer " + signAccessToken(t, "secret", nil), http.StatusNoContent},
+		{"подключение второго фактора самим пользователем", "/users/2/mfa",
+			"Bearer " + signAccessToken(t, "secret", member), http.StatusNoContent},
+		{"подключение второго фактора администратором", "/users/2/mfa",
+			"Bearer " + signAccessToken(t, "secret", nil), http.StatusForbidden},
+		{"чужая подпись", "/users/3/password", "Bearer " + signAccessToken(t, "other", nil), http.StatusUnauthorized},
+		{"токен второго шага", "/users/3/password",
+			"Bearer " + signAccessToken(t, "secret", jwt.MapClaims{"token_use": "mfa"}), http.StatusUnauthorized},
+		{"истекший токен", "/users/3/password",
+			"Bearer " + signAccessToken(t, "secret", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, tt.path, nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: получен код %d, ожидался %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	// Инициатором запроса с токеном считается пользователь токена, а не заголовок X-Actor
+	req := httptest.NewRequest(http.MethodGet, "/users/2", nil)
+	req.Header.Set("Authorization", "Bearer "+signAccessToken(t, "secret", member))
+	req.Header.Set(headerActor, "someone-else")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Body.String() != "member@example.com" {
+		t.Errorf("Неожиданный инициатор: %q", rec.Body.String())
+	}
+}
+
+// TestAuthMiddlewareChecksAccount проверяет, что токен пользователя, учетная запись которого больше не активна,
+// отклоняется до истечения срока, а права определяются текущей ролью пользователя, а не ролью из токена
+func TestAuthMiddlewareChecksAccount(t *testing.T) {
+	auth, accounts := newTestAuth()
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}/unlock", func(w http.ResponseWriter, r *http.Request) {
+		if requireAdmin(w, r) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	router.Use(AuthMiddleware(auth, nil, log.New(io.Discard, "", 0)))
+
+	request := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodPut, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	member := signAccessToken(t, "secret", jwt.MapClaims{"sub": "2", "role": model.UserRoleMember, "email": "member@example.com"})
+	if code := request("/users/2", member); code != http.StatusNoContent {
+		t.Fatalf("Токен активного пользователя: получен код %d, ожидался %d", code, http.StatusNoContent)
+	}
+	for _, state := range []string{model.UserStatusSuspended, model.UserStatusLocked} {
+		accounts[2].Status = state
+		if code := request("/users/2", member); code != http.StatusUnauthorized {
+			t.Errorf("Токен пользователя в состоянии %s: получен код %d, ожидался %d", state, code, http.StatusUnauthorized)
+		}
+	}
+	delete(accounts, 2)
+	if code := request("/users/2", member); code != http.StatusUnauthorized {
+		t.Errorf("Токен удаленного пользователя: получен код %d, ожидался %d", code, http.StatusUnauthorized)
+	}
+
+	// Токен администратора, которого понизили до участника, не дает прав администратора
+	accounts[1].Role = model.UserRoleMember
+	if code := request("/users/3/unlock", signAccessToken(t, "secret", nil)); code != http.StatusForbidden {
+		t.Errorf("Разблокировка пониженным администратором: получен код %d, ожидался %d", code, http.StatusForbidden)
+	}
+}
+
+// TestUserManagementAccess проверяет, что изменять чужие учетные записи, группы и приглашения
+// могут только администратор и сервисы по ключу API, а роль администратора назначает только администратор
+func TestUserManagementAccess(t *testing.T) {
+	router := mux.NewRouter()
+	NewUserHandler(nil, log.New(io.Discard, "", 0)).RegisterRoutes(router)
+	NewGroupHandler(nil, log.New(io.Discard, "", 0)).RegisterRoutes(router)
+	NewInvitationHandler(nil, log.New(io.Discard, "", 0)).RegisterRoutes(router)
+
+	member := requestinfo.Info{UserID: 2, Role: model.UserRoleMember}
+	admin := requestinfo.Info{UserID: 1, Role: model.UserRoleAdmin}
+	apiKey := requestinfo.Info{APIKey: "usk_abc"}
+	tests := []struct {
+		name   string
+		info   requestinfo.Info
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"приглашение без учетных данных", requestinfo.Info{}, http.MethodPost, "/invitations", `{"email":"a@example.com"}`, http.StatusUnauthorized},
+		{"приглашение участником", member, http.MethodPost, "/invitations", `{"email":"a@example.com"}`, http.StatusForbidden},
+		{"приглашение администратора по ключу", apiKey, http.MethodPost, "/invitations", `{"email":"a@example.com","role":"admin"}`, http.StatusForbidden},
+		{"список приглашений участником", member, http.MethodGet, "/invitations", "", http.StatusForbidden},
+		{"отзыв приглашения участником", member, http.MethodDelete, "/invitations/1", "", http.StatusForbidden},
+		{"создание пользователя участником", member, http.MethodPost, "/users", `{"name":"a","email":"a@example.com"}`, http.StatusForbidden},
+		{"создание администратора по ключу", apiKey, http.MethodPost, "/users", `{"name":"a","email":"a@example.com","role":"admin"}`, http.StatusForbidden},
+		{"изменение чужих данных участником", member, http.MethodPut, "/users/3", `{"name":"a"}`, http.StatusForbidden},
+		{"изменение своей роли участником", member, http.MethodPut, "/users/2", `{"role":"admin"}`, http.StatusForbidden},
+		{"назначение администратора по ключу", apiKey, http.MethodPut, "/users/3", `{"role":"admin"}`, http.StatusForbidden},
+		{"удаление пользователя участником", member, http.MethodDelete, "/users/3", "", http.StatusForbidden},
+		{"приостановка участником", member, http.MethodPost, "/users/3/suspend", "", http.StatusForbidden},
+		{"чужая история участником", member, http.MethodGet, "/users/3/history", "", http.StatusForbidden},
+		{"создание группы участником", member, http.MethodPost, "/groups", `{"name":"a"}`, http.StatusForbidden},
+		{"добавление в группу участником", member, http.MethodPost, "/groups/1/members", `{"user_id":2}`, http.StatusForbidden},
+		{"некорректное тело от администратора", admin, http.MethodPost, "/invitations", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req = req.WithContext(requestinfo.WithInfo(req.Context(), tt.info))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: получен код %d, ожидался %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+// TestRequestInfoClientIP проверяет, что IP-адрес из заголовков прокси принимается
+// только от доверенных прокси, а подставленные клиентом адреса пропускаются
+func TestRequestInfoClientIP(t *testing.T) {
+	var got string
+	middleware := RequestInfoMiddleware([]string{"10.0.0.0/8"})
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = requestinfo.FromContext(r.Context()).IP
+	}))
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"клиент без прокси", "203.0.113.5:1234", "", "", "203.0.113.5"},
+		{"заголовки от недоверенного адреса", "203.0.113.5:1234", "198.51.100.1", "198.51.100.2", "203.0.113.5"},
+		{"доверенный прокси", "10.0.0.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"цепочка доверенных прокси", "10.0.0.1:1234", "198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"подставленный клиентом адрес", "10.0.0.1:1234", "192.0.2.1, 198.51.100.1", "", "198.51.100.1"},
+		{"некорректный адрес в цепочке", "10.0.0.1:1234", "192.0.2.1, unknown, 10.0.0.2", "", "10.0.0.2"},
+		{"X-Real-IP от доверенного прокси", "10.0.0.1:1234", "", "198.51.100.2", "198.51.100.2"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Errorf("%s: получен IP %q, ожидался %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestRequestInfoHeaders проверяет, что ID запроса и инициатор от клиента приводятся к виду,
+// который помещается в журнал аудита: некорректный ID заменяется сгенерированным, инициатор обрезается
+func TestRequestInfoHeaders(t *testing.T) {
+	var got requestinfo.Info
+	handler := RequestInfoMiddleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = requestinfo.FromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name      string
+		requestID string
+		actor     string
+		keepID    bool
+		wantActor string
+	}{
+		{"корректные значения", "req-1", "alice@example.com", true, "alice@example.com"},
+		{"ID не передан", "", "", false, ""},
+		{"слишком длинный ID", strings.Repeat("a", requestinfo.MaxRequestIDLength+1), "", false, ""},
+		{"ID максимальной длины", strings.Repeat("a", requestinfo.MaxRequestIDLength), "", true, ""},
+		{"ID с пробелом", "req 1", "", false, ""},
+		{"слишком длинный инициатор", "req-2", strings.Repeat("a", 300), true, strings.Repeat("a", requestinfo.MaxActorLength)},
+		// 128 двухбайтовых символов: обрезка проходит по границе символа
+		{"инициатор не в ASCII", "req-3", strings.Repeat("я", 128), true, strings.Repeat("я", 127)},
+		{"некорректный UTF-8", "req-4", "ali\xffce", true, "alice"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(headerRequestID, tt.requestID)
+		req.Header.Set(headerActor, tt.actor)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if tt.keepID && got.RequestID != tt.requestID {
+			t.Errorf("%s: ID запроса %q заменен на %q", tt.name, tt.requestID, got.RequestID)
+		}
+		if !tt.keepID && (got.RequestID == tt.requestID || !requestinfo.ValidRequestID(got.RequestID)) {
+			t.Errorf("%s: ожидался сгенерированный ID запроса, получен %q", tt.name, got.RequestID)
+		}
+		if rec.Header().Get(headerRequestID) != got.RequestID {
+			t.Errorf("%s: в ответе ID запроса %q, в контексте %q", tt.name, rec.Header().Get(headerRequestID), got.RequestID)
+		}
+		if got.Actor != tt.wantActor {
+			t.Errorf("%s: получен инициатор %q (%d байт), ожидался %q", tt.name, got.Actor, len(got.Actor), tt.wantActor)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package handler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// authorizePageSource - страница входа провайдера OpenID Connect
+//
+//go:embed pages/authorize.html
+var authorizePageSource string
+
+// authorizePage - шаблон страницы входа
+var authorizePage = template.Must(template.New("authorize").Parse(authorizePageSource))
+
+// authorizeParams - параметры запроса авторизации, которые страница входа передает в POST /oauth2/authorize
+var authorizeParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "nonce",
+	"code_challenge", "code_challenge_method"}
+
+// authorizePageData - данные шаблона страницы входа
+type authorizePageData struct {
+	ClientName string           // Название клиента
+	Error      string           // Сообщение об ошибке предыдущей попытки
+	Email      string           // Введенная электронная почта
+	MFAToken   string           // Токен второго шага (непусто - страница запрашивает код)
+	Params     []authorizeParam // Скрытые параметры запроса авторизации
+}
+
+// authorizeParam - скрытое поле формы входа
+type authorizeParam struct {
+	Name  string
+	Value string
+}
+
+// OIDCHandler обрабатывает HTTP запросы провайдера OpenID Connect и управления его клиентами
+type OIDCHandler struct {
+	service *service.OIDCService // Сервис провайдера OpenID Connect
+	logger  *log.Logger          // Логгер для записи информации о запросах
+}
+
+// NewOIDCHandler создает новый обработчик провайдера OpenID Connect
+// service - сервис провайдера
+// logger - логгер для записи событий
+func NewOIDCHandler(service *service.OIDCService, logger *log.Logger) *OIDCHandler {
+	return &OIDCHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes регистрирует публичные маршруты провайдера
+// Арендатор определяется по идентификатору клиента или токену, поэтому маршруты не требуют заголовка арендатора
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *OIDCHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/.well-known/openid-configuration", h.GetDiscovery).Methods(http.MethodGet) // GET /.well-known/openid-configuration - документ обнаружения
+	r.HandleFunc("/oauth2/jwks", h.GetJWKS).Methods(http.MethodGet)                           // GET /oauth2/jwks - открытые ключи подписи
+	r.HandleFunc("/oauth2/authorize", h.GetAuthorize).Methods(http.MethodGet)                 // GET /oauth2/authorize - страница входа
+	r.HandleFunc("/oauth2/authorize", h.PostAuthorize).Methods(http.MethodPost)               // POST /oauth2/authorize - вход и выдача кода
+	r.HandleFunc("/oauth2/token", h.Token).Methods(http.MethodPost)                           // POST /oauth2/token - обмен кода на токены
+	r.HandleFunc("/oauth2/userinfo", h.UserInfo).Methods(http.MethodGet, http.MethodPost)     // GET, POST /oauth2/userinfo - сведения о пользователе
+}
+
+// RegisterClientRoutes регистрирует маршруты управления клиентами, выполняемые в пределах арендатора
+// Маршруты доступны только администратору арендатора по токену доступа
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *OIDCHandler) RegisterClientRoutes(r *mux.Router) {
+	r.HandleFunc("/oauth2/clients", h.GetClients).Methods(http.MethodGet)           // GET /oauth2/clients - зарегистрированные клиенты
+	r.HandleFunc("/oauth2/clients", h.CreateClient).Methods(http.MethodPost)        // POST /oauth2/clients - зарегистрировать клиента
+	r.HandleFunc("/oauth2/clients/{id}", h.DeleteClient).Methods(http.MethodDelete) // DELETE /oauth2/clients/{id} - удалить клиента
+}
+
+// GetDiscovery обрабатывает GET /.well-known/openid-configuration
+func (h *OIDCHandler) GetDiscovery(w http.ResponseWriter, r *http.Request) {
+	discovery, err := h.service.Discovery()
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения документа обнаружения", "Не удалось получить документ обнаружения")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, discovery)
+}
+
+// GetJWKS обрабатывает GET /oauth2/jwks
+// Возвращает открытые ключи, включая замененные ключи, которыми подписаны еще действующие токены
+func (h *OIDCHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	jwks, err := h.service.JWKS(r.Context())
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения ключей подписи", "Не удалось получить ключи подписи")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, jwks)
+}
+
+// GetAuthorize обрабатывает GET /oauth2/authorize
+// Проверяет запрос авторизации и показывает страницу входа
+// Ошибки клиента и адреса возврата показываются пользователю, остальные ошибки передаются клиенту через адрес возврата
+func (h *OIDCHandler) GetAuthorize(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizationRequest(r.URL.Query())
+	client, err := h.service.CheckAuthorization(r.Context(), req)
+	if err != nil {
+		h.respondWithAuthorizeError(w, r, req, err)
+		return
+	}
+
+	h.renderAuthorizePage(w, http.StatusOK, client.Name, req, authorizePageData{})
+}
+
+// PostAuthorize обрабатывает POST /oauth2/authorize
+// Выполняет вход по форме страницы входа и перенаправляет пользователя на адрес возврата с кодом авторизации
+// Если у пользователя включена двухфакторная аутентификация, показывает страницу ввода кода
+func (h *OIDCHandler) PostAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+	req := parseAuthorizationRequest(r.PostForm)
+	client, err := h.service.CheckAuthorization(r.Context(), req)
+	if err != nil {
+		h.respondWithAuthorizeError(w, r, req, err)
+		return
+	}
+
+	login := model.LoginRequest{Email: r.PostForm.Get("email"), Password: r.PostForm.Get("password")}
+	mfa := model.MFALoginRequest{
+		MFAToken:     r.PostForm.Get("mfa_token"),
+		Code:         strings.TrimSpace(r.PostForm.Get("code")),
+		RecoveryCode: strings.TrimSpace(r.PostForm.Get("recovery_code")),
+	}
+	redirectURL, challenge, err := h.service.Authorize(r.Context(), req, login, mfa)
+	if err != nil {
+		page := authorizePageData{Email: login.Email}
+		var throttled *service.LoginThrottledError
+		status := http.StatusUnauthorized
+		switch {
+		case errors.As(err, &throttled):
+			w.Header().Set("Retry-After", strconv.Itoa(int((throttled.RetryAfter+time.Second-1)/time.Second)))
+			status, page.Error = http.StatusTooManyRequests, "Слишком много неудачных попыток входа, повторите позже"
+		case errors.Is(err, service.ErrInvalidCredentials):
+			page.Error = "Неверная электронная почта или пароль"
+		case errors.Is(err, service.ErrInvalidMFAToken):
+			page.Error = "Время на ввод кода истекло, войдите снова"
+		case errors.Is(err, service.ErrInvalidMFACode):
+			page.Error, page.MFAToken = "Неверный код двухфакторной аутентификации", mfa.MFAToken
+		case errors.Is(err, service.ErrAccountInactive):
+			status, page.Error = http.StatusForbidden, "Учетная запись не активна"
+		case errors.Is(err, service.ErrInvalidInput):
+			status, page.Error, page.MFAToken = http.StatusBadRequest, "Заполните все поля формы", mfa.MFAToken
+		default:
+			h.respondWithAuthorizeError(w, r, req, err)
+			return
+		}
+		h.renderAuthorizePage(w, status, client.Name, req, page)
+		return
+	}
+	if challenge != nil {
+		h.renderAuthorizePage(w, http.StatusOK, client.Name, req,
+			authorizePageData{Email: login.Email, MFAToken: challenge.MFAToken})
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+// Token обрабатывает POST /oauth2/token
+// Обменивает код авторизации на токен доступа и ID-токен
+// Клиент передает секрет в заголовке Authorization: Basic или в теле формы; ошибки возвращаются в формате RFC 6749
+func (h *OIDCHandler) Token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "некорректное тело запроса")
+		return
+	}
+	req := model.OIDCTokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	}
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		// Идентификатор и секрет в заголовке Basic кодируются как application/x-www-form-urlencoded (RFC 6749, 2.3.1)
+		var errID, errSecret error
+		req.ClientID, errID = url.QueryUnescape(clientID)
+		req.ClientSecret, errSecret = url.QueryUnescape(clientSecret)
+		if errID != nil || errSecret != nil {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "некорректный заголовок Authorization")
+			return
+		}
+	}
+
+	tokens, err := h.service.Exchange(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidClient):
+			if basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+			}
+			respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "неверный идентификатор или секрет клиента")
+		case errors.Is(err, service.ErrInvalidGrant):
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant",
+				"код авторизации неверный, истек, уже использован или не соответствует code_verifier")
+		case errors.Is(err, service.ErrUnsupportedGrantType):
+			respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type",
+				"поддерживается только grant_type=authorization_code")
+		case errors.Is(err, service.ErrInvalidInput):
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "не переданы code или client_id")
+		case errors.Is(err, service.ErrOIDCDisabled):
+			respondWithOAuthError(w, http.StatusNotImplemented, "server_error", "провайдер OpenID Connect не настроен")
+		default:
+			h.logger.Printf("Ошибка выдачи токенов OpenID Connect: %v", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// UserInfo обрабатывает GET и POST /oauth2/userinfo
+// Возвращает утверждения о пользователе по токену доступа из заголовка Authorization: Bearer
+func (h *OIDCHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth2"`)
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_request", "требуется токен доступа")
+		return
+	}
+
+	claims, err := h.service.UserInfo(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAccessToken):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="oauth2", error="invalid_token"`)
+			respondWithOAuthError(w, http.StatusUnauthorized, "invalid_token", "токен доступа неверный или истек")
+		case errors.Is(err, service.ErrOIDCDisabled):
+			respondWithOAuthError(w, http.StatusNotImplemented, "server_error", "провайдер OpenID Connect не настроен")
+		default:
+			h.logger.Printf("Ошибка получения сведений о пользователе OpenID Connect: %v", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, claims)
+}
+
+// GetClients обрабатывает GET /oauth2/clients
+// Возвращает страницу клиентов арендатора без секретов, общее количество передается в заголовке X-Total-Count
+func (h *OIDCHandler) GetClients(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры пагинации", http.StatusBadRequest)
+		return
+	}
+
+	clients, total, err := h.service.ListClients(r.Context(), limit, offset)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения клиентов OpenID Connect", "Не удалось получить клиентов")
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+// CreateClient обрабатывает POST /oauth2/clients
+// Регистрирует клиента; секрет конфиденциального клиента возвращается только в этом ответе
+func (h *OIDCHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var create model.OIDCClientCreate
+	if err := json.NewDecoder(r.Body).Decode(&create); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.service.CreateClient(r.Context(), create)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка регистрации клиента OpenID Connect", "Не удалось зарегистрировать клиента")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// DeleteClient обрабатывает DELETE /oauth2/clients/{id}
+func (h *OIDCHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID клиента", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteClient(r.Context(), id); err != nil {
+		h.respondWithError(w, err, "Ошибка удаления клиента OpenID Connect", "Не удалось удалить клиента")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// renderAuthorizePage показывает страницу входа с параметрами запроса авторизации в скрытых полях
+func (h *OIDCHandler) renderAuthorizePage(w http.ResponseWriter, status int, clientName string,
+	req model.OIDCAuthorizationRequest, page authorizePageData) {
+	page.ClientName = clientName
+	values := authorizationRequestValues(req)
+	for _, name := range authorizeParams {
+		if value := values.Get(name); value != "" {
+			page.Params = append(page.Params, authorizeParam{Name: name, Value: value})
+		}
+	}
+
+	// Страницу входа нельзя встраивать в чужие страницы и кэшировать
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := authorizePage.Execute(w, page); err != nil {
+		h.logger.Printf("Ошибка отображения страницы входа: %v", err)
+	}
+}
+
+// respondWithAuthorizeError отвечает на ошибку запроса авторизации
+// Ошибки протокола передаются клиенту через адрес возврата, остальные показываются пользователю
+func (h *OIDCHandler) respondWithAuthorizeError(w http.ResponseWriter, r *http.Request,
+	req model.OIDCAuthorizationRequest, err error) {
+	var authErr *service.OIDCAuthorizationError
+	switch {
+	case errors.As(err, &authErr):
+		http.Redirect(w, r, h.service.ErrorRedirect(req, authErr), http.StatusFound)
+	case errors.Is(err, service.ErrOIDCClientNotFound):
+		http.Error(w, "Приложение не зарегистрировано", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidRedirectURI):
+		http.Error(w, "Адрес возврата не зарегистрирован для приложения", http.StatusBadRequest)
+	case errors.Is(err, service.ErrLoginDisabled), errors.Is(err, service.ErrMFADisabled):
+		http.Error(w, "Вход по паролю не настроен", http.StatusNotImplemented)
+	default:
+		h.respondWithError(w, err, "Ошибка авторизации OpenID Connect", "Не удалось выполнить вход")
+	}
+}
+
+// respondWithError преобразует ошибку сервиса в HTTP ответ
+// Неизвестные ошибки записываются в лог с logMessage, клиент получает userMessage
+func (h *OIDCHandler) respondWithError(w http.ResponseWriter, err error, logMessage, userMessage string) {
+	switch {
+	case errors.Is(err, service.ErrOIDCClientNotFound):
+		http.Error(w, "Клиент не найден", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidInput):
+		http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+	case errors.Is(err, service.ErrOIDCDisabled):
+		http.Error(w, "Провайдер OpenID Connect не настроен", http.StatusNotImplemented)
+	default:
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, userMessage, http.StatusInternalServerError)
+	}
+}
+
+// respondWithOAuthError отправляет ошибку в формате RFC 6749
+func respondWithOAuthError(w http.ResponseWriter, status int, code, description string) {
+	respondWithJSON(w, status, model.OAuthError{Error: code, Description: description})
+}
+
+// parseAuthorizationRequest читает параметры запроса авторизации из строки запроса или формы
+func parseAuthorizationRequest(values url.Values) model.OIDCAuthorizationRequest {
+	return model.OIDCAuthorizationRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		Nonce:               values.Get("nonce"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+// authorizationRequestValues возвращает параметры запроса авторизации в виде url.Values
+func authorizationRequestValues(req model.OIDCAuthorizationRequest) url.Values {
+	return url.Values{
+		"response_type":         {req.ResponseType},
+		"client_id":             {req.ClientID},
+		"redirect_uri":          {req.RedirectURI},
+		"scope":                 {req.Scope},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {req.CodeChallenge},
+		"code_challenge_method": {req.CodeChallengeMethod},
+	}
+}
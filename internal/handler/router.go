@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"github.com/gorilla/mux"
+)
+
+// Handlers - обработчики всех HTTP маршрутов сервиса
+type Handlers struct {
+	User       *UserHandler
+	Group      *GroupHandler
+	Invitation *InvitationHandler
+	Auth       *AuthHandler
+	Identity   *IdentityHandler
+	APIKey     *APIKeyHandler
+	OIDC       *OIDCHandler
+	Webhook    *WebhookHandler
+	Docs       *DocsHandler
+}
+
+// NewRouter создает маршрутизатор со всеми маршрутами сервиса
+// Маршруты пользователей, групп, приглашений, ключей API, клиентов OpenID Connect и подписок на вебхуки
+// выполняются в пределах арендатора и требуют ключа API или токена доступа, поэтому вынесены в отдельный
+// маршрутизатор со своим middleware (ключ API и токен определяют арендатора раньше заголовка); вход
+// выполняется в пределах арендатора без учетных данных; документация общая для всех арендаторов, а принятие
+// приглашения, публичные маршруты OpenID Connect и возврат от внешнего поставщика определяют арендатора
+// по токену, клиенту или параметру state и регистрируются раньше маршрутов арендатора
+// h - обработчики маршрутов
+// auth - middleware проверки ключа API или токена доступа (nil - без проверки, только для тестов)
+// tenant - middleware определения арендатора (nil - разделение по арендаторам выключено)
+func NewRouter(h Handlers, auth, tenant mux.MiddlewareFunc) *mux.Router {
+	router := mux.NewRouter()
+	h.Invitation.RegisterAcceptRoute(router)
+	h.OIDC.RegisterRoutes(router)
+	h.Identity.RegisterCallbackRoute(router)
+
+	loginRouter := router.NewRoute().Subrouter()
+	h.Auth.RegisterLoginRoutes(loginRouter)
+	h.Identity.RegisterLoginRoutes(loginRouter)
+
+	userRouter := router.NewRoute().Subrouter()
+	h.User.RegisterRoutes(userRouter)
+	h.Group.RegisterRoutes(userRouter)
+	h.Invitation.RegisterRoutes(userRouter)
+	h.Auth.RegisterRoutes(userRouter)
+	h.Identity.RegisterRoutes(userRouter)
+	h.APIKey.RegisterRoutes(userRouter)
+	h.OIDC.RegisterClientRoutes(userRouter)
+	h.Webhook.RegisterRoutes(userRouter)
+	if auth != nil {
+		userRouter.Use(auth)
+	}
+	if tenant != nil {
+		loginRouter.Use(tenant)
+		userRouter.Use(tenant)
+	}
+
+	h.Docs.RegisterRoutes(router)
+	return router
+}
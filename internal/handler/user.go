@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/janson/usermicroservice/internal/model"
@@ -30,32 +34,67 @@ func NewUserHandler(service *service.UserService, logger *log.Logger) *UserHandl
 }
 
 // RegisterRoutes регистрирует все маршруты для работы с пользователями
+// Чтение доступно любому проверенному запросу, изменения - администратору арендатора и сервисам по ключу API;
+// свои данные и историю пользователь может изменять и читать сам
 // r - маршрутизатор, в который будут добавлены маршруты
 func (h *UserHandler) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/users", h.GetAllUsers).Methods(http.MethodGet)        // GET /users - получить всех пользователей
-	r.HandleFunc("/users/{id}", h.GetUser).Methods(http.MethodGet)       // GET /users/{id} - получить пользователя по ID
-	r.HandleFunc("/users", h.CreateUser).Methods(http.MethodPost)        // POST /users - создать нового пользователя
-	r.HandleFunc("/users/{id}", h.UpdateUser).Methods(http.MethodPut)    // PUT /users/{id} - обновить пользователя
-	r.HandleFunc("/users/{id}", h.DeleteUser).Methods(http.MethodDelete) // DELETE /users/{id} - удалить пользователя
+	r.HandleFunc("/users", h.GetAllUsers).Methods(http.MethodGet)                     // GET /users - получить всех пользователей
+	r.HandleFunc("/users/{id}", h.GetUser).Methods(http.MethodGet)                    // GET /users/{id} - получить пользователя по ID
+	r.HandleFunc("/users", h.CreateUser).Methods(http.MethodPost)                     // POST /users - создать нового пользователя
+	r.HandleFunc("/users/{id}", h.UpdateUser).Methods(http.MethodPut)                 // PUT /users/{id} - обновить пользователя
+	r.HandleFunc("/users/{id}", h.DeleteUser).Methods(http.MethodDelete)              // DELETE /users/{id} - удалить пользователя
+	r.HandleFunc("/users/{id}/history", h.GetUserHistory).Methods(http.MethodGet)     // GET /users/{id}/history - история изменений
+	r.HandleFunc("/users/{id}/suspend", h.SuspendUser).Methods(http.MethodPost)       // POST /users/{id}/suspend - приостановить учетную запись
+	r.HandleFunc("/users/{id}/reactivate", h.ReactivateUser).Methods(http.MethodPost) // POST /users/{id}/reactivate - активировать учетную запись
 }
 
 // GetAllUsers обрабатывает GET /users
-// Возвращает список всех пользователей
+// Без параметров limit и offset возвращает всех пользователей, с ними - страницу списка
+// Параметр updated_since (RFC 3339) оставляет только пользователей, измененных начиная с указанного момента,
+// sort задает порядок сортировки: id (по умолчанию) или updated_at
+// Параметры metadata.<ключ>=<значение> оставляют пользователей с указанным значением ключа метаданных,
+// has_metadata=<ключ> - пользователей, у которых ключ задан, status - пользователей в указанном состоянии
+// Общее количество подходящих пользователей передается в заголовке X-Total-Count
+// Поддерживает условный запрос с If-None-Match
 func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	h.logger.Printf("Обработка запроса: %s %s", r.Method, r.URL.Path)
 
-	users, err := h.service.GetAll(r.Context())
+	var filter model.UserFilter
+	query := r.URL.Query()
+	if query.Has("limit") || query.Has("offset") {
+		limit, offset, err := parsePagination(r)
+		if err != nil {
+			http.Error(w, "Некорректные параметры пагинации", http.StatusBadRequest)
+			return
+		}
+		filter.Limit, filter.Offset = limit, offset
+	}
+
+	if err := parseUserListFilter(r, &filter); err != nil {
+		http.Error(w, "Некорректные параметры фильтрации", http.StatusBadRequest)
+		return
+	}
+
+	users, total, err := h.service.GetAll(r.Context(), filter)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			http.Error(w, "Некорректные параметры фильтрации", http.StatusBadRequest)
+			return
+		}
 		h.logger.Printf("Ошибка получения пользователей: %v", err)
 		http.Error(w, "Не удалось получить пользователей", http.StatusInternalServerError)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, users)
+	// Last-Modified для списка не передается: удаление пользователя не меняет время изменения остальных,
+	// поэтому актуальность списка проверяется только по ETag
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondConditional(w, r, users, time.Time{}, strconv.Itoa(total))
 }
 
 // GetUser обрабатывает GET /users/{id}
 // Возвращает пользователя с указанным ID
+// Поддерживает условные запросы с If-None-Match и If-Modified-Since
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	h.logger.Printf("Обработка запроса: %s %s", r.Method, r.URL.Path)
 
@@ -77,19 +116,27 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, user)
+	respondConditional(w, r, user, user.UpdatedAt)
 }
 
 // CreateUser обрабатывает POST /users
 // Создает нового пользователя
+// Создать администратора может только администратор арендатора по токену доступа
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	h.logger.Printf("Обработка запроса: %s %s", r.Method, r.URL.Path)
 
+	if !requireUserManager(w, r) {
+		return
+	}
+
 	var userCreate model.UserCreate
 	if err := json.NewDecoder(r.Body).Decode(&userCreate); err != nil {
 		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
 		return
 	}
+	if !requireRoleGrant(w, r, userCreate.Role) {
+		return
+	}
 
 	user, err := h.service.Create(r.Context(), userCreate)
 	if err != nil {
@@ -97,6 +144,10 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
 			return
 		}
+		if errors.Is(err, service.ErrEmailTaken) {
+			http.Error(w, "Электронная почта уже используется", http.StatusConflict)
+			return
+		}
 		h.logger.Printf("Ошибка создания пользователя: %v", err)
 		http.Error(w, "Не удалось создать пользователя", http.StatusInternalServerError)
 		return
@@ -107,6 +158,7 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 // UpdateUser обрабатывает PUT /users/{id}
 // Обновляет информацию о пользователе
+// Пользователь может изменить свои данные, кроме роли; роль администратора назначает только администратор
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	h.logger.Printf("Обработка запроса: %s %s", r.Method, r.URL.Path)
 
@@ -116,12 +168,18 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
 		return
 	}
+	if !requireSelfOrUserManager(w, r, id) {
+		return
+	}
 
 	var userUpdate model.UserUpdate
 	if err := json.NewDecoder(r.Body).Decode(&userUpdate); err != nil {
 		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
 		return
 	}
+	if !requireRoleGrant(w, r, userUpdate.Role) {
+		return
+	}
 
 	user, err := h.service.Update(r.Context(), id, userUpdate)
 	if err != nil {
@@ -133,6 +191,10 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
 			return
 		}
+		if errors.Is(err, service.ErrEmailTaken) {
+			http.Error(w, "Электронная почта уже используется", http.StatusConflict)
+			return
+		}
 		h.logger.Printf("Ошибка обновления пользователя: %v", err)
 		http.Error(w, "Не удалось обновить пользователя", http.StatusInternalServerError)
 		return
@@ -152,6 +214,9 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
 		return
 	}
+	if !requireUserManager(w, r) {
+		return
+	}
 
 	err = h.service.Delete(r.Context(), id)
 	if err != nil {
@@ -167,8 +232,172 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// SuspendUser обрабатывает POST /users/{id}/suspend
+// Приостанавливает активную учетную запись, причина из тела запроса записывается в журнал аудита
+func (h *UserHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUserStatus(w, r, h.service.Suspend, "Ошибка приостановки пользователя", "Не удалось приостановить пользователя")
+}
+
+// ReactivateUser обрабатывает POST /users/{id}/reactivate
+// Активирует ожидающую активации, приостановленную или заблокированную учетную запись
+func (h *UserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUserStatus(w, r, h.service.Reactivate, "Ошибка активации пользователя", "Не удалось активировать пользователя")
+}
+
+// changeUserStatus выполняет перевод учетной записи в другое состояние
+// Тело запроса с причиной необязательно
+func (h *UserHandler) changeUserStatus(w http.ResponseWriter, r *http.Request,
+	change func(ctx context.Context, id int64, reason string) (*model.User, error), logMessage, userMessage string) {
+	h.logger.Printf("Обработка запроса: %s %s", r.Method, r.URL.Path)
+
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		h.logger.Printf("Ошибка разбора ID пользователя: %v", err)
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	if !requireUserManager(w, r) {
+		return
+	}
+
+	var body model.UserStatusChange
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	user, err := change(r.Context(), id, body.Reason)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			http.Error(w, "Пользователь не найден", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInput) {
+			http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidStatusTransition) {
+			http.Error(w, "Недопустимое изменение состояния учетной записи", http.StatusConflict)
+			return
+		}
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, userMessage, http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// GetUserHistory обрабатывает GET /users/{id}/history
+// Возвращает страницу журнала аудита пользователя, общее количество записей передается в заголовке X-Total-Count
+func (h *UserHandler) GetUserHistory(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("Обработка запроса: %s %s", r.Method, r.URL.Path)
+
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		h.logger.Printf("Ошибка разбора ID пользователя: %v", err)
+		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		return
+	}
+	if !requireSelfOrUserManager(w, r, id) {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, "Некорректные параметры пагинации", http.StatusBadRequest)
+		return
+	}
+
+	entries, total, err := h.service.History(r.Context(), id, limit, offset)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			http.Error(w, "Пользователь не найден", http.StatusNotFound)
+			return
+		}
+		h.logger.Printf("Ошибка получения истории пользователя: %v", err)
+		http.Error(w, "Не удалось получить историю пользователя", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	respondWithJSON(w, http.StatusOK, entries)
+}
+
 // Вспомогательные функции
 
+// Параметры постраничной выборки по умолчанию
+const (
+	defaultPageLimit = 50  // Размер страницы, если limit не указан
+	maxPageLimit     = 100 // Максимально допустимый размер страницы
+)
+
+// metadataParamPrefix - префикс параметров строки запроса, фильтрующих список по значениям метаданных
+const metadataParamPrefix = "metadata."
+
+// parsePagination извлекает параметры limit и offset из строки запроса
+func parsePagination(r *http.Request) (int, int, error) {
+	limit, offset := defaultPageLimit, 0
+	query := r.URL.Query()
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			return 0, 0, errors.New("некорректный параметр limit")
+		}
+		limit = parsed
+	}
+
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("некорректный параметр offset")
+		}
+		offset = parsed
+	}
+
+	return limit, offset, nil
+}
+
+// parseUserListFilter извлекает параметры фильтрации и сортировки списка пользователей из строки запроса
+func parseUserListFilter(r *http.Request, filter *model.UserFilter) error {
+	query := r.URL.Query()
+
+	if value := query.Get("updated_since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return errors.New("некорректный параметр updated_since")
+		}
+		filter.UpdatedSince = parsed
+	}
+
+	filter.Sort = query.Get("sort")
+	switch filter.Sort {
+	case "", model.UserSortID, model.UserSortUpdatedAt:
+	default:
+		return errors.New("некорректный параметр sort")
+	}
+
+	for name, values := range query {
+		key, ok := strings.CutPrefix(name, metadataParamPrefix)
+		if !ok {
+			continue
+		}
+		if filter.Metadata == nil {
+			filter.Metadata = make(map[string]string)
+		}
+		filter.Metadata[key] = values[0]
+	}
+	filter.MetadataKeys = query["has_metadata"]
+
+	filter.Status = query.Get("status")
+	if filter.Status != "" && !model.ValidUserStatus(filter.Status) {
+		return errors.New("некорректный параметр status")
+	}
+
+	return nil
+}
+
 // parseIDFromRequest извлекает ID пользователя из параметров запроса
 func parseIDFromRequest(r *http.Request) (int64, error) {
 	vars := mux.Vars(r)
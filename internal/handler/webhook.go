@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// WebhookHandler обрабатывает HTTP запросы для управления подписками на вебхуки
+type WebhookHandler struct {
+	service *service.WebhookService // Сервис подписок на вебхуки
+	logger  *log.Logger             // Логгер для записи информации о запросах
+}
+
+// NewWebhookHandler создает новый обработчик подписок на вебхуки
+// service - сервис подписок
+// logger - логгер для записи событий
+func NewWebhookHandler(service *service.WebhookService, logger *log.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes регистрирует маршруты для работы с подписками на вебхуки
+// Подписки относятся к арендатору запроса и доступны только администратору арендатора по токену доступа
+// r - маршрутизатор, в который будут добавлены маршруты
+func (h *WebhookHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/webhooks", h.GetAllWebhooks).Methods(http.MethodGet)                       // GET /webhooks - получить все подписки
+	r.HandleFunc("/webhooks/{id}", h.GetWebhook).Methods(http.MethodGet)                      // GET /webhooks/{id} - получить подписку по ID
+	r.HandleFunc("/webhooks", h.CreateWebhook).Methods(http.MethodPost)                       // POST /webhooks - создать подписку
+	r.HandleFunc("/webhooks/{id}", h.UpdateWebhook).Methods(http.MethodPut)                   // PUT /webhooks/{id} - обновить подписку
+	r.HandleFunc("/webhooks/{id}", h.DeleteWebhook).Methods(http.MethodDelete)                // DELETE /webhooks/{id} - удалить подписку
+	r.HandleFunc("/webhooks/{id}/deliveries", h.GetWebhookDeliveries).Methods(http.MethodGet) // GET /webhooks/{id}/deliveries - журнал доставок
+}
+
+// GetAllWebhooks обрабатывает GET /webhooks
+// Возвращает список подписок арендатора без секретов
+func (h *WebhookHandler) GetAllWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	subs, err := h.service.GetAll(r.Context())
+	if err != nil {
+		h.logger.Printf("Ошибка получения подписок: %v", err)
+		http.Error(w, "Не удалось получить подписки", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	respondWithJSON(w, http.StatusOK, subs)
+}
+
+// GetWebhook обрабатывает GET /webhooks/{id}
+// Возвращает подписку с указанным ID без секрета
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID подписки", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.service.GetByID(r.Context(), id)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения подписки", "Не удалось получить подписку")
+		return
+	}
+
+	sub.Secret = ""
+	respondWithJSON(w, http.StatusOK, sub)
+}
+
+// CreateWebhook обрабатывает POST /webhooks
+// Создает подписку и возвращает ее вместе с секретом
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var create model.WebhookSubscriptionCreate
+	if err := json.NewDecoder(r.Body).Decode(&create); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.service.Create(r.Context(), create)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка создания подписки", "Не удалось создать подписку")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, sub)
+}
+
+// UpdateWebhook обрабатывает PUT /webhooks/{id}
+// Обновляет подписку; передача "active": true включает автоматически отключенную подписку
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID подписки", http.StatusBadRequest)
+		return
+	}
+
+	var update model.WebhookSubscriptionUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.service.Update(r.Context(), id, update)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка обновления подписки", "Не удалось обновить подписку")
+		return
+	}
+
+	sub.Secret = ""
+	respondWithJSON(w, http.StatusOK, sub)
+}
+
+// DeleteWebhook обрабатывает DELETE /webhooks/{id}
+// Удаляет подписку вместе с журналом доставок
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID подписки", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id); err != nil {
+		h.respondWithError(w, err, "Ошибка удаления подписки", "Не удалось удалить подписку")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries обрабатывает GET /webhooks/{id}/deliveries
+// Возвращает последние попытки доставки по подписке
+func (h *WebhookHandler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Некорректный ID подписки", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.service.Deliveries(r.Context(), id)
+	if err != nil {
+		h.respondWithError(w, err, "Ошибка получения журнала доставок", "Не удалось получить журнал доставок")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, deliveries)
+}
+
+// respondWithError преобразует ошибку сервиса в HTTP ответ
+// logMessage - префикс для записи неожиданной ошибки в лог
+// userMessage - текст ответа клиенту при внутренней ошибке
+func (h *WebhookHandler) respondWithError(w http.ResponseWriter, err error, logMessage, userMessage string) {
+	switch {
+	case errors.Is(err, service.ErrWebhookNotFound):
+		http.Error(w, "Подписка не найдена", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidInput):
+		http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+	default:
+		h.logger.Printf("%s: %v", logMessage, err)
+		http.Error(w, userMessage, http.StatusInternalServerError)
+	}
+}
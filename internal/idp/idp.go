@@ -0,0 +1,64 @@
+// Package idp выполняет вход через внешних поставщиков удостоверений (например, корпоративных)
+// Поставщик показывает пользователю свою страницу входа и после возврата пользователя
+// подтверждает его удостоверение; тип поставщика выбирается в конфигурации
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+)
+
+// httpTimeout - таймаут запросов к поставщику, если HTTP клиент не передан
+const httpTimeout = 10 * time.Second
+
+// Identity - удостоверение пользователя, подтвержденное поставщиком
+type Identity struct {
+	Subject       string // Идентификатор пользователя у поставщика
+	Email         string // Электронная почта
+	EmailVerified bool   // Поставщик подтвердил электронную почту
+	Name          string // Имя пользователя
+}
+
+// AuthRequest содержит параметры перенаправления пользователя к поставщику
+type AuthRequest struct {
+	State         string // Значение, которое поставщик вернет без изменений
+	Nonce         string // Значение для проверки ID-токена
+	CodeChallenge string // PKCE code_challenge (S256)
+}
+
+// Provider - внешний поставщик удостоверений
+// Реализация должна вернуть удостоверение только после проверки ответа поставщика
+type Provider interface {
+	// AuthURL возвращает адрес страницы входа поставщика
+	AuthURL(ctx context.Context, req AuthRequest) (string, error)
+	// Exchange обменивает код из адреса возврата на подтвержденное удостоверение
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+// Ошибки входа через поставщика
+var (
+	ErrUnknownType     = errors.New("unknown identity provider type")          // В конфигурации указан неизвестный тип поставщика
+	ErrProviderFailure = errors.New("identity provider request failed")        // Поставщик недоступен или вернул ошибку
+	ErrInvalidIDToken  = errors.New("invalid id token from identity provider") // ID-токен не прошел проверку
+)
+
+// New создает поставщика по настройкам из конфигурации
+// cfg - настройки поставщика
+// client - HTTP клиент для запросов к поставщику (nil - клиент с таймаутом 10 секунд)
+func New(cfg config.IdentityProviderConfig, client *http.Client) (Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+
+	switch cfg.Type {
+	case "", "oidc":
+		return NewOIDCProvider(cfg, client), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, cfg.Type)
+	}
+}
@@ -0,0 +1,93 @@
+// Package idptest содержит локального поставщика OpenID Connect для тестов входа через внешних поставщиков
+package idptest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// Учетные данные клиента, которые принимает Issuer
+const (
+	ClientID     = "client"
+	ClientSecret = "secret"
+)
+
+// Issuer - локальный поставщик OpenID Connect, выдающий на обмен кода ID-токен с заданными утверждениями
+// Поля можно менять между обменами кода, чтобы проверить отклонение токенов
+type Issuer struct {
+	Server *httptest.Server // HTTP сервер поставщика, его URL - издатель токенов
+	Key    *rsa.PrivateKey  // Ключ подписи ID-токена (в JWKS публикуется ключ, созданный при запуске)
+	Claims jwt.MapClaims    // Утверждения ID-токена, выдаваемого на обмен кода
+	Form   url.Values       // Параметры последнего запроса на обмен кода
+}
+
+// NewIssuer запускает локального поставщика, который останавливается по завершении теста
+// Утверждения по умолчанию: sub ext-42, nonce n-1, подтвержденная почта ivan@example.com, имя Иван
+func NewIssuer(t *testing.T) *Issuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Ошибка создания ключа: %v", err)
+	}
+	m := &Issuer{Key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(model.OIDCDiscovery{
+			Issuer:                m.Server.URL,
+			AuthorizationEndpoint: m.Server.URL + "/authorize",
+			TokenEndpoint:         m.Server.URL + "/token",
+			JWKSURI:               m.Server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(model.JWKSet{Keys: []model.JWK{{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: "mock",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.Form = r.PostForm
+		if id, secret, _ := r.BasicAuth(); id != ClientID || secret != ClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(model.OAuthError{Error: "invalid_client"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.Claims)
+		token.Header["kid"] = "mock"
+		signed, _ := token.SignedString(m.Key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Server.Close)
+
+	m.Claims = jwt.MapClaims{
+		"iss":            m.Server.URL,
+		"aud":            ClientID,
+		"sub":            "ext-42",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          "n-1",
+		"email":          "ivan@example.com",
+		"email_verified": "true",
+		"name":           "Иван",
+	}
+	return m
+}
@@ -0,0 +1,272 @@
+package idp
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// maxResponseSize - максимальный размер ответа поставщика
+const maxResponseSize = 1 << 20
+
+// defaultScopes - области, запрашиваемые у поставщика, если они не заданы в конфигурации
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// OIDCProvider выполняет вход через поставщика OpenID Connect по потоку кода авторизации с PKCE (S256)
+// Адреса конечных точек читаются из документа обнаружения поставщика при первом входе,
+// открытые ключи перечитываются, если ID-токен подписан неизвестным ключом
+type OIDCProvider struct {
+	issuer       string           // Адрес издателя
+	clientID     string           // Идентификатор клиента
+	clientSecret string           // Секрет клиента (пусто - публичный клиент)
+	redirectURL  string           // Адрес возврата
+	scopes       []string         // Запрашиваемые области
+	client       *http.Client     // HTTP клиент для запросов к поставщику
+	now          func() time.Time // Текущее время (подменяется в тестах)
+
+	mu        sync.Mutex                // Защищает discovery и keys
+	discovery *model.OIDCDiscovery      // Документ обнаружения (nil - еще не прочитан)
+	keys      map[string]*rsa.PublicKey // Открытые ключи по идентификатору
+}
+
+// NewOIDCProvider создает поставщика OpenID Connect
+// cfg - настройки поставщика
+// client - HTTP клиент для запросов к поставщику
+func NewOIDCProvider(cfg config.IdentityProviderConfig, client *http.Client) *OIDCProvider {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+
+	return &OIDCProvider{
+		issuer:       cfg.Issuer,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		redirectURL:  cfg.RedirectURL,
+		scopes:       scopes,
+		client:       client,
+		now:          time.Now,
+	}
+}
+
+// AuthURL возвращает адрес страницы входа поставщика с параметрами запроса авторизации
+func (p *OIDCProvider) AuthURL(ctx context.Context, req AuthRequest) (string, error) {
+	d, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: некорректный authorization_endpoint: %v", ErrProviderFailure, err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", req.State)
+	query.Set("nonce", req.Nonce)
+	query.Set("code_challenge", req.CodeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Exchange обменивает код авторизации на ID-токен и возвращает удостоверение из проверенного токена
+// Проверяются подпись, издатель, получатель, срок действия и nonce
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	d, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", codeVerifier)
+	if p.clientSecret == "" {
+		form.Set("client_id", p.clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		// Идентификатор и секрет в заголовке Basic кодируются как application/x-www-form-urlencoded (RFC 6749, 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderFailure, err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		model.OAuthError
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("%w: ответ на обмен кода (%d): %v", ErrProviderFailure, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: обмен кода (%d): %s %s", ErrProviderFailure, resp.StatusCode, tokens.Error,
+			tokens.Description)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: в ответе нет id_token", ErrInvalidIDToken)
+	}
+
+	return p.verify(ctx, d, tokens.IDToken, nonce)
+}
+
+// verify проверяет ID-токен и извлекает из него удостоверение
+func (p *OIDCProvider) verify(ctx context.Context, d *model.OIDCDiscovery, idToken, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, d.JWKSURI, kid)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.clientID), jwt.WithExpirationRequired(), jwt.WithTimeFunc(p.now))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if value, _ := claims["nonce"].(string); value != nonce {
+		return nil, fmt.Errorf("%w: nonce не совпадает", ErrInvalidIDToken)
+	}
+	// Токен для нескольких получателей должен быть выдан этому клиенту (OpenID Connect Core, 3.1.3.7)
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.clientID {
+			return nil, fmt.Errorf("%w: azp не совпадает с идентификатором клиента", ErrInvalidIDToken)
+		}
+	}
+
+	identity := &Identity{}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: нет утверждения sub", ErrInvalidIDToken)
+	}
+	identity.Email, _ = claims["email"].(string)
+	// Некоторые поставщики передают email_verified строкой
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	identity.Name, _ = claims["name"].(string)
+	if identity.Name == "" {
+		identity.Name, _ = claims["preferred_username"].(string)
+	}
+
+	return identity, nil
+}
+
+// metadata возвращает документ обнаружения поставщика, читая его при первом обращении
+func (p *OIDCProvider) metadata(ctx context.Context) (*model.OIDCDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d model.OIDCDiscovery
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+	if d.Issuer != p.issuer {
+		return nil, fmt.Errorf("%w: издатель в документе обнаружения %q не совпадает с %q", ErrProviderFailure,
+			d.Issuer, p.issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: в документе обнаружения нет адресов конечных точек", ErrProviderFailure)
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key возвращает открытый ключ по идентификатору, перечитывая ключи поставщика, если ключ неизвестен
+// Если у токена нет идентификатора ключа, используется единственный ключ поставщика
+func (p *OIDCProvider) key(ctx context.Context, jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := findKey(p.keys, kid); key != nil {
+		return key, nil
+	}
+
+	var set model.JWKSet
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+
+	if key := findKey(p.keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("неизвестный ключ подписи %q", kid)
+}
+
+// findKey ищет ключ по идентификатору
+func findKey(keys map[string]*rsa.PublicKey, kid string) *rsa.PublicKey {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return keys[kid]
+}
+
+// getJSON выполняет GET запрос к поставщику и разбирает ответ JSON
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrProviderFailure, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: GET %s: %s", ErrProviderFailure, url, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("%w: GET %s: %v", ErrProviderFailure, url, err)
+	}
+	return nil
+}
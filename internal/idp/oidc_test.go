@@ -0,0 +1,60 @@
+package idp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/idp/idptest"
+)
+
+// TestOIDCProviderExchange проверяет вход через локального поставщика и отклонение ID-токенов,
+// не прошедших проверку
+func TestOIDCProviderExchange(t *testing.T) {
+	m := idptest.NewIssuer(t)
+	p := NewOIDCProvider(config.IdentityProviderConfig{Issuer: m.Server.URL, ClientID: idptest.ClientID,
+		ClientSecret: idptest.ClientSecret, RedirectURL: "https://app.example.com/callback"}, m.Server.Client())
+	ctx := context.Background()
+
+	authURL, err := p.AuthURL(ctx, AuthRequest{State: "s-1", Nonce: "n-1", CodeChallenge: "c-1"})
+	if err != nil {
+		t.Fatalf("Ошибка получения адреса входа: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	if u.Path != "/authorize" || u.Query().Get("state") != "s-1" || u.Query().Get("code_challenge_method") != "S256" ||
+		u.Query().Get("scope") != "openid email profile" {
+		t.Errorf("Неожиданный адрес входа: %s", authURL)
+	}
+
+	identity, err := p.Exchange(ctx, "code-1", "verifier-1", "n-1")
+	if err != nil {
+		t.Fatalf("Ошибка обмена кода: %v", err)
+	}
+	if identity.Subject != "ext-42" || identity.Email != "ivan@example.com" || !identity.EmailVerified ||
+		identity.Name != "Иван" {
+		t.Errorf("Неожиданное удостоверение: %+v", identity)
+	}
+	if m.Form.Get("code") != "code-1" || m.Form.Get("code_verifier") != "verifier-1" {
+		t.Errorf("Неожиданные параметры обмена кода: %v", m.Form)
+	}
+
+	if _, err := p.Exchange(ctx, "code-1", "verifier-1", "n-2"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Токен с другим nonce должен отклоняться, получено: %v", err)
+	}
+
+	m.Claims["aud"] = "other"
+	if _, err := p.Exchange(ctx, "code-1", "verifier-1", "n-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Токен для другого клиента должен отклоняться, получено: %v", err)
+	}
+	m.Claims["aud"] = "client"
+
+	// Токен, подписанный другим ключом с тем же kid, не проходит проверку подписи
+	m.Key, _ = rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := p.Exchange(ctx, "code-1", "verifier-1", "n-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Токен с чужой подписью должен отклоняться, получено: %v", err)
+	}
+}
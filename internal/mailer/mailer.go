@@ -0,0 +1,130 @@
+// Package mailer отправляет письма пользователям (например, приглашения)
+// Способ отправки выбирается в конфигурации: запись в лог для разработки или SMTP сервер
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+)
+
+// Message - письмо с текстом без разметки
+type Message struct {
+	To      string // Адрес получателя
+	Subject string // Тема письма
+	Body    string // Текст письма
+}
+
+// Mailer отправляет письма
+// Реализация должна вернуть ошибку, если письмо не принято для доставки
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Ошибки отправки писем
+var (
+	ErrUnknownBackend = errors.New("unknown mailer backend") // В конфигурации указан неизвестный способ отправки
+	ErrInvalidHeader  = errors.New("invalid message header") // Адрес или тема содержат перевод строки
+)
+
+// New создает отправителя писем по настройкам из конфигурации
+// cfg - настройки отправки писем
+// logger - логгер для способа log
+func New(cfg config.MailerConfig, logger *log.Logger) (Mailer, error) {
+	switch cfg.Backend {
+	case "", "log":
+		return NewLogMailer(logger), nil
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, cfg.Backend)
+	}
+}
+
+// LogMailer записывает письма в лог вместо отправки
+// Предназначен для локальной разработки и тестирования
+type LogMailer struct {
+	logger *log.Logger // Логгер, в который записываются письма
+}
+
+// NewLogMailer создает отправителя, записывающего письма в лог
+// logger - логгер для записи писем
+func NewLogMailer(logger *log.Logger) *LogMailer {
+	return &LogMailer{
+		logger: logger,
+	}
+}
+
+// Send записывает письмо в лог
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.Printf("Письмо для %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer отправляет письма через SMTP сервер
+// Если сервер поддерживает STARTTLS, соединение шифруется (см. smtp.SendMail)
+type SMTPMailer struct {
+	addr string    // Адрес SMTP сервера в виде host:port
+	auth smtp.Auth // Аутентификация PLAIN (nil - без аутентификации)
+	from string    // Адрес отправителя
+}
+
+// NewSMTPMailer создает отправителя писем через SMTP сервер
+// cfg - настройки SMTP сервера и адрес отправителя
+func NewSMTPMailer(cfg config.MailerConfig) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		from: cfg.From,
+	}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)
+	}
+	return m
+}
+
+// Send отправляет письмо
+// smtp.SendMail не принимает контекст, поэтому отмена контекста проверяется только перед отправкой
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := buildMessage(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, data)
+}
+
+// buildMessage формирует письмо в формате RFC 5322 с текстом в UTF-8
+// Тема кодируется по RFC 2047, так как может содержать не ASCII символы
+func buildMessage(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBuildMessage проверяет заголовки письма, кодирование темы и отклонение переводов строк в заголовках
+func TestBuildMessage(t *testing.T) {
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	data, err := buildMessage("noreply@example.com", Message{
+		To:      "user@example.com",
+		Subject: "Приглашение",
+		Body:    "Строка 1\nСтрока 2",
+	}, date)
+	if err != nil {
+		t.Fatalf("Ошибка формирования письма: %v", err)
+	}
+
+	text := string(data)
+	for _, want := range []string{
+		"From: noreply@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: =?utf-8?q?",
+		"Date: Fri, 01 Mar 2024 12:00:00 +0000\r\n",
+		"\r\n\r\nСтрока 1\r\nСтрока 2",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Письмо не содержит %q:\n%s", want, text)
+		}
+	}
+
+	_, err = buildMessage("noreply@example.com", Message{To: "user@example.com\r\nBcc: other@example.com"}, date)
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Ожидалась ошибка %v, получено %v", ErrInvalidHeader, err)
+	}
+}
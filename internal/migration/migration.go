@@ -0,0 +1,204 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/migrations"
+)
+
+// Режимы применения миграций при запуске сервиса
+const (
+	ModeAuto   = "auto"   // Применить недостающие миграции и проверить схему
+	ModeVerify = "verify" // Только проверить, что схема актуальна
+	ModeOff    = "off"    // Не проверять схему
+)
+
+// lockKey - ключ advisory lock, под которым выполняются миграции
+// Отличается от ключа блокировки ретранслятора outbox
+const lockKey = 7_421_002
+
+// defaultLockTimeout - время ожидания блокировки миграций по умолчанию
+const defaultLockTimeout = time.Minute
+
+// Ошибки проверки состояния схемы
+var (
+	ErrDirty  = errors.New("database schema is dirty")
+	ErrBehind = errors.New("database schema is behind the binary")
+)
+
+// New создает экземпляр для управления миграциями базы данных
+// Миграции читаются из файлов, встроенных в исполняемый файл
+// Используется сервисом при запуске и утилитой userctl
+// cfg - настройки подключения к базе данных
+func New(cfg config.DatabaseConfig) (*migrate.Migrate, error) {
+	src, err := openSource()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithSourceInstance("iofs", src, cfg.URL())
+}
+
+// LatestVersion возвращает номер последней миграции, встроенной в исполняемый файл
+func LatestVersion() (uint, error) {
+	src, err := openSource()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// Lock захватывает advisory lock миграций на отдельном соединении
+// Пока блокировка удерживается, другие экземпляры сервиса и userctl ждут ее освобождения
+// ctx - контекст, ограничивающий время ожидания блокировки
+// cfg - настройки подключения к базе данных
+// Возвращает функцию освобождения блокировки
+func Lock(ctx context.Context, cfg config.DatabaseConfig) (func(), error) {
+	db, err := sql.Open("postgres", cfg.URL())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, fmt.Errorf("ожидание блокировки миграций: %w", err)
+	}
+
+	return func() {
+		// Блокировка сессионная, поэтому закрытие соединения также освобождает ее
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+		conn.Close()
+		db.Close()
+	}, nil
+}
+
+// Run приводит схему базы данных в соответствие с режимом из конфигурации
+// Возвращает ошибку, если схема осталась в состоянии dirty или отстает от встроенных миграций,
+// в этом случае сервис не должен запускаться
+// ctx - контекст выполнения
+// cfg - конфигурация сервиса
+// logger - логгер для записи событий
+func Run(ctx context.Context, cfg *config.Config, logger *log.Logger) error {
+	mode := cfg.Migrations.Mode
+	if mode == "" {
+		mode = ModeAuto
+	}
+	if mode == ModeOff {
+		logger.Println("Проверка схемы базы данных отключена (migrations.mode = off)")
+		return nil
+	}
+
+	lockTimeout := cfg.Migrations.LockTimeout.Duration
+	if lockTimeout == 0 {
+		lockTimeout = defaultLockTimeout
+	}
+	lockCtx, cancel := context.WithTimeout(ctx, lockTimeout)
+	defer cancel()
+
+	unlock, err := Lock(lockCtx, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := New(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("инициализация миграций: %w", err)
+	}
+	defer m.Close()
+
+	return apply(m, mode, logger)
+}
+
+// apply применяет недостающие миграции в режиме auto и проверяет схему
+// Вызывается под блокировкой миграций
+// m - экземпляр миграций
+// mode - режим auto или verify
+// logger - логгер для записи событий
+func apply(m *migrate.Migrate, mode string, logger *log.Logger) error {
+	if mode == ModeAuto {
+		// Миграции применяются только к отстающей схеме: dirty схема дает понятную ошибку ниже,
+		// а схема новее исполняемого файла (после отката версии сервиса) не содержит известных ему миграций
+		if _, _, err := Check(m); errors.Is(err, ErrBehind) {
+			if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+				return fmt.Errorf("применение миграций: %w", err)
+			}
+		}
+	}
+
+	current, latest, err := Check(m)
+	if err != nil {
+		return err
+	}
+
+	if current > latest {
+		logger.Printf("Версия схемы базы данных %d новее последней встроенной миграции %d", current, latest)
+	} else {
+		logger.Printf("Схема базы данных актуальна (версия %d)", current)
+	}
+	return nil
+}
+
+// Check сравнивает версию схемы с последней встроенной миграцией
+// Возвращает текущую и последнюю версии
+// Ошибка ErrDirty означает незавершенную миграцию, ErrBehind - непримененные миграции
+func Check(m *migrate.Migrate) (current, latest uint, err error) {
+	latest, err = LatestVersion()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	current, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		current, dirty, err = 0, false, nil
+	}
+	if err != nil {
+		return 0, latest, err
+	}
+
+	if dirty {
+		return current, latest, fmt.Errorf("%w: миграция %d завершилась с ошибкой, исправьте схему и выполните userctl migrate force", ErrDirty, current)
+	}
+	if current < latest {
+		return current, latest, fmt.Errorf("%w: версия %d, требуется %d", ErrBehind, current, latest)
+	}
+	return current, latest, nil
+}
+
+// openSource открывает источник встроенных миграций
+func openSource() (source.Driver, error) {
+	return iofs.New(migrations.FS, ".")
+}
@@ -0,0 +1,132 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/stub"
+
+	"github.com/janson/usermicroservice/internal/config"
+)
+
+// newStubMigrate создает экземпляр встроенных миграций с базой данных в памяти
+// version - текущая версия схемы (database.NilVersion - миграции не применялись)
+// dirty - последняя миграция завершилась с ошибкой
+func newStubMigrate(t *testing.T, version int, dirty bool) (*migrate.Migrate, *stub.Stub) {
+	t.Helper()
+
+	src, err := openSource()
+	if err != nil {
+		t.Fatalf("Ошибка открытия встроенных миграций: %v", err)
+	}
+	driver, err := stub.WithInstance(nil, &stub.Config{})
+	if err != nil {
+		t.Fatalf("Ошибка создания базы данных в памяти: %v", err)
+	}
+	db := driver.(*stub.Stub)
+	db.CurrentVersion, db.IsDirty = version, dirty
+
+	m, err := migrate.NewWithInstance("iofs", src, "stub", db)
+	if err != nil {
+		t.Fatalf("Ошибка создания экземпляра миграций: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, db
+}
+
+// latestVersion возвращает номер последней встроенной миграции
+func latestVersion(t *testing.T) uint {
+	t.Helper()
+
+	latest, err := LatestVersion()
+	if err != nil || latest == 0 {
+		t.Fatalf("Не удалось определить последнюю миграцию: %d, %v", latest, err)
+	}
+	return latest
+}
+
+// TestCheck проверяет сравнение версии схемы с последней встроенной миграцией
+func TestCheck(t *testing.T) {
+	latest := latestVersion(t)
+
+	tests := []struct {
+		name    string
+		version int
+		dirty   bool
+		want    error
+	}{
+		{"пустая база данных", database.NilVersion, false, ErrBehind},
+		{"отстающая схема", int(latest) - 1, false, ErrBehind},
+		{"незавершенная миграция", int(latest), true, ErrDirty},
+		{"актуальная схема", int(latest), false, nil},
+		{"схема новее исполняемого файла", int(latest) + 1, false, nil},
+	}
+	for _, tt := range tests {
+		m, _ := newStubMigrate(t, tt.version, tt.dirty)
+
+		_, gotLatest, err := Check(m)
+		if !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+			t.Errorf("%s: ожидалась ошибка %v, получено %v", tt.name, tt.want, err)
+		}
+		if gotLatest != latest {
+			t.Errorf("%s: ожидалась последняя версия %d, получена %d", tt.name, latest, gotLatest)
+		}
+	}
+}
+
+// TestApplyModes проверяет режимы запуска: auto применяет недостающие миграции, verify только проверяет схему,
+// а незавершенная миграция останавливает запуск в обоих режимах без применения миграций
+func TestApplyModes(t *testing.T) {
+	latest := latestVersion(t)
+	logger := log.New(io.Discard, "", 0)
+
+	m, db := newStubMigrate(t, database.NilVersion, false)
+	if err := apply(m, ModeAuto, logger); err != nil {
+		t.Fatalf("auto: ошибка применения миграций: %v", err)
+	}
+	if db.CurrentVersion != int(latest) || len(db.MigrationSequence) != int(latest) {
+		t.Errorf("auto: ожидалось применение %d миграций, применено %d (версия %d)", latest, len(db.MigrationSequence), db.CurrentVersion)
+	}
+
+	m, db = newStubMigrate(t, int(latest)-1, false)
+	if err := apply(m, ModeVerify, logger); !errors.Is(err, ErrBehind) {
+		t.Errorf("verify: ожидалась ошибка %v, получено %v", ErrBehind, err)
+	}
+	if len(db.MigrationSequence) != 0 {
+		t.Errorf("verify не должен применять миграции, применено %d", len(db.MigrationSequence))
+	}
+
+	for _, mode := range []string{ModeAuto, ModeVerify} {
+		m, db = newStubMigrate(t, int(latest)-1, true)
+		if err := apply(m, mode, logger); !errors.Is(err, ErrDirty) {
+			t.Errorf("%s: ожидалась ошибка %v, получено %v", mode, ErrDirty, err)
+		}
+		if len(db.MigrationSequence) != 0 {
+			t.Errorf("%s: миграции не должны применяться к dirty схеме, применено %d", mode, len(db.MigrationSequence))
+		}
+	}
+
+	// Схема новее исполняемого файла (например, после отката версии сервиса) не мешает запуску
+	for _, mode := range []string{ModeAuto, ModeVerify} {
+		m, db = newStubMigrate(t, int(latest)+1, false)
+		if err := apply(m, mode, logger); err != nil {
+			t.Errorf("%s: схема новее исполняемого файла: ошибка %v", mode, err)
+		}
+		if len(db.MigrationSequence) != 0 {
+			t.Errorf("%s: миграции не должны применяться к более новой схеме, применено %d", mode, len(db.MigrationSequence))
+		}
+	}
+}
+
+// TestRunOff проверяет, что в режиме off схема не проверяется и подключение к базе данных не требуется
+func TestRunOff(t *testing.T) {
+	cfg := &config.Config{Migrations: config.MigrationsConfig{Mode: ModeOff}}
+	if err := Run(context.Background(), cfg, log.New(io.Discard, "", 0)); err != nil {
+		t.Errorf("Ожидался запуск без проверки схемы, получена ошибка %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// Разрешения ключей API
+// Разрешение на чтение дает доступ к запросам GET, на запись - ко всем запросам к ресурсу
+const (
+	ScopeUsersRead        = "users:read"        // Чтение пользователей
+	ScopeUsersWrite       = "users:write"       // Изменение пользователей, паролей и двухфакторной аутентификации
+	ScopeGroupsRead       = "groups:read"       // Чтение групп и участников
+	ScopeGroupsWrite      = "groups:write"      // Изменение групп и участников
+	ScopeInvitationsRead  = "invitations:read"  // Чтение приглашений
+	ScopeInvitationsWrite = "invitations:write" // Создание и отзыв приглашений
+)
+
+// ValidAPIKeyScope сообщает, что строка является известным разрешением ключа API
+func ValidAPIKeyScope(scope string) bool {
+	switch scope {
+	case ScopeUsersRead, ScopeUsersWrite, ScopeGroupsRead, ScopeGroupsWrite, ScopeInvitationsRead, ScopeInvitationsWrite:
+		return true
+	default:
+		return false
+	}
+}
+
+// APIKey представляет ключ API для доступа сервисов без пароля пользователя
+// Ключ не хранится и возвращается только при создании (APIKeyCreated)
+type APIKey struct {
+	ID         int64      `json:"id"`                     // Уникальный идентификатор ключа
+	TenantID   string     `json:"tenant_id"`              // Арендатор, в пределах которого действует ключ
+	Name       string     `json:"name"`                   // Название ключа
+	Prefix     string     `json:"prefix"`                 // Открытый префикс ключа для опознания
+	Scopes     []string   `json:"scopes"`                 // Разрешения ключа
+	CreatedBy  string     `json:"created_by"`             // Инициатор создания ключа
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`   // Срок действия (отсутствует - бессрочный)
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // Время последнего использования
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`   // Дата отзыва
+	CreatedAt  time.Time  `json:"created_at"`             // Дата и время создания ключа
+}
+
+// Active сообщает, что ключ не отозван и не истек на момент now
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Allows сообщает, что ключ имеет разрешение scope
+// Разрешение на запись к ресурсу включает разрешение на чтение
+func (k APIKey) Allows(scope string) bool {
+	resource, access, _ := strings.Cut(scope, ":")
+	for _, s := range k.Scopes {
+		if s == scope || (access == "read" && s == resource+":write") {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyCreate используется для создания ключа API
+type APIKeyCreate struct {
+	Name      string     `json:"name"`                 // Название ключа
+	Scopes    []string   `json:"scopes"`               // Разрешения ключа
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Срок действия (опционально)
+}
+
+// APIKeyCreated возвращается при создании ключа API и содержит сам ключ
+type APIKeyCreated struct {
+	APIKey
+	Key string `json:"key"` // Ключ для заголовка Authorization: ApiKey; показывается только один раз
+}
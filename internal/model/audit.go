@@ -0,0 +1,91 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// Действия, фиксируемые в журнале аудита
+const (
+	AuditActionCreate = "create" // Создание пользователя
+	AuditActionUpdate = "update" // Изменение пользователя
+	AuditActionDelete = "delete" // Удаление пользователя
+)
+
+// FieldChange описывает изменение одного поля пользователя
+// Для созданного пользователя Before отсутствует, для удаленного - After
+type FieldChange struct {
+	Before interface{} `json:"before,omitempty"` // Значение до изменения
+	After  interface{} `json:"after,omitempty"`  // Значение после изменения
+}
+
+// AuditEntry представляет запись журнала аудита изменений пользователя
+type AuditEntry struct {
+	ID        int64                  `json:"id"`               // Уникальный идентификатор записи
+	UserID    int64                  `json:"user_id"`          // ID измененного пользователя
+	TenantID  string                 `json:"tenant_id"`        // Арендатор пользователя
+	Action    string                 `json:"action"`           // Действие: create, update, delete
+	Actor     string                 `json:"actor"`            // Инициатор изменения
+	RequestID string                 `json:"request_id"`       // ID HTTP запроса
+	IP        string                 `json:"ip"`               // IP-адрес клиента
+	Diff      map[string]FieldChange `json:"diff"`             // Измененные поля
+	Reason    string                 `json:"reason,omitempty"` // Причина изменения (например, приостановки учетной записи)
+	CreatedAt time.Time              `json:"created_at"`       // Дата и время изменения
+}
+
+// auditIgnoredFields - служебные поля, изменения которых не записываются в журнал аудита
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+	"updated_by": true,
+	"tenant_id":  true,
+}
+
+// DiffUsers вычисляет различия между двумя состояниями пользователя по их JSON представлению
+// before - состояние до изменения (nil для созданного пользователя)
+// after - состояние после изменения (nil для удаленного пользователя)
+func DiffUsers(before, after *User) (map[string]FieldChange, error) {
+	beforeFields, err := userFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := userFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]FieldChange)
+	for name, value := range beforeFields {
+		if newValue, ok := afterFields[name]; !ok || !reflect.DeepEqual(value, newValue) {
+			diff[name] = FieldChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			diff[name] = FieldChange{After: value}
+		}
+	}
+
+	return diff, nil
+}
+
+// userFields возвращает поля пользователя в виде словаря JSON значений
+func userFields(user *User) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if user == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name := range auditIgnoredFields {
+		delete(fields, name)
+	}
+
+	return fields, nil
+}
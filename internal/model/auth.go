@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+)
+
+// LoginRequest используется для входа по электронной почте и паролю
+type LoginRequest struct {
+	Email    string `json:"email"`    // Электронная почта пользователя
+	Password string `json:"password"` // Пароль
+}
+
+// LoginToken содержит токен доступа, выданный после успешного входа
+// Если у пользователя включена двухфакторная аутентификация, первый шаг входа возвращает
+// только MFARequired и MFAToken, а токен доступа выдается после проверки кода
+type LoginToken struct {
+	AccessToken string `json:"access_token,omitempty"` // Токен JWT для заголовка Authorization: Bearer
+	TokenType   string `json:"token_type,omitempty"`   // Тип токена (всегда Bearer)
+	ExpiresIn   int    `json:"expires_in"`             // Срок действия токена доступа или токена второго шага в секундах
+	MFARequired bool   `json:"mfa_required,omitempty"` // Требуется второй шаг входа
+	MFAToken    string `json:"mfa_token,omitempty"`    // Токен второго шага входа
+}
+
+// AccessClaims содержит утверждения проверенного токена доступа
+// Роль и электронная почта соответствуют моменту выдачи токена
+type AccessClaims struct {
+	UserID   int64  // ID пользователя (утверждение sub)
+	TenantID string // Арендатор пользователя
+	Email    string // Электронная почта пользователя
+	Role     string // Роль пользователя: admin или member
+}
+
+// PasswordSet используется для установки пароля пользователя администратором
+type PasswordSet struct {
+	Password string `json:"password"` // Новый пароль
+}
+
+// Области учета неудачных попыток входа
+const (
+	LoginScopeAccount = "account" // Учетная запись (ключ - электронная почта в нижнем регистре)
+	LoginScopeIP      = "ip"      // IP-адрес клиента
+)
+
+// LoginKey определяет учет неудачных попыток входа: область и ключ в ней
+type LoginKey struct {
+	Scope string // Область учета: LoginScopeAccount или LoginScopeIP
+	Key   string // Электронная почта в нижнем регистре или IP-адрес
+}
+
+// LoginAttempts содержит учет неудачных попыток входа для учетной записи или IP-адреса
+// Нулевое значение означает, что неудачных попыток не было
+type LoginAttempts struct {
+	Failures      int       // Число неудачных попыток подряд в пределах окна учета
+	LastFailureAt time.Time // Время последней неудачной попытки
+	LockedUntil   time.Time // Окончание временной блокировки (нулевое значение - блокировки нет)
+}
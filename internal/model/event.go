@@ -0,0 +1,25 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Типы доменных событий жизненного цикла пользователя
+const (
+	EventUserCreated = "UserCreated" // Пользователь создан
+	EventUserUpdated = "UserUpdated" // Данные пользователя изменены
+	EventUserDeleted = "UserDeleted" // Пользователь удален
+)
+
+// Event представляет доменное событие, записанное в таблицу outbox
+// События публикуются ретранслятором в порядке возрастания ID
+type Event struct {
+	ID          int64           `json:"id"`           // Порядковый номер события
+	AggregateID int64           `json:"aggregate_id"` // ID пользователя, к которому относится событие
+	TenantID    string          `json:"tenant_id"`    // Арендатор пользователя
+	Type        string          `json:"type"`         // Тип события (UserCreated, UserUpdated, UserDeleted)
+	Payload     json.RawMessage `json:"payload"`      // Состояние пользователя на момент события
+	CreatedAt   time.Time       `json:"created_at"`   // Дата и время возникновения события
+	Attempts    int             `json:"-"`            // Число неудачных попыток публикации
+}
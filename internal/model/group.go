@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+)
+
+// Роли участников группы
+const (
+	GroupRoleOwner  = "owner"  // Владелец группы
+	GroupRoleAdmin  = "admin"  // Администратор группы
+	GroupRoleMember = "member" // Обычный участник
+)
+
+// Group представляет группу (команду) пользователей арендатора
+type Group struct {
+	ID          int64     `json:"id"`          // Уникальный идентификатор группы
+	TenantID    string    `json:"tenant_id"`   // Арендатор, которому принадлежит группа
+	Name        string    `json:"name"`        // Название группы (уникально в пределах арендатора)
+	Description string    `json:"description"` // Описание группы
+	CreatedAt   time.Time `json:"created_at"`  // Дата и время создания группы
+	UpdatedAt   time.Time `json:"updated_at"`  // Дата и время последнего изменения группы
+}
+
+// GroupCreate используется для создания новой группы
+type GroupCreate struct {
+	Name        string `json:"name"`                  // Название группы
+	Description string `json:"description,omitempty"` // Описание группы (опционально)
+}
+
+// GroupUpdate используется для обновления группы
+// Поля-указатели позволяют обновлять только переданные значения
+type GroupUpdate struct {
+	Name        *string `json:"name,omitempty"`        // Новое название группы
+	Description *string `json:"description,omitempty"` // Новое описание группы
+}
+
+// GroupMember представляет участие пользователя в группе
+type GroupMember struct {
+	GroupID   int64     `json:"group_id"`   // Группа
+	UserID    int64     `json:"user_id"`    // Участник группы
+	Role      string    `json:"role"`       // Роль участника: owner, admin, member
+	CreatedAt time.Time `json:"created_at"` // Дата и время добавления в группу
+}
+
+// GroupMemberAdd используется для добавления пользователя в группу
+// Если роль не указана, пользователь добавляется с ролью member
+type GroupMemberAdd struct {
+	UserID int64  `json:"user_id"`        // Добавляемый пользователь
+	Role   string `json:"role,omitempty"` // Роль участника (опционально)
+}
+
+// GroupMemberUpdate используется для изменения роли участника группы
+type GroupMemberUpdate struct {
+	Role string `json:"role"` // Новая роль участника
+}
+
+// UserGroup представляет группу, в которой состоит пользователь, вместе с его ролью
+type UserGroup struct {
+	Group
+	Role     string    `json:"role"`      // Роль пользователя в группе
+	JoinedAt time.Time `json:"joined_at"` // Дата и время добавления пользователя в группу
+}
+
+// ValidGroupRole сообщает, что роль участника группы допустима
+func ValidGroupRole(role string) bool {
+	switch role {
+	case GroupRoleOwner, GroupRoleAdmin, GroupRoleMember:
+		return true
+	}
+	return false
+}
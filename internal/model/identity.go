@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+)
+
+// UserIdentity представляет учетную запись внешнего поставщика удостоверений, привязанную к пользователю
+type UserIdentity struct {
+	ID          int64      `json:"id"`                      // Уникальный идентификатор привязки
+	TenantID    string     `json:"tenant_id"`               // Арендатор пользователя
+	UserID      int64      `json:"user_id"`                 // Пользователь
+	Provider    string     `json:"provider"`                // Имя поставщика из конфигурации
+	Subject     string     `json:"subject"`                 // Идентификатор пользователя у поставщика
+	Email       string     `json:"email"`                   // Электронная почта у поставщика при привязке
+	CreatedAt   time.Time  `json:"created_at"`              // Дата и время привязки
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"` // Время последнего входа через поставщика
+}
+
+// IdentityProvider описывает настроенного внешнего поставщика удостоверений
+type IdentityProvider struct {
+	Name     string `json:"name"`      // Имя поставщика
+	LoginURL string `json:"login_url"` // Адрес начала входа через поставщика
+}
+
+// IdentityLoginState хранит параметры незавершенного входа через внешнего поставщика
+// до возврата пользователя от поставщика
+type IdentityLoginState struct {
+	Provider     string    // Имя поставщика
+	Nonce        string    // Значение nonce для проверки ID-токена
+	CodeVerifier string    // PKCE code_verifier
+	ExpiresAt    time.Time // Срок действия
+}
+
+// IdentityLoginStart возвращается при начале входа через внешнего поставщика
+type IdentityLoginStart struct {
+	AuthorizationURL string `json:"authorization_url"` // Адрес страницы входа поставщика, на который перенаправляется пользователь
+}
+
+// IdentityCallback содержит параметры возврата пользователя от поставщика
+type IdentityCallback struct {
+	Code             string // Код авторизации
+	State            string // Значение state из начала входа
+	Error            string // Код ошибки, если поставщик отклонил вход
+	ErrorDescription string // Описание ошибки от поставщика
+}
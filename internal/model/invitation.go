@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+)
+
+// Состояния приглашения
+const (
+	InvitationPending  = "pending"  // Ожидает принятия
+	InvitationAccepted = "accepted" // Принято, пользователь создан
+	InvitationRevoked  = "revoked"  // Отозвано администратором или заменено новым приглашением
+	InvitationExpired  = "expired"  // Истек срок действия
+)
+
+// Invitation представляет приглашение пользователя в организацию арендатора
+// Токен приглашения не хранится и отправляется только в письме приглашенному
+type Invitation struct {
+	ID         int64      `json:"id"`                    // Уникальный идентификатор приглашения
+	TenantID   string     `json:"tenant_id"`             // Арендатор, в который приглашается пользователь
+	Email      string     `json:"email"`                 // Электронная почта приглашенного
+	Role       string     `json:"role"`                  // Роль, которую получит пользователь
+	InvitedBy  string     `json:"invited_by"`            // Инициатор приглашения
+	ExpiresAt  time.Time  `json:"expires_at"`            // Срок действия приглашения
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"` // Дата принятия
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`  // Дата отзыва
+	UserID     *int64     `json:"user_id,omitempty"`     // Пользователь, созданный при принятии
+	CreatedAt  time.Time  `json:"created_at"`            // Дата и время создания приглашения
+}
+
+// Status возвращает состояние приглашения на момент now
+func (i Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+// InvitationCreate используется для создания приглашения
+// Если роль не указана, пользователь получит роль member
+type InvitationCreate struct {
+	Email string `json:"email"`          // Электронная почта приглашаемого
+	Role  string `json:"role,omitempty"` // Роль (опционально)
+}
+
+// InvitationAccept используется для принятия приглашения
+// Электронная почта и роль берутся из приглашения
+type InvitationAccept struct {
+	Token       string `json:"token"`                  // Токен из письма с приглашением
+	Name        string `json:"name"`                   // Имя нового пользователя
+	DisplayName string `json:"display_name,omitempty"` // Отображаемое имя (опционально)
+	Locale      string `json:"locale,omitempty"`       // Язык (опционально)
+	Timezone    string `json:"timezone,omitempty"`     // Часовой пояс (опционально)
+	Password    string `json:"password,omitempty"`     // Пароль для входа (опционально, без пароля вход невозможен)
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+)
+
+// MFA содержит секрет двухфакторной аутентификации (TOTP) пользователя
+type MFA struct {
+	UserID          int64      // Пользователь
+	SecretEncrypted []byte     // Зашифрованный секрет TOTP
+	ConfirmedAt     *time.Time // Дата подтверждения (nil - подключение не подтверждено)
+	LastUsedStep    int64      // Шаг времени последнего принятого кода (защита от повторного использования)
+}
+
+// MFAEnrollment содержит секрет для подключения приложения-аутентификатора
+// Секрет возвращается один раз, при начале подключения
+type MFAEnrollment struct {
+	Secret string `json:"secret"`      // Секрет в Base32 для ввода вручную
+	URI    string `json:"otpauth_uri"` // Адрес otpauth:// для QR-кода
+}
+
+// MFAConfirm используется для подтверждения подключения кодом из приложения-аутентификатора
+type MFAConfirm struct {
+	Code string `json:"code"` // Код из приложения
+}
+
+// MFARecoveryCodes содержит одноразовые коды восстановления
+// Коды возвращаются один раз, при подтверждении подключения
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"` // Коды восстановления
+}
+
+// MFAStatus описывает состояние двухфакторной аутентификации пользователя
+type MFAStatus struct {
+	Enabled           bool       `json:"enabled"`                // Двухфакторная аутентификация включена
+	ConfirmedAt       *time.Time `json:"confirmed_at,omitempty"` // Дата включения
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`    // Число неиспользованных кодов восстановления
+}
+
+// MFALoginRequest используется для второго шага входа
+// Передается код из приложения-аутентификатора или код восстановления
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token"`               // Токен, выданный на первом шаге входа
+	Code         string `json:"code,omitempty"`          // Код из приложения
+	RecoveryCode string `json:"recovery_code,omitempty"` // Одноразовый код восстановления
+}
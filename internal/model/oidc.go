@@ -0,0 +1,120 @@
+package model
+
+import (
+	"time"
+)
+
+// OIDCClient представляет приложение, зарегистрированное для входа через провайдер OpenID Connect
+// Секрет клиента не хранится и возвращается только при регистрации (OIDCClientCreated)
+type OIDCClient struct {
+	ID           int64     `json:"id"`            // Уникальный идентификатор регистрации
+	TenantID     string    `json:"tenant_id"`     // Арендатор, пользователи которого входят в приложение
+	ClientID     string    `json:"client_id"`     // Идентификатор клиента для запросов авторизации
+	Name         string    `json:"name"`          // Название приложения, показывается на странице входа
+	RedirectURIs []string  `json:"redirect_uris"` // Разрешенные адреса возврата
+	Confidential bool      `json:"confidential"`  // Конфиденциальный клиент (с секретом)
+	CreatedBy    string    `json:"created_by"`    // Инициатор регистрации
+	CreatedAt    time.Time `json:"created_at"`    // Дата и время регистрации
+}
+
+// OIDCClientCreate используется для регистрации клиента
+// Публичные клиенты (браузерные и мобильные приложения) не получают секрета и проходят только проверку PKCE
+type OIDCClientCreate struct {
+	Name         string   `json:"name"`          // Название приложения
+	RedirectURIs []string `json:"redirect_uris"` // Разрешенные адреса возврата
+	Confidential bool     `json:"confidential"`  // Выдать секрет клиента
+}
+
+// OIDCClientCreated возвращается при регистрации клиента и содержит секрет конфиденциального клиента
+type OIDCClientCreated struct {
+	OIDCClient
+	ClientSecret string `json:"client_secret,omitempty"` // Секрет клиента; показывается только один раз
+}
+
+// OIDCAuthorizationRequest содержит параметры запроса авторизации (GET /oauth2/authorize)
+type OIDCAuthorizationRequest struct {
+	ResponseType        string // Тип ответа (поддерживается только code)
+	ClientID            string // Идентификатор клиента
+	RedirectURI         string // Адрес возврата (должен быть зарегистрирован)
+	Scope               string // Запрошенные области через пробел (должна быть openid)
+	State               string // Значение клиента, возвращается без изменений
+	Nonce               string // Значение для ID-токена
+	CodeChallenge       string // PKCE code_challenge
+	CodeChallengeMethod string // PKCE code_challenge_method (поддерживается только S256)
+}
+
+// OIDCAuthorizationCode представляет выданный код авторизации
+type OIDCAuthorizationCode struct {
+	ClientID      string    // Клиент, которому выдан код
+	UserID        int64     // Вошедший пользователь
+	RedirectURI   string    // Адрес возврата из запроса авторизации
+	Scope         string    // Запрошенные области через пробел
+	Nonce         string    // Значение nonce для ID-токена
+	CodeChallenge string    // PKCE code_challenge
+	AuthTime      time.Time // Время входа пользователя
+	ExpiresAt     time.Time // Срок действия кода
+}
+
+// OIDCTokenRequest содержит параметры запроса обмена кода на токены (POST /oauth2/token)
+type OIDCTokenRequest struct {
+	GrantType    string // Тип гранта (поддерживается только authorization_code)
+	Code         string // Код авторизации
+	RedirectURI  string // Адрес возврата, с которым запрошен код
+	ClientID     string // Идентификатор клиента
+	ClientSecret string // Секрет конфиденциального клиента
+	CodeVerifier string // PKCE code_verifier
+}
+
+// OIDCTokenResponse содержит токены, выданные в обмен на код авторизации
+type OIDCTokenResponse struct {
+	AccessToken string `json:"access_token"` // Токен доступа к /oauth2/userinfo
+	TokenType   string `json:"token_type"`   // Тип токена (всегда Bearer)
+	ExpiresIn   int    `json:"expires_in"`   // Срок действия токена доступа в секундах
+	IDToken     string `json:"id_token"`     // ID-токен с утверждениями о пользователе
+	Scope       string `json:"scope"`        // Выданные области через пробел
+}
+
+// OIDCSigningKey представляет ключ подписи токенов провайдера
+type OIDCSigningKey struct {
+	KID                 string    // Идентификатор ключа в JWKS
+	PrivateKeyEncrypted []byte    // Зашифрованный закрытый ключ PKCS#8
+	CreatedAt           time.Time // Дата и время создания ключа
+}
+
+// OIDCDiscovery - документ обнаружения провайдера (/.well-known/openid-configuration)
+type OIDCDiscovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// JWK - открытый ключ RSA в формате JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"` // Тип ключа (RSA)
+	Use string `json:"use"` // Назначение (sig)
+	Alg string `json:"alg"` // Алгоритм (RS256)
+	Kid string `json:"kid"` // Идентификатор ключа
+	N   string `json:"n"`   // Модуль в Base64url
+	E   string `json:"e"`   // Открытая экспонента в Base64url
+}
+
+// JWKSet - набор открытых ключей подписи (/oauth2/jwks)
+type JWKSet struct {
+	Keys []JWK `json:"keys"` // Ключи, которыми могут быть подписаны действующие токены
+}
+
+// OAuthError - ошибка конечной точки /oauth2/token или /oauth2/userinfo (RFC 6749, 5.2)
+type OAuthError struct {
+	Error       string `json:"error"`                       // Код ошибки (invalid_request, invalid_client, invalid_grant и т.д.)
+	Description string `json:"error_description,omitempty"` // Описание ошибки для разработчика клиента
+}
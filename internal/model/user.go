@@ -6,23 +6,172 @@ import (
 
 // User представляет собой сущность пользователя в системе
 // Эта структура используется для передачи данных о пользователе между слоями приложения
+// Поля профиля необязательны: пустая строка означает, что значение не задано
 type User struct {
-	ID        int64     `json:"id"`         // Уникальный идентификатор пользователя
-	Name      string    `json:"name"`       // Имя пользователя
-	Email     string    `json:"email"`      // Электронная почта (уникальна для каждого пользователя)
-	CreatedAt time.Time `json:"created_at"` // Дата и время создания пользователя
+	ID            int64                  `json:"id"`             // Уникальный идентификатор пользователя
+	TenantID      string                 `json:"tenant_id"`      // Арендатор, которому принадлежит пользователь
+	Name          string                 `json:"name"`           // Имя пользователя
+	Email         string                 `json:"email"`          // Электронная почта (уникальна для каждого пользователя)
+	DisplayName   string                 `json:"display_name"`   // Отображаемое имя
+	Phone         string                 `json:"phone"`          // Телефон в формате E.164
+	Locale        string                 `json:"locale"`         // Язык в виде тега BCP 47
+	Timezone      string                 `json:"timezone"`       // Часовой пояс IANA
+	AvatarURL     string                 `json:"avatar_url"`     // URL аватара
+	Metadata      map[string]interface{} `json:"metadata"`       // Произвольные атрибуты (JSON объект)
+	Role          string                 `json:"role"`           // Роль в организации арендатора: admin или member
+	EmailVerified bool                   `json:"email_verified"` // Электронная почта подтверждена (пользователь принял приглашение или вошел через внешнего поставщика)
+	Status        string                 `json:"status"`         // Состояние учетной записи: pending, active, suspended или locked
+	CreatedAt     time.Time              `json:"created_at"`     // Дата и время создания пользователя
+	UpdatedAt     time.Time              `json:"updated_at"`     // Дата и время последнего изменения пользователя
+	UpdatedBy     string                 `json:"updated_by"`     // Инициатор последнего изменения пользователя
+}
+
+// Роли пользователя в организации арендатора
+const (
+	UserRoleAdmin  = "admin"  // Администратор организации
+	UserRoleMember = "member" // Обычный пользователь
+)
+
+// ValidUserRole сообщает, что роль пользователя допустима
+func ValidUserRole(role string) bool {
+	return role == UserRoleAdmin || role == UserRoleMember
+}
+
+// Состояния учетной записи пользователя
+// Удаленный пользователь удаляется из хранилища, поэтому состояние deleted не хранится
+// и используется только в проверке переходов
+const (
+	UserStatusPending   = "pending"   // Ожидает активации
+	UserStatusActive    = "active"    // Активна
+	UserStatusSuspended = "suspended" // Приостановлена администратором
+	UserStatusLocked    = "locked"    // Заблокирована системой (например, после неудачных попыток входа)
+	UserStatusDeleted   = "deleted"   // Удалена
+)
+
+// userStatusTransitions - допустимые переходы между состояниями учетной записи
+var userStatusTransitions = map[string][]string{
+	UserStatusPending:   {UserStatusActive, UserStatusDeleted},
+	UserStatusActive:    {UserStatusSuspended, UserStatusLocked, UserStatusDeleted},
+	UserStatusSuspended: {UserStatusActive, UserStatusDeleted},
+	UserStatusLocked:    {UserStatusActive, UserStatusDeleted},
+}
+
+// ValidUserStatus сообщает, что состояние может храниться у пользователя
+func ValidUserStatus(status string) bool {
+	_, ok := userStatusTransitions[status]
+	return ok
+}
+
+// CanTransitionUserStatus сообщает, что учетную запись можно перевести из состояния from в состояние to
+func CanTransitionUserStatus(from, to string) bool {
+	for _, next := range userStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CanLogin сообщает, что пользователь может входить в систему
+// Вход разрешен только активной учетной записи
+func (u User) CanLogin() bool {
+	return u.Status == UserStatusActive
 }
 
 // UserCreate используется для создания нового пользователя
-// Содержит только поля, необходимые для создания пользователя
+// Обязательны только имя и электронная почта, без роли пользователь создается с ролью member,
+// без состояния - активным
 type UserCreate struct {
-	Name  string `json:"name"`  // Имя нового пользователя
-	Email string `json:"email"` // Электронная почта нового пользователя
+	Name          string                 `json:"name"`                   // Имя нового пользователя
+	Email         string                 `json:"email"`                  // Электронная почта нового пользователя
+	DisplayName   string                 `json:"display_name,omitempty"` // Отображаемое имя (опционально)
+	Phone         string                 `json:"phone,omitempty"`        // Телефон в формате E.164 (опционально)
+	Locale        string                 `json:"locale,omitempty"`       // Язык (опционально)
+	Timezone      string                 `json:"timezone,omitempty"`     // Часовой пояс (опционально)
+	AvatarURL     string                 `json:"avatar_url,omitempty"`   // URL аватара (опционально)
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`     // Метаданные (опционально)
+	Role          string                 `json:"role,omitempty"`         // Роль (опционально)
+	Status        string                 `json:"status,omitempty"`       // Начальное состояние: pending или active (опционально)
+	EmailVerified bool                   `json:"-"`                      // Почта подтверждена (не принимается из API, выставляется при принятии приглашения и входе через внешнего поставщика)
 }
 
 // UserUpdate используется для обновления существующего пользователя
 // Поля помечены как omitempty, чтобы можно было обновлять только часть полей
+// Поля профиля - указатели: nil оставляет значение без изменений, пустая строка очищает его
+// Метаданные заменяются целиком: nil оставляет их без изменений, пустой объект очищает
+// Изменение электронной почты снимает признак ее подтверждения
 type UserUpdate struct {
-	Name  string `json:"name,omitempty"`  // Новое имя пользователя (опционально)
-	Email string `json:"email,omitempty"` // Новая электронная почта (опционально)
+	Name        string                 `json:"name,omitempty"`         // Новое имя пользователя (опционально)
+	Email       string                 `json:"email,omitempty"`        // Новая электронная почта (опционально)
+	DisplayName *string                `json:"display_name,omitempty"` // Новое отображаемое имя
+	Phone       *string                `json:"phone,omitempty"`        // Новый телефон
+	Locale      *string                `json:"locale,omitempty"`       // Новый язык
+	Timezone    *string                `json:"timezone,omitempty"`     // Новый часовой пояс
+	AvatarURL   *string                `json:"avatar_url,omitempty"`   // Новый URL аватара
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`     // Новые метаданные
+	Role        string                 `json:"role,omitempty"`         // Новая роль (опционально)
+}
+
+// IsEmpty сообщает, что обновление не изменяет ни одного поля
+func (u UserUpdate) IsEmpty() bool {
+	return u.Name == "" && u.Email == "" && u.DisplayName == nil && u.Phone == nil &&
+		u.Locale == nil && u.Timezone == nil && u.AvatarURL == nil && u.Metadata == nil && u.Role == ""
+}
+
+// Apply возвращает копию пользователя с примененными изменениями
+func (u UserUpdate) Apply(user User) User {
+	if u.Name != "" {
+		user.Name = u.Name
+	}
+	if u.Email != "" && u.Email != user.Email {
+		user.Email = u.Email
+		user.EmailVerified = false
+	}
+	if u.DisplayName != nil {
+		user.DisplayName = *u.DisplayName
+	}
+	if u.Phone != nil {
+		user.Phone = *u.Phone
+	}
+	if u.Locale != nil {
+		user.Locale = *u.Locale
+	}
+	if u.Timezone != nil {
+		user.Timezone = *u.Timezone
+	}
+	if u.AvatarURL != nil {
+		user.AvatarURL = *u.AvatarURL
+	}
+	if u.Metadata != nil {
+		user.Metadata = u.Metadata
+	}
+	if u.Role != "" {
+		user.Role = u.Role
+	}
+	return user
+}
+
+// UserStatusChange используется для перевода учетной записи в другое состояние
+// Новое состояние определяется операцией (приостановка, восстановление), причина записывается в журнал аудита
+type UserStatusChange struct {
+	Status string `json:"-"`                // Новое состояние
+	Reason string `json:"reason,omitempty"` // Причина изменения (опционально)
+}
+
+// Порядок сортировки списка пользователей
+const (
+	UserSortID        = "id"         // По ID (по умолчанию)
+	UserSortUpdatedAt = "updated_at" // По времени последнего изменения, затем по ID
+)
+
+// UserFilter содержит параметры выборки списка пользователей
+// Нулевое значение означает выборку всех пользователей, отсортированных по ID
+type UserFilter struct {
+	Limit        int               // Максимальное количество пользователей (0 - без ограничения)
+	Offset       int               // Смещение от начала отсортированного списка
+	UpdatedSince time.Time         // Только пользователи, измененные начиная с этого момента (нулевое значение - все)
+	Sort         string            // Порядок сортировки: UserSortID или UserSortUpdatedAt (пустая строка - UserSortID)
+	Metadata     map[string]string // Только пользователи, у которых значения ключей метаданных совпадают (в текстовом виде)
+	MetadataKeys []string          // Только пользователи, у которых в метаданных есть все перечисленные ключи
+	Status       string            // Только пользователи в этом состоянии (пустая строка - в любом)
 }
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"time"
+)
+
+// WebhookSubscription представляет подписку партнера на события пользователей
+type WebhookSubscription struct {
+	ID           int64      `json:"id"`                    // Уникальный идентификатор подписки
+	URL          string     `json:"url"`                   // URL получателя уведомлений
+	Secret       string     `json:"secret,omitempty"`      // Секрет для подписи (возвращается только при создании)
+	EventTypes   []string   `json:"event_types"`           // Типы событий (пустой список - все события)
+	Active       bool       `json:"active"`                // Признак активности подписки
+	FailureCount int        `json:"failure_count"`         // Количество неудачных доставок подряд
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"` // Дата автоматического отключения
+	CreatedAt    time.Time  `json:"created_at"`            // Дата и время создания подписки
+}
+
+// Matches сообщает, подписана ли подписка на события указанного типа
+func (s WebhookSubscription) Matches(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscriptionCreate используется для создания новой подписки
+// Если секрет не указан, он будет сгенерирован сервисом
+type WebhookSubscriptionCreate struct {
+	URL        string   `json:"url"`                   // URL получателя уведомлений
+	Secret     string   `json:"secret,omitempty"`      // Секрет для подписи (опционально)
+	EventTypes []string `json:"event_types,omitempty"` // Типы событий (опционально)
+}
+
+// WebhookSubscriptionUpdate используется для обновления подписки
+// Поля-указатели позволяют обновлять только переданные значения
+type WebhookSubscriptionUpdate struct {
+	URL        *string   `json:"url,omitempty"`         // Новый URL получателя
+	Secret     *string   `json:"secret,omitempty"`      // Новый секрет
+	EventTypes *[]string `json:"event_types,omitempty"` // Новый список типов событий
+	Active     *bool     `json:"active,omitempty"`      // Включение или отключение подписки
+}
+
+// WebhookDelivery представляет одну попытку доставки события получателю
+type WebhookDelivery struct {
+	ID             int64     `json:"id"`                    // Уникальный идентификатор попытки
+	SubscriptionID int64     `json:"subscription_id"`       // Подписка, по которой выполнялась доставка
+	EventID        int64     `json:"event_id"`              // ID доставляемого события
+	EventType      string    `json:"event_type"`            // Тип события
+	Attempt        int       `json:"attempt"`               // Номер попытки (начиная с 1)
+	StatusCode     int       `json:"status_code,omitempty"` // HTTP код ответа (0 - ответ не получен)
+	Error          string    `json:"error,omitempty"`       // Текст ошибки доставки
+	DurationMS     int64     `json:"duration_ms"`           // Длительность запроса в миллисекундах
+	Success        bool      `json:"success"`               // Признак успешной доставки
+	CreatedAt      time.Time `json:"created_at"`            // Дата и время попытки
+}
+
+// WebhookTask представляет ожидающую доставку события по одной подписке из очереди
+type WebhookTask struct {
+	ID             int64  `json:"id"`              // Уникальный идентификатор доставки
+	TenantID       string `json:"tenant_id"`       // Арендатор события и подписки
+	SubscriptionID int64  `json:"subscription_id"` // Подписка получателя
+	EventID        int64  `json:"event_id"`        // ID доставляемого события
+	AggregateID    int64  `json:"aggregate_id"`    // ID пользователя, к которому относится событие
+	EventType      string `json:"event_type"`      // Тип события
+	Body           []byte `json:"body"`            // Тело уведомления, одинаковое для всех попыток
+	Attempts       int    `json:"attempts"`        // Число уже выполненных попыток
+}
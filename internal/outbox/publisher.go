@@ -0,0 +1,140 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// Publisher доставляет доменные события внешним потребителям
+// Реализация должна вернуть ошибку, если доставка не подтверждена, -
+// тогда событие останется в outbox и будет отправлено повторно
+type Publisher interface {
+	Publish(ctx context.Context, event model.Event) error
+}
+
+// ErrUnknownPublisher возвращается, если в конфигурации указан неизвестный тип публикатора
+var ErrUnknownPublisher = errors.New("unknown outbox publisher")
+
+// NewPublisher создает публикатор по настройкам из конфигурации
+// cfg - настройки outbox
+func NewPublisher(cfg config.OutboxConfig) (Publisher, error) {
+	switch cfg.Publisher {
+	case "file":
+		return NewFilePublisher(cfg.FilePath), nil
+	case "webhook":
+		return NewWebhookPublisher(cfg.WebhookURL, nil), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPublisher, cfg.Publisher)
+	}
+}
+
+// FilePublisher записывает события в файл в формате JSON Lines
+// Предназначен для локальной разработки и тестирования
+type FilePublisher struct {
+	path string     // Путь к файлу
+	mu   sync.Mutex // Защищает файл от одновременной записи
+}
+
+// NewFilePublisher создает публикатор, дописывающий события в файл
+// path - путь к файлу
+func NewFilePublisher(path string) *FilePublisher {
+	return &FilePublisher{
+		path: path,
+	}
+}
+
+// Publish дописывает событие в конец файла
+func (p *FilePublisher) Publish(ctx context.Context, event model.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	file, err := os.OpenFile(p.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WebhookPublisher отправляет каждое событие POST-запросом на заданный URL
+type WebhookPublisher struct {
+	url    string       // URL получателя событий
+	client *http.Client // HTTP клиент для отправки запросов
+}
+
+// NewWebhookPublisher создает публикатор, отправляющий события по HTTP
+// url - URL получателя
+// client - HTTP клиент (nil - клиент с таймаутом по умолчанию)
+func NewWebhookPublisher(url string, client *http.Client) *WebhookPublisher {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &WebhookPublisher{
+		url:    url,
+		client: client,
+	}
+}
+
+// Publish отправляет событие и считает доставку успешной при ответе 2xx
+func (p *WebhookPublisher) Publish(ctx context.Context, event model.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", event.Type)
+	req.Header.Set("X-Event-ID", fmt.Sprint(event.ID))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("получатель ответил кодом %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// MultiPublisher передает событие нескольким публикаторам по очереди
+// Если хотя бы один публикатор вернул ошибку, событие будет отправлено повторно всем,
+// поэтому получатели должны быть готовы к дубликатам
+type MultiPublisher []Publisher
+
+// Publish передает событие всем публикаторам и возвращает первую ошибку
+func (m MultiPublisher) Publish(ctx context.Context, event model.Event) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// recordingPublisher запоминает опубликованные события и возвращает заданную ошибку
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []model.Event
+	err    error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event model.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+	return p.err
+}
+
+// testEvent возвращает событие изменения пользователя aggregateID с номером id
+func testEvent(id, aggregateID int64) model.Event {
+	return model.Event{ID: id, AggregateID: aggregateID, TenantID: "default", Type: model.EventUserUpdated,
+		Payload: json.RawMessage(`{"id":1}`), CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+}
+
+// TestFilePublisher проверяет, что события дописываются в файл по одному JSON объекту в строке
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	publisher := NewFilePublisher(path)
+
+	for id := int64(1); id <= 2; id++ {
+		if err := publisher.Publish(context.Background(), testEvent(id, 1)); err != nil {
+			t.Fatalf("Ошибка публикации события %d: %v", id, err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Ошибка открытия файла: %v", err)
+	}
+	defer file.Close()
+
+	var ids []int64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event model.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Строка %q не является событием: %v", scanner.Text(), err)
+		}
+		if event.Type != model.EventUserUpdated || string(event.Payload) != `{"id":1}` {
+			t.Errorf("Неожиданное событие в файле: %+v", event)
+		}
+		ids = append(ids, event.ID)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("Ожидались события 1 и 2 по порядку, получено %v", ids)
+	}
+}
+
+// TestMultiPublisher проверяет, что событие передается всем публикаторам по очереди,
+// а ошибка публикатора прерывает рассылку и возвращается ретранслятору
+func TestMultiPublisher(t *testing.T) {
+	first, second := &recordingPublisher{}, &recordingPublisher{}
+	if err := (MultiPublisher{first, second}).Publish(context.Background(), testEvent(1, 1)); err != nil {
+		t.Fatalf("Ошибка публикации: %v", err)
+	}
+	if len(first.events) != 1 || len(second.events) != 1 {
+		t.Errorf("Событие должно попасть ко всем публикаторам: %d и %d", len(first.events), len(second.events))
+	}
+
+	failing := &recordingPublisher{err: errors.New("брокер недоступен")}
+	last := &recordingPublisher{}
+	if err := (MultiPublisher{failing, last}).Publish(context.Background(), testEvent(2, 1)); !errors.Is(err, failing.err) {
+		t.Errorf("Ожидалась ошибка %v, получено %v", failing.err, err)
+	}
+	if len(last.events) != 0 {
+		t.Errorf("После ошибки событие не должно передаваться следующим публикаторам")
+	}
+}
@@ -0,0 +1,144 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// Значения по умолчанию для настроек ретранслятора
+const (
+	defaultPollInterval   = time.Second
+	defaultBatchSize      = 100
+	defaultMaxAttempts    = 10
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+)
+
+// Store - хранилище исходящих событий
+// Реализуется postgres.OutboxRepository
+type Store interface {
+	ProcessBatch(ctx context.Context, limit int, handle func(model.Event) error, retry func(model.Event) (time.Duration, bool)) (int, error)
+}
+
+// Relay периодически читает неопубликованные события из таблицы outbox
+// и передает их публикатору
+// Доставка выполняется по принципу "как минимум один раз": событие отмечается
+// опубликованным только после успешного вызова Publisher.Publish
+// Неудачное событие повторяется с экспоненциальной задержкой, а после maxAttempts попыток
+// откладывается и больше не публикуется, чтобы не задерживать остальные события
+type Relay struct {
+	store          Store         // Хранилище исходящих событий
+	publisher      Publisher     // Публикатор событий
+	logger         *log.Logger   // Логгер для записи ошибок публикации
+	pollInterval   time.Duration // Интервал опроса таблицы outbox
+	batchSize      int           // Максимальное число событий за один проход
+	maxAttempts    int           // Число неудачных попыток, после которого событие откладывается
+	initialBackoff time.Duration // Задержка перед первым повтором
+	maxBackoff     time.Duration // Верхняя граница задержки между повторами
+}
+
+// NewRelay создает новый ретранслятор событий
+// store - хранилище исходящих событий
+// publisher - публикатор, в который отправляются события
+// cfg - настройки outbox (нулевые значения заменяются значениями по умолчанию)
+// logger - логгер для записи событий
+func NewRelay(store Store, publisher Publisher, cfg config.OutboxConfig, logger *log.Logger) *Relay {
+	r := &Relay{
+		store:          store,
+		publisher:      publisher,
+		logger:         logger,
+		pollInterval:   cfg.PollInterval.Duration,
+		batchSize:      cfg.BatchSize,
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff.Duration,
+		maxBackoff:     cfg.MaxBackoff.Duration,
+	}
+
+	if r.pollInterval <= 0 {
+		r.pollInterval = defaultPollInterval
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = defaultBatchSize
+	}
+	if r.maxAttempts <= 0 {
+		r.maxAttempts = defaultMaxAttempts
+	}
+	if r.initialBackoff <= 0 {
+		r.initialBackoff = defaultInitialBackoff
+	}
+	if r.maxBackoff <= 0 {
+		r.maxBackoff = defaultMaxBackoff
+	}
+
+	return r
+}
+
+// Run запускает цикл публикации и блокируется до отмены контекста
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain публикует порции событий, пока в очереди есть что отправлять
+func (r *Relay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		published, err := r.store.ProcessBatch(ctx, r.batchSize, func(event model.Event) error {
+			if err := r.publisher.Publish(ctx, event); err != nil {
+				r.logger.Printf("Ошибка публикации события %d (%s): %v", event.ID, event.Type, err)
+				return err
+			}
+			return nil
+		}, r.retry)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Printf("Ошибка обработки таблицы outbox: %v", err)
+			}
+			return
+		}
+
+		// Неполная порция означает, что очередь пуста или в ней остались только неудачные события
+		if published < r.batchSize {
+			return
+		}
+	}
+}
+
+// retry возвращает задержку до следующей попытки публикации события
+// После maxAttempts неудачных попыток возвращает false, и событие откладывается
+func (r *Relay) retry(event model.Event) (time.Duration, bool) {
+	if event.Attempts >= r.maxAttempts {
+		r.logger.Printf("Событие %d (%s) отложено после %d неудачных попыток публикации", event.ID, event.Type, event.Attempts)
+		return 0, false
+	}
+	return r.backoff(event.Attempts), true
+}
+
+// backoff возвращает задержку перед повтором с номером retry: экспоненциальный рост
+// от initialBackoff до maxBackoff со случайным разбросом в пределах половины задержки
+func (r *Relay) backoff(retry int) time.Duration {
+	delay := r.initialBackoff
+	for i := 1; i < retry && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.maxBackoff {
+		delay = r.maxBackoff
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
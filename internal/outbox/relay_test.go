@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// fakeStore передает ретранслятору события из памяти и запоминает решения о повторах
+// Повторяет постоянную ошибку публикации: неудачное событие возвращается в каждой порции до откладывания
+type fakeStore struct {
+	events    []model.Event
+	published []int64
+	delays    []time.Duration
+	dead      []int64
+}
+
+func (s *fakeStore) ProcessBatch(ctx context.Context, limit int, handle func(model.Event) error, retry func(model.Event) (time.Duration, bool)) (int, error) {
+	published := 0
+	var pending []model.Event
+	for _, event := range s.events {
+		if err := handle(event); err != nil {
+			event.Attempts++
+			delay, ok := retry(event)
+			if !ok {
+				s.dead = append(s.dead, event.ID)
+				continue
+			}
+			s.delays = append(s.delays, delay)
+			pending = append(pending, event)
+			continue
+		}
+		s.published = append(s.published, event.ID)
+		published++
+	}
+	s.events = pending
+	return published, nil
+}
+
+// TestRelayRetriesAndDeadLetters проверяет повторы неудачного события с растущей задержкой
+// и его откладывание после max_attempts попыток
+func TestRelayRetriesAndDeadLetters(t *testing.T) {
+	store := &fakeStore{events: []model.Event{testEvent(1, 1)}}
+	publisher := &recordingPublisher{err: errors.New("брокер недоступен")}
+	relay := NewRelay(store, publisher, config.OutboxConfig{
+		MaxAttempts:    3,
+		InitialBackoff: config.Duration{Duration: time.Second},
+		MaxBackoff:     config.Duration{Duration: 2 * time.Second},
+	}, log.New(io.Discard, "", 0))
+
+	for i := 0; i < 4; i++ {
+		relay.drain(context.Background())
+	}
+
+	if len(publisher.events) != 3 {
+		t.Errorf("Ожидалось 3 попытки публикации, выполнено %d", len(publisher.events))
+	}
+	if len(store.delays) != 2 {
+		t.Fatalf("Ожидалось 2 повтора, получено %v", store.delays)
+	}
+	if store.delays[0] < 500*time.Millisecond || store.delays[0] > time.Second ||
+		store.delays[1] < time.Second || store.delays[1] > 2*time.Second {
+		t.Errorf("Задержки повторов вне ожидаемых границ: %v", store.delays)
+	}
+	if len(store.dead) != 1 || store.dead[0] != 1 || len(store.events) != 0 {
+		t.Errorf("Событие должно быть отложено после последней попытки: отложены %v, в очереди %v", store.dead, store.events)
+	}
+}
+
+// TestRelayDrainsFullBatches проверяет, что ретранслятор запрашивает следующую порцию,
+// пока порции заполнены полностью
+func TestRelayDrainsFullBatches(t *testing.T) {
+	store := &batchStore{remaining: 5}
+	relay := NewRelay(store, &recordingPublisher{}, config.OutboxConfig{BatchSize: 2}, log.New(io.Discard, "", 0))
+
+	relay.drain(context.Background())
+
+	if store.remaining != 0 || store.calls != 3 {
+		t.Errorf("Ожидалось 3 порции до опустошения очереди, выполнено %d, осталось %d событий", store.calls, store.remaining)
+	}
+}
+
+// batchStore отдает remaining событий порциями не больше limit
+type batchStore struct {
+	remaining int
+	calls     int
+}
+
+func (s *batchStore) ProcessBatch(ctx context.Context, limit int, handle func(model.Event) error, retry func(model.Event) (time.Duration, bool)) (int, error) {
+	s.calls++
+	published := 0
+	for ; published < limit && s.remaining > 0; published++ {
+		if err := handle(testEvent(int64(s.calls), 1)); err != nil {
+			return published, err
+		}
+		s.remaining--
+	}
+	return published, nil
+}
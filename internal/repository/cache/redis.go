@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/janson/usermicroservice/internal/config"
+)
+
+// defaultSize - число записей LRU кэша, если размер не задан в конфигурации
+const defaultSize = 10000
+
+// NewStore создает хранилище кэша пользователей по конфигурации
+// Используется сервисом и утилитой userctl, чтобы они работали с одним хранилищем redis
+// cfg - настройки кэша
+func NewStore(cfg config.CacheConfig) Store {
+	if cfg.Backend == "redis" {
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+		return NewRedis(client, "userservice:")
+	}
+
+	size := cfg.Size
+	if size == 0 {
+		size = defaultSize
+	}
+	return NewLRU(size)
+}
+
+// Redis - хранилище на сервере с протоколом Redis (Redis, KeyDB, Valkey и совместимые)
+// Позволяет нескольким экземплярам сервиса использовать общий кэш и общую инвалидацию
+type Redis struct {
+	client redis.UniversalClient // Клиент сервера
+	prefix string                // Префикс ключей сервиса
+}
+
+// NewRedis создает новое хранилище на сервере Redis
+// client - клиент сервера
+// prefix - префикс ключей, отделяющий ключи сервиса от других данных на сервере
+func NewRedis(client redis.UniversalClient, prefix string) *Redis {
+	return &Redis{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Get возвращает значение и признак его наличия
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set сохраняет значение на время ttl
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
+
+// Delete удаляет значения по ключам
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = r.prefix + key
+	}
+	return r.client.Del(ctx, prefixed...).Err()
+}
@@ -0,0 +1,118 @@
+// Package cache реализует кэширование чтения пользователей поверх репозитория
+// Значения хранятся во встроенном LRU кэше процесса или на сервере с протоколом Redis
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Store - хранилище кэшированных значений
+type Store interface {
+	// Get возвращает значение и признак его наличия
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set сохраняет значение на время ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete удаляет значения по ключам
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// lruEntry - элемент LRU кэша
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// LRU - кэш в памяти процесса с ограничением числа элементов и временем жизни значений
+// При переполнении вытесняется элемент, к которому дольше всего не обращались
+// Безопасен для одновременного использования из нескольких горутин
+type LRU struct {
+	mu       sync.Mutex
+	capacity int                      // Максимальное число элементов
+	order    *list.List               // Элементы от недавно использованных к давно использованным
+	items    map[string]*list.Element // Элементы по ключам
+	now      func() time.Time
+}
+
+// NewLRU создает новый LRU кэш
+// capacity - максимальное число элементов
+func NewLRU(capacity int) *LRU {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRU{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element, capacity),
+		now:      time.Now,
+	}
+}
+
+// Get возвращает значение, если оно есть и не устарело
+func (c *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(elem)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set сохраняет значение на время ttl
+func (c *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Delete удаляет значения по ключам
+func (c *LRU) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := c.items[key]; ok {
+			c.remove(elem)
+		}
+	}
+	return nil
+}
+
+// Len возвращает текущее число элементов, включая устаревшие, но еще не удаленные
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// remove удаляет элемент, вызывается под блокировкой
+func (c *LRU) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*lruEntry).key)
+}
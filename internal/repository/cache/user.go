@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// Значения по умолчанию для времени жизни записей кэша
+const (
+	defaultTTL         = time.Minute
+	defaultNegativeTTL = 10 * time.Second
+)
+
+// fillTimeout ограничивает чтение из репозитория при промахе: оно не прерывается отменой запроса,
+// который его начал, поэтому срок задается отдельно
+const fillTimeout = 10 * time.Second
+
+// negativeValue - значение, которым кэшируется отсутствие пользователя
+var negativeValue = []byte("null")
+
+// generationShards - число счетчиков поколений ключей; ключи распределяются по счетчикам по хэшу,
+// поэтому память не растет с числом пользователей, а совпадение счетчика лишь отменяет лишнее заполнение
+const generationShards = 256
+
+// metrics - счетчики кэша пользователей, доступные по /debug/vars
+// hits - найдено в кэше, negative_hits - в кэше сохранено отсутствие пользователя,
+// misses - запрос к репозиторию, shared - промах обслужен запросом другой горутины,
+// stale_fills - прочитанное при промахе значение не сохранено из-за сброса записи,
+// errors - ошибки хранилища, invalidations - сброшенные записи
+var metrics = expvar.NewMap("user_cache")
+
+// UserRepository кэширует получение пользователя по ID поверх другого репозитория
+// Записи сбрасываются при изменении и удалении пользователя сразу и повторно после фиксации транзакции,
+// одновременные промахи по одному ключу объединяются в один запрос к репозиторию
+// Промах читается с основного сервера, а не с реплики, и не сохраняется, если во время чтения запись
+// была сброшена (см. generation), поэтому в кэш не попадает состояние до изменения
+// Сбрасываются только записи в хранилище этого экземпляра: изменения других экземпляров с хранилищем memory
+// и изменения userctl без хранилища redis становятся видны по истечении ttl
+// Ошибки хранилища кэша записываются в лог и не прерывают запрос
+type UserRepository struct {
+	next        repository.UserRepository       // Репозиторий, к которому обращается кэш при промахе
+	store       Store                           // Хранилище кэша
+	ttl         time.Duration                   // Время жизни найденного пользователя
+	negativeTTL time.Duration                   // Время жизни записи об отсутствии пользователя
+	group       singleflight.Group              // Объединение одновременных промахов
+	generations [generationShards]atomic.Uint64 // Счетчики сбросов записей по хэшу ключа
+	logger      *log.Logger                     // Логгер для записи ошибок хранилища
+}
+
+// NewUserRepository создает новый кэширующий репозиторий пользователей
+// next - репозиторий с данными
+// store - хранилище кэша
+// ttl - время жизни найденного пользователя (0 - 1m)
+// negativeTTL - время жизни записи об отсутствии пользователя (0 - 10s)
+// logger - логгер для записи ошибок хранилища
+func NewUserRepository(next repository.UserRepository, store Store, ttl, negativeTTL time.Duration, logger *log.Logger) *UserRepository {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if negativeTTL <= 0 {
+		negativeTTL = defaultNegativeTTL
+	}
+
+	return &UserRepository{
+		next:        next,
+		store:       store,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		logger:      logger,
+	}
+}
+
+// Create создает пользователя и сбрасывает запись об отсутствии пользователя с его ID
+func (r *UserRepository) Create(ctx context.Context, user model.UserCreate) (*model.User, error) {
+	created, err := r.next.Create(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	r.invalidate(ctx, created.ID)
+	return created, nil
+}
+
+// GetByID возвращает пользователя из кэша или из репозитория
+// Внутри транзакции кэш не используется, чтобы проверки перед изменением видели актуальные данные
+func (r *UserRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	if postgres.InTx(ctx) {
+		return r.next.GetByID(ctx, id)
+	}
+
+	key := userKey(ctx, id)
+	data, ok, err := r.store.Get(ctx, key)
+	if err != nil {
+		r.storeError("чтение", key, err)
+	} else if ok {
+		var user *model.User
+		if err := json.Unmarshal(data, &user); err == nil {
+			if user == nil {
+				metrics.Add("negative_hits", 1)
+			} else {
+				metrics.Add("hits", 1)
+			}
+			return user, nil
+		}
+		r.storeError("разбор", key, err)
+	}
+
+	metrics.Add("misses", 1)
+	results := r.group.DoChan(key, func() (interface{}, error) {
+		// Результат ожидают все объединенные запросы, поэтому отмена запроса, начавшего чтение,
+		// не должна его прерывать; арендатор и сведения о запросе из контекста сохраняются
+		fillCtx, cancel := context.WithTimeout(detachedContext{ctx}, fillTimeout)
+		defer cancel()
+
+		generation := r.generation(key).Load()
+		user, err := r.next.GetByID(postgres.WithPrimary(fillCtx), id)
+		if err != nil {
+			return nil, err
+		}
+
+		r.set(fillCtx, key, user, generation)
+		return user, nil
+	})
+
+	var result singleflight.Result
+	select {
+	case result = <-results:
+	case <-ctx.Done():
+		// Запрос отменен, чтение продолжается для остальных ожидающих
+		return nil, ctx.Err()
+	}
+	if result.Shared {
+		metrics.Add("shared", 1)
+	}
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	user := result.Val.(*model.User)
+	if user == nil {
+		return nil, nil
+	}
+	copied := *user // Вызывающие стороны не должны разделять один экземпляр
+	return &copied, nil
+}
+
+// GetByEmail получает пользователя по электронной почте без кэширования
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.next.GetByEmail(ctx, email)
+}
+
+// GetAll получает пользователей без кэширования
+func (r *UserRepository) GetAll(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	return r.next.GetAll(ctx, filter)
+}
+
+// Count возвращает количество пользователей без кэширования
+func (r *UserRepository) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	return r.next.Count(ctx, filter)
+}
+
+// Update обновляет пользователя и сбрасывает его запись в кэше
+func (r *UserRepository) Update(ctx context.Context, id int64, user model.UserUpdate) (*model.User, error) {
+	updated, err := r.next.Update(ctx, id, user)
+	if err != nil {
+		return nil, err
+	}
+
+	r.invalidate(ctx, id)
+	return updated, nil
+}
+
+// ChangeStatus изменяет состояние учетной записи и сбрасывает запись пользователя в кэше
+func (r *UserRepository) ChangeStatus(ctx context.Context, id int64, change model.UserStatusChange) (*model.User, error) {
+	updated, err := r.next.ChangeStatus(ctx, id, change)
+	if err != nil {
+		return nil, err
+	}
+
+	r.invalidate(ctx, id)
+	return updated, nil
+}
+
+// Delete удаляет пользователя и сбрасывает его запись в кэше
+func (r *UserRepository) Delete(ctx context.Context, id int64) error {
+	if err := r.next.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, id)
+	return nil
+}
+
+// set сохраняет пользователя или запись о его отсутствии, прочитанные при поколении ключа generation
+// Если запись была сброшена во время чтения, значение устарело и не сохраняется; если сброс пришелся
+// на сохранение, значение удаляется повторно
+func (r *UserRepository) set(ctx context.Context, key string, user *model.User, generation uint64) {
+	counter := r.generation(key)
+	if counter.Load() != generation {
+		metrics.Add("stale_fills", 1)
+		return
+	}
+
+	data, ttl := negativeValue, r.negativeTTL
+	if user != nil {
+		var err error
+		if data, err = json.Marshal(user); err != nil {
+			r.storeError("сериализация", key, err)
+			return
+		}
+		ttl = r.ttl
+	}
+
+	if err := r.store.Set(ctx, key, data, ttl); err != nil {
+		r.storeError("запись", key, err)
+		return
+	}
+
+	// Сброс увеличивает поколение до удаления записи, поэтому удаление после проверки
+	// либо уже выполнено после сохранения, либо выполняется здесь
+	if counter.Load() != generation {
+		metrics.Add("stale_fills", 1)
+		if err := r.store.Delete(ctx, key); err != nil {
+			r.storeError("сброс", key, err)
+		}
+	}
+}
+
+// generation возвращает счетчик сбросов, которым учитывается ключ
+func (r *UserRepository) generation(key string) *atomic.Uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &r.generations[h.Sum32()%generationShards]
+}
+
+// invalidate сбрасывает запись пользователя сразу и повторно после фиксации транзакции,
+// чтобы чтение до фиксации не оставило в кэше старое состояние
+func (r *UserRepository) invalidate(ctx context.Context, id int64) {
+	key := userKey(ctx, id)
+	drop := func() {
+		r.generation(key).Add(1)
+		r.group.Forget(key)
+		if err := r.store.Delete(ctx, key); err != nil {
+			r.storeError("сброс", key, err)
+			return
+		}
+		metrics.Add("invalidations", 1)
+	}
+
+	drop()
+	if postgres.InTx(ctx) {
+		postgres.AfterCommit(ctx, drop)
+	}
+}
+
+// storeError учитывает и записывает в лог ошибку хранилища кэша
+func (r *UserRepository) storeError(op, key string, err error) {
+	metrics.Add("errors", 1)
+	r.logger.Printf("Ошибка кэша пользователей (%s %s): %v", op, key, err)
+}
+
+// userKey возвращает ключ кэша пользователя
+// Ключ включает арендатора из контекста, чтобы пользователь не был возвращен из кэша другому арендатору
+func userKey(ctx context.Context, id int64) string {
+	return "user:" + requestinfo.FromContext(ctx).Tenant() + ":" + strconv.FormatInt(id, 10)
+}
+
+// detachedContext сохраняет значения родительского контекста без его отмены и срока
+// (как context.WithoutCancel, появившийся в Go 1.21)
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// fakeRepository - репозиторий в памяти, считающий обращения к GetByID
+type fakeRepository struct {
+	mu      sync.Mutex
+	users   map[int64]model.User
+	gets    int32
+	release chan struct{} // Если задан, GetByID ждет его закрытия или отмены контекста
+}
+
+func (f *fakeRepository) Create(_ context.Context, user model.UserCreate) (*model.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	created := model.User{ID: int64(len(f.users) + 1), Name: user.Name, Email: user.Email}
+	f.users[created.ID] = created
+	return &created, nil
+}
+
+func (f *fakeRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	atomic.AddInt32(&f.gets, 1)
+	if f.release != nil {
+		select {
+		case <-f.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (f *fakeRepository) GetByEmail(context.Context, string) (*model.User, error) { return nil, nil }
+
+func (f *fakeRepository) GetAll(context.Context, model.UserFilter) ([]model.User, error) {
+	return nil, nil
+}
+
+func (f *fakeRepository) Count(context.Context, model.UserFilter) (int, error) { return 0, nil }
+
+func (f *fakeRepository) ChangeStatus(_ context.Context, id int64, change model.UserStatusChange) (*model.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[id]
+	if !ok {
+		return nil, nil
+	}
+	user.Status = change.Status
+	f.users[id] = user
+	return &user, nil
+}
+
+func (f *fakeRepository) Update(_ context.Context, id int64, update model.UserUpdate) (*model.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[id]
+	if !ok {
+		return nil, nil
+	}
+	user.Name = update.Name
+	f.users[id] = user
+	return &user, nil
+}
+
+func (f *fakeRepository) Delete(_ context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.users, id)
+	return nil
+}
+
+// newTestRepository создает кэширующий репозиторий поверх fakeRepository
+func newTestRepository() (*UserRepository, *fakeRepository) {
+	fake := &fakeRepository{users: map[int64]model.User{}}
+	return NewUserRepository(fake, NewLRU(100), time.Minute, time.Minute, log.New(io.Discard, "", 0)), fake
+}
+
+// TestGetByIDCachesAndInvalidates проверяет кэширование, кэширование отсутствия и сброс при изменениях
+func TestGetByIDCachesAndInvalidates(t *testing.T) {
+	ctx := context.Background()
+	repo, fake := newTestRepository()
+
+	// Отсутствие пользователя кэшируется, создание сбрасывает эту запись
+	for i := 0; i < 2; i++ {
+		if user, err := repo.GetByID(ctx, 1); err != nil || user != nil {
+			t.Fatalf("Ожидалось отсутствие пользователя, получено %v, %v", user, err)
+		}
+	}
+	if fake.gets != 1 {
+		t.Errorf("Отсутствие пользователя должно кэшироваться, обращений к репозиторию: %d", fake.gets)
+	}
+
+	if _, err := repo.Create(ctx, model.UserCreate{Name: "Old", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if user, _ := repo.GetByID(ctx, 1); user == nil || user.Name != "Old" {
+			t.Fatalf("Ожидался созданный пользователь, получено %+v", user)
+		}
+	}
+	if fake.gets != 2 {
+		t.Errorf("Ожидалось 2 обращения к репозиторию, выполнено %d", fake.gets)
+	}
+
+	if _, err := repo.Update(ctx, 1, model.UserUpdate{Name: "New"}); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := repo.GetByID(ctx, 1); user == nil || user.Name != "New" {
+		t.Errorf("После обновления ожидалось новое имя, получено %+v", user)
+	}
+
+	if err := repo.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := repo.GetByID(ctx, 1); user != nil {
+		t.Errorf("После удаления ожидалось отсутствие пользователя, получено %+v", user)
+	}
+}
+
+// TestGetByIDDiscardsStaleFill проверяет, что значение, прочитанное до сброса записи, не сохраняется в кэше
+func TestGetByIDDiscardsStaleFill(t *testing.T) {
+	ctx := context.Background()
+	repo, fake := newTestRepository()
+	fake.users[1] = model.User{ID: 1, Name: "Old"}
+	fake.release = make(chan struct{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		repo.GetByID(ctx, 1)
+	}()
+	for atomic.LoadInt32(&fake.gets) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Изменение во время чтения увеличивает поколение ключа
+	if _, err := repo.Update(ctx, 1, model.UserUpdate{Name: "New"}); err != nil {
+		t.Fatal(err)
+	}
+	close(fake.release)
+	<-done
+
+	if user, _ := repo.GetByID(ctx, 1); user == nil || user.Name != "New" {
+		t.Errorf("Ожидалось новое имя, получено %+v", user)
+	}
+	if gets := atomic.LoadInt32(&fake.gets); gets != 2 {
+		t.Errorf("Значение, прочитанное до сброса, не должно кэшироваться, обращений к репозиторию: %d", gets)
+	}
+	if user, _ := repo.GetByID(ctx, 1); user == nil || atomic.LoadInt32(&fake.gets) != 2 {
+		t.Errorf("Значение после сброса должно кэшироваться, обращений к репозиторию: %d", fake.gets)
+	}
+}
+
+// TestGetByIDCollapsesConcurrentMisses проверяет объединение одновременных промахов в один запрос
+func TestGetByIDCollapsesConcurrentMisses(t *testing.T) {
+	repo, fake := newTestRepository()
+	fake.users[1] = model.User{ID: 1, Name: "A"}
+	fake.release = make(chan struct{})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			defer wg.Done()
+			if user, err := repo.GetByID(context.Background(), 1); err != nil || user == nil {
+				t.Errorf("Ожидался пользователь, получено %v, %v", user, err)
+			}
+		}()
+	}
+
+	// Ждем, пока первый запрос дойдет до репозитория, и даем остальным присоединиться к нему
+	for atomic.LoadInt32(&fake.gets) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(fake.release)
+	wg.Wait()
+
+	if fake.gets != 1 {
+		t.Errorf("Ожидалось 1 обращение к репозиторию, выполнено %d", fake.gets)
+	}
+}
+
+// TestGetByIDSurvivesCanceledCaller проверяет, что отмена запроса, начавшего чтение при промахе,
+// прерывает только его, а объединенные с ним запросы получают пользователя
+func TestGetByIDSurvivesCanceledCaller(t *testing.T) {
+	repo, fake := newTestRepository()
+	fake.users[1] = model.User{ID: 1, Name: "A"}
+	fake.release = make(chan struct{})
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := repo.GetByID(first, 1)
+		firstErr <- err
+	}()
+	for atomic.LoadInt32(&fake.gets) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	type result struct {
+		user *model.User
+		err  error
+	}
+	second := make(chan result, 1)
+	go func() {
+		user, err := repo.GetByID(context.Background(), 1)
+		second <- result{user, err}
+	}()
+	time.Sleep(20 * time.Millisecond) // Даем второму запросу присоединиться к чтению
+
+	cancel()
+	select {
+	case err := <-firstErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Отмененный запрос: ожидалась ошибка %v, получено %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Отмененный запрос не завершился до окончания чтения")
+	}
+
+	close(fake.release)
+	got := <-second
+	if got.err != nil || got.user == nil || got.user.Name != "A" {
+		t.Errorf("Объединенный запрос: ожидался пользователь, получено %v, %v", got.user, got.err)
+	}
+	if gets := atomic.LoadInt32(&fake.gets); gets != 1 {
+		t.Errorf("Ожидалось 1 обращение к репозиторию, выполнено %d", gets)
+	}
+}
+
+// TestGetByIDSeparatesTenants проверяет, что записи кэша одного арендатора не возвращаются другому
+func TestGetByIDSeparatesTenants(t *testing.T) {
+	repo, fake := newTestRepository()
+	fake.users[1] = model.User{ID: 1, TenantID: "acme", Name: "Alice"}
+
+	acme := requestinfo.WithInfo(context.Background(), requestinfo.Info{TenantID: "acme"})
+	other := requestinfo.WithInfo(context.Background(), requestinfo.Info{TenantID: "other"})
+
+	for _, ctx := range []context.Context{acme, acme, other} {
+		if _, err := repo.GetByID(ctx, 1); err != nil {
+			t.Fatalf("Ошибка получения пользователя: %v", err)
+		}
+	}
+
+	if gets := atomic.LoadInt32(&fake.gets); gets != 2 {
+		t.Errorf("Ожидалось 2 обращения к репозиторию (по одному на арендатора), выполнено %d", gets)
+	}
+}
+
+// TestLRUEvictionAndTTL проверяет вытеснение давно использованных и устаревших записей
+func TestLRUEvictionAndTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	lru := NewLRU(2)
+	lru.now = func() time.Time { return now }
+
+	lru.Set(ctx, "a", []byte("1"), time.Minute)
+	lru.Set(ctx, "b", []byte("2"), time.Second)
+	lru.Get(ctx, "a")
+	lru.Set(ctx, "c", []byte("3"), time.Minute)
+
+	if _, ok, _ := lru.Get(ctx, "b"); ok {
+		t.Error("Давно использованная запись должна быть вытеснена")
+	}
+	if _, ok, _ := lru.Get(ctx, "a"); !ok {
+		t.Error("Недавно использованная запись должна остаться")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := lru.Get(ctx, "c"); ok {
+		t.Error("Устаревшая запись не должна возвращаться")
+	}
+	if lru.Len() != 1 {
+		t.Errorf("Ожидалась 1 запись, получено %d", lru.Len())
+	}
+}
@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// apiKeyColumns - столбцы ключа API в порядке сканирования scanAPIKey
+const apiKeyColumns = "id, tenant_id, name, prefix, scopes, created_by, expires_at, last_used_at, revoked_at, created_at"
+
+// APIKeyRepository обрабатывает операции с ключами API
+// Все запросы ограничены арендатором из сведений о запросе в контексте (requestinfo.Info.Tenant)
+type APIKeyRepository struct {
+	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+}
+
+// NewAPIKeyRepository создает новый репозиторий ключей API
+// db - пул соединений с базой данных
+func NewAPIKeyRepository(db *pgxpool.Pool) *APIKeyRepository {
+	return &APIKeyRepository{
+		db: db,
+	}
+}
+
+// scanAPIKey сканирует строку со столбцами apiKeyColumns в структуру ключа API
+func scanAPIKey(row pgx.Row) (*model.APIKey, error) {
+	var key model.APIKey
+	err := row.Scan(&key.ID, &key.TenantID, &key.Name, &key.Prefix, &key.Scopes, &key.CreatedBy, &key.ExpiresAt,
+		&key.LastUsedAt, &key.RevokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Create добавляет новый ключ API
+// Инициатор создания берется из сведений о запросе в контексте
+// ctx - контекст для операции с базой данных
+// key - название, префикс, разрешения и срок действия ключа
+// keyHash - хэш ключа
+func (r *APIKeyRepository) Create(ctx context.Context, key model.APIKey, keyHash string) (*model.APIKey, error) {
+	query := `
+		INSERT INTO api_keys (tenant_id, name, prefix, key_hash, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + apiKeyColumns
+
+	info := requestinfo.FromContext(ctx)
+	return scanAPIKey(conn(ctx, r.db).QueryRow(ctx, query, info.Tenant(), key.Name, key.Prefix, keyHash, key.Scopes,
+		info.Actor, key.ExpiresAt))
+}
+
+// GetByHash получает ключ API по хэшу ключа, в том числе отозванный или истекший
+// Возвращает nil без ошибки, если ключ не найден
+// ctx - контекст для операции с базой данных
+// keyHash - хэш ключа
+func (r *APIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE key_hash = $1 AND tenant_id = $2"
+
+	key, err := scanAPIKey(conn(ctx, r.db).QueryRow(ctx, query, keyHash, requestinfo.FromContext(ctx).Tenant()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// List получает страницу неотозванных ключей API, начиная с самых новых
+// ctx - контекст для операции с базой данных
+// limit, offset - параметры постраничной выборки
+// Возвращает ключи страницы и общее количество неотозванных ключей
+func (r *APIKeyRepository) List(ctx context.Context, limit, offset int) ([]model.APIKey, int, error) {
+	tenantID := requestinfo.FromContext(ctx).Tenant()
+	where := "WHERE tenant_id = $1 AND revoked_at IS NULL"
+
+	var total int
+	if err := conn(ctx, r.db).QueryRow(ctx, "SELECT COUNT(*) FROM api_keys "+where, tenantID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + apiKeyColumns + " FROM api_keys " + where + " ORDER BY id DESC LIMIT $2 OFFSET $3"
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, tenantID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		keys = append(keys, *key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return keys, total, nil
+}
+
+// Revoke отзывает ключ API
+// Возвращает false, если ключ не найден или уже отозван
+// ctx - контекст для операции с базой данных
+// id - идентификатор ключа
+func (r *APIKeyRepository) Revoke(ctx context.Context, id int64) (bool, error) {
+	commandTag, err := conn(ctx, r.db).Exec(ctx,
+		"UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL",
+		id, requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// TouchLastUsed обновляет время последнего использования ключа
+// Время обновляется не чаще одного раза за interval, чтобы частые запросы не нагружали базу данных записью
+// ctx - контекст для операции с базой данных
+// id - идентификатор ключа
+// now - время использования
+// interval - минимальный интервал между обновлениями
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id int64, now time.Time, interval time.Duration) error {
+	_, err := conn(ctx, r.db).Exec(ctx, `
+		UPDATE api_keys SET last_used_at = $1
+		WHERE id = $2 AND tenant_id = $3 AND (last_used_at IS NULL OR last_used_at <= $4)`,
+		now, id, requestinfo.FromContext(ctx).Tenant(), now.Add(-interval))
+	return err
+}
@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// AuditRepository обрабатывает чтение журнала аудита изменений пользователей
+// Запись в журнал выполняется UserRepository в транзакции изменения
+type AuditRepository struct {
+	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+}
+
+// NewAuditRepository создает новый репозиторий журнала аудита
+// db - пул соединений с базой данных
+func NewAuditRepository(db *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{
+		db: db,
+	}
+}
+
+// insertAudit записывает изменение пользователя в журнал аудита в рамках переданной транзакции
+// Инициатор, ID запроса, IP-адрес и арендатор берутся из контекста запроса
+// action - действие (create, update, delete)
+// reason - причина изменения (пустая строка - не указана)
+// before - состояние до изменения (nil для создания)
+// after - состояние после изменения (nil для удаления)
+func insertAudit(ctx context.Context, tx pgx.Tx, action, reason string, before, after *model.User) error {
+	diff, err := model.DiffUsers(before, after)
+	if err != nil {
+		return err
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+
+	userID := int64(0)
+	if after != nil {
+		userID = after.ID
+	} else if before != nil {
+		userID = before.ID
+	}
+
+	info := requestinfo.FromContext(ctx)
+
+	query := `
+		INSERT INTO user_audit (user_id, action, actor, request_id, ip, diff, tenant_id, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err = tx.Exec(ctx, query, userID, action, info.Actor, info.RequestID, info.IP, diffJSON, info.Tenant(), reason)
+	return err
+}
+
+// insertAuditNote блокирует пользователя до конца транзакции и записывает в журнал аудита изменение
+// без изменения полей пользователя (например, смену пароля) с причиной reason
+// Возвращает false, если пользователь не найден
+func insertAuditNote(ctx context.Context, tx pgx.Tx, userID int64, reason string) (bool, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = $1 AND tenant_id = $2 FOR UPDATE"
+
+	var user model.User
+	if err := scanUser(tx.QueryRow(ctx, query, userID, requestinfo.FromContext(ctx).Tenant()), &user); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, insertAudit(ctx, tx, model.AuditActionUpdate, reason, &user, &user)
+}
+
+// ListByUser получает историю изменений пользователя, начиная с самых новых записей
+// Возвращаются только записи арендатора из контекста запроса
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+// limit, offset - параметры постраничной выборки
+// Возвращает записи страницы и общее количество записей по пользователю
+func (r *AuditRepository) ListByUser(ctx context.Context, userID int64, limit, offset int) ([]model.AuditEntry, int, error) {
+	tenantID := requestinfo.FromContext(ctx).Tenant()
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM user_audit WHERE tenant_id = $1 AND user_id = $2"
+	if err := conn(ctx, r.db).QueryRow(ctx, countQuery, tenantID, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, user_id, tenant_id, action, actor, request_id, ip, diff, reason, created_at
+		FROM user_audit
+		WHERE tenant_id = $1 AND user_id = $2
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, tenantID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		var entry model.AuditEntry
+		var diff []byte
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.TenantID, &entry.Action, &entry.Actor,
+			&entry.RequestID, &entry.IP, &diff, &entry.Reason, &entry.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal(diff, &entry.Diff); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// CredentialRepository обрабатывает операции с паролями пользователей и учетом неудачных попыток входа
+// Все запросы ограничены арендатором из сведений о запросе в контексте (requestinfo.Info.Tenant)
+type CredentialRepository struct {
+	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+}
+
+// NewCredentialRepository создает новый репозиторий учетных данных
+// db - пул соединений с базой данных
+func NewCredentialRepository(db *pgxpool.Pool) *CredentialRepository {
+	return &CredentialRepository{
+		db: db,
+	}
+}
+
+// GetPasswordHash получает хэш пароля пользователя
+// Возвращает пустую строку без ошибки, если пароль не установлен
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+func (r *CredentialRepository) GetPasswordHash(ctx context.Context, userID int64) (string, error) {
+	var hash string
+	err := conn(ctx, r.db).QueryRow(ctx,
+		"SELECT password_hash FROM user_credentials WHERE user_id = $1 AND tenant_id = $2",
+		userID, requestinfo.FromContext(ctx).Tenant()).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return hash, err
+}
+
+// SetPasswordHash устанавливает хэш пароля пользователя
+// Смена пароля записывается в журнал аудита с причиной reason; сам хэш в журнал не попадает
+// Возвращает false, если пользователь не найден
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+// hash - хэш нового пароля
+// reason - причина для журнала аудита
+func (r *CredentialRepository) SetPasswordHash(ctx context.Context, userID int64, hash, reason string) (bool, error) {
+	query := `
+		INSERT INTO user_credentials (user_id, tenant_id, password_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET password_hash = EXCLUDED.password_hash, updated_at = NOW()
+	`
+
+	found := false
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		var err error
+		if found, err = insertAuditNote(ctx, tx, userID, reason); err != nil || !found {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, query, userID, requestinfo.FromContext(ctx).Tenant(), hash)
+		return err
+	})
+
+	return found, err
+}
+
+// ReserveAttempt проверяет ограничение входа и учитывает попытку как неудачную до проверки пароля или кода
+// Строки учета по всем ключам создаются при необходимости и блокируются до конца транзакции, поэтому
+// одновременные попытки для одной учетной записи или IP-адреса обрабатываются по очереди и каждая видит
+// попытки, учтенные предыдущими. Ключи блокируются в переданном порядке: учетная запись, затем IP-адрес
+// reserve получает текущий учет по ключу и возвращает учет после попытки или ошибку, если попытка
+// не разрешена; тогда транзакция откатывается и учет не меняется
+// Возвращает учет после попытки по каждому ключу в порядке keys
+// ctx - контекст для операции с базой данных
+// keys - учетная запись и IP-адрес попытки
+// reserve - решение о попытке по текущему учету
+func (r *CredentialRepository) ReserveAttempt(ctx context.Context, keys []model.LoginKey,
+	reserve func(key model.LoginKey, attempts model.LoginAttempts) (model.LoginAttempts, error)) ([]model.LoginAttempts, error) {
+	// ON CONFLICT DO UPDATE блокирует существующую строку и возвращает ее последнюю версию
+	lockQuery := `
+		INSERT INTO login_attempts AS a (tenant_id, scope, key, failures, last_failure_at)
+		VALUES ($1, $2, $3, 0, NOW())
+		ON CONFLICT (tenant_id, scope, key) DO UPDATE SET failures = a.failures
+		RETURNING failures, last_failure_at, locked_until
+	`
+	updateQuery := `
+		UPDATE login_attempts SET failures = $4, last_failure_at = $5, locked_until = $6
+		WHERE tenant_id = $1 AND scope = $2 AND key = $3
+	`
+
+	tenantID := requestinfo.FromContext(ctx).Tenant()
+	var reserved []model.LoginAttempts
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		reserved = make([]model.LoginAttempts, 0, len(keys))
+		for _, key := range keys {
+			attempts, err := scanAttempts(tx.QueryRow(ctx, lockQuery, tenantID, key.Scope, key.Key))
+			if err != nil {
+				return err
+			}
+
+			next, err := reserve(key, attempts)
+			if err != nil {
+				return err
+			}
+			var lockedUntil *time.Time
+			if !next.LockedUntil.IsZero() {
+				lockedUntil = &next.LockedUntil
+			}
+			if _, err := tx.Exec(ctx, updateQuery, tenantID, key.Scope, key.Key, next.Failures, next.LastFailureAt,
+				lockedUntil); err != nil {
+				return err
+			}
+			reserved = append(reserved, next)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reserved, nil
+}
+
+// ReleaseAttempt отменяет учет попытки, зарезервированной ReserveAttempt, если она оказалась успешной
+// Снимается и блокировка, если ее установила эта попытка
+// ctx - контекст для операции с базой данных
+// key - учетная запись или IP-адрес попытки
+// reserved - учет после попытки, возвращенный ReserveAttempt
+func (r *CredentialRepository) ReleaseAttempt(ctx context.Context, key model.LoginKey, reserved model.LoginAttempts) error {
+	query := `
+		UPDATE login_attempts
+		SET failures = GREATEST(failures - 1, 0), locked_until = CASE WHEN $4 THEN NULL ELSE locked_until END
+		WHERE tenant_id = $1 AND scope = $2 AND key = $3
+	`
+
+	_, err := conn(ctx, r.db).Exec(ctx, query, requestinfo.FromContext(ctx).Tenant(), key.Scope, key.Key,
+		!reserved.LockedUntil.IsZero())
+	return err
+}
+
+// ResetAttempts удаляет учет неудачных попыток входа и блокировку
+// ctx - контекст для операции с базой данных
+// scope - область учета
+// key - электронная почта или IP-адрес
+func (r *CredentialRepository) ResetAttempts(ctx context.Context, scope, key string) error {
+	_, err := conn(ctx, r.db).Exec(ctx,
+		"DELETE FROM login_attempts WHERE tenant_id = $1 AND scope = $2 AND key = $3",
+		requestinfo.FromContext(ctx).Tenant(), scope, key)
+	return err
+}
+
+// scanAttempts сканирует строку учета неудачных попыток входа
+func scanAttempts(row pgx.Row) (model.LoginAttempts, error) {
+	var attempts model.LoginAttempts
+	var lockedUntil *time.Time
+	if err := row.Scan(&attempts.Failures, &attempts.LastFailureAt, &lockedUntil); err != nil {
+		return model.LoginAttempts{}, err
+	}
+	if lockedUntil != nil {
+		attempts.LockedUntil = *lockedUntil
+	}
+	return attempts, nil
+}
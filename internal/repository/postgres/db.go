@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// Значения по умолчанию для подключения к базе данных
+const (
+	defaultConnectAttempts = 10
+	connectInitialBackoff  = 500 * time.Millisecond
+	connectMaxBackoff      = 10 * time.Second
+)
+
+// Connect создает пул соединений с основным сервером базы данных
+// Если сервер еще недоступен (например, контейнер PostgreSQL запускается одновременно с сервисом),
+// подключение повторяется с экспоненциальной задержкой до database.connect_attempts раз
+// ctx - контекст, отмена которого прекращает повторы
+// cfg - настройки базы данных
+// logger - логгер для записи неудачных попыток
+func Connect(ctx context.Context, cfg config.DatabaseConfig, logger *log.Logger) (*pgxpool.Pool, error) {
+	poolConfig, err := newPoolConfig(cfg.ConnectionString(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := cfg.ConnectAttempts
+	if attempts <= 0 {
+		attempts = defaultConnectAttempts
+	}
+
+	backoff := connectInitialBackoff
+	for attempt := 1; ; attempt++ {
+		pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
+		if err == nil {
+			return pool, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			return nil, err
+		}
+
+		logger.Printf("Попытка подключения к базе данных %d из %d не удалась: %v, повтор через %s", attempt, attempts, err, backoff)
+		if err := sleepJitter(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+		if backoff > connectMaxBackoff {
+			backoff = connectMaxBackoff
+		}
+	}
+}
+
+// setTenant записывает арендатора из контекста в параметр сеанса app.tenant_id перед выдачей соединения из пула
+// Параметр используется политиками row-level security таблиц users, user_audit, groups и group_members
+// Значение перезаписывается при каждой выдаче, поэтому не переходит к запросам другого арендатора
+// Соединение, на котором не удалось задать параметр, закрывается пулом
+func setTenant(ctx context.Context, conn *pgx.Conn) bool {
+	_, err := conn.Exec(ctx, "SELECT set_config('app.tenant_id', $1, false)", requestinfo.FromContext(ctx).Tenant())
+	return err == nil
+}
+
+// RowLevelSecurityEnabled сообщает, включена ли row-level security для таблиц users и user_audit
+// Используется при запуске, чтобы предупредить о настройке database.row_level_security без включенных политик
+func RowLevelSecurityEnabled(ctx context.Context, db *pgxpool.Pool) (bool, error) {
+	query := `
+		SELECT bool_and(relrowsecurity)
+		FROM pg_class
+		WHERE oid IN ('users'::regclass, 'user_audit'::regclass)
+	`
+
+	var enabled bool
+	err := db.QueryRow(ctx, query).Scan(&enabled)
+	return enabled, err
+}
+
+// newPoolConfig создает настройки пула соединений из строки подключения
+// Параметры пула, таймаут подключения и таймаут выполнения запроса берутся из конфигурации,
+// незаданные параметры остаются значениями pgxpool по умолчанию
+// dsn - строка подключения к серверу
+// cfg - настройки базы данных
+func newPoolConfig(dsn string, cfg config.DatabaseConfig) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime.Duration > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime.Duration
+	}
+	if cfg.MaxConnIdleTime.Duration > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime.Duration
+	}
+	if cfg.HealthCheckPeriod.Duration > 0 {
+		poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod.Duration
+	}
+	if cfg.ConnectTimeout.Duration > 0 {
+		poolConfig.ConnConfig.ConnectTimeout = cfg.ConnectTimeout.Duration
+	}
+
+	// Сервер прерывает любой запрос, выполняющийся дольше statement_timeout
+	if cfg.StatementTimeout.Duration > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if cfg.RowLevelSecurity {
+		poolConfig.BeforeAcquire = setTenant
+	}
+
+	return poolConfig, nil
+}
@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+)
+
+// TestNewPoolConfig проверяет перенос параметров пула и таймаутов из конфигурации
+func TestNewPoolConfig(t *testing.T) {
+	cfg := config.DatabaseConfig{
+		Host: "localhost", Port: "5432", User: "postgres", DBName: "userservice", SSLMode: "disable",
+		MaxConns:         20,
+		MinConns:         5,
+		MaxConnLifetime:  config.Duration{Duration: time.Hour},
+		StatementTimeout: config.Duration{Duration: 1500 * time.Millisecond},
+		ConnectTimeout:   config.Duration{Duration: 3 * time.Second},
+	}
+
+	poolConfig, err := newPoolConfig(cfg.ConnectionString(), cfg)
+	if err != nil {
+		t.Fatalf("Ошибка создания настроек пула: %v", err)
+	}
+
+	if poolConfig.MaxConns != 20 || poolConfig.MinConns != 5 || poolConfig.MaxConnLifetime != time.Hour {
+		t.Errorf("Параметры пула не применены: %+v", poolConfig)
+	}
+	if poolConfig.ConnConfig.ConnectTimeout != 3*time.Second {
+		t.Errorf("Ожидался таймаут подключения 3s, получен %s", poolConfig.ConnConfig.ConnectTimeout)
+	}
+	if got := poolConfig.ConnConfig.RuntimeParams["statement_timeout"]; got != "1500" {
+		t.Errorf("Ожидался statement_timeout 1500, получен %q", got)
+	}
+}
@@ -0,0 +1,316 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// Списки столбцов в порядке сканирования scanGroup и scanGroupMember
+const (
+	groupColumns       = "id, tenant_id, name, description, created_at, updated_at"
+	groupMemberColumns = "group_id, user_id, role, created_at"
+)
+
+// GroupRepository обрабатывает операции с группами пользователей и участием в них
+// Все запросы ограничены арендатором из сведений о запросе в контексте (requestinfo.Info.Tenant)
+type GroupRepository struct {
+	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+}
+
+// NewGroupRepository создает новый репозиторий групп
+// db - пул соединений с базой данных
+func NewGroupRepository(db *pgxpool.Pool) *GroupRepository {
+	return &GroupRepository{
+		db: db,
+	}
+}
+
+// scanGroup сканирует строку со столбцами groupColumns в структуру группы
+func scanGroup(row pgx.Row) (*model.Group, error) {
+	var group model.Group
+	err := row.Scan(&group.ID, &group.TenantID, &group.Name, &group.Description, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// scanGroupMember сканирует строку со столбцами groupMemberColumns в структуру участника
+func scanGroupMember(row pgx.Row) (*model.GroupMember, error) {
+	var member model.GroupMember
+	if err := row.Scan(&member.GroupID, &member.UserID, &member.Role, &member.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// Create добавляет новую группу
+// Возвращает ErrDuplicate, если группа с таким названием уже есть у арендатора
+// ctx - контекст для операции с базой данных
+// group - данные группы
+func (r *GroupRepository) Create(ctx context.Context, group model.GroupCreate) (*model.Group, error) {
+	query := `
+		INSERT INTO groups (tenant_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING ` + groupColumns
+
+	created, err := scanGroup(conn(ctx, r.db).QueryRow(ctx, query,
+		requestinfo.FromContext(ctx).Tenant(), group.Name, group.Description))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrDuplicate
+		}
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetByID получает группу по идентификатору
+// Возвращает nil без ошибки, если группа не найдена
+// ctx - контекст для операции с базой данных
+// id - идентификатор группы
+func (r *GroupRepository) GetByID(ctx context.Context, id int64) (*model.Group, error) {
+	query := "SELECT " + groupColumns + " FROM groups WHERE id = $1 AND tenant_id = $2"
+
+	group, err := scanGroup(conn(ctx, r.db).QueryRow(ctx, query, id, requestinfo.FromContext(ctx).Tenant()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// GetAll получает страницу групп арендатора, отсортированных по ID
+// ctx - контекст для операции с базой данных
+// limit, offset - параметры постраничной выборки
+// Возвращает группы страницы и общее количество групп
+func (r *GroupRepository) GetAll(ctx context.Context, limit, offset int) ([]model.Group, int, error) {
+	tenantID := requestinfo.FromContext(ctx).Tenant()
+
+	var total int
+	if err := conn(ctx, r.db).QueryRow(ctx, "SELECT COUNT(*) FROM groups WHERE tenant_id = $1", tenantID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + groupColumns + " FROM groups WHERE tenant_id = $1 ORDER BY id LIMIT $2 OFFSET $3"
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, tenantID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	groups := []model.Group{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, *group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return groups, total, nil
+}
+
+// Update сохраняет измененную группу
+// Возвращает nil без ошибки, если группа не найдена, и ErrDuplicate, если новое название уже занято
+// ctx - контекст для операции с базой данных
+// group - группа с измененными полями
+func (r *GroupRepository) Update(ctx context.Context, group model.Group) (*model.Group, error) {
+	query := `
+		UPDATE groups
+		SET name = $1, description = $2, updated_at = NOW()
+		WHERE id = $3 AND tenant_id = $4
+		RETURNING ` + groupColumns
+
+	updated, err := scanGroup(conn(ctx, r.db).QueryRow(ctx, query, group.Name, group.Description,
+		group.ID, requestinfo.FromContext(ctx).Tenant()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if isUniqueViolation(err) {
+			return nil, ErrDuplicate
+		}
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Delete удаляет группу вместе с участием в ней
+// Возвращает false, если группа не найдена
+// ctx - контекст для операции с базой данных
+// id - идентификатор группы
+func (r *GroupRepository) Delete(ctx context.Context, id int64) (bool, error) {
+	commandTag, err := conn(ctx, r.db).Exec(ctx, "DELETE FROM groups WHERE id = $1 AND tenant_id = $2",
+		id, requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// AddMember добавляет пользователя в группу
+// Существование группы и пользователя у арендатора проверяет вызывающий код
+// Возвращает ErrDuplicate, если пользователь уже состоит в группе
+// ctx - контекст для операции с базой данных
+// member - группа, пользователь и роль
+func (r *GroupRepository) AddMember(ctx context.Context, member model.GroupMember) (*model.GroupMember, error) {
+	query := `
+		INSERT INTO group_members (group_id, user_id, role, tenant_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + groupMemberColumns
+
+	added, err := scanGroupMember(conn(ctx, r.db).QueryRow(ctx, query, member.GroupID, member.UserID, member.Role,
+		requestinfo.FromContext(ctx).Tenant()))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrDuplicate
+		}
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// UpdateMember изменяет роль участника группы
+// Возвращает nil без ошибки, если пользователь не состоит в группе
+// ctx - контекст для операции с базой данных
+// groupID - идентификатор группы
+// userID - идентификатор участника
+// role - новая роль
+func (r *GroupRepository) UpdateMember(ctx context.Context, groupID, userID int64, role string) (*model.GroupMember, error) {
+	query := `
+		UPDATE group_members
+		SET role = $1
+		WHERE group_id = $2 AND user_id = $3 AND tenant_id = $4
+		RETURNING ` + groupMemberColumns
+
+	updated, err := scanGroupMember(conn(ctx, r.db).QueryRow(ctx, query, role, groupID, userID,
+		requestinfo.FromContext(ctx).Tenant()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// RemoveMember исключает пользователя из группы
+// Возвращает false, если пользователь не состоит в группе
+// ctx - контекст для операции с базой данных
+// groupID - идентификатор группы
+// userID - идентификатор участника
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupID, userID int64) (bool, error) {
+	commandTag, err := conn(ctx, r.db).Exec(ctx,
+		"DELETE FROM group_members WHERE group_id = $1 AND user_id = $2 AND tenant_id = $3",
+		groupID, userID, requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// ListMembers получает страницу участников группы в порядке добавления
+// ctx - контекст для операции с базой данных
+// groupID - идентификатор группы
+// limit, offset - параметры постраничной выборки
+// Возвращает участников страницы и общее количество участников
+func (r *GroupRepository) ListMembers(ctx context.Context, groupID int64, limit, offset int) ([]model.GroupMember, int, error) {
+	tenantID := requestinfo.FromContext(ctx).Tenant()
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM group_members WHERE tenant_id = $1 AND group_id = $2"
+	if err := conn(ctx, r.db).QueryRow(ctx, countQuery, tenantID, groupID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + groupMemberColumns + ` FROM group_members
+		WHERE tenant_id = $1 AND group_id = $2
+		ORDER BY created_at, user_id
+		LIMIT $3 OFFSET $4`
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, tenantID, groupID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	members := []model.GroupMember{}
+	for rows.Next() {
+		member, err := scanGroupMember(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		members = append(members, *member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return members, total, nil
+}
+
+// ListByUser получает все группы, в которых состоит пользователь, вместе с его ролью
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+func (r *GroupRepository) ListByUser(ctx context.Context, userID int64) ([]model.UserGroup, error) {
+	query := `
+		SELECT g.id, g.tenant_id, g.name, g.description, g.created_at, g.updated_at, m.role, m.created_at
+		FROM group_members m
+		JOIN groups g ON g.id = m.group_id
+		WHERE m.tenant_id = $1 AND m.user_id = $2
+		ORDER BY g.id
+	`
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, requestinfo.FromContext(ctx).Tenant(), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []model.UserGroup{}
+	for rows.Next() {
+		var group model.UserGroup
+		if err := rows.Scan(&group.ID, &group.TenantID, &group.Name, &group.Description,
+			&group.CreatedAt, &group.UpdatedAt, &group.Role, &group.JoinedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// RemoveUser исключает пользователя из всех групп
+// Вызывается сервисом пользователей в транзакции удаления пользователя
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+func (r *GroupRepository) RemoveUser(ctx context.Context, userID int64) error {
+	_, err := conn(ctx, r.db).Exec(ctx, "DELETE FROM group_members WHERE user_id = $1 AND tenant_id = $2",
+		userID, requestinfo.FromContext(ctx).Tenant())
+	return err
+}
@@ -0,0 +1,226 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// identityColumns - столбцы привязки в порядке сканирования scanIdentity
+const identityColumns = "id, tenant_id, user_id, provider, subject, email, created_at, last_login_at"
+
+// IdentityRepository обрабатывает операции с учетными записями внешних поставщиков удостоверений
+// и незавершенными входами через них
+// Все запросы ограничены арендатором из сведений о запросе в контексте (requestinfo.Info.Tenant)
+type IdentityRepository struct {
+	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+}
+
+// NewIdentityRepository создает новый репозиторий внешних учетных записей
+// db - пул соединений с базой данных
+func NewIdentityRepository(db *pgxpool.Pool) *IdentityRepository {
+	return &IdentityRepository{
+		db: db,
+	}
+}
+
+// scanIdentity сканирует строку со столбцами identityColumns в структуру привязки
+func scanIdentity(row pgx.Row) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := row.Scan(&identity.ID, &identity.TenantID, &identity.UserID, &identity.Provider, &identity.Subject,
+		&identity.Email, &identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateState сохраняет параметры начатого входа через поставщика
+// Истекшие незавершенные входы арендатора удаляются
+// ctx - контекст для операции с базой данных
+// state - поставщик, nonce, code_verifier и срок действия
+// stateHash - хэш параметра state
+func (r *IdentityRepository) CreateState(ctx context.Context, state model.IdentityLoginState, stateHash string) error {
+	return withTx(ctx, r.db, func(tx pgx.Tx) error {
+		tenantID := requestinfo.FromContext(ctx).Tenant()
+		if _, err := tx.Exec(ctx, "DELETE FROM identity_login_states WHERE tenant_id = $1 AND expires_at < NOW()",
+			tenantID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO identity_login_states (state_hash, tenant_id, provider, nonce, code_verifier, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			stateHash, tenantID, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+		return err
+	})
+}
+
+// ConsumeState получает и удаляет параметры начатого входа, чтобы возврат от поставщика нельзя было повторить
+// Возвращает nil без ошибки, если вход не найден
+// ctx - контекст для операции с базой данных
+// stateHash - хэш параметра state
+func (r *IdentityRepository) ConsumeState(ctx context.Context, stateHash string) (*model.IdentityLoginState, error) {
+	query := `
+		DELETE FROM identity_login_states
+		WHERE state_hash = $1 AND tenant_id = $2
+		RETURNING provider, nonce, code_verifier, expires_at`
+
+	var state model.IdentityLoginState
+	err := conn(ctx, r.db).QueryRow(ctx, query, stateHash, requestinfo.FromContext(ctx).Tenant()).Scan(
+		&state.Provider, &state.Nonce, &state.CodeVerifier, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// GetBySubject получает привязку по поставщику и идентификатору пользователя у поставщика
+// Возвращает nil без ошибки, если привязка не найдена
+// ctx - контекст для операции с базой данных
+// provider - имя поставщика
+// subject - идентификатор пользователя у поставщика
+func (r *IdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	query := "SELECT " + identityColumns + " FROM user_identities WHERE provider = $1 AND subject = $2 AND tenant_id = $3"
+
+	identity, err := scanIdentity(conn(ctx, r.db).QueryRow(ctx, query, provider, subject,
+		requestinfo.FromContext(ctx).Tenant()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// Link привязывает учетную запись поставщика к пользователю и записывает привязку в журнал аудита
+// Возвращает nil без ошибки, если пользователь не найден, и ErrDuplicate, если учетная запись уже привязана
+// или к пользователю уже привязана другая учетная запись этого поставщика
+// ctx - контекст для операции с базой данных
+// identity - пользователь, поставщик, идентификатор у поставщика и электронная почта
+func (r *IdentityRepository) Link(ctx context.Context, identity model.UserIdentity) (*model.UserIdentity, error) {
+	var linked *model.UserIdentity
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		found, err := insertAuditNote(ctx, tx, identity.UserID, "привязана учетная запись поставщика "+identity.Provider)
+		if err != nil || !found {
+			return err
+		}
+
+		query := `
+			INSERT INTO user_identities (tenant_id, user_id, provider, subject, email, last_login_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING ` + identityColumns
+
+		linked, err = scanIdentity(tx.QueryRow(ctx, query, requestinfo.FromContext(ctx).Tenant(), identity.UserID,
+			identity.Provider, identity.Subject, identity.Email, identity.LastLoginAt))
+		if isUniqueViolation(err) {
+			return ErrDuplicate
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return linked, nil
+}
+
+// TouchLogin записывает время входа через поставщика
+// ctx - контекст для операции с базой данных
+// id - идентификатор привязки
+// now - время входа
+func (r *IdentityRepository) TouchLogin(ctx context.Context, id int64, now time.Time) error {
+	_, err := conn(ctx, r.db).Exec(ctx, "UPDATE user_identities SET last_login_at = $1 WHERE id = $2 AND tenant_id = $3",
+		now, id, requestinfo.FromContext(ctx).Tenant())
+	return err
+}
+
+// ListByUser получает учетные записи поставщиков, привязанные к пользователю, в порядке привязки
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+func (r *IdentityRepository) ListByUser(ctx context.Context, userID int64) ([]model.UserIdentity, error) {
+	query := "SELECT " + identityColumns + " FROM user_identities WHERE user_id = $1 AND tenant_id = $2 ORDER BY id"
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, userID, requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []model.UserIdentity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// Delete отвязывает учетную запись поставщика от пользователя и записывает это в журнал аудита
+// Отвязка запоминается, чтобы следующий вход через поставщика не привязал учетную запись снова (см. Unlinked)
+// Возвращает false, если привязка не найдена
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+// id - идентификатор привязки
+func (r *IdentityRepository) Delete(ctx context.Context, userID, id int64) (bool, error) {
+	deleted := false
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		var provider string
+		err := tx.QueryRow(ctx, `
+			DELETE FROM user_identities WHERE id = $1 AND user_id = $2 AND tenant_id = $3
+			RETURNING provider`,
+			id, userID, requestinfo.FromContext(ctx).Tenant()).Scan(&provider)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		deleted = true
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO user_identity_unlinks (user_id, provider, tenant_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, provider) DO UPDATE SET unlinked_at = NOW()`,
+			userID, provider, requestinfo.FromContext(ctx).Tenant()); err != nil {
+			return err
+		}
+
+		_, err = insertAuditNote(ctx, tx, userID, "отвязана учетная запись поставщика "+provider)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// Unlinked сообщает, что учетная запись поставщика была отвязана от пользователя
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+// provider - имя поставщика
+func (r *IdentityRepository) Unlinked(ctx context.Context, userID int64, provider string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_identity_unlinks WHERE user_id = $1 AND provider = $2 AND tenant_id = $3
+		)`
+
+	var unlinked bool
+	err := conn(ctx, r.db).QueryRow(ctx, query, userID, provider, requestinfo.FromContext(ctx).Tenant()).Scan(&unlinked)
+	return unlinked, err
+}
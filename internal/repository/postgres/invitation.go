@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// invitationColumns - столбцы приглашения в порядке сканирования scanInvitation
+const invitationColumns = "id, tenant_id, email, role, invited_by, expires_at, accepted_at, revoked_at, user_id, created_at"
+
+// invitationPending - условие действующего приглашения
+const invitationPending = "accepted_at IS NULL AND revoked_at IS NULL"
+
+// InvitationRepository обрабатывает операции с приглашениями пользователей
+// Все запросы ограничены арендатором из сведений о запросе в контексте (requestinfo.Info.Tenant)
+type InvitationRepository struct {
+	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+}
+
+// NewInvitationRepository создает новый репозиторий приглашений
+// db - пул соединений с базой данных
+func NewInvitationRepository(db *pgxpool.Pool) *InvitationRepository {
+	return &InvitationRepository{
+		db: db,
+	}
+}
+
+// scanInvitation сканирует строку со столбцами invitationColumns в структуру приглашения
+func scanInvitation(row pgx.Row) (*model.Invitation, error) {
+	var inv model.Invitation
+	err := row.Scan(&inv.ID, &inv.TenantID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt,
+		&inv.AcceptedAt, &inv.RevokedAt, &inv.UserID, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// Create добавляет новое приглашение
+// Инициатор приглашения берется из сведений о запросе в контексте
+// ctx - контекст для операции с базой данных
+// inv - электронная почта, роль и срок действия приглашения
+// tokenHash - хэш токена приглашения
+func (r *InvitationRepository) Create(ctx context.Context, inv model.Invitation, tokenHash string) (*model.Invitation, error) {
+	query := `
+		INSERT INTO invitations (tenant_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + invitationColumns
+
+	info := requestinfo.FromContext(ctx)
+	return scanInvitation(conn(ctx, r.db).QueryRow(ctx, query, info.Tenant(), inv.Email, inv.Role, tokenHash,
+		info.Actor, inv.ExpiresAt))
+}
+
+// GetByID получает приглашение по идентификатору
+// Возвращает nil без ошибки, если приглашение не найдено
+// ctx - контекст для операции с базой данных
+// id - идентификатор приглашения
+func (r *InvitationRepository) GetByID(ctx context.Context, id int64) (*model.Invitation, error) {
+	query := "SELECT " + invitationColumns + " FROM invitations WHERE id = $1 AND tenant_id = $2"
+	return r.get(ctx, query, id, requestinfo.FromContext(ctx).Tenant())
+}
+
+// GetByTokenHash получает приглашение по хэшу токена и блокирует его до конца транзакции,
+// чтобы одно приглашение не было принято дважды
+// Возвращает nil без ошибки, если приглашение не найдено
+// ctx - контекст для операции с базой данных (должен содержать транзакцию)
+// tokenHash - хэш токена приглашения
+func (r *InvitationRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*model.Invitation, error) {
+	query := "SELECT " + invitationColumns + " FROM invitations WHERE token_hash = $1 AND tenant_id = $2 FOR UPDATE"
+	return r.get(ctx, query, tokenHash, requestinfo.FromContext(ctx).Tenant())
+}
+
+// get выполняет запрос одного приглашения
+func (r *InvitationRepository) get(ctx context.Context, query string, args ...interface{}) (*model.Invitation, error) {
+	inv, err := scanInvitation(conn(ctx, r.db).QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// ListPending получает страницу действующих приглашений, начиная с самых новых
+// ctx - контекст для операции с базой данных
+// now - момент, на который проверяется срок действия
+// limit, offset - параметры постраничной выборки
+// Возвращает приглашения страницы и общее количество действующих приглашений
+func (r *InvitationRepository) ListPending(ctx context.Context, now time.Time, limit, offset int) ([]model.Invitation, int, error) {
+	tenantID := requestinfo.FromContext(ctx).Tenant()
+	where := "WHERE tenant_id = $1 AND " + invitationPending + " AND expires_at > $2"
+
+	var total int
+	if err := conn(ctx, r.db).QueryRow(ctx, "SELECT COUNT(*) FROM invitations "+where, tenantID, now).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + invitationColumns + " FROM invitations " + where + " ORDER BY id DESC LIMIT $3 OFFSET $4"
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, tenantID, now, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	invitations := []model.Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		invitations = append(invitations, *inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return invitations, total, nil
+}
+
+// Revoke отзывает приглашение, если оно еще не принято и не отозвано
+// Возвращает false, если приглашение не найдено или уже не действует
+// ctx - контекст для операции с базой данных
+// id - идентификатор приглашения
+func (r *InvitationRepository) Revoke(ctx context.Context, id int64) (bool, error) {
+	commandTag, err := conn(ctx, r.db).Exec(ctx,
+		"UPDATE invitations SET revoked_at = NOW() WHERE id = $1 AND tenant_id = $2 AND "+invitationPending,
+		id, requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// RevokePending отзывает все непринятые приглашения на электронную почту
+// Вызывается перед созданием нового приглашения, чтобы действовала только последняя ссылка
+// ctx - контекст для операции с базой данных
+// email - электронная почта приглашенного
+func (r *InvitationRepository) RevokePending(ctx context.Context, email string) error {
+	_, err := conn(ctx, r.db).Exec(ctx,
+		"UPDATE invitations SET revoked_at = NOW() WHERE tenant_id = $1 AND email = $2 AND "+invitationPending,
+		requestinfo.FromContext(ctx).Tenant(), email)
+	return err
+}
+
+// MarkAccepted отмечает приглашение принятым и сохраняет созданного пользователя
+// ctx - контекст для операции с базой данных
+// id - идентификатор приглашения
+// userID - идентификатор созданного пользователя
+func (r *InvitationRepository) MarkAccepted(ctx context.Context, id, userID int64) error {
+	_, err := conn(ctx, r.db).Exec(ctx,
+		"UPDATE invitations SET accepted_at = NOW(), user_id = $1 WHERE id = $2 AND tenant_id = $3",
+		userID, id, requestinfo.FromContext(ctx).Tenant())
+	return err
+}
+
+// Delete удаляет приглашение
+// Используется, если письмо с приглашением не удалось отправить
+// ctx - контекст для операции с базой данных
+// id - идентификатор приглашения
+func (r *InvitationRepository) Delete(ctx context.Context, id int64) error {
+	_, err := conn(ctx, r.db).Exec(ctx, "DELETE FROM invitations WHERE id = $1 AND tenant_id = $2",
+		id, requestinfo.FromContext(ctx).Tenant())
+	return err
+}
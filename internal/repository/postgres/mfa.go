@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// MFARepository обрабатывает операции с секретами двухфакторной аутентификации и кодами восстановления
+// Все запросы ограничены арендатором из сведений о запросе в контексте (requestinfo.Info.Tenant)
+type MFARepository struct {
+	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+}
+
+// NewMFARepository создает новый репозиторий двухфакторной аутентификации
+// db - пул соединений с базой данных
+func NewMFARepository(db *pgxpool.Pool) *MFARepository {
+	return &MFARepository{
+		db: db,
+	}
+}
+
+// Get получает секрет двухфакторной аутентификации пользователя
+// Возвращает nil без ошибки, если подключение не начиналось
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+func (r *MFARepository) Get(ctx context.Context, userID int64) (*model.MFA, error) {
+	query := `
+		SELECT user_id, secret_encrypted, confirmed_at, last_used_step
+		FROM user_mfa
+		WHERE user_id = $1 AND tenant_id = $2
+	`
+
+	var mfa model.MFA
+	err := conn(ctx, r.db).QueryRow(ctx, query, userID, requestinfo.FromContext(ctx).Tenant()).
+		Scan(&mfa.UserID, &mfa.SecretEncrypted, &mfa.ConfirmedAt, &mfa.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// SavePending сохраняет секрет, ожидающий подтверждения, вместо прежнего неподтвержденного
+// Подтвержденный секрет не заменяется: возвращается false
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+// secretEncrypted - зашифрованный секрет
+func (r *MFARepository) SavePending(ctx context.Context, userID int64, secretEncrypted []byte) (bool, error) {
+	query := `
+		INSERT INTO user_mfa AS m (user_id, tenant_id, secret_encrypted)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret_encrypted = EXCLUDED.secret_encrypted, last_used_step = 0,
+			created_at = NOW()
+		WHERE m.confirmed_at IS NULL
+	`
+
+	commandTag, err := conn(ctx, r.db).Exec(ctx, query, userID, requestinfo.FromContext(ctx).Tenant(), secretEncrypted)
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// Confirm включает двухфакторную аутентификацию и заменяет коды восстановления
+// Включение записывается в журнал аудита; возвращает false, если пользователь не найден
+// или подключение не ожидает подтверждения
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+// step - шаг времени принятого кода подтверждения
+// codeHashes - хэши новых кодов восстановления
+func (r *MFARepository) Confirm(ctx context.Context, userID, step int64, codeHashes []string) (bool, error) {
+	confirmed := false
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		commandTag, err := tx.Exec(ctx, `
+			UPDATE user_mfa SET confirmed_at = NOW(), last_used_step = $1
+			WHERE user_id = $2 AND tenant_id = $3 AND confirmed_at IS NULL`,
+			step, userID, requestinfo.FromContext(ctx).Tenant())
+		if err != nil || commandTag.RowsAffected() == 0 {
+			return err
+		}
+
+		if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+			return err
+		}
+
+		confirmed, err = insertAuditNote(ctx, tx, userID, "включена двухфакторная аутентификация")
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return confirmed, nil
+}
+
+// UseStep отмечает шаг времени принятого кода
+// Возвращает false, если код этого или более позднего шага уже использован (повтор кода)
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+// step - шаг времени кода
+func (r *MFARepository) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	commandTag, err := conn(ctx, r.db).Exec(ctx, `
+		UPDATE user_mfa SET last_used_step = $1
+		WHERE user_id = $2 AND tenant_id = $3 AND confirmed_at IS NOT NULL AND last_used_step < $1`,
+		step, userID, requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// UseRecoveryCode отмечает код восстановления использованным
+// Использование кода записывается в журнал аудита; возвращает false, если код не найден или уже использован
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+// codeHash - хэш кода восстановления
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	used := false
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		commandTag, err := tx.Exec(ctx, `
+			UPDATE user_recovery_codes SET used_at = NOW()
+			WHERE id = (
+				SELECT id FROM user_recovery_codes
+				WHERE user_id = $1 AND tenant_id = $2 AND code_hash = $3 AND used_at IS NULL
+				LIMIT 1
+				FOR UPDATE
+			)`,
+			userID, requestinfo.FromContext(ctx).Tenant(), codeHash)
+		if err != nil || commandTag.RowsAffected() == 0 {
+			return err
+		}
+
+		used = true
+		_, err = insertAuditNote(ctx, tx, userID, "вход по коду восстановления")
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return used, nil
+}
+
+// CountRecoveryCodes возвращает число неиспользованных кодов восстановления
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+func (r *MFARepository) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := conn(ctx, r.db).QueryRow(ctx,
+		"SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND tenant_id = $2 AND used_at IS NULL",
+		userID, requestinfo.FromContext(ctx).Tenant()).Scan(&count)
+	return count, err
+}
+
+// Delete удаляет секрет и коды восстановления пользователя (сброс двухфакторной аутентификации)
+// Сброс записывается в журнал аудита с причиной reason; возвращает false, если пользователь не найден
+// или двухфакторная аутентификация не подключалась
+// ctx - контекст для операции с базой данных
+// userID - идентификатор пользователя
+// reason - причина для журнала аудита
+func (r *MFARepository) Delete(ctx context.Context, userID int64, reason string) (bool, error) {
+	deleted := false
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		tenantID := requestinfo.FromContext(ctx).Tenant()
+		commandTag, err := tx.Exec(ctx, "DELETE FROM user_mfa WHERE user_id = $1 AND tenant_id = $2", userID, tenantID)
+		if err != nil || commandTag.RowsAffected() == 0 {
+			return err
+		}
+		if err := replaceRecoveryCodes(ctx, tx, userID, nil); err != nil {
+			return err
+		}
+
+		deleted, err = insertAuditNote(ctx, tx, userID, reason)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// replaceRecoveryCodes удаляет коды восстановления пользователя и добавляет новые
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int64, codeHashes []string) error {
+	tenantID := requestinfo.FromContext(ctx).Tenant()
+	_, err := tx.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1 AND tenant_id = $2", userID, tenantID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(ctx, "INSERT INTO user_recovery_codes (user_id, tenant_id, code_hash) VALUES ($1, $2, $3)",
+			userID, tenantID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// oidcClientColumns - столбцы клиента в порядке сканирования scanOIDCClient
+const oidcClientColumns = "id, tenant_id, client_id, name, redirect_uris, secret_hash IS NOT NULL, created_by, created_at"
+
+// OIDCRepository обрабатывает операции с клиентами, кодами авторизации и ключами подписи провайдера OpenID Connect
+// Запросы к клиентам и кодам ограничены арендатором из сведений о запросе в контексте (requestinfo.Info.Tenant),
+// ключи подписи общие для всех арендаторов
+type OIDCRepository struct {
+	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+}
+
+// NewOIDCRepository создает новый репозиторий провайдера OpenID Connect
+// db - пул соединений с базой данных
+func NewOIDCRepository(db *pgxpool.Pool) *OIDCRepository {
+	return &OIDCRepository{
+		db: db,
+	}
+}
+
+// scanOIDCClient сканирует строку со столбцами oidcClientColumns в структуру клиента
+func scanOIDCClient(row pgx.Row) (*model.OIDCClient, error) {
+	var client model.OIDCClient
+	err := row.Scan(&client.ID, &client.TenantID, &client.ClientID, &client.Name, &client.RedirectURIs,
+		&client.Confidential, &client.CreatedBy, &client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// CreateClient регистрирует клиента
+// Инициатор регистрации берется из сведений о запросе в контексте
+// ctx - контекст для операции с базой данных
+// client - идентификатор, название и адреса возврата клиента
+// secretHash - хэш секрета (пустая строка - публичный клиент)
+func (r *OIDCRepository) CreateClient(ctx context.Context, client model.OIDCClient, secretHash string) (*model.OIDCClient, error) {
+	query := `
+		INSERT INTO oidc_clients (tenant_id, client_id, secret_hash, name, redirect_uris, created_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+		RETURNING ` + oidcClientColumns
+
+	info := requestinfo.FromContext(ctx)
+	return scanOIDCClient(conn(ctx, r.db).QueryRow(ctx, query, info.Tenant(), client.ClientID, secretHash, client.Name,
+		client.RedirectURIs, info.Actor))
+}
+
+// GetClient получает клиента по идентификатору клиента вместе с хэшем секрета
+// Возвращает nil без ошибки, если клиент не найден
+// ctx - контекст для операции с базой данных
+// clientID - идентификатор клиента
+func (r *OIDCRepository) GetClient(ctx context.Context, clientID string) (*model.OIDCClient, string, error) {
+	query := "SELECT " + oidcClientColumns + ", COALESCE(secret_hash, '') FROM oidc_clients WHERE client_id = $1 AND tenant_id = $2"
+
+	var client model.OIDCClient
+	var secretHash string
+	err := conn(ctx, r.db).QueryRow(ctx, query, clientID, requestinfo.FromContext(ctx).Tenant()).Scan(
+		&client.ID, &client.TenantID, &client.ClientID, &client.Name, &client.RedirectURIs, &client.Confidential,
+		&client.CreatedBy, &client.CreatedAt, &secretHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+
+	return &client, secretHash, nil
+}
+
+// ListClients получает страницу клиентов, начиная с последних зарегистрированных
+// ctx - контекст для операции с базой данных
+// limit, offset - параметры постраничной выборки
+// Возвращает клиентов страницы и общее количество клиентов
+func (r *OIDCRepository) ListClients(ctx context.Context, limit, offset int) ([]model.OIDCClient, int, error) {
+	tenantID := requestinfo.FromContext(ctx).Tenant()
+
+	var total int
+	if err := conn(ctx, r.db).QueryRow(ctx, "SELECT COUNT(*) FROM oidc_clients WHERE tenant_id = $1", tenantID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + oidcClientColumns + " FROM oidc_clients WHERE tenant_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3"
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, tenantID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	clients := []model.OIDCClient{}
+	for rows.Next() {
+		client, err := scanOIDCClient(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		clients = append(clients, *client)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return clients, total, nil
+}
+
+// DeleteClient удаляет регистрацию клиента вместе с его неиспользованными кодами авторизации
+// Возвращает false, если клиент не найден
+// ctx - контекст для операции с базой данных
+// id - идентификатор регистрации
+func (r *OIDCRepository) DeleteClient(ctx context.Context, id int64) (bool, error) {
+	deleted := false
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		tenantID := requestinfo.FromContext(ctx).Tenant()
+		var clientID string
+		err := tx.QueryRow(ctx, "DELETE FROM oidc_clients WHERE id = $1 AND tenant_id = $2 RETURNING client_id",
+			id, tenantID).Scan(&clientID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		deleted = true
+		_, err = tx.Exec(ctx, "DELETE FROM oidc_authorization_codes WHERE client_id = $1 AND tenant_id = $2",
+			clientID, tenantID)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// CreateCode сохраняет код авторизации и удаляет истекшие коды арендатора
+// ctx - контекст для операции с базой данных
+// code - параметры кода
+// codeHash - хэш кода
+func (r *OIDCRepository) CreateCode(ctx context.Context, code model.OIDCAuthorizationCode, codeHash string) error {
+	return withTx(ctx, r.db, func(tx pgx.Tx) error {
+		tenantID := requestinfo.FromContext(ctx).Tenant()
+		_, err := tx.Exec(ctx, "DELETE FROM oidc_authorization_codes WHERE tenant_id = $1 AND expires_at < NOW()", tenantID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO oidc_authorization_codes
+				(code_hash, tenant_id, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			codeHash, tenantID, code.ClientID, code.UserID, code.RedirectURI, code.Scope, code.Nonce, code.CodeChallenge,
+			code.AuthTime, code.ExpiresAt)
+		return err
+	})
+}
+
+// ConsumeCode получает и удаляет код авторизации, поэтому код можно обменять только один раз
+// Возвращает nil без ошибки, если код не найден или уже использован
+// ctx - контекст для операции с базой данных
+// codeHash - хэш кода
+func (r *OIDCRepository) ConsumeCode(ctx context.Context, codeHash string) (*model.OIDCAuthorizationCode, error) {
+	query := `
+		DELETE FROM oidc_authorization_codes
+		WHERE code_hash = $1 AND tenant_id = $2
+		RETURNING client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at
+	`
+
+	var code model.OIDCAuthorizationCode
+	err := conn(ctx, r.db).QueryRow(ctx, query, codeHash, requestinfo.FromContext(ctx).Tenant()).Scan(
+		&code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope, &code.Nonce, &code.CodeChallenge,
+		&code.AuthTime, &code.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// ListSigningKeys получает все ключи подписи, начиная с самого старого
+// ctx - контекст для операции с базой данных
+func (r *OIDCRepository) ListSigningKeys(ctx context.Context) ([]model.OIDCSigningKey, error) {
+	rows, err := conn(ctx, r.db).Query(ctx,
+		"SELECT kid, private_key_encrypted, created_at FROM oidc_signing_keys ORDER BY created_at, kid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.OIDCSigningKey{}
+	for rows.Next() {
+		var key model.OIDCSigningKey
+		if err := rows.Scan(&key.KID, &key.PrivateKeyEncrypted, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// CreateSigningKey сохраняет новый ключ подписи, если нет ключа новее notBefore
+// Условие не дает нескольким репликам одновременно создать по ключу; возвращает false, если ключ не сохранен
+// ctx - контекст для операции с базой данных
+// key - новый ключ
+// notBefore - время, начиная с которого существующий ключ считается действующим
+func (r *OIDCRepository) CreateSigningKey(ctx context.Context, key model.OIDCSigningKey, notBefore time.Time) (bool, error) {
+	created := false
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		// Блокировка таблицы на время транзакции упорядочивает создание ключей репликами
+		if _, err := tx.Exec(ctx, "LOCK TABLE oidc_signing_keys IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+
+		commandTag, err := tx.Exec(ctx, `
+			INSERT INTO oidc_signing_keys (kid, private_key_encrypted, created_at)
+			SELECT $1, $2, $3
+			WHERE NOT EXISTS (SELECT 1 FROM oidc_signing_keys WHERE created_at > $4)`,
+			key.KID, key.PrivateKeyEncrypted, key.CreatedAt, notBefore)
+		if err != nil {
+			return err
+		}
+
+		created = commandTag.RowsAffected() > 0
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return created, nil
+}
+
+// DeleteSigningKey удаляет ключ подписи, которым больше не подписаны действующие токены
+// ctx - контекст для операции с базой данных
+// kid - идентификатор ключа
+func (r *OIDCRepository) DeleteSigningKey(ctx context.Context, kid string) error {
+	_, err := conn(ctx, r.db).Exec(ctx, "DELETE FROM oidc_signing_keys WHERE kid = $1", kid)
+	return err
+}
@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// outboxLockKey - ключ advisory-блокировки, которая гарантирует,
+// что события обрабатывает только один экземпляр ретранслятора
+const outboxLockKey = 7_421_001
+
+// OutboxRepository обрабатывает операции с таблицей исходящих событий
+// Используется ретранслятором для выборки и отметки опубликованных событий
+type OutboxRepository struct {
+	db txBeginner // Пул соединений с базой данных PostgreSQL
+}
+
+// NewOutboxRepository создает новый репозиторий исходящих событий
+// db - пул соединений с базой данных
+func NewOutboxRepository(db *pgxpool.Pool) *OutboxRepository {
+	return &OutboxRepository{
+		db: db,
+	}
+}
+
+// insertEvent записывает доменное событие в таблицу outbox в рамках переданной транзакции
+// Событие относится к арендатору пользователя
+// tx - транзакция, в которой выполняется изменение пользователя
+// eventType - тип события
+// user - состояние пользователя, которое попадет в полезную нагрузку события
+func insertEvent(ctx context.Context, tx pgx.Tx, eventType string, user *model.User) error {
+	payload, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO outbox (aggregate_id, tenant_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	_, err = tx.Exec(ctx, query, user.ID, user.TenantID, eventType, payload)
+	return err
+}
+
+// ProcessBatch выбирает очередную порцию неопубликованных событий и передает их в handle
+// Успешно обработанные события отмечаются опубликованными, неудачные - откладываются до следующей попытки
+// на задержку из retry или, если retry вернула false, переносятся в отложенные (dead_at) и больше не выбираются
+// После первой ошибки по пользователю остальные его события в этой порции пропускаются, а его события
+// после ожидающего повтора не выбираются, чтобы сохранить порядок доставки для каждого пользователя
+// ctx - контекст для операции с базой данных
+// limit - максимальное количество событий в порции
+// handle - функция публикации одного события
+// retry - задержка до следующей попытки для события с учетом текущей неудачной (Attempts)
+// Возвращает количество успешно опубликованных событий
+func (r *OutboxRepository) ProcessBatch(ctx context.Context, limit int, handle func(model.Event) error, retry func(model.Event) (time.Duration, bool)) (int, error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокировка снимается автоматически при завершении транзакции
+	var locked bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", outboxLockKey).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil // Порцию уже обрабатывает другой экземпляр
+	}
+
+	// Отложенные до повтора события не занимают порцию, но задерживают следующие события того же пользователя
+	query := `
+		SELECT o.id, o.aggregate_id, o.tenant_id, o.event_type, o.payload, o.created_at, o.attempts
+		FROM outbox o
+		WHERE o.published_at IS NULL AND o.dead_at IS NULL AND o.next_attempt_at <= NOW()
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox e
+				WHERE e.aggregate_id = o.aggregate_id AND e.id < o.id
+					AND e.published_at IS NULL AND e.dead_at IS NULL AND e.next_attempt_at > NOW()
+			)
+		ORDER BY o.id
+		LIMIT $1
+	`
+
+	rows, err := tx.Query(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []model.Event
+	for rows.Next() {
+		var event model.Event
+		if err := rows.Scan(&event.ID, &event.AggregateID, &event.TenantID, &event.Type, &event.Payload, &event.CreatedAt, &event.Attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	failed := make(map[int64]bool)
+	for _, event := range events {
+		if failed[event.AggregateID] {
+			continue
+		}
+
+		if err := handle(event); err != nil {
+			failed[event.AggregateID] = true
+			event.Attempts++
+			if err := markFailed(ctx, tx, event, err, retry); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		if _, err := tx.Exec(ctx, "UPDATE outbox SET published_at = NOW() WHERE id = $1", event.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return published, nil
+}
+
+// markFailed записывает неудачную попытку публикации и откладывает событие до повтора
+// или переносит его в отложенные, если retry вернула false
+func markFailed(ctx context.Context, tx pgx.Tx, event model.Event, publishErr error, retry func(model.Event) (time.Duration, bool)) error {
+	delay, ok := retry(event)
+	if !ok {
+		_, err := tx.Exec(ctx,
+			"UPDATE outbox SET attempts = attempts + 1, last_error = $2, dead_at = NOW() WHERE id = $1",
+			event.ID, publishErr.Error(),
+		)
+		return err
+	}
+
+	_, err := tx.Exec(ctx,
+		"UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond' WHERE id = $1",
+		event.ID, publishErr.Error(), delay.Milliseconds(),
+	)
+	return err
+}
@@ -0,0 +1,363 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// fakeOutboxRow - строка таблицы outbox в памяти
+type fakeOutboxRow struct {
+	event         model.Event
+	published     bool
+	dead          bool
+	nextAttemptAt time.Time
+	lastError     string
+}
+
+// pending сообщает, что событие ожидает публикации
+func (row *fakeOutboxRow) pending() bool {
+	return !row.published && !row.dead
+}
+
+// fakeOutboxDB - таблица outbox и advisory-блокировка в памяти
+// Выборка повторяет запрос ProcessBatch: ожидающие события, время повтора которых наступило,
+// кроме событий пользователя после его события, ожидающего повтора
+type fakeOutboxDB struct {
+	mu     sync.Mutex
+	now    time.Time
+	locked bool
+	rows   []*fakeOutboxRow
+}
+
+// newFakeOutboxDB создает таблицу с событиями пользователей aggregates в порядке их ID
+func newFakeOutboxDB(aggregates ...int64) *fakeOutboxDB {
+	db := &fakeOutboxDB{now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	for i, aggregate := range aggregates {
+		db.rows = append(db.rows, &fakeOutboxRow{
+			event: model.Event{ID: int64(i + 1), AggregateID: aggregate, TenantID: "default",
+				Type: model.EventUserUpdated, Payload: json.RawMessage(`{}`), CreatedAt: db.now},
+			nextAttemptAt: db.now,
+		})
+	}
+	return db
+}
+
+func (db *fakeOutboxDB) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	return &fakeOutboxTx{db: db}, nil
+}
+
+// row возвращает строку по ID события
+func (db *fakeOutboxDB) row(id int64) *fakeOutboxRow {
+	for _, row := range db.rows {
+		if row.event.ID == id {
+			return row
+		}
+	}
+	return nil
+}
+
+// fakeOutboxTx - транзакция fakeOutboxDB
+// Изменения применяются при фиксации, блокировка снимается при фиксации или откате
+type fakeOutboxTx struct {
+	pgx.Tx
+	db      *fakeOutboxDB
+	locked  bool
+	done    bool
+	changes []func()
+}
+
+func (tx *fakeOutboxTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	if !strings.Contains(sql, "pg_try_advisory_xact_lock") {
+		return fakeRow{err: errors.New("неожиданный запрос " + sql)}
+	}
+	if !tx.db.locked {
+		tx.db.locked = true
+		tx.locked = true
+	}
+	return fakeRow{values: []interface{}{tx.locked}}
+}
+
+func (tx *fakeOutboxTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	waiting := make(map[int64]bool)
+	var values [][]interface{}
+	for _, row := range tx.db.rows {
+		if !row.pending() {
+			continue
+		}
+		if row.nextAttemptAt.After(tx.db.now) {
+			waiting[row.event.AggregateID] = true
+			continue
+		}
+		if waiting[row.event.AggregateID] || len(values) == args[0].(int) {
+			continue
+		}
+		e := row.event
+		values = append(values, []interface{}{e.ID, e.AggregateID, e.TenantID, e.Type, e.Payload, e.CreatedAt, e.Attempts})
+	}
+	return &fakeRows{values: values}, nil
+}
+
+func (tx *fakeOutboxTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	row := tx.db.row(args[0].(int64))
+	switch {
+	case strings.Contains(sql, "published_at = NOW()"):
+		tx.changes = append(tx.changes, func() { row.published = true })
+	case strings.Contains(sql, "dead_at = NOW()"):
+		tx.changes = append(tx.changes, func() {
+			row.event.Attempts++
+			row.lastError = args[1].(string)
+			row.dead = true
+		})
+	case strings.Contains(sql, "next_attempt_at = NOW()"):
+		delay := time.Duration(args[2].(int64)) * time.Millisecond
+		tx.changes = append(tx.changes, func() {
+			row.event.Attempts++
+			row.lastError = args[1].(string)
+			row.nextAttemptAt = tx.db.now.Add(delay)
+		})
+	default:
+		return nil, errors.New("неожиданный запрос " + sql)
+	}
+	return pgconn.CommandTag("UPDATE 1"), nil
+}
+
+func (tx *fakeOutboxTx) Commit(ctx context.Context) error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	if !tx.done {
+		for _, change := range tx.changes {
+			change()
+		}
+	}
+	tx.finish()
+	return nil
+}
+
+func (tx *fakeOutboxTx) Rollback(ctx context.Context) error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	tx.finish()
+	return nil
+}
+
+// finish завершает транзакцию и снимает ее блокировку, вызывается под db.mu
+func (tx *fakeOutboxTx) finish() {
+	if tx.locked {
+		tx.db.locked = false
+		tx.locked = false
+	}
+	tx.done = true
+}
+
+// fakeRow - результат QueryRow
+type fakeRow struct {
+	values []interface{}
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scanValues(r.values, dest)
+}
+
+// fakeRows - результат Query
+type fakeRows struct {
+	pgx.Rows
+	values [][]interface{}
+	next   int
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.values)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	return scanValues(r.values[r.next-1], dest)
+}
+
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Close() {}
+
+// scanValues копирует значения в указатели dest
+func scanValues(values, dest []interface{}) error {
+	if len(values) != len(dest) {
+		return errors.New("число значений не совпадает с числом полей")
+	}
+	for i, value := range values {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+// retryAfter возвращает функцию повтора с задержкой delay и откладыванием события после maxAttempts попыток
+func retryAfter(delay time.Duration, maxAttempts int) func(model.Event) (time.Duration, bool) {
+	return func(event model.Event) (time.Duration, bool) {
+		return delay, event.Attempts < maxAttempts
+	}
+}
+
+// TestProcessBatchKeepsAggregateOrder проверяет, что после ошибки публикации события пользователя
+// его следующие события не публикуются до успешного повтора, а события других пользователей - публикуются
+func TestProcessBatchKeepsAggregateOrder(t *testing.T) {
+	db := newFakeOutboxDB(1, 2, 1, 2)
+	repo := &OutboxRepository{db: db}
+
+	var handled []int64
+	handle := func(event model.Event) error {
+		handled = append(handled, event.ID)
+		if event.ID == 1 {
+			return errors.New("брокер недоступен")
+		}
+		return nil
+	}
+
+	published, err := repo.ProcessBatch(context.Background(), 10, handle, retryAfter(time.Minute, 5))
+	if err != nil {
+		t.Fatalf("Ошибка обработки порции: %v", err)
+	}
+	if published != 2 || !reflect.DeepEqual(handled, []int64{1, 2, 4}) {
+		t.Fatalf("Ожидалась публикация событий 2 и 4 после ошибки события 1, опубликовано %d, обработаны %v", published, handled)
+	}
+	if row := db.row(1); row.event.Attempts != 1 || row.lastError != "брокер недоступен" || !row.nextAttemptAt.Equal(db.now.Add(time.Minute)) {
+		t.Errorf("Неудачная попытка не записана: %+v", row)
+	}
+
+	// До наступления времени повтора события пользователя 1 не выбираются
+	handled = nil
+	if _, err := repo.ProcessBatch(context.Background(), 10, handle, retryAfter(time.Minute, 5)); err != nil {
+		t.Fatalf("Ошибка обработки порции: %v", err)
+	}
+	if len(handled) != 0 {
+		t.Errorf("До повтора события пользователя не должны публиковаться, обработаны %v", handled)
+	}
+
+	db.now = db.now.Add(time.Minute)
+	handled = nil
+	published, err = repo.ProcessBatch(context.Background(), 10, func(event model.Event) error {
+		handled = append(handled, event.ID)
+		return nil
+	}, retryAfter(time.Minute, 5))
+	if err != nil || published != 2 || !reflect.DeepEqual(handled, []int64{1, 3}) {
+		t.Errorf("Повтор должен опубликовать события 1 и 3 по порядку: опубликовано %d, обработаны %v, ошибка %v", published, handled, err)
+	}
+}
+
+// TestProcessBatchDeadLetter проверяет, что постоянно неудачное событие не занимает порцию:
+// во время ожидания повтора выбираются следующие события, а после последней попытки событие откладывается
+// и следующие события того же пользователя публикуются
+func TestProcessBatchDeadLetter(t *testing.T) {
+	db := newFakeOutboxDB(1, 1, 2)
+	repo := &OutboxRepository{db: db}
+
+	var handled []int64
+	handle := func(event model.Event) error {
+		handled = append(handled, event.ID)
+		if event.ID == 1 {
+			return errors.New("некорректное событие")
+		}
+		return nil
+	}
+
+	// process обрабатывает порцию из одного события и возвращает обработанные события
+	process := func() []int64 {
+		t.Helper()
+		handled = nil
+		if _, err := repo.ProcessBatch(context.Background(), 1, handle, retryAfter(time.Second, 2)); err != nil {
+			t.Fatalf("Ошибка обработки порции: %v", err)
+		}
+		return handled
+	}
+
+	if got := process(); !reflect.DeepEqual(got, []int64{1}) {
+		t.Fatalf("Первая попытка: ожидалась обработка события 1, обработаны %v", got)
+	}
+	// До повтора порция достается событию другого пользователя, а не неудачному событию
+	if got := process(); !reflect.DeepEqual(got, []int64{3}) {
+		t.Fatalf("Во время ожидания повтора ожидалась публикация события 3, обработаны %v", got)
+	}
+
+	db.now = db.now.Add(time.Second)
+	if got := process(); !reflect.DeepEqual(got, []int64{1}) {
+		t.Fatalf("Вторая попытка: ожидалась обработка события 1, обработаны %v", got)
+	}
+	if row := db.row(1); !row.dead || row.event.Attempts != 2 || row.lastError != "некорректное событие" {
+		t.Fatalf("Событие должно быть отложено после 2 попыток: %+v", row)
+	}
+
+	if got := process(); !reflect.DeepEqual(got, []int64{2}) || !db.row(2).published {
+		t.Errorf("После откладывания ожидалась публикация события 2, обработаны %v", got)
+	}
+	if got := process(); len(got) != 0 {
+		t.Errorf("Отложенное событие не должно выбираться, обработаны %v", got)
+	}
+}
+
+// TestProcessBatchLockHandoff проверяет, что пока порцию обрабатывает один экземпляр, другой
+// ничего не публикует, а после завершения транзакции блокировку получает следующий экземпляр
+func TestProcessBatchLockHandoff(t *testing.T) {
+	db := newFakeOutboxDB(1, 2)
+	first := &OutboxRepository{db: db}
+	second := &OutboxRepository{db: db}
+	retry := retryAfter(time.Second, 5)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := first.ProcessBatch(context.Background(), 1, func(event model.Event) error {
+			close(started)
+			<-release
+			return nil
+		}, retry)
+		done <- err
+	}()
+
+	<-started
+	published, err := second.ProcessBatch(context.Background(), 10, func(event model.Event) error {
+		t.Errorf("Событие %d опубликовано без блокировки", event.ID)
+		return nil
+	}, retry)
+	if err != nil || published != 0 {
+		t.Errorf("Без блокировки ожидалась пустая порция: опубликовано %d, ошибка %v", published, err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Ошибка обработки порции: %v", err)
+	}
+
+	var handled []int64
+	published, err = second.ProcessBatch(context.Background(), 10, func(event model.Event) error {
+		handled = append(handled, event.ID)
+		return nil
+	}, retry)
+	if err != nil || published != 1 || !reflect.DeepEqual(handled, []int64{2}) {
+		t.Errorf("После снятия блокировки ожидалась публикация события 2: опубликовано %d, обработаны %v, ошибка %v",
+			published, handled, err)
+	}
+}
@@ -0,0 +1,262 @@
+package postgres
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// Значения по умолчанию для маршрутизации чтения на реплики
+const (
+	defaultMaxReplicaLag        = 5 * time.Second
+	defaultReplicaStickiness    = 5 * time.Second
+	defaultReplicaCheckInterval = 5 * time.Second
+	replicaCheckTimeout         = 2 * time.Second
+)
+
+// replicaLagQuery возвращает задержку применения WAL на реплике в секундах
+// Если вся полученная WAL применена, задержка считается нулевой, даже если на основном сервере давно не было записей
+const replicaLagQuery = `
+	SELECT pg_is_in_recovery(),
+		CASE
+			WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+		END
+`
+
+// replica - пул соединений с репликой и результат последней проверки
+type replica struct {
+	pool    *pgxpool.Pool // Пул соединений с репликой
+	healthy atomic.Bool   // Реплика доступна и отстает не больше допустимого
+}
+
+// ReplicaRouter направляет чтение на реплики, а запись оставляет основному серверу
+// После записи чтение в рамках той же сессии (инициатор или IP-адрес клиента)
+// некоторое время выполняется на основном сервере, чтобы клиент видел свои изменения
+// Недоступные или отстающие реплики исключаются до следующей успешной проверки
+type ReplicaRouter struct {
+	replicas      []*replica    // Реплики в порядке из конфигурации
+	next          atomic.Uint32 // Счетчик для циклического выбора реплики
+	maxLag        time.Duration // Допустимая задержка реплики
+	stickiness    time.Duration // Время чтения с основного сервера после записи
+	checkInterval time.Duration // Интервал проверки реплик
+	logger        *log.Logger   // Логгер для записи изменений состояния реплик
+	now           func() time.Time
+
+	mu     sync.Mutex           // Защищает writes
+	writes map[string]time.Time // Время окончания чтения с основного сервера по сессиям
+}
+
+// OpenReplicas создает пулы соединений с репликами из конфигурации
+// Параметры пулов и таймауты совпадают с основным сервером
+// Соединения устанавливаются при первом использовании, поэтому недоступная при запуске реплика
+// не мешает запуску сервиса и подключится после восстановления
+// cfg - настройки базы данных
+func OpenReplicas(cfg config.DatabaseConfig) ([]*pgxpool.Pool, error) {
+	pools := make([]*pgxpool.Pool, 0, len(cfg.Replicas))
+	for _, dsn := range cfg.Replicas {
+		poolConfig, err := newPoolConfig(dsn, cfg)
+		if err != nil {
+			closePools(pools)
+			return nil, err
+		}
+		poolConfig.LazyConnect = true
+
+		pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
+		if err != nil {
+			closePools(pools)
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// closePools закрывает пулы соединений
+func closePools(pools []*pgxpool.Pool) {
+	for _, pool := range pools {
+		pool.Close()
+	}
+}
+
+// NewReplicaRouter создает новый маршрутизатор чтения
+// До первой проверки в Run все реплики считаются недоступными и чтение выполняется на основном сервере
+// pools - пулы соединений с репликами
+// cfg - настройки базы данных (допустимая задержка, время привязки сессии, интервал проверки)
+// logger - логгер для записи событий
+func NewReplicaRouter(pools []*pgxpool.Pool, cfg config.DatabaseConfig, logger *log.Logger) *ReplicaRouter {
+	router := &ReplicaRouter{
+		maxLag:        cfg.MaxReplicaLag.Duration,
+		stickiness:    cfg.ReplicaStickiness.Duration,
+		checkInterval: cfg.ReplicaCheckInterval.Duration,
+		logger:        logger,
+		now:           time.Now,
+		writes:        make(map[string]time.Time),
+	}
+	if router.maxLag <= 0 {
+		router.maxLag = defaultMaxReplicaLag
+	}
+	if router.stickiness <= 0 {
+		router.stickiness = defaultReplicaStickiness
+	}
+	if router.checkInterval <= 0 {
+		router.checkInterval = defaultReplicaCheckInterval
+	}
+
+	for _, pool := range pools {
+		router.replicas = append(router.replicas, &replica{pool: pool})
+	}
+
+	return router
+}
+
+// Run периодически проверяет доступность и задержку реплик до отмены контекста
+// ctx - контекст, отмена которого останавливает проверки
+func (r *ReplicaRouter) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		r.check(ctx)
+		r.pruneWrites()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check проверяет все реплики и записывает в лог изменения их состояния
+func (r *ReplicaRouter) check(ctx context.Context) {
+	for i, rep := range r.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+		var (
+			inRecovery bool
+			lagSeconds float64
+		)
+		err := rep.pool.QueryRow(checkCtx, replicaLagQuery).Scan(&inRecovery, &lagSeconds)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		lag := time.Duration(lagSeconds * float64(time.Second))
+		healthy := err == nil && inRecovery && lag <= r.maxLag
+		if healthy == rep.healthy.Swap(healthy) {
+			continue
+		}
+
+		switch {
+		case healthy:
+			r.logger.Printf("Реплика %d доступна для чтения (задержка %s)", i, lag)
+		case err != nil:
+			r.logger.Printf("Реплика %d исключена: %v", i, err)
+		case !inRecovery:
+			r.logger.Printf("Реплика %d исключена: сервер не находится в режиме восстановления", i)
+		default:
+			r.logger.Printf("Реплика %d исключена: задержка %s превышает %s", i, lag, r.maxLag)
+		}
+	}
+}
+
+// primaryKey - ключ контекста, требующего чтения с основного сервера
+type primaryKey struct{}
+
+// WithPrimary возвращает копию контекста, чтение в котором выполняется на основном сервере
+// Используется кэшем пользователей, чтобы не сохранить состояние отстающей реплики
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// reader возвращает соединение для чтения
+// Транзакция из контекста имеет приоритет, затем основной сервер для контекста WithPrimary и для сессии
+// с недавней записью, затем доступная реплика, выбираемая по кругу
+// Метод допускает nil маршрутизатор, в этом случае чтение выполняется на основном сервере
+func (r *ReplicaRouter) reader(ctx context.Context, primary *pgxpool.Pool) querier {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx
+	}
+	if r == nil || len(r.replicas) == 0 || ctx.Value(primaryKey{}) != nil || r.sticky(ctx) {
+		return primary
+	}
+
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(int(start)+i)%len(r.replicas)]
+		if rep.healthy.Load() {
+			return rep.pool
+		}
+	}
+
+	return primary
+}
+
+// markWrite привязывает сессию из контекста к основному серверу после записи
+// Метод допускает nil маршрутизатор
+func (r *ReplicaRouter) markWrite(ctx context.Context) {
+	if r == nil || len(r.replicas) == 0 {
+		return
+	}
+	session := sessionKey(ctx)
+	if session == "" {
+		return
+	}
+
+	r.mu.Lock()
+	r.writes[session] = r.now().Add(r.stickiness)
+	r.mu.Unlock()
+}
+
+// sticky сообщает, что сессия из контекста недавно выполняла запись
+func (r *ReplicaRouter) sticky(ctx context.Context) bool {
+	session := sessionKey(ctx)
+	if session == "" {
+		return false
+	}
+
+	r.mu.Lock()
+	until, ok := r.writes[session]
+	r.mu.Unlock()
+
+	return ok && r.now().Before(until)
+}
+
+// pruneWrites удаляет истекшие привязки сессий
+func (r *ReplicaRouter) pruneWrites() {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for session, until := range r.writes {
+		if !now.Before(until) {
+			delete(r.writes, session)
+		}
+	}
+}
+
+// sessionKey определяет сессию клиента по проверенному пользователю токена доступа или ключу API,
+// а без них - по IP-адресу
+// Пользователь учитывается в пределах арендатора. Заголовок X-Actor не учитывается: его может передать
+// любой клиент, и чужое имя привязало бы к основному серверу чтение другой сессии
+func sessionKey(ctx context.Context) string {
+	info := requestinfo.FromContext(ctx)
+	switch {
+	case info.UserID != 0:
+		return "user:" + info.Tenant() + "/" + strconv.FormatInt(info.UserID, 10)
+	case info.APIKey != "":
+		return "api-key:" + info.APIKey
+	case info.IP != "":
+		return "ip:" + info.IP
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// TestReplicaRouterReader проверяет выбор сервера для чтения: реплика, привязка после записи и возврат на основной сервер
+func TestReplicaRouterReader(t *testing.T) {
+	// Пулы не используются для запросов, поэтому достаточно различимых указателей
+	primary, replicaPool := &pgxpool.Pool{}, &pgxpool.Pool{}
+
+	now := time.Now()
+	router := NewReplicaRouter([]*pgxpool.Pool{replicaPool}, config.DatabaseConfig{}, log.New(io.Discard, "", 0))
+	router.now = func() time.Time { return now }
+
+	ctx := requestinfo.WithInfo(context.Background(), requestinfo.Info{UserID: 1})
+	other := requestinfo.WithInfo(context.Background(), requestinfo.Info{IP: "10.0.0.1"})
+
+	if router.reader(ctx, primary) != primary {
+		t.Error("До первой проверки чтение должно выполняться на основном сервере")
+	}
+
+	router.replicas[0].healthy.Store(true)
+	if router.reader(ctx, primary) != replicaPool {
+		t.Error("Ожидалось чтение с доступной реплики")
+	}
+
+	router.markWrite(ctx)
+	if router.reader(ctx, primary) != primary {
+		t.Error("После записи сессия должна читать с основного сервера")
+	}
+	if router.reader(other, primary) != replicaPool {
+		t.Error("Запись одной сессии не должна влиять на другие")
+	}
+	// Инициатор из заголовка X-Actor не определяет сессию
+	spoofed := requestinfo.WithInfo(context.Background(), requestinfo.Info{Actor: "1", IP: "10.0.0.2"})
+	if router.reader(spoofed, primary) != replicaPool {
+		t.Error("Инициатор из заголовка не должен разделять привязку чужой сессии")
+	}
+
+	if router.reader(WithPrimary(other), primary) != primary {
+		t.Error("Контекст WithPrimary должен читать с основного сервера")
+	}
+
+	now = now.Add(defaultReplicaStickiness)
+	if router.reader(ctx, primary) != replicaPool {
+		t.Error("После окончания привязки ожидалось чтение с реплики")
+	}
+
+	router.replicas[0].healthy.Store(false)
+	if router.reader(other, primary) != primary {
+		t.Error("При недоступной реплике чтение должно выполняться на основном сервере")
+	}
+
+	var nilRouter *ReplicaRouter
+	if nilRouter.reader(ctx, primary) != primary {
+		t.Error("Без реплик чтение должно выполняться на основном сервере")
+	}
+}
@@ -0,0 +1,220 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/config"
+)
+
+// Значения по умолчанию для транзакций
+const (
+	defaultTxMaxAttempts = 3
+	txRetryBackoff       = 20 * time.Millisecond
+)
+
+// Коды ошибок PostgreSQL, обрабатываемые репозиториями
+const (
+	sqlStateSerializationFailure = "40001" // Конфликт сериализуемых транзакций
+	sqlStateUniqueViolation      = "23505" // Нарушение уникального индекса
+)
+
+// ErrDuplicate возвращается, если запись нарушает уникальный индекс
+var ErrDuplicate = errors.New("duplicate record")
+
+// isoLevels сопоставляет уровни изоляции из конфигурации с уровнями pgx
+var isoLevels = map[string]pgx.TxIsoLevel{
+	"":                pgx.ReadCommitted,
+	"read_committed":  pgx.ReadCommitted,
+	"repeatable_read": pgx.RepeatableRead,
+	"serializable":    pgx.Serializable,
+}
+
+// txKey - ключ контекста, под которым хранится текущая транзакция
+type txKey struct{}
+
+// txState - транзакция, начатая TxManager, и функции, ожидающие ее фиксации
+type txState struct {
+	tx          pgx.Tx   // Текущая транзакция
+	afterCommit []func() // Функции, вызываемые после успешной фиксации
+}
+
+// querier - общие методы пула соединений и транзакции
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// txBeginner - пул соединений, в котором начинаются транзакции
+// Реализуется *pgxpool.Pool, в тестах заменяется транзакциями в памяти
+type txBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// TxManager выполняет несколько вызовов репозиториев в одной транзакции
+// Транзакция передается через контекст, поэтому методы репозиториев присоединяются к ней автоматически
+type TxManager struct {
+	db          txBeginner     // Пул соединений с базой данных PostgreSQL
+	isoLevel    pgx.TxIsoLevel // Уровень изоляции транзакций
+	maxAttempts int            // Максимальное число попыток при конфликте сериализации
+}
+
+// NewTxManager создает новый менеджер транзакций
+// db - пул соединений с базой данных
+// cfg - настройки базы данных (уровень изоляции и число попыток)
+func NewTxManager(db *pgxpool.Pool, cfg config.DatabaseConfig) *TxManager {
+	isoLevel, ok := isoLevels[cfg.IsolationLevel]
+	if !ok {
+		isoLevel = pgx.ReadCommitted
+	}
+
+	maxAttempts := cfg.TxMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultTxMaxAttempts
+	}
+
+	return &TxManager{
+		db:          db,
+		isoLevel:    isoLevel,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// WithTx выполняет fn в транзакции и фиксирует ее, если fn не вернула ошибку
+// Вызовы репозиториев с переданным в fn контекстом выполняются в этой транзакции
+// Если контекст уже содержит транзакцию, fn присоединяется к ней без повторов
+// При конфликте сериализации (SQLSTATE 40001) транзакция повторяется целиком,
+// поэтому fn не должна иметь побочных эффектов вне базы данных
+// ctx - контекст операции
+// fn - функция, выполняемая в транзакции
+func (m *TxManager) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := txFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	var err error
+	for attempt := 1; attempt <= m.maxAttempts; attempt++ {
+		if attempt > 1 {
+			if err := sleepJitter(ctx, time.Duration(attempt-1)*txRetryBackoff); err != nil {
+				return err
+			}
+		}
+
+		err = m.runTx(ctx, fn)
+		if !isSerializationFailure(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// runTx выполняет одну попытку транзакции
+func (m *TxManager) runTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := m.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: m.isoLevel})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	state := &txState{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	for _, hook := range state.afterCommit {
+		hook()
+	}
+	return nil
+}
+
+// InTx сообщает, выполняется ли операция в транзакции, начатой TxManager.WithTx
+func InTx(ctx context.Context) bool {
+	_, ok := txFromContext(ctx)
+	return ok
+}
+
+// AfterCommit вызывает fn после фиксации текущей транзакции из контекста
+// Вне транзакции fn вызывается сразу, при откате транзакции - не вызывается
+// Используется для действий, которые не должны опережать фиксацию (например, сброс кэша)
+func AfterCommit(ctx context.Context, fn func()) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		fn()
+		return
+	}
+	state.afterCommit = append(state.afterCommit, fn)
+}
+
+// txFromContext возвращает транзакцию, начатую TxManager.WithTx
+func txFromContext(ctx context.Context) (pgx.Tx, bool) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return state.tx, true
+}
+
+// conn возвращает текущую транзакцию из контекста или пул соединений
+func conn(ctx context.Context, db *pgxpool.Pool) querier {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// withTx выполняет fn в текущей транзакции из контекста или в новой транзакции,
+// которая фиксируется, если fn не вернула ошибку
+// Используется, чтобы изменение данных, запись аудита и доменное событие записывались атомарно
+func withTx(ctx context.Context, db *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	if tx, ok := txFromContext(ctx); ok {
+		return fn(tx)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// isSerializationFailure сообщает, что транзакцию можно безопасно повторить
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == sqlStateSerializationFailure
+}
+
+// isUniqueViolation сообщает, что запрос нарушил уникальный индекс
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == sqlStateUniqueViolation
+}
+
+// sleepJitter ожидает случайное время до max или отмену контекста
+func sleepJitter(ctx context.Context, max time.Duration) error {
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(max) + 1)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
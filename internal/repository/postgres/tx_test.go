@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// fakeTxDB начинает транзакции, фиксация которых возвращает ошибки commitErrs по очереди
+type fakeTxDB struct {
+	commitErrs []error
+	begins     int
+	commits    int
+	rollbacks  int
+}
+
+func (db *fakeTxDB) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	db.begins++
+	return &fakeTx{db: db}, nil
+}
+
+// fakeTx - транзакция fakeTxDB
+type fakeTx struct {
+	pgx.Tx
+	db   *fakeTxDB
+	done bool
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.done = true
+	if len(tx.db.commitErrs) > 0 {
+		err := tx.db.commitErrs[0]
+		tx.db.commitErrs = tx.db.commitErrs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	tx.db.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	if !tx.done {
+		tx.done = true
+		tx.db.rollbacks++
+	}
+	return nil
+}
+
+// serializationFailure - ошибка конфликта сериализуемых транзакций
+var serializationFailure = &pgconn.PgError{Code: sqlStateSerializationFailure}
+
+// TestWithTxRetriesSerializationFailure проверяет повтор транзакции при конфликте сериализации
+// и вызов функций AfterCommit только после успешной фиксации
+func TestWithTxRetriesSerializationFailure(t *testing.T) {
+	db := &fakeTxDB{commitErrs: []error{serializationFailure, serializationFailure}}
+	manager := &TxManager{db: db, maxAttempts: 3}
+
+	calls, hooks := 0, 0
+	err := manager.WithTx(context.Background(), func(ctx context.Context) error {
+		calls++
+		AfterCommit(ctx, func() { hooks++ })
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Ошибка транзакции: %v", err)
+	}
+	if calls != 3 || db.begins != 3 || db.commits != 1 {
+		t.Errorf("Ожидалось 3 попытки и 1 фиксация, выполнено %d попыток, %d транзакций, %d фиксаций", calls, db.begins, db.commits)
+	}
+	if hooks != 1 {
+		t.Errorf("AfterCommit должна вызываться один раз после успешной фиксации, вызвана %d раз", hooks)
+	}
+
+	// После maxAttempts конфликтов возвращается ошибка сериализации
+	db = &fakeTxDB{commitErrs: []error{serializationFailure, serializationFailure, serializationFailure}}
+	manager = &TxManager{db: db, maxAttempts: 3}
+	err = manager.WithTx(context.Background(), func(ctx context.Context) error { return nil })
+	if !isSerializationFailure(err) || db.begins != 3 {
+		t.Errorf("Ожидалась ошибка сериализации после 3 попыток, получено %v после %d попыток", err, db.begins)
+	}
+}
+
+// TestWithTxDoesNotRetryOtherErrors проверяет, что ошибка fn возвращается без повтора и откатывает транзакцию,
+// а функции AfterCommit при откате не вызываются
+func TestWithTxDoesNotRetryOtherErrors(t *testing.T) {
+	db := &fakeTxDB{}
+	manager := &TxManager{db: db, maxAttempts: 3}
+	errFailed := errors.New("нарушено ограничение")
+
+	hooks := 0
+	err := manager.WithTx(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, func() { hooks++ })
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("Ожидалась ошибка %v, получено %v", errFailed, err)
+	}
+	if db.begins != 1 || db.commits != 0 || db.rollbacks != 1 {
+		t.Errorf("Ожидалась 1 откаченная транзакция: %+v", db)
+	}
+	if hooks != 0 {
+		t.Errorf("AfterCommit не должна вызываться при откате, вызвана %d раз", hooks)
+	}
+}
+
+// TestWithTxJoinsAmbientTx проверяет, что вложенный WithTx и репозитории присоединяются к текущей транзакции,
+// а вне транзакции AfterCommit вызывает функцию сразу
+func TestWithTxJoinsAmbientTx(t *testing.T) {
+	db := &fakeTxDB{}
+	manager := &TxManager{db: db, maxAttempts: 3}
+
+	hooks := 0
+	err := manager.WithTx(context.Background(), func(ctx context.Context) error {
+		outer, _ := txFromContext(ctx)
+		return manager.WithTx(ctx, func(ctx context.Context) error {
+			if !InTx(ctx) || conn(ctx, nil) != outer {
+				t.Error("Вложенная транзакция должна использовать внешнюю транзакцию")
+			}
+			AfterCommit(ctx, func() { hooks++ })
+			if hooks != 0 {
+				t.Error("AfterCommit во вложенной транзакции не должна вызываться до фиксации внешней")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("Ошибка транзакции: %v", err)
+	}
+	if db.begins != 1 || db.commits != 1 || hooks != 1 {
+		t.Errorf("Ожидалась одна транзакция и вызов AfterCommit после ее фиксации: %+v, вызовов %d", db, hooks)
+	}
+
+	ctx := context.Background()
+	AfterCommit(ctx, func() { hooks++ })
+	if InTx(ctx) || hooks != 2 {
+		t.Errorf("Вне транзакции AfterCommit должна вызываться сразу")
+	}
+}
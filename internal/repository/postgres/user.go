@@ -2,49 +2,138 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
 )
 
+// userColumns - столбцы пользователя в порядке сканирования scanUser
+const userColumns = "id, tenant_id, name, email, display_name, phone, locale, timezone, avatar_url, metadata, " +
+	"role, email_verified, status, created_at, updated_at, updated_by"
+
+// scanUser сканирует строку со столбцами userColumns в структуру пользователя
+func scanUser(row pgx.Row, user *model.User) error {
+	return row.Scan(&user.ID, &user.TenantID, &user.Name, &user.Email,
+		&user.DisplayName, &user.Phone, &user.Locale, &user.Timezone, &user.AvatarURL, &user.Metadata,
+		&user.Role, &user.EmailVerified, &user.Status, &user.CreatedAt, &user.UpdatedAt, &user.UpdatedBy)
+}
+
+// userOrderBy - допустимые выражения ORDER BY для порядка сортировки из фильтра
+// Сортировка по времени изменения дополняется ID, чтобы порядок был однозначным
+// при совпадении времени и страницы не пропускали и не повторяли пользователей
+var userOrderBy = map[string]string{
+	"":                      "id",
+	model.UserSortID:        "id",
+	model.UserSortUpdatedAt: "updated_at, id",
+}
+
+// userWhere возвращает условие WHERE для фильтра и его аргументы
+// Выборка всегда ограничена арендатором tenantID
+// Проверка наличия ключа (?) позволяет использовать GIN индекс по метаданным
+func userWhere(tenantID string, filter model.UserFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions = append(conditions, "tenant_id = "+arg(tenantID))
+
+	if !filter.UpdatedSince.IsZero() {
+		conditions = append(conditions, "updated_at >= "+arg(filter.UpdatedSince))
+	}
+
+	// Ключи сортируются, чтобы текст запроса не зависел от порядка обхода словаря
+	keys := make([]string, 0, len(filter.Metadata))
+	for key := range filter.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := arg(key)
+		conditions = append(conditions, fmt.Sprintf("metadata ? %s AND metadata ->> %s = %s", name, name, arg(filter.Metadata[key])))
+	}
+	for _, key := range filter.MetadataKeys {
+		conditions = append(conditions, "metadata ? "+arg(key))
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = "+arg(filter.Status))
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
 // UserRepository обрабатывает операции с базой данных, связанные с пользователями
 // Этот тип реализует доступ к данным пользователей в PostgreSQL
+// Запись выполняется на основном сервере, чтение - на репликах, если они настроены
+// Все запросы ограничены арендатором из сведений о запросе в контексте (requestinfo.Info.Tenant)
 type UserRepository struct {
-	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+	db       *pgxpool.Pool  // Пул соединений с основным сервером PostgreSQL
+	replicas *ReplicaRouter // Маршрутизатор чтения на реплики (nil - чтение с основного сервера)
 }
 
 // NewUserRepository создает новый репозиторий пользователей
-// db - пул соединений с базой данных
-func NewUserRepository(db *pgxpool.Pool) *UserRepository {
+// db - пул соединений с основным сервером базы данных
+// replicas - маршрутизатор чтения на реплики или nil
+func NewUserRepository(db *pgxpool.Pool, replicas *ReplicaRouter) *UserRepository {
 	return &UserRepository{
-		db: db,
+		db:       db,
+		replicas: replicas,
 	}
 }
 
 // Create добавляет нового пользователя в базу данных
+// Вместе с пользователем в outbox записывается событие UserCreated, а в журнал аудита - запись create
+// Инициатор изменения updated_by берется из сведений о запросе в контексте
+// Возвращает ErrDuplicate, если электронная почта уже используется у арендатора
 // ctx - контекст для операции с базой данных
 // user - данные для создания пользователя
 func (r *UserRepository) Create(ctx context.Context, user model.UserCreate) (*model.User, error) {
 	// SQL запрос для вставки нового пользователя и получения его данных
 	query := `
-		INSERT INTO users (name, email, created_at) 
-		VALUES ($1, $2, $3) 
-		RETURNING id, name, email, created_at
-	`
+		INSERT INTO users (name, email, display_name, phone, locale, timezone, avatar_url, metadata,
+			created_at, updated_at, updated_by, tenant_id, role, email_verified, status) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $10, $11, $12, $13, $14) 
+		RETURNING ` + userColumns
 
 	createdAt := time.Now()
+	metadata := user.Metadata
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
 	var createdUser model.User
 
 	// Выполнение запроса и сканирование результатов в структуру User
-	err := r.db.QueryRow(ctx, query, user.Name, user.Email, createdAt).
-		Scan(&createdUser.ID, &createdUser.Name, &createdUser.Email, &createdUser.CreatedAt)
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		info := requestinfo.FromContext(ctx)
+		err := scanUser(tx.QueryRow(ctx, query, user.Name, user.Email, user.DisplayName, user.Phone, user.Locale,
+			user.Timezone, user.AvatarURL, metadata, createdAt, info.Actor, info.Tenant(), user.Role, user.EmailVerified, user.Status), &createdUser)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return ErrDuplicate
+			}
+			return err
+		}
+
+		if err := insertAudit(ctx, tx, model.AuditActionCreate, "", nil, &createdUser); err != nil {
+			return err
+		}
+
+		return insertEvent(ctx, tx, model.EventUserCreated, &createdUser)
+	})
 
 	if err != nil {
 		return nil, err
 	}
+	r.replicas.markWrite(ctx)
 
 	return &createdUser, nil
 }
@@ -55,17 +144,16 @@ func (r *UserRepository) Create(ctx context.Context, user model.UserCreate) (*mo
 func (r *UserRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
 	// SQL запрос для получения пользователя по ID
 	query := `
-		SELECT id, name, email, created_at 
+		SELECT ` + userColumns + `
 		FROM users 
-		WHERE id = $1
+		WHERE id = $1 AND tenant_id = $2
 	`
 
 	var user model.User
-	err := r.db.QueryRow(ctx, query, id).
-		Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt)
+	err := scanUser(r.replicas.reader(ctx, r.db).QueryRow(ctx, query, id, requestinfo.FromContext(ctx).Tenant()), &user)
 
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil // Пользователь не найден, возвращаем nil без ошибки
 		}
 		return nil, err
@@ -74,28 +162,67 @@ func (r *UserRepository) GetByID(ctx context.Context, id int64) (*model.User, er
 	return &user, nil
 }
 
-// GetAll получает всех пользователей из базы данных
+// GetByEmail получает пользователя по электронной почте
 // ctx - контекст для операции с базой данных
-func (r *UserRepository) GetAll(ctx context.Context) ([]model.User, error) {
-	// SQL запрос для получения всех пользователей, отсортированных по ID
+// email - электронная почта пользователя
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
 	query := `
-		SELECT id, name, email, created_at 
-		FROM users
-		ORDER BY id
+		SELECT ` + userColumns + `
+		FROM users 
+		WHERE email = $1 AND tenant_id = $2
 	`
 
+	var user model.User
+	err := scanUser(r.replicas.reader(ctx, r.db).QueryRow(ctx, query, email, requestinfo.FromContext(ctx).Tenant()), &user)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil // Пользователь не найден, возвращаем nil без ошибки
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetAll получает пользователей из базы данных
+// ctx - контекст для операции с базой данных
+// filter - параметры выборки, сортировки и пагинации
+func (r *UserRepository) GetAll(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	orderBy, ok := userOrderBy[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный порядок сортировки %q", filter.Sort)
+	}
+
+	var limit *int
+	if filter.Limit > 0 {
+		limit = &filter.Limit
+	}
+
+	// SQL запрос для получения отсортированных пользователей
+	// LIMIT NULL в PostgreSQL означает выборку без ограничения
+	where, args := userWhere(requestinfo.FromContext(ctx).Tenant(), filter)
+	args = append(args, limit, filter.Offset)
+	query := fmt.Sprintf(`
+		SELECT `+userColumns+`
+		FROM users
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, where, orderBy, len(args)-1, len(args))
+
 	// Выполнение запроса
-	rows, err := r.db.Query(ctx, query)
+	rows, err := r.replicas.reader(ctx, r.db).Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	// Сканирование результатов в слайс пользователей
-	var users []model.User
+	users := []model.User{}
 	for rows.Next() {
 		var user model.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt); err != nil {
+		if err := scanUser(rows, &user); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -109,61 +236,186 @@ func (r *UserRepository) GetAll(ctx context.Context) ([]model.User, error) {
 	return users, nil
 }
 
+// Count возвращает общее количество пользователей, подходящих под фильтр
+// Параметры пагинации фильтра не учитываются
+// ctx - контекст для операции с базой данных
+// filter - параметры выборки
+func (r *UserRepository) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	where, args := userWhere(requestinfo.FromContext(ctx).Tenant(), filter)
+	var total int
+	err := r.replicas.reader(ctx, r.db).QueryRow(ctx, "SELECT COUNT(*) FROM users "+where, args...).Scan(&total)
+	return total, err
+}
+
 // Update обновляет информацию о пользователе
+// Чтение текущего состояния и изменение выполняются в одной транзакции с блокировкой строки,
+// поэтому параллельные обновления не теряют изменения друг друга
+// Вместе с изменением в outbox записывается событие UserUpdated, а в журнал аудита - различия полей
+// Время изменения updated_at выставляется триггером, инициатор updated_by - из сведений о запросе
+// Возвращает ErrDuplicate, если новая электронная почта уже используется у арендатора
 // ctx - контекст для операции с базой данных
 // id - идентификатор пользователя для обновления
 // user - данные для обновления
 func (r *UserRepository) Update(ctx context.Context, id int64, user model.UserUpdate) (*model.User, error) {
-	// Сначала получаем текущего пользователя, чтобы убедиться, что он существует
-	currentUser, err := r.GetByID(ctx, id)
+	selectQuery := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1 AND tenant_id = $2
+		FOR UPDATE
+	`
+
+	// SQL запрос для обновления пользователя
+	updateQuery := `
+		UPDATE users 
+		SET name = $1, email = $2, display_name = $3, phone = $4, locale = $5, timezone = $6,
+			avatar_url = $7, metadata = $8, role = $9, email_verified = $10, updated_by = $11
+		WHERE id = $12
+		RETURNING ` + userColumns
+
+	var updatedUser *model.User
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		// Сначала получаем текущего пользователя, чтобы убедиться, что он существует
+		var before model.User // Состояние до изменения для журнала аудита
+		err := scanUser(tx.QueryRow(ctx, selectQuery, id, requestinfo.FromContext(ctx).Tenant()), &before)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil // Пользователь не найден
+			}
+			return err
+		}
+
+		// Обновляем переданные поля
+		current := user.Apply(before)
+
+		var updated model.User
+		err = scanUser(tx.QueryRow(ctx, updateQuery, current.Name, current.Email, current.DisplayName, current.Phone,
+			current.Locale, current.Timezone, current.AvatarURL, current.Metadata, current.Role, current.EmailVerified,
+			requestinfo.FromContext(ctx).Actor, id), &updated)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return ErrDuplicate
+			}
+			return err
+		}
+
+		if err := insertAudit(ctx, tx, model.AuditActionUpdate, "", &before, &updated); err != nil {
+			return err
+		}
+		if err := insertEvent(ctx, tx, model.EventUserUpdated, &updated); err != nil {
+			return err
+		}
+
+		updatedUser = &updated
+		return nil
+	})
+
 	if err != nil {
 		return nil, err
 	}
-	if currentUser == nil {
-		return nil, nil // Пользователь не найден
+	if updatedUser != nil {
+		r.replicas.markWrite(ctx)
 	}
 
-	// Обновляем непустые поля
-	if user.Name != "" {
-		currentUser.Name = user.Name
-	}
-	if user.Email != "" {
-		currentUser.Email = user.Email
-	}
+	return updatedUser, nil
+}
 
-	// SQL запрос для обновления пользователя
-	query := `
-		UPDATE users 
-		SET name = $1, email = $2
-		WHERE id = $3
-		RETURNING id, name, email, created_at
+// ErrStatusTransition возвращается, если учетную запись нельзя перевести из текущего состояния в новое
+var ErrStatusTransition = errors.New("user status transition is not allowed")
+
+// ChangeStatus переводит учетную запись пользователя в другое состояние
+// Допустимость перехода проверяется по текущему состоянию строки, заблокированной до конца транзакции
+// Вместе с изменением в outbox записывается событие UserUpdated, а в журнал аудита - изменение с причиной
+// Возвращает nil без ошибки, если пользователь не найден, и ErrStatusTransition, если переход недопустим
+// ctx - контекст для операции с базой данных
+// id - идентификатор пользователя
+// change - новое состояние и причина изменения
+func (r *UserRepository) ChangeStatus(ctx context.Context, id int64, change model.UserStatusChange) (*model.User, error) {
+	selectQuery := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1 AND tenant_id = $2
+		FOR UPDATE
 	`
 
-	var updatedUser model.User
-	err = r.db.QueryRow(ctx, query, currentUser.Name, currentUser.Email, id).
-		Scan(&updatedUser.ID, &updatedUser.Name, &updatedUser.Email, &updatedUser.CreatedAt)
+	updateQuery := `
+		UPDATE users
+		SET status = $1, updated_by = $2
+		WHERE id = $3
+		RETURNING ` + userColumns
+
+	var updatedUser *model.User
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		var before model.User
+		err := scanUser(tx.QueryRow(ctx, selectQuery, id, requestinfo.FromContext(ctx).Tenant()), &before)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil // Пользователь не найден
+			}
+			return err
+		}
+
+		if !model.CanTransitionUserStatus(before.Status, change.Status) {
+			return ErrStatusTransition
+		}
+
+		var updated model.User
+		err = scanUser(tx.QueryRow(ctx, updateQuery, change.Status, requestinfo.FromContext(ctx).Actor, id), &updated)
+		if err != nil {
+			return err
+		}
+
+		if err := insertAudit(ctx, tx, model.AuditActionUpdate, change.Reason, &before, &updated); err != nil {
+			return err
+		}
+		if err := insertEvent(ctx, tx, model.EventUserUpdated, &updated); err != nil {
+			return err
+		}
+
+		updatedUser = &updated
+		return nil
+	})
 
 	if err != nil {
 		return nil, err
 	}
+	if updatedUser != nil {
+		r.replicas.markWrite(ctx)
+	}
 
-	return &updatedUser, nil
+	return updatedUser, nil
 }
 
 // Delete удаляет пользователя по ID
+// Вместе с удалением в outbox записывается событие UserDeleted с последним состоянием пользователя,
+// а в журнал аудита - запись delete
 // ctx - контекст для операции с базой данных
 // id - идентификатор пользователя для удаления
 func (r *UserRepository) Delete(ctx context.Context, id int64) error {
-	query := "DELETE FROM users WHERE id = $1"
+	query := `
+		DELETE FROM users
+		WHERE id = $1 AND tenant_id = $2
+		RETURNING ` + userColumns
 
-	commandTag, err := r.db.Exec(ctx, query, id)
+	err := withTx(ctx, r.db, func(tx pgx.Tx) error {
+		var deletedUser model.User
+		err := scanUser(tx.QueryRow(ctx, query, id, requestinfo.FromContext(ctx).Tenant()), &deletedUser)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil // Пользователь не найден, не считается ошибкой
+			}
+			return err
+		}
+
+		if err := insertAudit(ctx, tx, model.AuditActionDelete, "", &deletedUser, nil); err != nil {
+			return err
+		}
+
+		return insertEvent(ctx, tx, model.EventUserDeleted, &deletedUser)
+	})
 	if err != nil {
 		return err
 	}
-
-	if commandTag.RowsAffected() == 0 {
-		return nil // Пользователь не найден, не считается ошибкой
-	}
+	r.replicas.markWrite(ctx)
 
 	return nil
 }
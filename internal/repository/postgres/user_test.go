@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// TestUserWhere проверяет построение условия WHERE и порядок аргументов фильтра списка
+func TestUserWhere(t *testing.T) {
+	where, args := userWhere("acme", model.UserFilter{})
+	if where != "WHERE tenant_id = $1" || !reflect.DeepEqual(args, []interface{}{"acme"}) {
+		t.Errorf("Пустой фильтр должен ограничивать только арендатора, получено %q %v", where, args)
+	}
+
+	since := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	where, args = userWhere("acme", model.UserFilter{
+		UpdatedSince: since,
+		Metadata:     map[string]string{"team": "core", "department": "sales"},
+		MetadataKeys: []string{"vip"},
+		Status:       model.UserStatusSuspended,
+	})
+
+	wantWhere := "WHERE tenant_id = $1 AND updated_at >= $2" +
+		" AND metadata ? $3 AND metadata ->> $3 = $4" +
+		" AND metadata ? $5 AND metadata ->> $5 = $6" +
+		" AND metadata ? $7 AND status = $8"
+	if where != wantWhere {
+		t.Errorf("Неожиданное условие:\n%s\nожидалось:\n%s", where, wantWhere)
+	}
+	wantArgs := []interface{}{"acme", since, "department", "sales", "team", "core", "vip", model.UserStatusSuspended}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("Неожиданные аргументы %v, ожидалось %v", args, wantArgs)
+	}
+}
@@ -0,0 +1,331 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// webhookColumns - список колонок подписки в порядке сканирования scanWebhook
+const webhookColumns = "id, url, secret, event_types, active, failure_count, disabled_at, created_at"
+
+// WebhookRepository обрабатывает операции с подписками на вебхуки и журналом доставок
+// Подписки выбираются и изменяются в пределах арендатора из контекста (см. requestinfo)
+type WebhookRepository struct {
+	db *pgxpool.Pool // Пул соединений с базой данных PostgreSQL
+}
+
+// NewWebhookRepository создает новый репозиторий вебхуков
+// db - пул соединений с базой данных
+func NewWebhookRepository(db *pgxpool.Pool) *WebhookRepository {
+	return &WebhookRepository{
+		db: db,
+	}
+}
+
+// scanWebhook сканирует строку результата в структуру подписки
+func scanWebhook(row pgx.Row) (*model.WebhookSubscription, error) {
+	var sub model.WebhookSubscription
+	err := row.Scan(&sub.ID, &sub.URL, &sub.Secret, &sub.EventTypes, &sub.Active,
+		&sub.FailureCount, &sub.DisabledAt, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+	return &sub, nil
+}
+
+// Create добавляет новую подписку
+// ctx - контекст для операции с базой данных
+// sub - данные подписки (секрет должен быть уже заполнен)
+func (r *WebhookRepository) Create(ctx context.Context, sub model.WebhookSubscriptionCreate) (*model.WebhookSubscription, error) {
+	query := `
+		INSERT INTO webhook_subscriptions (tenant_id, url, secret, event_types)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + webhookColumns
+
+	eventTypes := sub.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	return scanWebhook(conn(ctx, r.db).QueryRow(ctx, query, requestinfo.FromContext(ctx).Tenant(), sub.URL, sub.Secret,
+		eventTypes))
+}
+
+// GetByID получает подписку по идентификатору
+// Возвращает nil без ошибки, если подписка не найдена
+func (r *WebhookRepository) GetByID(ctx context.Context, id int64) (*model.WebhookSubscription, error) {
+	query := "SELECT " + webhookColumns + " FROM webhook_subscriptions WHERE id = $1 AND tenant_id = $2"
+
+	sub, err := scanWebhook(conn(ctx, r.db).QueryRow(ctx, query, id, requestinfo.FromContext(ctx).Tenant()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// GetAll получает все подписки, отсортированные по ID
+func (r *WebhookRepository) GetAll(ctx context.Context) ([]model.WebhookSubscription, error) {
+	query := "SELECT " + webhookColumns + " FROM webhook_subscriptions WHERE tenant_id = $1 ORDER BY id"
+	return r.list(ctx, query, requestinfo.FromContext(ctx).Tenant())
+}
+
+// ListActiveForEvent получает активные подписки арендатора, которые должны получить событие указанного типа
+// eventType - тип события
+func (r *WebhookRepository) ListActiveForEvent(ctx context.Context, eventType string) ([]model.WebhookSubscription, error) {
+	query := "SELECT " + webhookColumns + ` FROM webhook_subscriptions
+		WHERE tenant_id = $1 AND active AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+		ORDER BY id`
+	return r.list(ctx, query, requestinfo.FromContext(ctx).Tenant(), eventType)
+}
+
+// list выполняет запрос и сканирует все подписки из результата
+func (r *WebhookRepository) list(ctx context.Context, query string, args ...interface{}) ([]model.WebhookSubscription, error) {
+	rows, err := conn(ctx, r.db).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []model.WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// Update сохраняет измененную подписку
+// Повторное включение подписки сбрасывает счетчик ошибок и дату отключения
+// Возвращает nil без ошибки, если подписка не найдена
+func (r *WebhookRepository) Update(ctx context.Context, sub model.WebhookSubscription) (*model.WebhookSubscription, error) {
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = $1, secret = $2, event_types = $3, active = $4,
+			failure_count = CASE WHEN $4 AND NOT active THEN 0 ELSE failure_count END,
+			disabled_at = CASE WHEN $4 THEN NULL ELSE disabled_at END
+		WHERE id = $5 AND tenant_id = $6
+		RETURNING ` + webhookColumns
+
+	updated, err := scanWebhook(conn(ctx, r.db).QueryRow(ctx, query, sub.URL, sub.Secret, sub.EventTypes, sub.Active, sub.ID,
+		requestinfo.FromContext(ctx).Tenant()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Delete удаляет подписку вместе с журналом ее доставок
+// Возвращает false, если подписка не найдена
+func (r *WebhookRepository) Delete(ctx context.Context, id int64) (bool, error) {
+	commandTag, err := conn(ctx, r.db).Exec(ctx, "DELETE FROM webhook_subscriptions WHERE id = $1 AND tenant_id = $2", id,
+		requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// RecordDelivery записывает попытку доставки в журнал
+func (r *WebhookRepository) RecordDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries
+			(subscription_id, event_id, event_type, attempt, status_code, error, duration_ms, success)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, ''), $7, $8)
+	`
+
+	_, err := conn(ctx, r.db).Exec(ctx, query, delivery.SubscriptionID, delivery.EventID, delivery.EventType,
+		delivery.Attempt, delivery.StatusCode, delivery.Error, delivery.DurationMS, delivery.Success)
+	return err
+}
+
+// ListDeliveries получает последние попытки доставки по подписке, начиная с самых новых
+// id - идентификатор подписки
+// limit - максимальное количество записей
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, id int64, limit int) ([]model.WebhookDelivery, error) {
+	query := `
+		SELECT id, subscription_id, event_id, event_type, attempt,
+			COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, success, created_at
+		FROM webhook_deliveries
+		WHERE subscription_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		var d model.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Attempt,
+			&d.StatusCode, &d.Error, &d.DurationMS, &d.Success, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordFailure увеличивает счетчик неудачных доставок подряд
+// и отключает подписку, когда счетчик достигает порога
+// threshold - порог отключения (0 - не отключать)
+// Возвращает true, если подписка была отключена этим вызовом
+func (r *WebhookRepository) RecordFailure(ctx context.Context, id int64, threshold int) (bool, error) {
+	query := `
+		UPDATE webhook_subscriptions
+		SET failure_count = failure_count + 1,
+			active = CASE WHEN $2 > 0 AND failure_count + 1 >= $2 THEN FALSE ELSE active END,
+			disabled_at = CASE WHEN $2 > 0 AND failure_count + 1 >= $2 AND active THEN NOW() ELSE disabled_at END
+		WHERE id = $1
+		RETURNING COALESCE(NOT active AND disabled_at = NOW(), FALSE)
+	`
+
+	var disabled bool
+	if err := conn(ctx, r.db).QueryRow(ctx, query, id, threshold).Scan(&disabled); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return disabled, nil
+}
+
+// ResetFailures сбрасывает счетчик неудачных доставок после успешной доставки
+func (r *WebhookRepository) ResetFailures(ctx context.Context, id int64) error {
+	_, err := conn(ctx, r.db).Exec(ctx, "UPDATE webhook_subscriptions SET failure_count = 0 WHERE id = $1 AND failure_count > 0", id)
+	return err
+}
+
+// Enqueue ставит событие в очередь доставки по подпискам
+// Повторная постановка того же события по подписке игнорируется, поэтому повтор публикации
+// ретранслятором outbox не приводит к повторной доставке
+// event - доставляемое событие
+// body - тело уведомления
+// subs - подписки, которые должны получить событие
+func (r *WebhookRepository) Enqueue(ctx context.Context, event model.Event, body []byte, subs []model.WebhookSubscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(subs))
+	for i, sub := range subs {
+		ids[i] = sub.ID
+	}
+
+	query := `
+		INSERT INTO webhook_queue (tenant_id, subscription_id, event_id, aggregate_id, event_type, body)
+		SELECT $1, subscription_id, $3, $4, $5, $6
+		FROM unnest($2::BIGINT[]) AS subscription_id
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+	`
+
+	_, err := conn(ctx, r.db).Exec(ctx, query, requestinfo.FromContext(ctx).Tenant(), ids, event.ID, event.AggregateID,
+		event.Type, body)
+	return err
+}
+
+// ClaimTasks выбирает доставки всех арендаторов, время которых наступило, и откладывает их на время lease,
+// чтобы другие экземпляры сервиса не выполняли их одновременно
+// Доставка не выбирается, пока по той же подписке в очереди есть более раннее событие того же пользователя,
+// поэтому порядок событий пользователя у получателя сохраняется
+// limit - максимальное количество доставок
+// lease - время, на которое доставки закрепляются за вызывающим
+func (r *WebhookRepository) ClaimTasks(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookTask, error) {
+	query := `
+		UPDATE webhook_queue
+		SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT q.id
+			FROM webhook_queue q
+			WHERE q.next_attempt_at <= NOW()
+				AND NOT EXISTS (
+					SELECT 1 FROM webhook_queue p
+					WHERE p.subscription_id = q.subscription_id AND p.aggregate_id = q.aggregate_id AND p.id < q.id
+				)
+			ORDER BY q.id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, tenant_id, subscription_id, event_id, aggregate_id, event_type, body, attempts
+	`
+
+	rows, err := conn(ctx, r.db).Query(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []model.WebhookTask{}
+	for rows.Next() {
+		var task model.WebhookTask
+		if err := rows.Scan(&task.ID, &task.TenantID, &task.SubscriptionID, &task.EventID, &task.AggregateID,
+			&task.EventType, &task.Body, &task.Attempts); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING не сохраняет порядок подзапроса
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+// CompleteTask удаляет доставку из очереди после успешной доставки или последней попытки
+func (r *WebhookRepository) CompleteTask(ctx context.Context, id int64) error {
+	_, err := conn(ctx, r.db).Exec(ctx, "DELETE FROM webhook_queue WHERE id = $1", id)
+	return err
+}
+
+// RetryTask откладывает доставку после неудачной попытки
+// delay - задержка до следующей попытки
+// lastError - ошибка попытки
+func (r *WebhookRepository) RetryTask(ctx context.Context, id int64, delay time.Duration, lastError string) error {
+	query := `
+		UPDATE webhook_queue
+		SET attempts = attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond', last_error = $3
+		WHERE id = $1
+	`
+
+	_, err := conn(ctx, r.db).Exec(ctx, query, id, delay.Milliseconds(), lastError)
+	return err
+}
@@ -0,0 +1,58 @@
+// Package repository описывает интерфейсы слоя доступа к данным
+// Реализация для PostgreSQL находится в пакете postgres, кэширующая обертка - в пакете cache
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// UserRepository - хранилище пользователей, используемое сервисом пользователей
+// Методы получения возвращают nil без ошибки, если пользователь не найден
+type UserRepository interface {
+	Create(ctx context.Context, user model.UserCreate) (*model.User, error)
+	GetByID(ctx context.Context, id int64) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	GetAll(ctx context.Context, filter model.UserFilter) ([]model.User, error)
+	Count(ctx context.Context, filter model.UserFilter) (int, error)
+	Update(ctx context.Context, id int64, user model.UserUpdate) (*model.User, error)
+	ChangeStatus(ctx context.Context, id int64, change model.UserStatusChange) (*model.User, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// AuditRepository - журнал аудита, из которого сервис пользователей читает историю изменений
+type AuditRepository interface {
+	ListByUser(ctx context.Context, userID int64, limit, offset int) ([]model.AuditEntry, int, error)
+}
+
+// Transactor выполняет несколько вызовов репозиториев в одной транзакции
+// Реализуется postgres.TxManager: транзакция передается через контекст
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// CredentialRepository - хранилище паролей и учета неудачных попыток входа, используемое сервисом входа
+// Реализуется postgres.CredentialRepository
+type CredentialRepository interface {
+	GetPasswordHash(ctx context.Context, userID int64) (string, error)
+	SetPasswordHash(ctx context.Context, userID int64, hash, reason string) (bool, error)
+	ReserveAttempt(ctx context.Context, keys []model.LoginKey,
+		reserve func(key model.LoginKey, attempts model.LoginAttempts) (model.LoginAttempts, error)) ([]model.LoginAttempts, error)
+	ReleaseAttempt(ctx context.Context, key model.LoginKey, reserved model.LoginAttempts) error
+	ResetAttempts(ctx context.Context, scope, key string) error
+}
+
+// IdentityRepository - хранилище учетных записей внешних поставщиков и начатых входов через них
+// Методы получения возвращают nil без ошибки, если запись не найдена
+type IdentityRepository interface {
+	CreateState(ctx context.Context, state model.IdentityLoginState, stateHash string) error
+	ConsumeState(ctx context.Context, stateHash string) (*model.IdentityLoginState, error)
+	GetBySubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error)
+	Link(ctx context.Context, identity model.UserIdentity) (*model.UserIdentity, error)
+	TouchLogin(ctx context.Context, id int64, now time.Time) error
+	ListByUser(ctx context.Context, userID int64) ([]model.UserIdentity, error)
+	Delete(ctx context.Context, userID, id int64) (bool, error)
+	Unlinked(ctx context.Context, userID int64, provider string) (bool, error)
+}
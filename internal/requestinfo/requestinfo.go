@@ -0,0 +1,121 @@
+package requestinfo
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// Info содержит сведения о HTTP запросе, в рамках которого выполняется операция
+// Используется для записи журнала аудита, логирования и проверки прав доступа
+type Info struct {
+	RequestID string // Идентификатор запроса (заголовок X-Request-ID)
+	Actor     string // Инициатор изменения
+	IP        string // IP-адрес клиента
+	TenantID  string // Арендатор, в пределах которого выполняется операция (пусто - DefaultTenant)
+	UserID    int64  // Пользователь из проверенного токена доступа (0 - запрос без токена)
+	Role      string // Роль пользователя из токена доступа
+	APIKey    string // Префикс ключа API, которым выполнен запрос (пусто - запрос без ключа)
+}
+
+// Ограничения длины значений от клиента, соответствующие колонкам журнала аудита
+const (
+	MaxRequestIDLength = 100 // user_audit.request_id
+	MaxActorLength     = 255 // user_audit.actor и users.updated_by
+)
+
+// ValidRequestID сообщает, что идентификатор запроса от клиента можно сохранить в журнале аудита
+// и вернуть в заголовке ответа: он не пустой, не длиннее MaxRequestIDLength байт
+// и состоит из видимых символов ASCII
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// TruncateActor приводит инициатора от клиента к виду, который помещается в журнал аудита:
+// некорректные последовательности UTF-8 удаляются, а строка обрезается до MaxActorLength байт
+// по границе символа
+func TruncateActor(actor string) string {
+	actor = strings.ToValidUTF8(actor, "")
+	if len(actor) <= MaxActorLength {
+		return actor
+	}
+	cut := MaxActorLength
+	for cut > 0 && !utf8.RuneStart(actor[cut]) {
+		cut--
+	}
+	return actor[:cut]
+}
+
+// DefaultTenant - арендатор операций, для которых арендатор не определен
+// Используется, когда разделение по арендаторам выключено, и для фоновых задач
+const DefaultTenant = "default"
+
+// Tenant возвращает арендатора операции или DefaultTenant, если он не задан
+func (i Info) Tenant() string {
+	if i.TenantID == "" {
+		return DefaultTenant
+	}
+	return i.TenantID
+}
+
+// IsAdmin сообщает, что запрос выполняет администратор арендатора по токену доступа
+// Запросы по ключу API администраторскими не считаются
+func (i Info) IsAdmin() bool {
+	return i.UserID != 0 && i.APIKey == "" && i.Role == model.UserRoleAdmin
+}
+
+// Authenticated сообщает, что запрос выполнен с проверенным токеном доступа или ключом API
+func (i Info) Authenticated() bool {
+	return i.UserID != 0 || i.APIKey != ""
+}
+
+// IsSelf сообщает, что запрос выполняет по токену доступа сам пользователь id
+func (i Info) IsSelf(id int64) bool {
+	return i.APIKey == "" && i.UserID != 0 && i.UserID == id
+}
+
+// CanManageUsers сообщает, что запрос может изменять чужие учетные записи, группы и приглашения:
+// его выполняет администратор арендатора по токену доступа или сервис по ключу API
+// (разрешения ключа на ресурс проверяются при проверке ключа)
+func (i Info) CanManageUsers() bool {
+	return i.IsAdmin() || i.APIKey != ""
+}
+
+// CanGrantRole сообщает, что запрос может назначить пользователю роль role
+// Роль администратора назначает только администратор арендатора по токену доступа,
+// другие роли - также сервис по ключу API; пустая роль ничего не назначает
+func (i Info) CanGrantRole(role string) bool {
+	switch {
+	case role == "":
+		return true
+	case role == model.UserRoleAdmin:
+		return i.IsAdmin()
+	default:
+		return i.CanManageUsers()
+	}
+}
+
+// contextKey - тип ключа контекста, исключающий пересечение с ключами других пакетов
+type contextKey struct{}
+
+// WithInfo возвращает копию контекста со сведениями о запросе
+func WithInfo(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext возвращает сведения о запросе из контекста
+// Для контекста вне HTTP запроса (например, фоновые задачи) возвращается пустая структура
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(contextKey{}).(Info)
+	return info
+}
@@ -0,0 +1,182 @@
+// Package seed наполняет базу данных тестовыми данными из фикстур
+// Наполнение выполняется только явно (userctl seed) и только в окружениях,
+// перечисленных в фикстуре, поэтому тестовые пользователи не попадают в production
+package seed
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// EnvProduction - окружение, используемое, если в конфигурации окружение не указано
+const EnvProduction = "production"
+
+// Ошибки загрузки и применения фикстур
+var (
+	ErrUnknownProfile = errors.New("unknown seed profile")
+	ErrNotAllowed     = errors.New("fixture is not allowed in this environment")
+)
+
+// profiles содержит встроенные профили фикстур (<профиль>.yaml)
+//
+//go:embed fixtures/*.yaml
+var profiles embed.FS
+
+// Fixture описывает набор тестовых данных
+type Fixture struct {
+	Environments []string      `yaml:"environments" json:"environments"` // Окружения, в которых разрешено применение
+	Users        []FixtureUser `yaml:"users" json:"users"`               // Пользователи
+}
+
+// FixtureUser описывает пользователя в фикстуре
+// Пользователь определяется по email, имя обновляется при повторном применении
+type FixtureUser struct {
+	Name  string `yaml:"name" json:"name"`   // Имя пользователя
+	Email string `yaml:"email" json:"email"` // Электронная почта
+}
+
+// Result содержит итоги применения фикстуры
+type Result struct {
+	Created   int // Создано пользователей
+	Updated   int // Обновлено пользователей
+	Unchanged int // Пользователей, уже совпадающих с фикстурой
+}
+
+// Profiles возвращает имена встроенных профилей
+func Profiles() []string {
+	entries, _ := fs.ReadDir(profiles, "fixtures")
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile загружает встроенный профиль фикстур
+// name - имя профиля (dev, test)
+func Profile(name string) (*Fixture, error) {
+	data, err := profiles.ReadFile(path.Join("fixtures", name+".yaml"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w %q (доступны: %s)", ErrUnknownProfile, name, strings.Join(Profiles(), ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, ".yaml")
+}
+
+// Load загружает фикстуру из файла в формате YAML (.yaml, .yml) или JSON (.json)
+// filename - путь к файлу фикстуры
+func Load(filename string) (*Fixture, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, strings.ToLower(filepath.Ext(filename)))
+}
+
+// parse разбирает фикстуру в формате, определяемом расширением файла
+func parse(data []byte, ext string) (*Fixture, error) {
+	var fixture Fixture
+	switch ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("разбор YAML: %w", err)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("разбор JSON: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("неподдерживаемый формат фикстуры %q (ожидается .yaml, .yml или .json)", ext)
+	}
+	return &fixture, nil
+}
+
+// Allows сообщает, разрешено ли применение фикстуры в окружении
+// environment - окружение из конфигурации (пусто - production)
+func (f *Fixture) Allows(environment string) bool {
+	if environment == "" {
+		environment = EnvProduction
+	}
+	for _, env := range f.Environments {
+		if env == environment {
+			return true
+		}
+	}
+	return false
+}
+
+// Seeder применяет фикстуры через сервис пользователей,
+// поэтому изменения попадают в журнал аудита и outbox так же, как изменения через API
+type Seeder struct {
+	users       *service.UserService // Сервис пользователей
+	environment string               // Текущее окружение
+}
+
+// NewSeeder создает новый экземпляр для наполнения базы данных
+// users - сервис пользователей
+// environment - окружение из конфигурации (пусто - production)
+func NewSeeder(users *service.UserService, environment string) *Seeder {
+	return &Seeder{
+		users:       users,
+		environment: environment,
+	}
+}
+
+// Apply применяет фикстуру
+// Повторное применение безопасно: пользователи ищутся по email, существующие обновляются
+// ctx - контекст выполнения
+// fixture - применяемая фикстура
+func (s *Seeder) Apply(ctx context.Context, fixture *Fixture) (Result, error) {
+	var result Result
+
+	if !fixture.Allows(s.environment) {
+		env := s.environment
+		if env == "" {
+			env = EnvProduction
+		}
+		return result, fmt.Errorf("%w: окружение %q, разрешены: %s", ErrNotAllowed, env, strings.Join(fixture.Environments, ", "))
+	}
+
+	for _, u := range fixture.Users {
+		existing, err := s.users.GetByEmail(ctx, u.Email)
+		if errors.Is(err, service.ErrUserNotFound) {
+			if _, err := s.users.Create(ctx, model.UserCreate{Name: u.Name, Email: u.Email}); err != nil {
+				return result, fmt.Errorf("создание %s: %w", u.Email, err)
+			}
+			result.Created++
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if existing.Name == u.Name {
+			result.Unchanged++
+			continue
+		}
+		if _, err := s.users.Update(ctx, existing.ID, model.UserUpdate{Name: u.Name}); err != nil {
+			return result, fmt.Errorf("обновление %s: %w", u.Email, err)
+		}
+		result.Updated++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,152 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/service"
+)
+
+// TestBuiltinProfilesExcludeProduction проверяет, что встроенные профили разбираются и запрещены в production
+func TestBuiltinProfilesExcludeProduction(t *testing.T) {
+	for _, name := range Profiles() {
+		fixture, err := Profile(name)
+		if err != nil {
+			t.Fatalf("Ошибка загрузки профиля %s: %v", name, err)
+		}
+		if len(fixture.Users) == 0 {
+			t.Errorf("Профиль %s не содержит пользователей", name)
+		}
+		if fixture.Allows(EnvProduction) || fixture.Allows("") {
+			t.Errorf("Профиль %s разрешен в production", name)
+		}
+	}
+
+	if _, err := Profile("prod"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Ожидалась ErrUnknownProfile, получено %v", err)
+	}
+}
+
+// TestLoadJSON проверяет загрузку фикстуры из JSON файла
+func TestLoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	data := `{"environments": ["test"], "users": [{"name": "A", "email": "a@example.com"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture, err := Load(path)
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	if len(fixture.Users) != 1 || fixture.Users[0].Email != "a@example.com" || !fixture.Allows("test") {
+		t.Errorf("Получена неожиданная фикстура: %+v", fixture)
+	}
+}
+
+// fakeUsers - хранилище пользователей в памяти с уникальной почтой
+// Считает создания и изменения, чтобы проверить, что повторное применение фикстуры ничего не меняет
+type fakeUsers struct {
+	users   []*model.User
+	creates int
+	updates int
+}
+
+func (r *fakeUsers) Create(ctx context.Context, user model.UserCreate) (*model.User, error) {
+	r.creates++
+	created := &model.User{ID: int64(len(r.users) + 1), Name: user.Name, Email: user.Email}
+	r.users = append(r.users, created)
+	return created, nil
+}
+
+func (r *fakeUsers) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeUsers) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeUsers) Update(ctx context.Context, id int64, update model.UserUpdate) (*model.User, error) {
+	r.updates++
+	user, _ := r.GetByID(ctx, id)
+	if user != nil && update.Name != "" {
+		user.Name = update.Name
+	}
+	return user, nil
+}
+
+func (r *fakeUsers) GetAll(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	return nil, errors.New("не используется")
+}
+
+func (r *fakeUsers) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	return 0, errors.New("не используется")
+}
+
+func (r *fakeUsers) ChangeStatus(ctx context.Context, id int64, change model.UserStatusChange) (*model.User, error) {
+	return nil, errors.New("не используется")
+}
+
+func (r *fakeUsers) Delete(ctx context.Context, id int64) error {
+	return errors.New("не используется")
+}
+
+// fakeTransactor выполняет функцию без транзакции
+type fakeTransactor struct{}
+
+func (fakeTransactor) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// TestApplyIsIdempotent проверяет, что повторное применение фикстуры не создает и не изменяет пользователей,
+// а измененное в фикстуре имя обновляется у существующего пользователя
+func TestApplyIsIdempotent(t *testing.T) {
+	repo := &fakeUsers{}
+	seeder := NewSeeder(service.NewUserService(repo, nil, nil, fakeTransactor{}), "development")
+	fixture, err := Profile("dev")
+	if err != nil {
+		t.Fatalf("Ошибка загрузки профиля: %v", err)
+	}
+	total := len(fixture.Users)
+
+	result, err := seeder.Apply(context.Background(), fixture)
+	if err != nil || result != (Result{Created: total}) {
+		t.Fatalf("Первое применение: %+v, ошибка %v", result, err)
+	}
+
+	result, err = seeder.Apply(context.Background(), fixture)
+	if err != nil || result != (Result{Unchanged: total}) {
+		t.Errorf("Повторное применение: %+v, ошибка %v", result, err)
+	}
+	if repo.creates != total || repo.updates != 0 || len(repo.users) != total {
+		t.Errorf("Повторное применение не должно менять данные: создано %d, изменено %d", repo.creates, repo.updates)
+	}
+
+	fixture.Users[0].Name = "Переименованный"
+	result, err = seeder.Apply(context.Background(), fixture)
+	if err != nil || result != (Result{Updated: 1, Unchanged: total - 1}) {
+		t.Errorf("Применение с новым именем: %+v, ошибка %v", result, err)
+	}
+	if repo.users[0].Name != "Переименованный" || len(repo.users) != total {
+		t.Errorf("Имя существующего пользователя должно обновиться: %+v", repo.users[0])
+	}
+
+	if _, err := NewSeeder(service.NewUserService(repo, nil, nil, fakeTransactor{}), "").Apply(context.Background(), fixture); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("В production ожидалась ошибка %v, получено %v", ErrNotAllowed, err)
+	}
+}
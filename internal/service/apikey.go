@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/tenant"
+)
+
+// Параметры ключей API
+const (
+	apiKeyPrefix        = "usk_"      // Начало префикса ключа, по которому ключ можно опознать в логах и конфигурации
+	maxAPIKeyNameLength = 100         // Максимальная длина названия ключа (соответствует столбцу name)
+	apiKeyTouchInterval = time.Minute // Минимальный интервал между обновлениями времени последнего использования
+)
+
+// Ошибки сервиса ключей API
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")               // Ключ не найден или уже отозван
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked key") // Ключ в запросе неверный, истек или отозван
+)
+
+// APIKeyService обрабатывает бизнес-логику ключей API для доступа сервисов без пароля пользователя
+// Ключ имеет вид "<префикс>.<арендатор>.<случайная строка>": по нему запрос выполняется в пределах арендатора
+// без заголовка или токена арендатора, а префикс позволяет опознать ключ в списке ключей
+type APIKeyService struct {
+	repo *postgres.APIKeyRepository // Репозиторий ключей API
+	now  func() time.Time           // Текущее время (подменяется в тестах)
+}
+
+// NewAPIKeyService создает новый сервис ключей API
+// repo - репозиторий ключей API
+func NewAPIKeyService(repo *postgres.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// Create создает ключ API и возвращает его вместе с самим ключом
+// Ключ показывается только в этом ответе, хранится только его хэш
+// ctx - контекст операции
+// create - название, разрешения и срок действия ключа
+func (s *APIKeyService) Create(ctx context.Context, create model.APIKeyCreate) (*model.APIKeyCreated, error) {
+	create.Name = strings.TrimSpace(create.Name)
+	if create.Name == "" || len([]rune(create.Name)) > maxAPIKeyNameLength {
+		return nil, ErrInvalidInput
+	}
+	if create.ExpiresAt != nil && !create.ExpiresAt.After(s.now()) {
+		return nil, ErrInvalidInput
+	}
+	scopes, ok := normalizeScopes(create.Scopes)
+	if !ok {
+		return nil, ErrInvalidInput
+	}
+
+	prefix, key, err := generateAPIKey(requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.repo.Create(ctx, model.APIKey{
+		Name:      create.Name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: create.ExpiresAt,
+	}, hashToken(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.APIKeyCreated{APIKey: *created, Key: key}, nil
+}
+
+// List получает страницу неотозванных ключей API и их общее количество
+// ctx - контекст операции
+// limit, offset - параметры постраничной выборки
+func (s *APIKeyService) List(ctx context.Context, limit, offset int) ([]model.APIKey, int, error) {
+	return s.repo.List(ctx, limit, offset)
+}
+
+// Revoke отзывает ключ API; запросы с ним сразу перестают приниматься
+// ctx - контекст операции
+// id - идентификатор ключа
+func (s *APIKeyService) Revoke(ctx context.Context, id int64) error {
+	revoked, err := s.repo.Revoke(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// Authenticate проверяет ключ из заголовка Authorization и возвращает его
+// Проверка выполняется в пределах арендатора из ключа; время последнего использования обновляется
+// не чаще раза в минуту
+// Возвращает ErrInvalidAPIKey, если ключ неверный, истек или отозван
+// ctx - контекст операции
+// key - ключ API
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*model.APIKey, error) {
+	tenantID, ok := apiKeyTenant(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	info := requestinfo.FromContext(ctx)
+	info.TenantID = tenantID
+	ctx = requestinfo.WithInfo(ctx, info)
+
+	apiKey, err := s.repo.GetByHash(ctx, hashToken(key))
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if apiKey == nil || !apiKey.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := s.repo.TouchLastUsed(ctx, apiKey.ID, now, apiKeyTouchInterval); err != nil {
+		return nil, err
+	}
+
+	return apiKey, nil
+}
+
+// normalizeScopes проверяет разрешения ключа и удаляет повторы
+// Возвращает false, если разрешения не указаны или среди них есть неизвестные
+func normalizeScopes(scopes []string) ([]string, bool) {
+	if len(scopes) == 0 {
+		return nil, false
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !model.ValidAPIKeyScope(scope) {
+			return nil, false
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, true
+}
+
+// generateAPIKey генерирует префикс и ключ API для арендатора
+func generateAPIKey(tenantID string) (string, string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	prefix := apiKeyPrefix + recoveryEncoding.EncodeToString(buf)
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	return prefix, prefix + "." + tenantID + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// apiKeyTenant извлекает арендатора из ключа API
+func apiKeyTenant(key string) (string, bool) {
+	parts := strings.Split(key, ".")
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], apiKeyPrefix) || parts[2] == "" || !tenant.Valid(parts[1]) {
+		return "", false
+	}
+	return parts[1], true
+}
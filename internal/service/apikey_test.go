@@ -0,0 +1,59 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// TestAPIKeyFormat проверяет формат ключа API, извлечение арендатора и хэш
+func TestAPIKeyFormat(t *testing.T) {
+	prefix, key, err := generateAPIKey("acme")
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	if !strings.HasPrefix(prefix, apiKeyPrefix) || !strings.HasPrefix(key, prefix+".acme.") {
+		t.Errorf("Неожиданный формат ключа %q с префиксом %q", key, prefix)
+	}
+	if tenantID, ok := apiKeyTenant(key); !ok || tenantID != "acme" {
+		t.Errorf("Ожидался арендатор acme, получено %q, %v", tenantID, ok)
+	}
+	if len(hashToken(key)) != 64 || hashToken(key) == hashToken(key+"x") {
+		t.Errorf("Неожиданный хэш ключа")
+	}
+
+	for _, invalid := range []string{"", "acme.secret", "usk_abc.Acme Inc.secret", "other.acme.secret", "usk_abc.acme."} {
+		if _, ok := apiKeyTenant(invalid); ok {
+			t.Errorf("Ключ %q не должен приниматься", invalid)
+		}
+	}
+}
+
+// TestAPIKeyScopes проверяет разрешения ключа API и их проверку при создании
+func TestAPIKeyScopes(t *testing.T) {
+	key := model.APIKey{Scopes: []string{model.ScopeUsersWrite, model.ScopeGroupsRead}}
+	if !key.Allows(model.ScopeUsersRead) || !key.Allows(model.ScopeUsersWrite) || !key.Allows(model.ScopeGroupsRead) {
+		t.Errorf("Разрешение на запись должно включать чтение: %v", key.Scopes)
+	}
+	if key.Allows(model.ScopeGroupsWrite) || key.Allows(model.ScopeInvitationsRead) {
+		t.Errorf("Ключ не должен иметь разрешений сверх выданных: %v", key.Scopes)
+	}
+
+	if scopes, ok := normalizeScopes([]string{"users:read", "users:read", "groups:write"}); !ok || len(scopes) != 2 {
+		t.Errorf("Ожидались разрешения без повторов, получено %v, %v", scopes, ok)
+	}
+	for _, invalid := range [][]string{nil, {"users:admin"}} {
+		if _, ok := normalizeScopes(invalid); ok {
+			t.Errorf("Разрешения %v не должны приниматься", invalid)
+		}
+	}
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	if !(model.APIKey{ExpiresAt: &future}).Active(now) || (model.APIKey{ExpiresAt: &past}).Active(now) ||
+		(model.APIKey{RevokedAt: &past}).Active(now) {
+		t.Errorf("Неожиданная проверка срока действия и отзыва ключа")
+	}
+}
@@ -0,0 +1,771 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/tenant"
+)
+
+// Параметры входа по паролю, если они не заданы в конфигурации
+const (
+	defaultTokenTTL         = time.Hour        // Срок действия выданного токена
+	defaultMFATokenTTL      = 5 * time.Minute  // Срок действия токена второго шага входа
+	defaultLockoutWindow    = 15 * time.Minute // Окно учета неудачных попыток
+	defaultDelayAfter       = 3                // Число неудачных попыток до введения задержки
+	defaultBaseDelay        = time.Second      // Первая задержка между попытками
+	defaultMaxDelay         = time.Minute      // Максимальная задержка между попытками
+	defaultAccountThreshold = 10               // Число неудачных попыток до блокировки учетной записи
+	defaultIPThreshold      = 100              // Число неудачных попыток до блокировки IP-адреса
+	defaultLockoutDuration  = 15 * time.Minute // Длительность временной блокировки
+)
+
+// Назначение токенов в утверждении token_use
+// Токен второго шага входа подписывается тем же секретом, но не является токеном доступа
+const (
+	tokenUseAccess = "access" // Токен доступа
+	tokenUseMFA    = "mfa"    // Токен второго шага входа
+)
+
+// Ограничения пароля
+// bcrypt учитывает только первые 72 байта пароля, более длинные пароли отклоняются
+const (
+	minPasswordLength = 8  // Минимальная длина пароля в символах
+	maxPasswordBytes  = 72 // Максимальная длина пароля в байтах
+)
+
+// Ошибки сервиса входа
+var (
+	ErrLoginDisabled      = errors.New("password login is not configured") // Вход выключен (не задан auth.jwt_secret)
+	ErrInvalidCredentials = errors.New("invalid email or password")        // Неверная электронная почта или пароль
+	ErrAccountInactive    = errors.New("user account is not active")       // Учетная запись не активна
+	ErrLoginThrottled     = errors.New("too many failed login attempts")   // Вход временно ограничен после неудачных попыток
+	ErrInvalidMFAToken    = errors.New("invalid or expired mfa token")     // Токен второго шага входа неверный или истек
+)
+
+// LoginThrottledError возвращается, если вход временно ограничен после неудачных попыток
+// Соответствует ErrLoginThrottled при проверке errors.Is
+type LoginThrottledError struct {
+	RetryAfter time.Duration // Время до следующей разрешенной попытки
+}
+
+// Error возвращает текст ошибки
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrLoginThrottled, e.RetryAfter)
+}
+
+// Unwrap возвращает ErrLoginThrottled
+func (e *LoginThrottledError) Unwrap() error {
+	return ErrLoginThrottled
+}
+
+// loginMetrics - счетчики входа, публикуемые через expvar (/debug/vars)
+var loginMetrics = expvar.NewMap("login")
+
+// dummyPasswordHash - хэш для сравнения пароля неизвестного пользователя
+// Сравнение выполняется всегда, чтобы время ответа не раскрывало наличие учетной записи
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// lockoutPolicy содержит параметры защиты от перебора паролей с примененными значениями по умолчанию
+type lockoutPolicy struct {
+	window           time.Duration // Окно учета неудачных попыток подряд
+	delayAfter       int           // Число неудачных попыток, после которого вводится задержка
+	baseDelay        time.Duration // Первая задержка
+	maxDelay         time.Duration // Максимальная задержка
+	accountThreshold int           // Число неудачных попыток до блокировки учетной записи
+	ipThreshold      int           // Число неудачных попыток до блокировки IP-адреса
+	duration         time.Duration // Длительность временной блокировки
+}
+
+// newLockoutPolicy применяет значения по умолчанию к настройкам защиты от перебора
+func newLockoutPolicy(cfg config.LockoutConfig) lockoutPolicy {
+	p := lockoutPolicy{
+		window:           cfg.Window.Duration,
+		delayAfter:       cfg.DelayAfter,
+		baseDelay:        cfg.BaseDelay.Duration,
+		maxDelay:         cfg.MaxDelay.Duration,
+		accountThreshold: cfg.AccountThreshold,
+		ipThreshold:      cfg.IPThreshold,
+		duration:         cfg.Duration.Duration,
+	}
+	if p.window <= 0 {
+		p.window = defaultLockoutWindow
+	}
+	if p.delayAfter <= 0 {
+		p.delayAfter = defaultDelayAfter
+	}
+	if p.baseDelay <= 0 {
+		p.baseDelay = defaultBaseDelay
+	}
+	if p.maxDelay <= 0 {
+		p.maxDelay = defaultMaxDelay
+	}
+	if p.accountThreshold <= 0 {
+		p.accountThreshold = defaultAccountThreshold
+	}
+	if p.ipThreshold <= 0 {
+		p.ipThreshold = defaultIPThreshold
+	}
+	if p.duration <= 0 {
+		p.duration = defaultLockoutDuration
+	}
+	return p
+}
+
+// delay возвращает задержку после указанного числа неудачных попыток подряд
+// Задержка вводится начиная с delayAfter неудач и удваивается с каждой следующей, но не превышает maxDelay
+func (p lockoutPolicy) delay(failures int) time.Duration {
+	if failures < p.delayAfter {
+		return 0
+	}
+	d := p.baseDelay
+	for i := p.delayAfter; i < failures && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+	return d
+}
+
+// retryAfter возвращает время до следующей разрешенной попытки входа (0 - попытка разрешена)
+func (p lockoutPolicy) retryAfter(attempts model.LoginAttempts, now time.Time) time.Duration {
+	if attempts.LockedUntil.After(now) {
+		return attempts.LockedUntil.Sub(now)
+	}
+	if attempts.Failures == 0 || !attempts.LockedUntil.IsZero() || now.Sub(attempts.LastFailureAt) >= p.window {
+		// Неудач не было, блокировка закончилась или неудачи вышли за окно учета
+		return 0
+	}
+	if next := attempts.LastFailureAt.Add(p.delay(attempts.Failures)); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// reserve возвращает учет после еще одной неудачной попытки или время до следующей разрешенной попытки,
+// если попытка сейчас не разрешена
+// Неудачи вне окна учета и до окончившейся блокировки не учитываются: счет начинается заново
+// При достижении threshold неудач подряд вход блокируется на время duration
+func (p lockoutPolicy) reserve(attempts model.LoginAttempts, now time.Time, threshold int) (model.LoginAttempts, time.Duration) {
+	if retry := p.retryAfter(attempts, now); retry > 0 {
+		return attempts, retry
+	}
+
+	next := model.LoginAttempts{Failures: attempts.Failures + 1, LastFailureAt: now}
+	if now.Sub(attempts.LastFailureAt) >= p.window || !attempts.LockedUntil.IsZero() {
+		next.Failures = 1
+	}
+	if next.Failures >= threshold {
+		next.LockedUntil = now.Add(p.duration)
+	}
+	return next, 0
+}
+
+// loginAttempt - попытка входа, заранее учтенная как неудачная (см. AuthService.reserveAttempt)
+type loginAttempt struct {
+	keys     []model.LoginKey      // Учетная запись и IP-адрес (если известен)
+	reserved []model.LoginAttempts // Учет после попытки по каждому ключу
+}
+
+// AuthService обрабатывает вход пользователей по паролю
+// Неудачные попытки учитываются по учетной записи и по IP-адресу клиента: после delay_after неудач
+// вводится растущая задержка между попытками, после порогового числа неудач учетная запись
+// переводится в состояние locked, а IP-адрес блокируется на время lockout.duration
+// Если у пользователя включена двухфакторная аутентификация, вход выполняется в два шага:
+// после проверки пароля выдается токен второго шага, который обменивается на токен доступа
+// вместе с кодом из приложения или кодом восстановления
+type AuthService struct {
+	users       *UserService                    // Сервис пользователей
+	credentials repository.CredentialRepository // Репозиторий паролей и учета попыток входа
+	mfa         *MFAService                     // Сервис двухфакторной аутентификации
+	secret      []byte                          // Секрет подписи токенов
+	tenantClaim string                          // Утверждение токена с ID арендатора
+	tokenTTL    time.Duration                   // Срок действия токена
+	mfaTokenTTL time.Duration                   // Срок действия токена второго шага входа
+	lockout     lockoutPolicy                   // Параметры защиты от перебора
+	logger      *log.Logger                     // Логгер для записи блокировок
+	now         func() time.Time                // Текущее время (подменяется в тестах)
+}
+
+// NewAuthService создает новый сервис входа
+// users - сервис пользователей
+// credentials - репозиторий паролей и учета попыток входа
+// mfa - сервис двухфакторной аутентификации
+// cfg - настройки входа
+// tenantClaim - утверждение токена с ID арендатора (пусто - tenant_id)
+// logger - логгер для записи событий
+func NewAuthService(users *UserService, credentials repository.CredentialRepository, mfa *MFAService,
+	cfg config.AuthConfig, tenantClaim string, logger *log.Logger) *AuthService {
+	tokenTTL := cfg.TokenTTL.Duration
+	if tokenTTL <= 0 {
+		tokenTTL = defaultTokenTTL
+	}
+	mfaTokenTTL := cfg.MFATokenTTL.Duration
+	if mfaTokenTTL <= 0 {
+		mfaTokenTTL = defaultMFATokenTTL
+	}
+	if tenantClaim == "" {
+		tenantClaim = tenant.DefaultClaim
+	}
+
+	return &AuthService{
+		users:       users,
+		credentials: credentials,
+		mfa:         mfa,
+		secret:      []byte(cfg.JWTSecret),
+		tenantClaim: tenantClaim,
+		tokenTTL:    tokenTTL,
+		mfaTokenTTL: mfaTokenTTL,
+		lockout:     newLockoutPolicy(cfg.Lockout),
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// Login проверяет электронную почту и пароль и выдает токен доступа
+// Если у пользователя включена двухфакторная аутентификация, вместо токена доступа выдается
+// токен второго шага входа (см. LoginMFA)
+// Возвращает LoginThrottledError, если вход для учетной записи или IP-адреса временно ограничен,
+// ErrInvalidCredentials при неверной почте или пароле и ErrAccountInactive для неактивной учетной записи
+// ctx - контекст операции
+// req - электронная почта и пароль
+func (s *AuthService) Login(ctx context.Context, req model.LoginRequest) (*model.LoginToken, error) {
+	user, challenge, err := s.Authenticate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return challenge, nil
+	}
+
+	return s.issueToken(user, s.now())
+}
+
+// LoginMFA выполняет второй шаг входа: проверяет токен первого шага и код из приложения-аутентификатора
+// или одноразовый код восстановления и выдает токен доступа
+// Неверные коды учитываются вместе с неудачными попытками входа по паролю
+// ctx - контекст операции
+// req - токен первого шага и код
+func (s *AuthService) LoginMFA(ctx context.Context, req model.MFALoginRequest) (*model.LoginToken, error) {
+	user, err := s.AuthenticateMFA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueToken(user, s.now())
+}
+
+// LoginExternal выдает токен доступа пользователю, удостоверение которого подтвердил внешний поставщик
+// Если у пользователя включена двухфакторная аутентификация, вместо токена доступа выдается
+// токен второго шага входа (см. LoginMFA)
+// Возвращает ErrAccountInactive для учетной записи, которой вход запрещен
+// ctx - контекст операции
+// user - пользователь
+func (s *AuthService) LoginExternal(ctx context.Context, user *model.User) (*model.LoginToken, error) {
+	if len(s.secret) == 0 {
+		return nil, ErrLoginDisabled
+	}
+	if !user.CanLogin() {
+		loginMetrics.Add("inactive", 1)
+		return nil, ErrAccountInactive
+	}
+
+	now := s.now()
+	if s.mfa != nil {
+		enabled, err := s.mfa.enabled(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			loginMetrics.Add("mfa_challenge", 1)
+			return s.issueMFAToken(user, now)
+		}
+	}
+
+	loginMetrics.Add("success", 1)
+	return s.issueToken(user, now)
+}
+
+// Authenticate проверяет электронную почту и пароль с защитой от перебора, не выдавая токен доступа
+// Используется входом по паролю и провайдером OpenID Connect
+// Если у пользователя включена двухфакторная аутентификация, пользователь не возвращается,
+// а возвращается токен второго шага входа для AuthenticateMFA
+// Ошибки те же, что у Login
+// ctx - контекст операции
+// req - электронная почта и пароль
+func (s *AuthService) Authenticate(ctx context.Context, req model.LoginRequest) (*model.User, *model.LoginToken, error) {
+	if len(s.secret) == 0 {
+		return nil, nil, ErrLoginDisabled
+	}
+	if req.Email == "" || req.Password == "" {
+		return nil, nil, ErrInvalidInput
+	}
+
+	ctx = withLoginActor(ctx, req.Email)
+	info := requestinfo.FromContext(ctx)
+	now := s.now()
+	accountKey := strings.ToLower(strings.TrimSpace(req.Email))
+
+	attempt, err := s.reserveAttempt(ctx, accountKey, info.IP, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.users.repo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash := ""
+	if user != nil {
+		if hash, err = s.credentials.GetPasswordHash(ctx, user.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if !checkPassword(hash, req.Password) {
+		if err := s.recordFailure(ctx, user, attempt); err != nil {
+			return nil, nil, err
+		}
+		loginMetrics.Add("failure", 1)
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err := s.releaseAttempt(ctx, attempt); err != nil {
+		return nil, nil, err
+	}
+
+	// Блокировка учетной записи закончилась (иначе попытка была бы отклонена выше), снимаем ее автоматически
+	if user.Status == model.UserStatusLocked {
+		user, err = s.users.changeStatus(ctx, user.ID, model.UserStatusChange{
+			Status: model.UserStatusActive,
+			Reason: "автоматическая разблокировка после окончания блокировки входа",
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		loginMetrics.Add("unlocked", 1)
+	}
+	if !user.CanLogin() {
+		loginMetrics.Add("inactive", 1)
+		return nil, nil, ErrAccountInactive
+	}
+
+	if s.mfa != nil {
+		enabled, err := s.mfa.enabled(ctx, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if enabled {
+			// Учет неудачных попыток сбрасывается только после второго шага, чтобы перебор кодов
+			// ограничивался так же, как перебор паролей
+			loginMetrics.Add("mfa_challenge", 1)
+			challenge, err := s.issueMFAToken(user, now)
+			return nil, challenge, err
+		}
+	}
+
+	if err := s.completeAuthentication(ctx, accountKey); err != nil {
+		return nil, nil, err
+	}
+
+	return user, nil, nil
+}
+
+// AuthenticateMFA выполняет второй шаг входа без выдачи токена доступа и возвращает вошедшего пользователя
+// Ошибки те же, что у LoginMFA
+// ctx - контекст операции
+// req - токен первого шага и код
+func (s *AuthService) AuthenticateMFA(ctx context.Context, req model.MFALoginRequest) (*model.User, error) {
+	if len(s.secret) == 0 || s.mfa == nil {
+		return nil, ErrLoginDisabled
+	}
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		// Нужен ровно один из кодов
+		return nil, ErrInvalidInput
+	}
+
+	userID, err := s.parseMFAToken(ctx, req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	ctx = withLoginActor(ctx, user.Email)
+	now := s.now()
+	accountKey := strings.ToLower(user.Email)
+
+	attempt, err := s.reserveAttempt(ctx, accountKey, requestinfo.FromContext(ctx).IP, now)
+	if err != nil {
+		return nil, err
+	}
+	if !user.CanLogin() {
+		loginMetrics.Add("inactive", 1)
+		if err := s.releaseAttempt(ctx, attempt); err != nil {
+			return nil, err
+		}
+		return nil, ErrAccountInactive
+	}
+
+	ok, err := s.mfa.verify(ctx, user.ID, req.Code, req.RecoveryCode)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := s.recordFailure(ctx, user, attempt); err != nil {
+			return nil, err
+		}
+		loginMetrics.Add("mfa_failure", 1)
+		return nil, ErrInvalidMFACode
+	}
+	if err := s.releaseAttempt(ctx, attempt); err != nil {
+		return nil, err
+	}
+
+	if err := s.completeAuthentication(ctx, accountKey); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// completeAuthentication сбрасывает учет неудачных попыток учетной записи после успешного входа
+func (s *AuthService) completeAuthentication(ctx context.Context, accountKey string) error {
+	if err := s.credentials.ResetAttempts(ctx, model.LoginScopeAccount, accountKey); err != nil {
+		return err
+	}
+	loginMetrics.Add("success", 1)
+
+	return nil
+}
+
+// reserveAttempt проверяет, что вход для учетной записи и IP-адреса не ограничен, и учитывает попытку
+// как неудачную до проверки пароля или кода. Проверка и учет выполняются атомарно (см.
+// CredentialRepository.ReserveAttempt), поэтому одновременные попытки видят друг друга и параллельный перебор
+// ограничивается задержками и блокировкой так же, как последовательный
+// Успешная попытка снимается releaseAttempt. Если вход ограничен, возвращается LoginThrottledError,
+// а попытка не учитывается
+func (s *AuthService) reserveAttempt(ctx context.Context, accountKey, ip string, now time.Time) (*loginAttempt, error) {
+	attempt := &loginAttempt{keys: []model.LoginKey{{Scope: model.LoginScopeAccount, Key: accountKey}}}
+	if ip != "" {
+		attempt.keys = append(attempt.keys, model.LoginKey{Scope: model.LoginScopeIP, Key: ip})
+	}
+
+	reserved, err := s.credentials.ReserveAttempt(ctx, attempt.keys,
+		func(key model.LoginKey, attempts model.LoginAttempts) (model.LoginAttempts, error) {
+			threshold := s.lockout.accountThreshold
+			if key.Scope == model.LoginScopeIP {
+				threshold = s.lockout.ipThreshold
+			}
+			next, retry := s.lockout.reserve(attempts, now, threshold)
+			if retry > 0 {
+				return attempts, &LoginThrottledError{RetryAfter: retry}
+			}
+			return next, nil
+		})
+	var throttled *LoginThrottledError
+	if errors.As(err, &throttled) {
+		loginMetrics.Add("throttled", 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attempt.reserved = reserved
+	return attempt, nil
+}
+
+// releaseAttempt снимает учет попытки, которая оказалась успешной
+func (s *AuthService) releaseAttempt(ctx context.Context, attempt *loginAttempt) error {
+	for i, key := range attempt.keys {
+		if err := s.credentials.ReleaseAttempt(ctx, key, attempt.reserved[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withLoginActor возвращает контекст, в котором инициатором изменений при входе считается входящий,
+// если инициатор не передан в запросе
+func withLoginActor(ctx context.Context, email string) context.Context {
+	info := requestinfo.FromContext(ctx)
+	if info.Actor != "" {
+		return ctx
+	}
+	info.Actor = email
+	return requestinfo.WithInfo(ctx, info)
+}
+
+// recordFailure завершает неудачную попытку входа, учтенную reserveAttempt
+// Если попытка достигла порогового числа неудач, блокировка уже установлена при учете попытки:
+// здесь она записывается в лог, а учетная запись переводится в состояние locked с записью причины
+// в журнал аудита
+func (s *AuthService) recordFailure(ctx context.Context, user *model.User, attempt *loginAttempt) error {
+	for i, key := range attempt.keys {
+		reserved := attempt.reserved[i]
+		if reserved.LockedUntil.IsZero() {
+			continue
+		}
+
+		if key.Scope == model.LoginScopeIP {
+			loginMetrics.Add("ip_locked", 1)
+			s.logger.Printf("Вход с IP %s заблокирован до %s после %d неудачных попыток (арендатор %s)",
+				key.Key, reserved.LockedUntil.Format(time.RFC3339), reserved.Failures, requestinfo.FromContext(ctx).Tenant())
+			continue
+		}
+
+		loginMetrics.Add("account_locked", 1)
+		s.logger.Printf("Вход для %q заблокирован до %s после %d неудачных попыток (арендатор %s, IP %s)",
+			key.Key, reserved.LockedUntil.Format(time.RFC3339), reserved.Failures, requestinfo.FromContext(ctx).Tenant(),
+			requestinfo.FromContext(ctx).IP)
+
+		if user != nil && user.Status == model.UserStatusActive {
+			_, err := s.users.changeStatus(ctx, user.ID, model.UserStatusChange{
+				Status: model.UserStatusLocked,
+				Reason: fmt.Sprintf("превышено число неудачных попыток входа (%d), блокировка до %s",
+					reserved.Failures, reserved.LockedUntil.UTC().Format(time.RFC3339)),
+			})
+			if err != nil && !errors.Is(err, ErrInvalidStatusTransition) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Unlock снимает блокировку входа с учетной записи: сбрасывает учет неудачных попыток
+// и активирует учетную запись в состоянии locked
+// Учетная запись в другом состоянии не изменяется
+// ctx - контекст операции
+// id - идентификатор пользователя
+// reason - причина разблокировки для журнала аудита
+func (s *AuthService) Unlock(ctx context.Context, id int64, reason string) (*model.User, error) {
+	user, err := s.users.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.credentials.ResetAttempts(ctx, model.LoginScopeAccount, strings.ToLower(user.Email)); err != nil {
+		return nil, err
+	}
+	if user.Status != model.UserStatusLocked {
+		return user, nil
+	}
+
+	if strings.TrimSpace(reason) == "" {
+		reason = "разблокировка администратором"
+	}
+	user, err = s.users.changeStatus(ctx, id, model.UserStatusChange{Status: model.UserStatusActive, Reason: reason})
+	if err != nil {
+		return nil, err
+	}
+	loginMetrics.Add("unlocked", 1)
+
+	return user, nil
+}
+
+// SetPassword устанавливает пароль пользователя
+// ctx - контекст операции
+// id - идентификатор пользователя
+// password - новый пароль
+func (s *AuthService) SetPassword(ctx context.Context, id int64, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	found, err := s.credentials.SetPasswordHash(ctx, id, hash, "пароль изменен")
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// AuthenticateToken проверяет токен доступа и текущее состояние пользователя токена
+// Токен действует до истечения срока, поэтому приостановленный, заблокированный или удаленный пользователь
+// отклоняется по своей учетной записи, а роль и электронная почта берутся из учетной записи, а не из токена:
+// понижение администратора действует сразу, без ожидания истечения выданных ему токенов
+// Возвращает ErrLoginDisabled, если не задан auth.jwt_secret, и ErrInvalidAccessToken для неверного токена
+// или пользователя, которому вход запрещен
+// ctx - контекст операции
+// token - токен из заголовка Authorization: Bearer
+func (s *AuthService) AuthenticateToken(ctx context.Context, token string) (*model.AccessClaims, error) {
+	claims, err := s.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	info := requestinfo.FromContext(ctx)
+	info.TenantID = claims.TenantID
+	user, err := s.users.GetByID(requestinfo.WithInfo(ctx, info), claims.UserID)
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		return nil, fmt.Errorf("%w: пользователь удален", ErrInvalidAccessToken)
+	case err != nil:
+		return nil, err
+	case !user.CanLogin():
+		return nil, fmt.Errorf("%w: учетная запись в состоянии %s", ErrInvalidAccessToken, user.Status)
+	}
+
+	claims.Role = user.Role
+	claims.Email = user.Email
+	return claims, nil
+}
+
+// VerifyToken проверяет токен доступа, выданный при входе, и возвращает его утверждения
+// Проверяются подпись, срок действия (токен без срока отклоняется) и назначение token_use=access,
+// поэтому токен второго шага входа не принимается
+// Возвращает ErrLoginDisabled, если не задан auth.jwt_secret, и ErrInvalidAccessToken для неверного токена
+// token - токен из заголовка Authorization: Bearer
+func (s *AuthService) VerifyToken(token string) (*model.AccessClaims, error) {
+	if len(s.secret) == 0 {
+		return nil, ErrLoginDisabled
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(s.now))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessToken, err)
+	}
+	if claims["token_use"] != tokenUseAccess {
+		return nil, fmt.Errorf("%w: токен не является токеном доступа", ErrInvalidAccessToken)
+	}
+
+	access := &model.AccessClaims{}
+	subject, _ := claims.GetSubject()
+	if access.UserID, err = strconv.ParseInt(subject, 10, 64); err != nil || access.UserID <= 0 {
+		return nil, fmt.Errorf("%w: некорректное утверждение sub", ErrInvalidAccessToken)
+	}
+	access.TenantID, _ = claims[s.tenantClaim].(string)
+	if !tenant.Valid(access.TenantID) {
+		return nil, fmt.Errorf("%w: утверждение %q отсутствует или некорректно", ErrInvalidAccessToken, s.tenantClaim)
+	}
+	access.Role, _ = claims["role"].(string)
+	if !model.ValidUserRole(access.Role) {
+		return nil, fmt.Errorf("%w: некорректная роль", ErrInvalidAccessToken)
+	}
+	access.Email, _ = claims["email"].(string)
+
+	return access, nil
+}
+
+// issueToken выдает токен доступа пользователю
+// Токен содержит ID пользователя (sub), арендатора, электронную почту и роль
+func (s *AuthService) issueToken(user *model.User, now time.Time) (*model.LoginToken, error) {
+	claims := jwt.MapClaims{
+		"sub":         strconv.FormatInt(user.ID, 10),
+		s.tenantClaim: user.TenantID,
+		"email":       user.Email,
+		"role":        user.Role,
+		"token_use":   tokenUseAccess,
+		"iat":         jwt.NewNumericDate(now),
+		"exp":         jwt.NewNumericDate(now.Add(s.tokenTTL)),
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.LoginToken{
+		AccessToken: signed,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.tokenTTL / time.Second),
+	}, nil
+}
+
+// issueMFAToken выдает токен второго шага входа
+// Токен содержит только ID пользователя и арендатора и действует mfaTokenTTL
+func (s *AuthService) issueMFAToken(user *model.User, now time.Time) (*model.LoginToken, error) {
+	claims := jwt.MapClaims{
+		"sub":         strconv.FormatInt(user.ID, 10),
+		s.tenantClaim: user.TenantID,
+		"token_use":   tokenUseMFA,
+		"iat":         jwt.NewNumericDate(now),
+		"exp":         jwt.NewNumericDate(now.Add(s.mfaTokenTTL)),
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.LoginToken{
+		MFARequired: true,
+		MFAToken:    signed,
+		ExpiresIn:   int(s.mfaTokenTTL / time.Second),
+	}, nil
+}
+
+// parseMFAToken проверяет токен второго шага входа и возвращает ID пользователя
+// Токен должен быть выдан арендатору текущего запроса
+func (s *AuthService) parseMFAToken(ctx context.Context, token string) (int64, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(s.now))
+	if err != nil {
+		return 0, ErrInvalidMFAToken
+	}
+
+	if claims["token_use"] != tokenUseMFA || claims[s.tenantClaim] != requestinfo.FromContext(ctx).Tenant() {
+		return 0, ErrInvalidMFAToken
+	}
+	subject, _ := claims.GetSubject()
+	userID, err := strconv.ParseInt(subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMFAToken
+	}
+
+	return userID, nil
+}
+
+// hashPassword проверяет ограничения пароля и возвращает его хэш bcrypt
+func hashPassword(password string) (string, error) {
+	if len([]rune(password)) < minPasswordLength || len(password) > maxPasswordBytes {
+		return "", ErrInvalidInput
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkPassword сравнивает пароль с хэшем
+// Пустой хэш (пароль не установлен) сравнивается с dummyPasswordHash и никогда не совпадает
+func checkPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
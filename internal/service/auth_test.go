@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// TestLockoutPolicy проверяет растущую задержку между неудачными попытками входа, окно учета и блокировку
+func TestLockoutPolicy(t *testing.T) {
+	p := newLockoutPolicy(config.LockoutConfig{})
+
+	delays := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second}
+	for failures, want := range delays {
+		if got := p.delay(failures); got != want {
+			t.Errorf("Задержка после %d неудач: получено %s, ожидалось %s", failures, got, want)
+		}
+	}
+	if got := p.delay(1000); got != defaultMaxDelay {
+		t.Errorf("Задержка должна ограничиваться %s, получено %s", defaultMaxDelay, got)
+	}
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		attempts model.LoginAttempts
+		want     time.Duration
+	}{
+		{"без неудач", model.LoginAttempts{}, 0},
+		{"до задержки", model.LoginAttempts{Failures: 2, LastFailureAt: now}, 0},
+		{"задержка", model.LoginAttempts{Failures: 4, LastFailureAt: now.Add(-500 * time.Millisecond)}, 1500 * time.Millisecond},
+		{"задержка прошла", model.LoginAttempts{Failures: 4, LastFailureAt: now.Add(-3 * time.Second)}, 0},
+		{"вне окна учета", model.LoginAttempts{Failures: 9, LastFailureAt: now.Add(-defaultLockoutWindow)}, 0},
+		{"блокировка", model.LoginAttempts{Failures: 10, LastFailureAt: now, LockedUntil: now.Add(time.Minute)}, time.Minute},
+		{"блокировка закончилась", model.LoginAttempts{Failures: 10, LastFailureAt: now.Add(-time.Minute), LockedUntil: now}, 0},
+	}
+	for _, tt := range tests {
+		if got := p.retryAfter(tt.attempts, now); got != tt.want {
+			t.Errorf("%s: получено %s, ожидалось %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestIssueToken проверяет утверждения и срок действия токена, выданного при входе
+func TestIssueToken(t *testing.T) {
+	svc := NewAuthService(nil, nil, nil, config.AuthConfig{JWTSecret: "secret"}, "org", nil)
+	now := time.Now().Truncate(time.Second)
+
+	token, err := svc.issueToken(&model.User{ID: 42, TenantID: "acme", Email: "a@example.com", Role: model.UserRoleAdmin}, now)
+	if err != nil {
+		t.Fatalf("Ошибка выдачи токена: %v", err)
+	}
+	if token.TokenType != "Bearer" || token.ExpiresIn != int(defaultTokenTTL/time.Second) {
+		t.Errorf("Неожиданный тип или срок действия токена: %+v", token)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token.AccessToken, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("secret"), nil
+	})
+	if err != nil {
+		t.Fatalf("Ошибка проверки токена: %v", err)
+	}
+	if claims["sub"] != "42" || claims["org"] != "acme" || claims["role"] != model.UserRoleAdmin {
+		t.Errorf("Неожиданные утверждения токена: %v", claims)
+	}
+	if exp, _ := claims.GetExpirationTime(); exp == nil || !exp.Time.Equal(now.Add(defaultTokenTTL)) {
+		t.Errorf("Неожиданный срок действия токена: %v", exp)
+	}
+}
+
+// TestVerifyToken проверяет прием токена доступа и отклонение токена второго шага,
+// истекшего токена и токена с чужой подписью
+func TestVerifyToken(t *testing.T) {
+	svc := NewAuthService(nil, nil, nil, config.AuthConfig{JWTSecret: "secret"}, "org", nil)
+	now := time.Now().Truncate(time.Second)
+	user := &model.User{ID: 42, TenantID: "acme", Email: "a@example.com", Role: model.UserRoleAdmin}
+
+	token, err := svc.issueToken(user, now)
+	if err != nil {
+		t.Fatalf("Ошибка выдачи токена: %v", err)
+	}
+	claims, err := svc.VerifyToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("Ошибка проверки токена: %v", err)
+	}
+	want := model.AccessClaims{UserID: 42, TenantID: "acme", Email: "a@example.com", Role: model.UserRoleAdmin}
+	if *claims != want {
+		t.Errorf("Неожиданные утверждения: %+v", *claims)
+	}
+
+	challenge, err := svc.issueMFAToken(user, now)
+	if err != nil {
+		t.Fatalf("Ошибка выдачи токена второго шага: %v", err)
+	}
+	if _, err := svc.VerifyToken(challenge.MFAToken); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("Токен второго шага не должен приниматься как токен доступа, получено: %v", err)
+	}
+
+	expired, _ := svc.issueToken(user, now.Add(-2*defaultTokenTTL))
+	if _, err := svc.VerifyToken(expired.AccessToken); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("Истекший токен не должен приниматься, получено: %v", err)
+	}
+
+	other := NewAuthService(nil, nil, nil, config.AuthConfig{JWTSecret: "other"}, "org", nil)
+	if _, err := other.VerifyToken(token.AccessToken); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("Токен с чужой подписью не должен приниматься, получено: %v", err)
+	}
+}
+
+// TestPasswordHash проверяет ограничения длины пароля и сравнение с хэшем
+func TestPasswordHash(t *testing.T) {
+	for _, password := range []string{"short", strings.Repeat("п", 37)} {
+		if _, err := hashPassword(password); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Пароль длиной %d байт: ожидалась ошибка %v, получено %v", len(password), ErrInvalidInput, err)
+		}
+	}
+
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("Ошибка хэширования пароля: %v", err)
+	}
+	if !checkPassword(hash, "correct horse") || checkPassword(hash, "wrong horse") {
+		t.Errorf("Пароль должен совпадать только со своим хэшем")
+	}
+	if checkPassword("", "") {
+		t.Errorf("Пользователь без пароля не должен входить")
+	}
+}
+
+// fakeCredentials хранит пароли и учет попыток входа в памяти
+// ReserveAttempt выполняется под общей блокировкой, как под блокировкой строк учета в postgres.CredentialRepository
+type fakeCredentials struct {
+	mu       sync.Mutex
+	hashes   map[int64]string
+	attempts map[model.LoginKey]model.LoginAttempts
+}
+
+func (r *fakeCredentials) GetPasswordHash(ctx context.Context, userID int64) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hashes[userID], nil
+}
+
+func (r *fakeCredentials) SetPasswordHash(ctx context.Context, userID int64, hash, reason string) (bool, error) {
+	return false, errors.New("not implemented")
+}
+
+func (r *fakeCredentials) ReserveAttempt(ctx context.Context, keys []model.LoginKey,
+	reserve func(key model.LoginKey, attempts model.LoginAttempts) (model.LoginAttempts, error)) ([]model.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reserved := make([]model.LoginAttempts, 0, len(keys))
+	for _, key := range keys {
+		next, err := reserve(key, r.attempts[key])
+		if err != nil {
+			return nil, err
+		}
+		reserved = append(reserved, next)
+	}
+	for i, key := range keys {
+		r.attempts[key] = reserved[i]
+	}
+	return reserved, nil
+}
+
+func (r *fakeCredentials) ReleaseAttempt(ctx context.Context, key model.LoginKey, reserved model.LoginAttempts) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts := r.attempts[key]
+	if attempts.Failures > 0 {
+		attempts.Failures--
+	}
+	if !reserved.LockedUntil.IsZero() {
+		attempts.LockedUntil = time.Time{}
+	}
+	r.attempts[key] = attempts
+	return nil
+}
+
+func (r *fakeCredentials) ResetAttempts(ctx context.Context, scope, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, model.LoginKey{Scope: scope, Key: key})
+	return nil
+}
+
+// TestAuthenticateConcurrentAttempts проверяет, что одновременные попытки входа с неверным паролем
+// ограничиваются задержкой и блокировкой так же, как последовательные, а успешный вход не учитывается
+// как неудачная попытка
+func TestAuthenticateConcurrentAttempts(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("Ошибка хэширования пароля: %v", err)
+	}
+	users := &fakeUserRepository{users: map[int64]*model.User{
+		1: {ID: 1, Email: "ivan@example.com", Role: model.UserRoleMember, Status: model.UserStatusActive},
+	}}
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := requestinfo.WithInfo(context.Background(), requestinfo.Info{IP: "203.0.113.7"})
+
+	// attack выполняет попытки входа одновременно и возвращает число проверенных паролей
+	attack := func(svc *AuthService, email string, attempts int) int {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		checked := 0
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _, err := svc.Authenticate(ctx, model.LoginRequest{Email: email, Password: "wrong horse"})
+				var throttled *LoginThrottledError
+				switch {
+				case errors.Is(err, ErrInvalidCredentials):
+					mu.Lock()
+					checked++
+					mu.Unlock()
+				case !errors.As(err, &throttled):
+					t.Errorf("Ожидалась ошибка %v или ограничение входа, получено %v", ErrInvalidCredentials, err)
+				}
+			}()
+		}
+		wg.Wait()
+		return checked
+	}
+
+	// Задержка после delay_after неудач действует и на попытки, начатые одновременно
+	credentials := &fakeCredentials{hashes: map[int64]string{1: hash}, attempts: map[model.LoginKey]model.LoginAttempts{}}
+	svc := NewAuthService(NewUserService(users, nil, nil, fakeTransactor{}), credentials, nil,
+		config.AuthConfig{JWTSecret: "secret"}, "", log.New(io.Discard, "", 0))
+	svc.now = func() time.Time { return now }
+	if checked := attack(svc, "ivan@example.com", 20); checked != defaultDelayAfter {
+		t.Errorf("Проверено паролей: %d, ожидалось %d", checked, defaultDelayAfter)
+	}
+
+	// Без задержек число проверенных паролей ограничивается порогом блокировки
+	credentials = &fakeCredentials{hashes: map[int64]string{1: hash}, attempts: map[model.LoginKey]model.LoginAttempts{}}
+	svc = NewAuthService(NewUserService(users, nil, nil, fakeTransactor{}), credentials, nil,
+		config.AuthConfig{JWTSecret: "secret", Lockout: config.LockoutConfig{DelayAfter: 100, AccountThreshold: 5}},
+		"", log.New(io.Discard, "", 0))
+	svc.now = func() time.Time { return now }
+	if checked := attack(svc, "unknown@example.com", 20); checked != 5 {
+		t.Errorf("Проверено паролей до блокировки: %d, ожидалось 5", checked)
+	}
+	account := credentials.attempts[model.LoginKey{Scope: model.LoginScopeAccount, Key: "unknown@example.com"}]
+	if !account.LockedUntil.Equal(now.Add(defaultLockoutDuration)) {
+		t.Errorf("Учетная запись должна быть заблокирована до %s, учет: %+v", now.Add(defaultLockoutDuration), account)
+	}
+
+	// Успешный вход не учитывается как неудачная попытка с IP-адреса и сбрасывает учет учетной записи
+	if _, _, err := svc.Authenticate(ctx, model.LoginRequest{Email: "ivan@example.com", Password: "correct horse"}); err != nil {
+		t.Fatalf("Ошибка входа: %v", err)
+	}
+	if ip := credentials.attempts[model.LoginKey{Scope: model.LoginScopeIP, Key: "203.0.113.7"}]; ip.Failures != 5 {
+		t.Errorf("Успешный вход изменил учет IP-адреса: %+v, ожидалось 5 неудач", ip)
+	}
+	if _, ok := credentials.attempts[model.LoginKey{Scope: model.LoginScopeAccount, Key: "ivan@example.com"}]; ok {
+		t.Error("Учет учетной записи не сброшен после успешного входа")
+	}
+}
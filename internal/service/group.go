@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+)
+
+// Ограничения полей группы
+const (
+	maxGroupNameLength        = 100 // Максимальная длина названия группы в символах
+	maxGroupDescriptionLength = 500 // Максимальная длина описания группы в символах
+)
+
+// Ошибки сервиса групп
+var (
+	ErrGroupNotFound  = errors.New("group not found")                // Группа не найдена
+	ErrMemberNotFound = errors.New("group member not found")         // Пользователь не состоит в группе
+	ErrGroupExists    = errors.New("group name is already taken")    // Группа с таким названием уже есть
+	ErrAlreadyMember  = errors.New("user is already a group member") // Пользователь уже состоит в группе
+)
+
+// GroupService обрабатывает бизнес-логику групп пользователей и участия в них
+type GroupService struct {
+	repo  *postgres.GroupRepository // Репозиторий групп и участников
+	users repository.UserRepository // Репозиторий пользователей для проверки существования участников
+}
+
+// NewGroupService создает новый сервис групп
+// repo - репозиторий групп
+// users - репозиторий пользователей
+func NewGroupService(repo *postgres.GroupRepository, users repository.UserRepository) *GroupService {
+	return &GroupService{
+		repo:  repo,
+		users: users,
+	}
+}
+
+// Create создает новую группу
+// ctx - контекст операции
+// group - данные группы
+func (s *GroupService) Create(ctx context.Context, group model.GroupCreate) (*model.Group, error) {
+	group.Name = strings.TrimSpace(group.Name)
+	if !validGroupName(group.Name) || !validGroupDescription(group.Description) {
+		return nil, ErrInvalidInput
+	}
+
+	created, err := s.repo.Create(ctx, group)
+	if errors.Is(err, postgres.ErrDuplicate) {
+		return nil, ErrGroupExists
+	}
+	return created, err
+}
+
+// GetByID получает группу по ID
+// ctx - контекст операции
+// id - идентификатор группы
+func (s *GroupService) GetByID(ctx context.Context, id int64) (*model.Group, error) {
+	group, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if group == nil {
+		return nil, ErrGroupNotFound
+	}
+
+	return group, nil
+}
+
+// GetAll получает страницу групп и общее количество групп
+// ctx - контекст операции
+// limit, offset - параметры постраничной выборки
+func (s *GroupService) GetAll(ctx context.Context, limit, offset int) ([]model.Group, int, error) {
+	return s.repo.GetAll(ctx, limit, offset)
+}
+
+// Update обновляет название и описание группы
+// ctx - контекст операции
+// id - идентификатор группы
+// update - изменяемые поля
+func (s *GroupService) Update(ctx context.Context, id int64, update model.GroupUpdate) (*model.Group, error) {
+	if update.Name == nil && update.Description == nil {
+		return nil, ErrInvalidInput
+	}
+
+	group, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if !validGroupName(name) {
+			return nil, ErrInvalidInput
+		}
+		group.Name = name
+	}
+	if update.Description != nil {
+		if !validGroupDescription(*update.Description) {
+			return nil, ErrInvalidInput
+		}
+		group.Description = *update.Description
+	}
+
+	updated, err := s.repo.Update(ctx, *group)
+	if err != nil {
+		if errors.Is(err, postgres.ErrDuplicate) {
+			return nil, ErrGroupExists
+		}
+		return nil, err
+	}
+
+	if updated == nil {
+		return nil, ErrGroupNotFound
+	}
+
+	return updated, nil
+}
+
+// Delete удаляет группу вместе с участием в ней
+// ctx - контекст операции
+// id - идентификатор группы
+func (s *GroupService) Delete(ctx context.Context, id int64) error {
+	deleted, err := s.repo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+// Members получает страницу участников группы и общее количество участников
+// ctx - контекст операции
+// id - идентификатор группы
+// limit, offset - параметры постраничной выборки
+func (s *GroupService) Members(ctx context.Context, id int64, limit, offset int) ([]model.GroupMember, int, error) {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return nil, 0, err
+	}
+
+	return s.repo.ListMembers(ctx, id, limit, offset)
+}
+
+// AddMember добавляет пользователя в группу
+// Если роль не указана, пользователь добавляется с ролью member
+// ctx - контекст операции
+// id - идентификатор группы
+// member - пользователь и роль
+func (s *GroupService) AddMember(ctx context.Context, id int64, member model.GroupMemberAdd) (*model.GroupMember, error) {
+	if member.Role == "" {
+		member.Role = model.GroupRoleMember
+	}
+	if member.UserID <= 0 || !model.ValidGroupRole(member.Role) {
+		return nil, ErrInvalidInput
+	}
+
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByID(ctx, member.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	added, err := s.repo.AddMember(ctx, model.GroupMember{GroupID: id, UserID: member.UserID, Role: member.Role})
+	if errors.Is(err, postgres.ErrDuplicate) {
+		return nil, ErrAlreadyMember
+	}
+	return added, err
+}
+
+// UpdateMember изменяет роль участника группы
+// ctx - контекст операции
+// id - идентификатор группы
+// userID - идентификатор участника
+// update - новая роль
+func (s *GroupService) UpdateMember(ctx context.Context, id, userID int64, update model.GroupMemberUpdate) (*model.GroupMember, error) {
+	if !model.ValidGroupRole(update.Role) {
+		return nil, ErrInvalidInput
+	}
+
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.UpdateMember(ctx, id, userID, update.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated == nil {
+		return nil, ErrMemberNotFound
+	}
+
+	return updated, nil
+}
+
+// RemoveMember исключает пользователя из группы
+// ctx - контекст операции
+// id - идентификатор группы
+// userID - идентификатор участника
+func (s *GroupService) RemoveMember(ctx context.Context, id, userID int64) error {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return err
+	}
+
+	removed, err := s.repo.RemoveMember(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if !removed {
+		return ErrMemberNotFound
+	}
+
+	return nil
+}
+
+// UserGroups получает группы, в которых состоит пользователь
+// ctx - контекст операции
+// userID - идентификатор пользователя
+func (s *GroupService) UserGroups(ctx context.Context, userID int64) ([]model.UserGroup, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// validGroupName проверяет, что название группы не пустое и не длиннее допустимого
+func validGroupName(name string) bool {
+	return name != "" && utf8.RuneCountInString(name) <= maxGroupNameLength
+}
+
+// validGroupDescription проверяет длину описания группы
+func validGroupDescription(description string) bool {
+	return utf8.RuneCountInString(description) <= maxGroupDescriptionLength
+}
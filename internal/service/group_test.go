@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// TestGroupServiceRejectsInvalidInput проверяет, что некорректные данные групп отклоняются до обращения к хранилищу
+func TestGroupServiceRejectsInvalidInput(t *testing.T) {
+	svc := NewGroupService(nil, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"пустое название", func() error {
+			_, err := svc.Create(ctx, model.GroupCreate{Name: "   "})
+			return err
+		}},
+		{"слишком длинное название", func() error {
+			_, err := svc.Create(ctx, model.GroupCreate{Name: strings.Repeat("г", maxGroupNameLength+1)})
+			return err
+		}},
+		{"слишком длинное описание", func() error {
+			_, err := svc.Create(ctx, model.GroupCreate{Name: "Команда", Description: strings.Repeat("x", maxGroupDescriptionLength+1)})
+			return err
+		}},
+		{"пустое обновление", func() error {
+			_, err := svc.Update(ctx, 1, model.GroupUpdate{})
+			return err
+		}},
+		{"неизвестная роль участника", func() error {
+			_, err := svc.AddMember(ctx, 1, model.GroupMemberAdd{UserID: 1, Role: "guest"})
+			return err
+		}},
+		{"участник без ID", func() error {
+			_, err := svc.AddMember(ctx, 1, model.GroupMemberAdd{})
+			return err
+		}},
+		{"пустая роль при изменении", func() error {
+			_, err := svc.UpdateMember(ctx, 1, 1, model.GroupMemberUpdate{Role: ""})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("Ожидалась ошибка %v, получено %v", ErrInvalidInput, err)
+			}
+		})
+	}
+}
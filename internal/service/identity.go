@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/idp"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/tenant"
+)
+
+// Параметры входа через внешних поставщиков
+const (
+	identityLoginStateTTL = 10 * time.Minute // Срок действия начатого входа до возврата пользователя от поставщика
+	maxExternalNameLength = 100              // Максимальная длина имени создаваемого пользователя (соответствует столбцу name)
+)
+
+// Ошибки входа через внешних поставщиков
+var (
+	ErrIdentityProviderNotFound = errors.New("identity provider not found")                     // Поставщик не настроен
+	ErrInvalidLoginState        = errors.New("invalid or expired login state")                  // Вход не начат, истек или уже завершен
+	ErrExternalLoginDenied      = errors.New("login was denied by identity provider")           // Поставщик вернул ошибку вместо кода
+	ErrExternalLogin            = errors.New("identity provider login failed")                  // Поставщик недоступен или его ответ не прошел проверку
+	ErrEmailNotVerified         = errors.New("email is not verified")                           // Почта не подтверждена поставщиком или у найденного пользователя
+	ErrExternalUserNotFound     = errors.New("no user matches external identity")               // Пользователь с почтой из удостоверения не найден
+	ErrIdentityConflict         = errors.New("user already has an identity from this provider") // К пользователю привязана другая учетная запись поставщика
+	ErrIdentityNotFound         = errors.New("identity not found")                              // Привязка не найдена
+	ErrIdentityUnlinked         = errors.New("identity was unlinked from user")                 // Учетная запись поставщика отвязана от найденного пользователя
+)
+
+// identityMetrics - счетчики входа через внешних поставщиков, публикуемые через expvar (/debug/vars)
+var identityMetrics = expvar.NewMap("identity")
+
+// identityProvider - настроенный внешний поставщик
+type identityProvider struct {
+	provider    idp.Provider // Реализация входа
+	createUsers bool         // Создавать пользователя, если пользователь с почтой из удостоверения не найден
+}
+
+// IdentityService реализует вход через внешних поставщиков удостоверений (например, корпоративный OpenID Connect)
+// Учетная запись поставщика (provider, subject) привязывается к пользователю при первом входе
+// по подтвержденной поставщиком электронной почте, следующие входы находят пользователя по привязке
+// Параметр state содержит арендатора, поэтому возврат от поставщика не требует заголовка арендатора
+type IdentityService struct {
+	repo      repository.IdentityRepository // Репозиторий привязок и начатых входов
+	users     *UserService                  // Сервис пользователей
+	auth      *AuthService                  // Сервис входа для выдачи токенов
+	providers map[string]identityProvider   // Поставщики по имени
+	names     []string                      // Имена поставщиков в порядке конфигурации
+	now       func() time.Time              // Текущее время (подменяется в тестах)
+}
+
+// NewIdentityService создает новый сервис входа через внешних поставщиков
+// repo - репозиторий привязок и начатых входов
+// users - сервис пользователей
+// auth - сервис входа
+// providers - настройки поставщиков (auth.providers)
+func NewIdentityService(repo repository.IdentityRepository, users *UserService, auth *AuthService,
+	providers []config.IdentityProviderConfig) (*IdentityService, error) {
+	s := &IdentityService{
+		repo:      repo,
+		users:     users,
+		auth:      auth,
+		providers: make(map[string]identityProvider, len(providers)),
+		now:       time.Now,
+	}
+	for _, cfg := range providers {
+		provider, err := idp.New(cfg, nil)
+		if err != nil {
+			return nil, fmt.Errorf("поставщик %s: %w", cfg.Name, err)
+		}
+		s.providers[cfg.Name] = identityProvider{provider: provider, createUsers: cfg.CreateUsers}
+		s.names = append(s.names, cfg.Name)
+	}
+
+	return s, nil
+}
+
+// Providers возвращает настроенных поставщиков с адресами начала входа
+func (s *IdentityService) Providers() []model.IdentityProvider {
+	providers := make([]model.IdentityProvider, 0, len(s.names))
+	for _, name := range s.names {
+		providers = append(providers, model.IdentityProvider{Name: name, LoginURL: "/auth/providers/" + name + "/login"})
+	}
+	return providers
+}
+
+// StartLogin начинает вход через поставщика и возвращает адрес его страницы входа
+// Параметры входа (nonce и PKCE code_verifier) сохраняются до возврата пользователя по хэшу state
+// ctx - контекст операции
+// name - имя поставщика
+func (s *IdentityService) StartLogin(ctx context.Context, name string) (*model.IdentityLoginStart, error) {
+	p, ok := s.providers[name]
+	if !ok {
+		return nil, ErrIdentityProviderNotFound
+	}
+
+	state, stateHash, err := generateLoginState(requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomURLToken(16)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomURLToken(32)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+
+	authURL, err := p.provider.AuthURL(ctx, idp.AuthRequest{
+		State:         state,
+		Nonce:         nonce,
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExternalLogin, err)
+	}
+
+	err = s.repo.CreateState(ctx, model.IdentityLoginState{
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    s.now().Add(identityLoginStateTTL),
+	}, stateHash)
+	if err != nil {
+		return nil, err
+	}
+	identityMetrics.Add("started", 1)
+
+	return &model.IdentityLoginStart{AuthorizationURL: authURL}, nil
+}
+
+// CompleteLogin завершает вход после возврата пользователя от поставщика и выдает токен доступа
+// Пользователь находится по привязке учетной записи поставщика; при первом входе учетная запись
+// привязывается к пользователю с подтвержденной поставщиком почтой, а если такого пользователя нет
+// и у поставщика включен create_users, пользователь создается
+// Если у пользователя включена двухфакторная аутентификация, выдается токен второго шага входа
+// ctx - контекст операции
+// name - имя поставщика
+// callback - параметры адреса возврата
+func (s *IdentityService) CompleteLogin(ctx context.Context, name string, callback model.IdentityCallback) (*model.LoginToken, error) {
+	p, ok := s.providers[name]
+	if !ok {
+		return nil, ErrIdentityProviderNotFound
+	}
+	tenantID, ok := loginStateTenant(callback.State)
+	if !ok {
+		return nil, ErrInvalidLoginState
+	}
+
+	info := requestinfo.FromContext(ctx)
+	info.TenantID = tenantID
+	ctx = requestinfo.WithInfo(ctx, info)
+
+	// Начатый вход удаляется в любом случае, чтобы возврат от поставщика нельзя было повторить
+	state, err := s.repo.ConsumeState(ctx, hashToken(callback.State))
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || state.Provider != name || !s.now().Before(state.ExpiresAt) {
+		return nil, ErrInvalidLoginState
+	}
+	if callback.Error != "" {
+		identityMetrics.Add("denied", 1)
+		return nil, fmt.Errorf("%w: %s %s", ErrExternalLoginDenied, callback.Error, callback.ErrorDescription)
+	}
+	if callback.Code == "" {
+		return nil, ErrInvalidInput
+	}
+
+	identity, err := p.provider.Exchange(ctx, callback.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		identityMetrics.Add("failure", 1)
+		return nil, fmt.Errorf("%w: %v", ErrExternalLogin, err)
+	}
+
+	user, err := s.resolveUser(ctx, name, p, identity)
+	if err != nil {
+		return nil, err
+	}
+	identityMetrics.Add("success", 1)
+
+	return s.auth.LoginExternal(ctx, user)
+}
+
+// resolveUser находит пользователя по привязке учетной записи поставщика или привязывает ее
+// к пользователю с той же подтвержденной почтой, создавая пользователя при необходимости
+func (s *IdentityService) resolveUser(ctx context.Context, name string, p identityProvider,
+	identity *idp.Identity) (*model.User, error) {
+	now := s.now()
+	linked, err := s.repo.GetBySubject(ctx, name, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if linked != nil {
+		if err := s.repo.TouchLogin(ctx, linked.ID, now); err != nil {
+			return nil, err
+		}
+		return s.users.GetByID(ctx, linked.UserID)
+	}
+
+	// Без подтверждения почты поставщиком владелец учетной записи поставщика мог бы получить доступ
+	// к чужому пользователю с той же почтой
+	if identity.Email == "" || !identity.EmailVerified {
+		identityMetrics.Add("unverified_email", 1)
+		return nil, ErrEmailNotVerified
+	}
+
+	ctx = withLoginActor(ctx, identity.Email)
+	var user *model.User
+	err = s.users.tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		if user, err = s.users.repo.GetByEmail(ctx, identity.Email); err != nil {
+			return err
+		}
+		switch {
+		case user == nil && !p.createUsers:
+			return ErrExternalUserNotFound
+		case user == nil:
+			user, err = s.users.Create(ctx, model.UserCreate{
+				Name:          externalUserName(identity),
+				Email:         identity.Email,
+				EmailVerified: true,
+			})
+			if err != nil {
+				return err
+			}
+			identityMetrics.Add("created", 1)
+		case !user.EmailVerified:
+			// Иначе почту неподтвержденного пользователя мог бы указать кто угодно и получить вход
+			// владельца учетной записи поставщика
+			return ErrEmailNotVerified
+		default:
+			// Отвязанная учетная запись не привязывается снова по почте, иначе отвязка не имела бы смысла
+			unlinked, err := s.repo.Unlinked(ctx, user.ID, name)
+			if err != nil {
+				return err
+			}
+			if unlinked {
+				identityMetrics.Add("unlinked", 1)
+				return ErrIdentityUnlinked
+			}
+		}
+
+		linked, err := s.repo.Link(ctx, model.UserIdentity{
+			UserID:      user.ID,
+			Provider:    name,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LastLoginAt: &now,
+		})
+		if errors.Is(err, postgres.ErrDuplicate) {
+			return ErrIdentityConflict
+		}
+		if err != nil {
+			return err
+		}
+		if linked == nil {
+			return ErrUserNotFound
+		}
+		identityMetrics.Add("linked", 1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ListIdentities возвращает учетные записи поставщиков, привязанные к пользователю
+// ctx - контекст операции
+// userID - идентификатор пользователя
+func (s *IdentityService) ListIdentities(ctx context.Context, userID int64) ([]model.UserIdentity, error) {
+	if _, err := s.users.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// Unlink отвязывает учетную запись поставщика от пользователя
+// Следующий вход через этого поставщика не привяжет учетную запись по почте автоматически
+// ctx - контекст операции
+// userID - идентификатор пользователя
+// id - идентификатор привязки
+func (s *IdentityService) Unlink(ctx context.Context, userID, id int64) error {
+	if _, err := s.users.GetByID(ctx, userID); err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.Delete(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrIdentityNotFound
+	}
+
+	return nil
+}
+
+// externalUserName возвращает имя создаваемого пользователя: имя от поставщика или часть почты до @
+func externalUserName(identity *idp.Identity) string {
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if runes := []rune(name); len(runes) > maxExternalNameLength {
+		name = string(runes[:maxExternalNameLength])
+	}
+	return name
+}
+
+// randomURLToken возвращает n случайных байт в кодировке Base64url
+func randomURLToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// generateLoginState генерирует параметр state для арендатора и его хэш для хранения
+func generateLoginState(tenantID string) (string, string, error) {
+	random, err := randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	state := tenantID + "." + random
+	return state, hashToken(state), nil
+}
+
+// loginStateTenant извлекает арендатора из параметра state
+func loginStateTenant(state string) (string, bool) {
+	tenantID, random, ok := strings.Cut(state, ".")
+	if !ok || random == "" || !tenant.Valid(tenantID) {
+		return "", false
+	}
+	return tenantID, true
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/idp/idptest"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// fakeIdentityRepository - хранилище привязок и начатых входов в памяти
+// Повторяет уникальные индексы user_identities: (provider, subject) и (user_id, provider)
+type fakeIdentityRepository struct {
+	users      *fakeUserRepository
+	identities []model.UserIdentity
+	states     map[string]model.IdentityLoginState
+	unlinked   map[int64][]string
+}
+
+func (r *fakeIdentityRepository) CreateState(ctx context.Context, state model.IdentityLoginState, stateHash string) error {
+	r.states[stateHash] = state
+	return nil
+}
+
+func (r *fakeIdentityRepository) ConsumeState(ctx context.Context, stateHash string) (*model.IdentityLoginState, error) {
+	state, ok := r.states[stateHash]
+	if !ok {
+		return nil, nil
+	}
+	delete(r.states, stateHash)
+	return &state, nil
+}
+
+func (r *fakeIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeIdentityRepository) Link(ctx context.Context, identity model.UserIdentity) (*model.UserIdentity, error) {
+	if r.users.users[identity.UserID] == nil {
+		return nil, nil
+	}
+	for _, linked := range r.identities {
+		if linked.Provider == identity.Provider &&
+			(linked.Subject == identity.Subject || linked.UserID == identity.UserID) {
+			return nil, postgres.ErrDuplicate
+		}
+	}
+	identity.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, identity)
+	return &identity, nil
+}
+
+func (r *fakeIdentityRepository) TouchLogin(ctx context.Context, id int64, now time.Time) error {
+	for i := range r.identities {
+		if r.identities[i].ID == id {
+			r.identities[i].LastLoginAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeIdentityRepository) ListByUser(ctx context.Context, userID int64) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *fakeIdentityRepository) Delete(ctx context.Context, userID, id int64) (bool, error) {
+	for i, identity := range r.identities {
+		if identity.ID == id && identity.UserID == userID {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			r.unlinked[userID] = append(r.unlinked[userID], identity.Provider)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeIdentityRepository) Unlinked(ctx context.Context, userID int64, provider string) (bool, error) {
+	for _, unlinked := range r.unlinked[userID] {
+		if unlinked == provider {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// identityTest - сервис входа через локального поставщика corp с хранилищами в памяти
+type identityTest struct {
+	service *IdentityService
+	auth    *AuthService
+	users   *fakeUserRepository
+	repo    *fakeIdentityRepository
+	issuer  *idptest.Issuer
+}
+
+// newIdentityTest создает сервис входа через локального поставщика corp
+// createUsers - значение create_users поставщика
+func newIdentityTest(t *testing.T, createUsers bool) *identityTest {
+	issuer := idptest.NewIssuer(t)
+	users := &fakeUserRepository{users: map[int64]*model.User{}}
+	repo := &fakeIdentityRepository{users: users, states: map[string]model.IdentityLoginState{},
+		unlinked: map[int64][]string{}}
+
+	userService := NewUserService(users, nil, nil, fakeTransactor{})
+	auth := NewAuthService(userService, nil, nil, config.AuthConfig{JWTSecret: "secret"}, "",
+		log.New(io.Discard, "", 0))
+	service, err := NewIdentityService(repo, userService, auth, []config.IdentityProviderConfig{{
+		Name:         "corp",
+		Issuer:       issuer.Server.URL,
+		ClientID:     idptest.ClientID,
+		ClientSecret: idptest.ClientSecret,
+		RedirectURL:  "https://app.example.com/auth/providers/corp/callback",
+		CreateUsers:  createUsers,
+	}})
+	if err != nil {
+		t.Fatalf("Ошибка создания сервиса: %v", err)
+	}
+
+	return &identityTest{service: service, auth: auth, users: users, repo: repo, issuer: issuer}
+}
+
+// activeUser возвращает активного пользователя арендатора по умолчанию
+// verified - почта пользователя подтверждена
+func activeUser(id int64, email string, verified bool) *model.User {
+	return &model.User{ID: id, Email: email, Status: model.UserStatusActive, Role: model.UserRoleMember,
+		EmailVerified: verified, TenantID: requestinfo.DefaultTenant}
+}
+
+// login выполняет вход через поставщика: начинает вход, выдает ID-токен с утверждениями поставщика
+// для сохраненного nonce и завершает вход
+// Возвращает пользователя из выданного токена доступа
+func (it *identityTest) login(t *testing.T) (int64, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	start, err := it.service.StartLogin(ctx, "corp")
+	if err != nil {
+		t.Fatalf("Ошибка начала входа: %v", err)
+	}
+	authURL, err := url.Parse(start.AuthorizationURL)
+	if err != nil {
+		t.Fatalf("Некорректный адрес входа: %v", err)
+	}
+	state := authURL.Query().Get("state")
+	it.issuer.Claims["nonce"] = it.repo.states[hashToken(state)].Nonce
+
+	token, err := it.service.CompleteLogin(ctx, "corp", model.IdentityCallback{Code: "code-1", State: state})
+	if err != nil {
+		return 0, err
+	}
+	claims, err := it.auth.VerifyToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("Выдан некорректный токен доступа: %v", err)
+	}
+	return claims.UserID, nil
+}
+
+// TestIdentityLoginLinksVerifiedUser проверяет привязку учетной записи поставщика при первом входе
+// к пользователю с подтвержденной почтой и вход по привязке при следующих входах
+func TestIdentityLoginLinksVerifiedUser(t *testing.T) {
+	it := newIdentityTest(t, false)
+	it.users.users[1] = activeUser(1, "ivan@example.com", true)
+
+	userID, err := it.login(t)
+	if err != nil || userID != 1 {
+		t.Fatalf("Первый вход: пользователь %d, ошибка %v", userID, err)
+	}
+	if len(it.repo.identities) != 1 || it.repo.identities[0].Subject != "ext-42" || it.repo.identities[0].UserID != 1 {
+		t.Fatalf("Ожидалась привязка ext-42 к пользователю 1, получено %+v", it.repo.identities)
+	}
+
+	// Следующий вход находит пользователя по привязке, даже если почта у поставщика изменилась
+	it.issuer.Claims["email"] = "ivan.petrov@example.com"
+	userID, err = it.login(t)
+	if err != nil || userID != 1 {
+		t.Fatalf("Вход по привязке: пользователь %d, ошибка %v", userID, err)
+	}
+	if len(it.repo.identities) != 1 || it.repo.identities[0].LastLoginAt == nil {
+		t.Errorf("Вход по привязке должен обновить время входа без новой привязки: %+v", it.repo.identities)
+	}
+}
+
+// TestIdentityLoginRejectsUnverifiedEmail проверяет отказ во входе без подтверждения почты поставщиком
+// или у найденного пользователя
+func TestIdentityLoginRejectsUnverifiedEmail(t *testing.T) {
+	it := newIdentityTest(t, true)
+	it.users.users[1] = activeUser(1, "ivan@example.com", true)
+
+	it.issuer.Claims["email_verified"] = false
+	if _, err := it.login(t); !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("Неподтвержденная почта у поставщика: ожидалась ошибка %v, получено %v", ErrEmailNotVerified, err)
+	}
+
+	it.issuer.Claims["email_verified"] = true
+	it.users.users[1].EmailVerified = false
+	if _, err := it.login(t); !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("Неподтвержденная почта пользователя: ожидалась ошибка %v, получено %v", ErrEmailNotVerified, err)
+	}
+	if len(it.repo.identities) != 0 {
+		t.Errorf("Учетная запись не должна привязываться: %+v", it.repo.identities)
+	}
+}
+
+// TestIdentityLoginUnknownUser проверяет вход пользователя, которого нет в сервисе:
+// без create_users вход отклоняется, с create_users пользователь создается
+func TestIdentityLoginUnknownUser(t *testing.T) {
+	it := newIdentityTest(t, false)
+	if _, err := it.login(t); !errors.Is(err, ErrExternalUserNotFound) {
+		t.Errorf("Без create_users: ожидалась ошибка %v, получено %v", ErrExternalUserNotFound, err)
+	}
+	if len(it.users.users) != 0 {
+		t.Errorf("Без create_users пользователь не должен создаваться: %+v", it.users.users)
+	}
+
+	it = newIdentityTest(t, true)
+	userID, err := it.login(t)
+	if err != nil {
+		t.Fatalf("С create_users: ошибка %v", err)
+	}
+	created := it.users.users[userID]
+	if created == nil || created.Name != "Иван" || created.Email != "ivan@example.com" || !created.EmailVerified {
+		t.Errorf("Неожиданный созданный пользователь: %+v", created)
+	}
+}
+
+// TestIdentityLoginConflict проверяет, что вторая учетная запись того же поставщика
+// не привязывается к пользователю
+func TestIdentityLoginConflict(t *testing.T) {
+	it := newIdentityTest(t, false)
+	it.users.users[1] = activeUser(1, "ivan@example.com", true)
+	it.repo.identities = []model.UserIdentity{{ID: 1, UserID: 1, Provider: "corp", Subject: "ext-1"}}
+
+	if _, err := it.login(t); !errors.Is(err, ErrIdentityConflict) {
+		t.Errorf("Ожидалась ошибка %v, получено %v", ErrIdentityConflict, err)
+	}
+}
+
+// TestIdentityLoginAfterUnlink проверяет, что после отвязки вход через того же поставщика
+// не привязывает учетную запись к пользователю снова
+func TestIdentityLoginAfterUnlink(t *testing.T) {
+	it := newIdentityTest(t, true)
+	it.users.users[1] = activeUser(1, "ivan@example.com", true)
+
+	if _, err := it.login(t); err != nil {
+		t.Fatalf("Ошибка первого входа: %v", err)
+	}
+	if err := it.service.Unlink(context.Background(), 1, it.repo.identities[0].ID); err != nil {
+		t.Fatalf("Ошибка отвязки: %v", err)
+	}
+
+	if _, err := it.login(t); !errors.Is(err, ErrIdentityUnlinked) {
+		t.Errorf("Ожидалась ошибка %v, получено %v", ErrIdentityUnlinked, err)
+	}
+	if len(it.repo.identities) != 0 || len(it.users.users) != 1 {
+		t.Errorf("Вход после отвязки не должен привязывать или создавать пользователей: %+v, %+v",
+			it.repo.identities, it.users.users)
+	}
+}
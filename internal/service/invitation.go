@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/mailer"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/tenant"
+)
+
+// Параметры приглашений
+const (
+	defaultInvitationTTL = 72 * time.Hour // Срок действия приглашения, если он не задан в конфигурации
+	maxEmailLength       = 100            // Максимальная длина электронной почты (соответствует столбцу email)
+)
+
+// Ошибки сервиса приглашений
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")                       // Приглашение не найдено или токен неверный
+	ErrInvitationInactive = errors.New("invitation is accepted, revoked or expired") // Приглашение уже не действует
+	ErrInvitationNotSent  = errors.New("invitation email could not be sent")         // Письмо с приглашением не отправлено
+)
+
+// InvitationService обрабатывает бизнес-логику приглашений пользователей
+// Токен приглашения имеет вид "<арендатор>.<случайная строка>": по нему принятие приглашения
+// выполняется в пределах арендатора без заголовка или токена арендатора
+type InvitationService struct {
+	repo        *postgres.InvitationRepository // Репозиторий приглашений
+	users       *UserService                   // Сервис пользователей для создания приглашенного
+	credentials *postgres.CredentialRepository // Репозиторий паролей для пароля приглашенного
+	tx          *postgres.TxManager            // Менеджер транзакций
+	mailer      mailer.Mailer                  // Отправитель писем с приглашениями
+	ttl         time.Duration                  // Срок действия приглашения
+	acceptURL   string                         // Адрес страницы принятия приглашения
+	now         func() time.Time               // Текущее время (подменяется в тестах)
+}
+
+// NewInvitationService создает новый сервис приглашений
+// repo - репозиторий приглашений
+// users - сервис пользователей
+// credentials - репозиторий паролей
+// tx - менеджер транзакций
+// mailer - отправитель писем
+// cfg - настройки приглашений
+func NewInvitationService(repo *postgres.InvitationRepository, users *UserService,
+	credentials *postgres.CredentialRepository, tx *postgres.TxManager, mailer mailer.Mailer,
+	cfg config.InvitationsConfig) *InvitationService {
+	ttl := cfg.TTL.Duration
+	if ttl <= 0 {
+		ttl = defaultInvitationTTL
+	}
+
+	return &InvitationService{
+		repo:        repo,
+		users:       users,
+		credentials: credentials,
+		tx:          tx,
+		mailer:      mailer,
+		ttl:         ttl,
+		acceptURL:   cfg.AcceptURL,
+		now:         time.Now,
+	}
+}
+
+// Create создает приглашение и отправляет его на электронную почту
+// Прежние непринятые приглашения на ту же почту отзываются, действует только последняя ссылка
+// Если письмо не удалось отправить, приглашение удаляется и возвращается ErrInvitationNotSent
+// ctx - контекст операции
+// create - электронная почта и роль приглашаемого
+func (s *InvitationService) Create(ctx context.Context, create model.InvitationCreate) (*model.Invitation, error) {
+	if create.Role == "" {
+		create.Role = model.UserRoleMember
+	}
+	if !validEmail(create.Email) || !model.ValidUserRole(create.Role) {
+		return nil, ErrInvalidInput
+	}
+
+	token, tokenHash, err := generateInvitationToken(requestinfo.FromContext(ctx).Tenant())
+	if err != nil {
+		return nil, err
+	}
+
+	var created *model.Invitation
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		existing, err := s.users.repo.GetByEmail(ctx, create.Email)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrEmailTaken
+		}
+
+		if err := s.repo.RevokePending(ctx, create.Email); err != nil {
+			return err
+		}
+
+		created, err = s.repo.Create(ctx, model.Invitation{
+			Email:     create.Email,
+			Role:      create.Role,
+			ExpiresAt: s.now().Add(s.ttl),
+		}, tokenHash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mailer.Send(ctx, s.invitationMessage(created, token)); err != nil {
+		if deleteErr := s.repo.Delete(ctx, created.ID); deleteErr != nil {
+			return nil, fmt.Errorf("%w: %v (приглашение не удалено: %v)", ErrInvitationNotSent, err, deleteErr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvitationNotSent, err)
+	}
+
+	return created, nil
+}
+
+// ListPending получает страницу действующих приглашений и их общее количество
+// ctx - контекст операции
+// limit, offset - параметры постраничной выборки
+func (s *InvitationService) ListPending(ctx context.Context, limit, offset int) ([]model.Invitation, int, error) {
+	return s.repo.ListPending(ctx, s.now(), limit, offset)
+}
+
+// Revoke отзывает непринятое приглашение
+// ctx - контекст операции
+// id - идентификатор приглашения
+func (s *InvitationService) Revoke(ctx context.Context, id int64) error {
+	inv, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if inv == nil {
+		return ErrInvitationNotFound
+	}
+	if inv.Status(s.now()) != model.InvitationPending {
+		return ErrInvitationInactive
+	}
+
+	revoked, err := s.repo.Revoke(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		// Приглашение приняли или отозвали между чтением и изменением
+		return ErrInvitationInactive
+	}
+
+	return nil
+}
+
+// Accept принимает приглашение и создает пользователя с подтвержденной электронной почтой
+// Операция выполняется в пределах арендатора из токена, инициатором изменения в журнале аудита
+// считается приглашенный, если инициатор не передан в запросе
+// ctx - контекст операции
+// accept - токен из письма и данные нового пользователя
+func (s *InvitationService) Accept(ctx context.Context, accept model.InvitationAccept) (*model.User, error) {
+	tenantID, ok := invitationTenant(accept.Token)
+	if !ok {
+		return nil, ErrInvitationNotFound
+	}
+	if strings.TrimSpace(accept.Name) == "" {
+		return nil, ErrInvalidInput
+	}
+	passwordHash := ""
+	if accept.Password != "" {
+		var err error
+		if passwordHash, err = hashPassword(accept.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	info := requestinfo.FromContext(ctx)
+	info.TenantID = tenantID
+	ctx = requestinfo.WithInfo(ctx, info)
+
+	var created *model.User
+	err := s.tx.WithTx(ctx, func(ctx context.Context) error {
+		inv, err := s.repo.GetByTokenHash(ctx, hashToken(accept.Token))
+		if err != nil {
+			return err
+		}
+		if inv == nil {
+			return ErrInvitationNotFound
+		}
+		if inv.Status(s.now()) != model.InvitationPending {
+			return ErrInvitationInactive
+		}
+
+		if info.Actor == "" {
+			actorInfo := info
+			actorInfo.Actor = inv.Email
+			ctx = requestinfo.WithInfo(ctx, actorInfo)
+		}
+
+		created, err = s.users.Create(ctx, model.UserCreate{
+			Name:          accept.Name,
+			Email:         inv.Email,
+			DisplayName:   accept.DisplayName,
+			Locale:        accept.Locale,
+			Timezone:      accept.Timezone,
+			Role:          inv.Role,
+			EmailVerified: true,
+		})
+		if err != nil {
+			return err
+		}
+		if passwordHash != "" {
+			if _, err := s.credentials.SetPasswordHash(ctx, created.ID, passwordHash, "пароль задан при принятии приглашения"); err != nil {
+				return err
+			}
+		}
+
+		return s.repo.MarkAccepted(ctx, inv.ID, created.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// invitationMessage формирует письмо с приглашением
+// Если задан адрес страницы принятия, письмо содержит ссылку с токеном, иначе только токен
+func (s *InvitationService) invitationMessage(inv *model.Invitation, token string) mailer.Message {
+	var body strings.Builder
+	body.WriteString("Вас пригласили в сервис пользователей.\n\n")
+	if link, ok := acceptLink(s.acceptURL, token); ok {
+		fmt.Fprintf(&body, "Чтобы принять приглашение, перейдите по ссылке:\n%s\n\n", link)
+	} else {
+		fmt.Fprintf(&body, "Код приглашения:\n%s\n\n", token)
+	}
+	fmt.Fprintf(&body, "Приглашение действует до %s.\n", inv.ExpiresAt.UTC().Format("02.01.2006 15:04 MST"))
+
+	return mailer.Message{
+		To:      inv.Email,
+		Subject: "Приглашение в сервис пользователей",
+		Body:    body.String(),
+	}
+}
+
+// acceptLink добавляет токен параметром token к адресу страницы принятия приглашения
+func acceptLink(acceptURL, token string) (string, bool) {
+	if acceptURL == "" {
+		return "", false
+	}
+	u, err := url.Parse(acceptURL)
+	if err != nil {
+		return "", false
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), true
+}
+
+// generateInvitationToken генерирует токен приглашения для арендатора и его хэш для хранения
+func generateInvitationToken(tenantID string) (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := tenantID + "." + base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// invitationTenant извлекает арендатора из токена приглашения
+func invitationTenant(token string) (string, bool) {
+	tenantID, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" || !tenant.Valid(tenantID) {
+		return "", false
+	}
+	return tenantID, true
+}
+
+// validEmail проверяет, что строка является одним адресом электронной почты без имени
+func validEmail(email string) bool {
+	if email == "" || len(email) > maxEmailLength {
+		return false
+	}
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
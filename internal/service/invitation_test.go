@@ -0,0 +1,37 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestInvitationToken проверяет, что токен приглашения содержит арендатора и хэшируется детерминированно
+func TestInvitationToken(t *testing.T) {
+	token, hash, err := generateInvitationToken("acme")
+	if err != nil {
+		t.Fatalf("Ошибка генерации токена: %v", err)
+	}
+
+	if !strings.HasPrefix(token, "acme.") {
+		t.Errorf("Токен %q не начинается с арендатора", token)
+	}
+	if hash != hashToken(token) || len(hash) != 64 {
+		t.Errorf("Некорректный хэш токена: %q", hash)
+	}
+
+	tenantID, ok := invitationTenant(token)
+	if !ok || tenantID != "acme" {
+		t.Errorf("Арендатор из токена: %q, %v", tenantID, ok)
+	}
+
+	for _, bad := range []string{"", "acme", "acme.", "ACME.secret", "../x.secret"} {
+		if _, ok := invitationTenant(bad); ok {
+			t.Errorf("Токен %q должен быть отклонен", bad)
+		}
+	}
+
+	other, _, err := generateInvitationToken("acme")
+	if err != nil || other == token {
+		t.Errorf("Токены приглашений должны быть случайными")
+	}
+}
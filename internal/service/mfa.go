@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/totp"
+)
+
+// Параметры двухфакторной аутентификации
+const (
+	defaultMFAIssuer  = "UserService" // Название сервиса в приложении-аутентификаторе, если оно не задано
+	mfaSkew           = 1             // Допуск расхождения часов в шагах TOTP
+	recoveryCodeCount = 10            // Число кодов восстановления
+)
+
+// Ошибки двухфакторной аутентификации
+var (
+	ErrMFADisabled    = errors.New("mfa is not configured")             // Не задан ключ шифрования секретов
+	ErrMFAEnabled     = errors.New("mfa is already enabled")            // Двухфакторная аутентификация уже включена
+	ErrMFANotEnrolled = errors.New("mfa is not enrolled")               // Подключение не начиналось или не подтверждено
+	ErrInvalidMFACode = errors.New("invalid one-time or recovery code") // Неверный код из приложения или код восстановления
+)
+
+// recoveryEncoding - кодировка кодов восстановления (строчные буквы и цифры без похожих символов 0/1/8/9)
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// MFAService обрабатывает подключение и проверку двухфакторной аутентификации (TOTP, RFC 6238)
+// Секреты хранятся зашифрованными AES-256-GCM; имя арендатора и ID пользователя входят в
+// дополнительные данные шифрования, поэтому секрет нельзя перенести другому пользователю
+type MFAService struct {
+	users  *UserService            // Сервис пользователей
+	repo   *postgres.MFARepository // Репозиторий секретов и кодов восстановления
+	aead   cipher.AEAD             // Шифр секретов (nil - двухфакторная аутентификация выключена)
+	issuer string                  // Название сервиса в приложении-аутентификаторе
+	now    func() time.Time        // Текущее время (подменяется в тестах)
+}
+
+// NewMFAService создает новый сервис двухфакторной аутентификации
+// users - сервис пользователей
+// repo - репозиторий секретов и кодов восстановления
+// cfg - настройки входа (ключ шифрования и название сервиса)
+func NewMFAService(users *UserService, repo *postgres.MFARepository, cfg config.AuthConfig) (*MFAService, error) {
+	s := &MFAService{
+		users:  users,
+		repo:   repo,
+		issuer: cfg.MFAIssuer,
+		now:    time.Now,
+	}
+	if s.issuer == "" {
+		s.issuer = defaultMFAIssuer
+	}
+
+	if cfg.MFAEncryptionKey != "" {
+		aead, err := newAEAD(cfg.MFAEncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("ключ шифрования секретов: %w", err)
+		}
+		s.aead = aead
+	}
+
+	return s, nil
+}
+
+// Enroll начинает подключение двухфакторной аутентификации: генерирует секрет для приложения-аутентификатора
+// Прежнее неподтвержденное подключение заменяется; включенную аутентификацию нужно сначала сбросить
+// ctx - контекст операции
+// id - идентификатор пользователя
+func (s *MFAService) Enroll(ctx context.Context, id int64) (*model.MFAEnrollment, error) {
+	if s.aead == nil {
+		return nil, ErrMFADisabled
+	}
+
+	user, err := s.users.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encrypt(ctx, id, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.repo.SavePending(ctx, id, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrMFAEnabled
+	}
+
+	return &model.MFAEnrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm подтверждает подключение кодом из приложения-аутентификатора и включает двухфакторную аутентификацию
+// Возвращает одноразовые коды восстановления; они показываются только один раз
+// ctx - контекст операции
+// id - идентификатор пользователя
+// code - код из приложения
+func (s *MFAService) Confirm(ctx context.Context, id int64, code string) (*model.MFARecoveryCodes, error) {
+	if s.aead == nil {
+		return nil, ErrMFADisabled
+	}
+	if _, err := s.users.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, ErrMFANotEnrolled
+	}
+	if mfa.ConfirmedAt != nil {
+		return nil, ErrMFAEnabled
+	}
+
+	secret, err := s.decrypt(ctx, id, mfa.SecretEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, normalizeCode(code), s.now(), mfaSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	confirmed, err := s.repo.Confirm(ctx, id, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		// Подключение подтвердили или сбросили параллельным запросом
+		return nil, ErrMFANotEnrolled
+	}
+
+	return &model.MFARecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// Status возвращает состояние двухфакторной аутентификации пользователя
+// ctx - контекст операции
+// id - идентификатор пользователя
+func (s *MFAService) Status(ctx context.Context, id int64) (*model.MFAStatus, error) {
+	if _, err := s.users.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil || mfa.ConfirmedAt == nil {
+		return &model.MFAStatus{}, nil
+	}
+
+	left, err := s.repo.CountRecoveryCodes(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.MFAStatus{Enabled: true, ConfirmedAt: mfa.ConfirmedAt, RecoveryCodesLeft: left}, nil
+}
+
+// Reset сбрасывает двухфакторную аутентификацию пользователя (например, при утере телефона)
+// Секрет и коды восстановления удаляются, сброс записывается в журнал аудита
+// ctx - контекст операции
+// id - идентификатор пользователя
+// reason - причина сброса для журнала аудита
+func (s *MFAService) Reset(ctx context.Context, id int64, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if len([]rune(reason)) > maxStatusReasonLength {
+		return ErrInvalidInput
+	}
+	if reason == "" {
+		reason = "сброс двухфакторной аутентификации администратором"
+	}
+
+	if _, err := s.users.GetByID(ctx, id); err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.Delete(ctx, id, reason)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrMFANotEnrolled
+	}
+
+	return nil
+}
+
+// enabled сообщает, что у пользователя включена двухфакторная аутентификация
+func (s *MFAService) enabled(ctx context.Context, id int64) (bool, error) {
+	mfa, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return mfa != nil && mfa.ConfirmedAt != nil, nil
+}
+
+// verify проверяет код из приложения или код восстановления при входе
+// Код из приложения принимается один раз: повтор кода того же или более раннего шага отклоняется
+func (s *MFAService) verify(ctx context.Context, id int64, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		used, err := s.repo.UseRecoveryCode(ctx, id, hashRecoveryCode(recoveryCode))
+		if used {
+			loginMetrics.Add("recovery_code_used", 1)
+		}
+		return used, err
+	}
+
+	if s.aead == nil {
+		return false, ErrMFADisabled
+	}
+	mfa, err := s.repo.Get(ctx, id)
+	if err != nil || mfa == nil || mfa.ConfirmedAt == nil {
+		return false, err
+	}
+
+	secret, err := s.decrypt(ctx, id, mfa.SecretEncrypted)
+	if err != nil {
+		return false, err
+	}
+	step, ok := totp.Validate(secret, normalizeCode(code), s.now(), mfaSkew)
+	if !ok || step <= mfa.LastUsedStep {
+		return false, nil
+	}
+
+	return s.repo.UseStep(ctx, id, step)
+}
+
+// encrypt шифрует секрет пользователя; результат - nonce, за которым следует шифротекст
+func (s *MFAService) encrypt(ctx context.Context, userID int64, secret []byte) ([]byte, error) {
+	return seal(s.aead, secret, secretAdditionalData(ctx, userID))
+}
+
+// decrypt расшифровывает секрет пользователя
+func (s *MFAService) decrypt(ctx context.Context, userID int64, encrypted []byte) ([]byte, error) {
+	secret, err := open(s.aead, encrypted, secretAdditionalData(ctx, userID))
+	if err != nil {
+		return nil, fmt.Errorf("секрет TOTP: %w", err)
+	}
+	return secret, nil
+}
+
+// secretAdditionalData возвращает дополнительные данные шифрования секрета: арендатора и ID пользователя
+func secretAdditionalData(ctx context.Context, userID int64) []byte {
+	return []byte(fmt.Sprintf("%s:%d", requestinfo.FromContext(ctx).Tenant(), userID))
+}
+
+// generateRecoveryCodes генерирует коды восстановления вида xxxx-xxxx и их хэши для хранения
+func generateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+	buf := make([]byte, 5)
+	for i := 0; i < n; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := recoveryEncoding.EncodeToString(buf)
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode возвращает SHA-256 кода восстановления в шестнадцатеричном виде
+// Код приводится к нижнему регистру, дефисы и пробелы удаляются
+// Код содержит 40 случайных бит, а перебор ограничен защитой входа, поэтому медленный хэш не нужен
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToLower(normalizeCode(code)))
+}
+
+// normalizeCode удаляет из кода пробелы и дефисы, которые пользователи вводят для удобства
+func normalizeCode(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// newTestMFAService создает сервис двухфакторной аутентификации со случайным ключом шифрования без базы данных
+func newTestMFAService(t *testing.T) *MFAService {
+	t.Helper()
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	s, err := NewMFAService(nil, nil, config.AuthConfig{MFAEncryptionKey: key})
+	if err != nil {
+		t.Fatalf("Ошибка создания сервиса: %v", err)
+	}
+	return s
+}
+
+// TestMFASecretEncryption проверяет, что зашифрованный секрет расшифровывается только для того же пользователя и арендатора
+func TestMFASecretEncryption(t *testing.T) {
+	s := newTestMFAService(t)
+	ctx := requestinfo.WithInfo(context.Background(), requestinfo.Info{TenantID: "acme"})
+	secret := []byte("12345678901234567890")
+
+	encrypted, err := s.encrypt(ctx, 42, secret)
+	if err != nil {
+		t.Fatalf("Ошибка шифрования: %v", err)
+	}
+	if strings.Contains(string(encrypted), string(secret)) {
+		t.Errorf("Зашифрованный секрет содержит открытый текст")
+	}
+
+	decrypted, err := s.decrypt(ctx, 42, encrypted)
+	if err != nil || string(decrypted) != string(secret) {
+		t.Errorf("Неожиданный результат расшифровки: %q, %v", decrypted, err)
+	}
+	if _, err := s.decrypt(ctx, 43, encrypted); err == nil {
+		t.Errorf("Секрет не должен расшифровываться для другого пользователя")
+	}
+	other := requestinfo.WithInfo(context.Background(), requestinfo.Info{TenantID: "other"})
+	if _, err := s.decrypt(other, 42, encrypted); err == nil {
+		t.Errorf("Секрет не должен расшифровываться для другого арендатора")
+	}
+
+	if _, err := NewMFAService(nil, nil, config.AuthConfig{}); err != nil {
+		t.Errorf("Без ключа шифрования сервис должен создаваться выключенным: %v", err)
+	}
+	disabled, _ := NewMFAService(nil, nil, config.AuthConfig{})
+	if _, err := disabled.Enroll(ctx, 42); !errors.Is(err, ErrMFADisabled) {
+		t.Errorf("Ожидалась ошибка %v, получено %v", ErrMFADisabled, err)
+	}
+}
+
+// TestRecoveryCodes проверяет формат кодов восстановления и нормализацию кода перед хэшированием
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		t.Fatalf("Ошибка генерации кодов: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("Ожидалось %d кодов, получено %d", recoveryCodeCount, len(codes))
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}$`)
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("Неожиданный формат кода: %s", code)
+		}
+		if seen[code] {
+			t.Errorf("Код повторяется: %s", code)
+		}
+		seen[code] = true
+
+		if hashRecoveryCode(code) != hashes[i] {
+			t.Errorf("Хэш кода %s не совпадает с сохраненным", code)
+		}
+		entered := " " + strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "
+		if hashRecoveryCode(entered) != hashes[i] {
+			t.Errorf("Хэш кода без дефиса в верхнем регистре должен совпадать с сохраненным: %s", entered)
+		}
+	}
+}
+
+// TestMFAToken проверяет токен второго шага входа: назначение, арендатора и срок действия
+func TestMFAToken(t *testing.T) {
+	svc := NewAuthService(nil, nil, nil, config.AuthConfig{JWTSecret: "secret"}, "org", nil)
+	now := time.Now().Truncate(time.Second)
+	svc.now = func() time.Time { return now }
+	user := &model.User{ID: 42, TenantID: "acme", Email: "a@example.com", Role: model.UserRoleAdmin}
+	ctx := requestinfo.WithInfo(context.Background(), requestinfo.Info{TenantID: "acme"})
+
+	token, err := svc.issueMFAToken(user, now)
+	if err != nil {
+		t.Fatalf("Ошибка выдачи токена: %v", err)
+	}
+	if !token.MFARequired || token.AccessToken != "" || token.ExpiresIn != int(defaultMFATokenTTL/time.Second) {
+		t.Errorf("Неожиданный ответ первого шага входа: %+v", token)
+	}
+
+	if id, err := svc.parseMFAToken(ctx, token.MFAToken); err != nil || id != 42 {
+		t.Errorf("Ожидался пользователь 42, получено %d, %v", id, err)
+	}
+	other := requestinfo.WithInfo(context.Background(), requestinfo.Info{TenantID: "other"})
+	if _, err := svc.parseMFAToken(other, token.MFAToken); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("Токен другого арендатора: ожидалась ошибка %v, получено %v", ErrInvalidMFAToken, err)
+	}
+
+	access, err := svc.issueToken(user, now)
+	if err != nil {
+		t.Fatalf("Ошибка выдачи токена: %v", err)
+	}
+	if _, err := svc.parseMFAToken(ctx, access.AccessToken); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("Токен доступа не должен приниматься как токен второго шага: %v", err)
+	}
+
+	svc.now = func() time.Time { return now.Add(defaultMFATokenTTL + time.Second) }
+	if _, err := svc.parseMFAToken(ctx, token.MFAToken); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("Истекший токен: ожидалась ошибка %v, получено %v", ErrInvalidMFAToken, err)
+	}
+}
@@ -0,0 +1,671 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+	"github.com/janson/usermicroservice/internal/tenant"
+)
+
+// Параметры провайдера OpenID Connect, если они не заданы в конфигурации
+const (
+	defaultOIDCKeyRotation = 30 * 24 * time.Hour // Интервал смены ключа подписи
+	defaultOIDCCodeTTL     = time.Minute         // Срок действия кода авторизации
+	defaultOIDCTokenTTL    = time.Hour           // Срок действия токена доступа и ID-токена
+)
+
+// Ограничения регистрации клиентов
+const (
+	maxOIDCClientNameLength = 100 // Максимальная длина названия клиента
+	maxOIDCRedirectURIs     = 10  // Максимальное число адресов возврата
+)
+
+// Ограничения параметров запроса авторизации
+const (
+	maxOIDCStateLength = 512 // Максимальная длина state и nonce
+	minPKCELength      = 43  // Минимальная длина code_verifier и code_challenge (RFC 7636)
+	maxPKCELength      = 128 // Максимальная длина code_verifier и code_challenge (RFC 7636)
+)
+
+// Области OpenID Connect
+const (
+	oidcScopeOpenID  = "openid"  // Обязательная область входа
+	oidcScopeProfile = "profile" // Имя, язык, часовой пояс, аватар
+	oidcScopeEmail   = "email"   // Электронная почта
+	oidcScopePhone   = "phone"   // Телефон
+)
+
+// oidcScopes - поддерживаемые области в порядке выдачи
+var oidcScopes = []string{oidcScopeOpenID, oidcScopeProfile, oidcScopeEmail, oidcScopePhone}
+
+// Ошибки провайдера OpenID Connect
+var (
+	ErrOIDCDisabled         = errors.New("oidc provider is not configured")       // Провайдер выключен (не задан oidc.issuer)
+	ErrOIDCClientNotFound   = errors.New("oidc client not found")                 // Клиент не найден
+	ErrInvalidRedirectURI   = errors.New("redirect uri is not registered")        // Адрес возврата не зарегистрирован у клиента
+	ErrInvalidClient        = errors.New("invalid client credentials")            // Неверный идентификатор или секрет клиента
+	ErrInvalidGrant         = errors.New("invalid or expired authorization code") // Код авторизации неверный, истек или уже использован
+	ErrUnsupportedGrantType = errors.New("unsupported grant type")                // Тип гранта не поддерживается
+	ErrInvalidAccessToken   = errors.New("invalid or expired access token")       // Токен доступа неверный или истек
+)
+
+// OIDCAuthorizationError - ошибка запроса авторизации, о которой сообщается клиенту через адрес возврата (RFC 6749, 4.1.2.1)
+type OIDCAuthorizationError struct {
+	Code        string // Код ошибки (invalid_request, unsupported_response_type, invalid_scope)
+	Description string // Описание ошибки для разработчика клиента
+}
+
+// Error возвращает текст ошибки
+func (e *OIDCAuthorizationError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// oidcMetrics - счетчики провайдера OpenID Connect, публикуемые через expvar (/debug/vars)
+var oidcMetrics = expvar.NewMap("oidc")
+
+// OIDCService реализует минимальный провайдер OpenID Connect поверх входа по паролю:
+// поток кода авторизации с обязательным PKCE (S256), выдачу ID-токенов, подписанных RS256,
+// и конечную точку userinfo
+// Идентификатор клиента содержит арендатора, поэтому публичные конечные точки не требуют заголовка арендатора
+type OIDCService struct {
+	repo        *postgres.OIDCRepository // Репозиторий клиентов и кодов авторизации
+	users       *UserService             // Сервис пользователей
+	auth        *AuthService             // Сервис входа по паролю
+	keys        *oidcKeySet              // Ключи подписи токенов (nil - провайдер выключен)
+	issuer      string                   // Идентификатор издателя токенов
+	tenantClaim string                   // Утверждение токена с ID арендатора
+	codeTTL     time.Duration            // Срок действия кода авторизации
+	tokenTTL    time.Duration            // Срок действия токенов
+	now         func() time.Time         // Текущее время (подменяется в тестах)
+}
+
+// NewOIDCService создает новый сервис провайдера OpenID Connect
+// Если oidc.issuer не задан, провайдер выключен и методы возвращают ErrOIDCDisabled
+// repo - репозиторий клиентов, кодов авторизации и ключей подписи
+// users - сервис пользователей
+// auth - сервис входа по паролю
+// cfg - настройки провайдера
+// tenantClaim - утверждение токена с ID арендатора (пусто - tenant_id)
+// logger - логгер для записи смены ключей
+func NewOIDCService(repo *postgres.OIDCRepository, users *UserService, auth *AuthService, cfg config.OIDCConfig,
+	tenantClaim string, logger *log.Logger) (*OIDCService, error) {
+	rotation := cfg.KeyRotation.Duration
+	if rotation <= 0 {
+		rotation = defaultOIDCKeyRotation
+	}
+	codeTTL := cfg.CodeTTL.Duration
+	if codeTTL <= 0 {
+		codeTTL = defaultOIDCCodeTTL
+	}
+	tokenTTL := cfg.TokenTTL.Duration
+	if tokenTTL <= 0 {
+		tokenTTL = defaultOIDCTokenTTL
+	}
+	if tenantClaim == "" {
+		tenantClaim = tenant.DefaultClaim
+	}
+
+	s := &OIDCService{
+		repo:        repo,
+		users:       users,
+		auth:        auth,
+		issuer:      cfg.Issuer,
+		tenantClaim: tenantClaim,
+		codeTTL:     codeTTL,
+		tokenTTL:    tokenTTL,
+		now:         time.Now,
+	}
+	if cfg.Issuer != "" {
+		aead, err := newAEAD(cfg.KeyEncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("ключ шифрования ключей подписи: %w", err)
+		}
+		s.keys = newOIDCKeySet(repo, aead, rotation, tokenTTL, logger)
+	}
+
+	return s, nil
+}
+
+// Enabled сообщает, что провайдер включен
+func (s *OIDCService) Enabled() bool {
+	return s.keys != nil
+}
+
+// Run создает и меняет ключи подписи до отмены контекста
+// ctx - контекст, отмена которого останавливает смену ключей
+func (s *OIDCService) Run(ctx context.Context) {
+	if s.keys != nil {
+		s.keys.run(ctx)
+	}
+}
+
+// Discovery возвращает документ обнаружения провайдера
+func (s *OIDCService) Discovery() (*model.OIDCDiscovery, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+
+	return &model.OIDCDiscovery{
+		Issuer:                            s.issuer,
+		AuthorizationEndpoint:             s.issuer + "/oauth2/authorize",
+		TokenEndpoint:                     s.issuer + "/oauth2/token",
+		UserinfoEndpoint:                  s.issuer + "/oauth2/userinfo",
+		JWKSURI:                           s.issuer + "/oauth2/jwks",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwt.SigningMethodRS256.Alg()},
+		ScopesSupported:                   oidcScopes,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", s.tenantClaim,
+			"name", "locale", "zoneinfo", "picture", "updated_at", "email", "email_verified", "phone_number"},
+	}, nil
+}
+
+// JWKS возвращает открытые ключи, которыми могут быть подписаны действующие токены
+// ctx - контекст операции
+func (s *OIDCService) JWKS(ctx context.Context) (*model.JWKSet, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	return s.keys.jwks(ctx)
+}
+
+// CreateClient регистрирует клиента в арендаторе из контекста
+// Конфиденциальный клиент получает секрет, который возвращается только в ответе на регистрацию
+// ctx - контекст операции
+// create - название, адреса возврата и тип клиента
+func (s *OIDCService) CreateClient(ctx context.Context, create model.OIDCClientCreate) (*model.OIDCClientCreated, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	name := strings.TrimSpace(create.Name)
+	if name == "" || len([]rune(name)) > maxOIDCClientNameLength {
+		return nil, ErrInvalidInput
+	}
+	redirectURIs, ok := normalizeRedirectURIs(create.RedirectURIs)
+	if !ok {
+		return nil, ErrInvalidInput
+	}
+
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	clientID := requestinfo.FromContext(ctx).Tenant() + "." + recoveryEncoding.EncodeToString(buf)
+
+	secret, secretHash := "", ""
+	if create.Confidential {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		secret = base64.RawURLEncoding.EncodeToString(buf)
+		secretHash = hashToken(secret)
+	}
+
+	client, err := s.repo.CreateClient(ctx, model.OIDCClient{
+		ClientID:     clientID,
+		Name:         name,
+		RedirectURIs: redirectURIs,
+	}, secretHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.OIDCClientCreated{OIDCClient: *client, ClientSecret: secret}, nil
+}
+
+// ListClients возвращает страницу клиентов арендатора и их общее количество
+// ctx - контекст операции
+// limit - максимальное количество клиентов
+// offset - смещение
+func (s *OIDCService) ListClients(ctx context.Context, limit, offset int) ([]model.OIDCClient, int, error) {
+	return s.repo.ListClients(ctx, limit, offset)
+}
+
+// DeleteClient удаляет регистрацию клиента вместе с выданными ему кодами авторизации
+// Выданные токены действуют до истечения срока
+// ctx - контекст операции
+// id - ID регистрации
+func (s *OIDCService) DeleteClient(ctx context.Context, id int64) error {
+	deleted, err := s.repo.DeleteClient(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrOIDCClientNotFound
+	}
+	return nil
+}
+
+// CheckAuthorization проверяет запрос авторизации до показа страницы входа и возвращает клиента
+// Возвращает ErrOIDCClientNotFound или ErrInvalidRedirectURI, если перенаправлять пользователя нельзя,
+// и OIDCAuthorizationError для ошибок, о которых сообщается клиенту через адрес возврата (см. ErrorRedirect)
+// ctx - контекст операции
+// req - параметры запроса авторизации
+func (s *OIDCService) CheckAuthorization(ctx context.Context, req model.OIDCAuthorizationRequest) (*model.OIDCClient, error) {
+	_, client, err := s.checkAuthorization(ctx, req)
+	return client, err
+}
+
+// Authorize выполняет вход пользователя по запросу авторизации и возвращает адрес возврата с кодом авторизации
+// Если у пользователя включена двухфакторная аутентификация, вместо адреса возвращается токен второго шага:
+// страница входа запрашивает код и повторяет вызов с mfa
+// Ошибки входа те же, что у AuthService.Login и AuthService.LoginMFA, ошибки запроса - как у CheckAuthorization
+// ctx - контекст операции
+// req - параметры запроса авторизации
+// login - электронная почта и пароль (первый шаг)
+// mfa - токен первого шага и код (второй шаг; пустой токен - первый шаг)
+func (s *OIDCService) Authorize(ctx context.Context, req model.OIDCAuthorizationRequest, login model.LoginRequest,
+	mfa model.MFALoginRequest) (string, *model.LoginToken, error) {
+	ctx, _, err := s.checkAuthorization(ctx, req)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var user *model.User
+	if mfa.MFAToken != "" {
+		user, err = s.auth.AuthenticateMFA(ctx, mfa)
+	} else {
+		var challenge *model.LoginToken
+		user, challenge, err = s.auth.Authenticate(ctx, login)
+		if challenge != nil {
+			return "", challenge, nil
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	code := base64.RawURLEncoding.EncodeToString(buf)
+	now := s.now()
+	err = s.repo.CreateCode(ctx, model.OIDCAuthorizationCode{
+		ClientID:      req.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         grantedScope(req.Scope),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(s.codeTTL),
+	}, hashToken(code))
+	if err != nil {
+		return "", nil, err
+	}
+	oidcMetrics.Add("authorizations", 1)
+
+	params := url.Values{}
+	params.Set("code", code)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	params.Set("iss", s.issuer)
+	return withQuery(req.RedirectURI, params), nil, nil
+}
+
+// ErrorRedirect возвращает адрес возврата с ошибкой запроса авторизации
+// req - параметры запроса авторизации, прошедшего проверку клиента и адреса возврата
+// authErr - ошибка запроса
+func (s *OIDCService) ErrorRedirect(req model.OIDCAuthorizationRequest, authErr *OIDCAuthorizationError) string {
+	params := url.Values{}
+	params.Set("error", authErr.Code)
+	params.Set("error_description", authErr.Description)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	params.Set("iss", s.issuer)
+	return withQuery(req.RedirectURI, params)
+}
+
+// checkAuthorization проверяет запрос авторизации и возвращает контекст с арендатором клиента
+func (s *OIDCService) checkAuthorization(ctx context.Context,
+	req model.OIDCAuthorizationRequest) (context.Context, *model.OIDCClient, error) {
+	if !s.Enabled() {
+		return nil, nil, ErrOIDCDisabled
+	}
+	ctx, client, _, err := s.client(ctx, req.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, nil, ErrInvalidRedirectURI
+	}
+
+	switch {
+	case req.ResponseType != "code":
+		return nil, nil, &OIDCAuthorizationError{Code: "unsupported_response_type",
+			Description: "поддерживается только response_type=code"}
+	case !contains(strings.Fields(req.Scope), oidcScopeOpenID):
+		return nil, nil, &OIDCAuthorizationError{Code: "invalid_scope", Description: "требуется область openid"}
+	case req.CodeChallengeMethod != "S256" || !validPKCE(req.CodeChallenge):
+		return nil, nil, &OIDCAuthorizationError{Code: "invalid_request",
+			Description: "требуется PKCE: code_challenge с code_challenge_method=S256"}
+	case len(req.State) > maxOIDCStateLength || len(req.Nonce) > maxOIDCStateLength:
+		return nil, nil, &OIDCAuthorizationError{Code: "invalid_request", Description: "слишком длинный state или nonce"}
+	}
+
+	return ctx, client, nil
+}
+
+// client находит клиента по идентификатору и возвращает контекст с его арендатором и хэш секрета
+func (s *OIDCService) client(ctx context.Context, clientID string) (context.Context, *model.OIDCClient, string, error) {
+	tenantID, ok := oidcClientTenant(clientID)
+	if !ok {
+		return nil, nil, "", ErrOIDCClientNotFound
+	}
+	info := requestinfo.FromContext(ctx)
+	info.TenantID = tenantID
+	ctx = requestinfo.WithInfo(ctx, info)
+
+	client, secretHash, err := s.repo.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if client == nil {
+		return nil, nil, "", ErrOIDCClientNotFound
+	}
+	return ctx, client, secretHash, nil
+}
+
+// Exchange обменивает код авторизации на токен доступа и ID-токен
+// Код одноразовый: он удаляется при первом обмене, даже если обмен не удался
+// Возвращает ErrInvalidClient при неверном клиенте или секрете, ErrInvalidGrant при неверном, истекшем
+// или чужом коде, неверном code_verifier и для неактивного пользователя
+// ctx - контекст операции
+// req - параметры обмена
+func (s *OIDCService) Exchange(ctx context.Context, req model.OIDCTokenRequest) (*model.OIDCTokenResponse, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	if req.GrantType != "authorization_code" {
+		return nil, ErrUnsupportedGrantType
+	}
+	if req.Code == "" || req.ClientID == "" {
+		return nil, ErrInvalidInput
+	}
+
+	ctx, client, secretHash, err := s.client(ctx, req.ClientID)
+	if errors.Is(err, ErrOIDCClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if client.Confidential &&
+		subtle.ConstantTimeCompare([]byte(hashToken(req.ClientSecret)), []byte(secretHash)) != 1 {
+		oidcMetrics.Add("token_failures", 1)
+		return nil, ErrInvalidClient
+	}
+
+	code, err := s.repo.ConsumeCode(ctx, hashToken(req.Code))
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if code == nil || code.ClientID != client.ClientID || !code.ExpiresAt.After(now) ||
+		code.RedirectURI != req.RedirectURI || !verifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		oidcMetrics.Add("token_failures", 1)
+		return nil, ErrInvalidGrant
+	}
+
+	user, err := s.users.repo.GetByID(ctx, code.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.CanLogin() {
+		oidcMetrics.Add("token_failures", 1)
+		return nil, ErrInvalidGrant
+	}
+
+	response, err := s.issueTokens(ctx, user, client.ClientID, code, now)
+	if err != nil {
+		return nil, err
+	}
+	oidcMetrics.Add("tokens", 1)
+	return response, nil
+}
+
+// issueTokens подписывает токен доступа и ID-токен самым новым ключом
+func (s *OIDCService) issueTokens(ctx context.Context, user *model.User, clientID string,
+	code *model.OIDCAuthorizationCode, now time.Time) (*model.OIDCTokenResponse, error) {
+	key, err := s.keys.signing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sign := func(claims jwt.MapClaims) (string, error) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = key.kid
+		return token.SignedString(key.key)
+	}
+	subject := strconv.FormatInt(user.ID, 10)
+	exp := jwt.NewNumericDate(now.Add(s.tokenTTL))
+
+	accessToken, err := sign(jwt.MapClaims{
+		"iss":         s.issuer,
+		"sub":         subject,
+		"aud":         s.issuer + "/oauth2/userinfo",
+		"client_id":   clientID,
+		"scope":       code.Scope,
+		s.tenantClaim: user.TenantID,
+		"token_use":   tokenUseAccess,
+		"iat":         jwt.NewNumericDate(now),
+		"exp":         exp,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	idClaims := jwt.MapClaims{
+		"iss":         s.issuer,
+		"sub":         subject,
+		"aud":         clientID,
+		s.tenantClaim: user.TenantID,
+		"auth_time":   jwt.NewNumericDate(code.AuthTime),
+		"iat":         jwt.NewNumericDate(now),
+		"exp":         exp,
+	}
+	if code.Nonce != "" {
+		idClaims["nonce"] = code.Nonce
+	}
+	for name, value := range userClaims(user, code.Scope) {
+		idClaims[name] = value
+	}
+	idToken, err := sign(idClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.tokenTTL / time.Second),
+		IDToken:     idToken,
+		Scope:       code.Scope,
+	}, nil
+}
+
+// UserInfo проверяет токен доступа провайдера и возвращает утверждения о пользователе по выданным областям
+// Возвращает ErrInvalidAccessToken, если токен неверный, истек или пользователь больше не может входить
+// ctx - контекст операции
+// accessToken - токен доступа из ответа /oauth2/token
+func (s *OIDCService) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.keys.public(ctx, kid)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.issuer+"/oauth2/userinfo"), jwt.WithExpirationRequired(), jwt.WithTimeFunc(s.now))
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	tenantID, _ := claims[s.tenantClaim].(string)
+	subject, _ := claims["sub"].(string)
+	scope, _ := claims["scope"].(string)
+	userID, err := strconv.ParseInt(subject, 10, 64)
+	if use, _ := claims["token_use"].(string); err != nil || use != tokenUseAccess || !tenant.Valid(tenantID) {
+		return nil, ErrInvalidAccessToken
+	}
+	info := requestinfo.FromContext(ctx)
+	info.TenantID = tenantID
+	ctx = requestinfo.WithInfo(ctx, info)
+
+	user, err := s.users.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.CanLogin() {
+		return nil, ErrInvalidAccessToken
+	}
+
+	result := userClaims(user, scope)
+	result["sub"] = subject
+	result[s.tenantClaim] = tenantID
+	return result, nil
+}
+
+// userClaims возвращает утверждения о пользователе для выданных областей
+// Пустые поля профиля не включаются
+func userClaims(user *model.User, scope string) map[string]interface{} {
+	claims := map[string]interface{}{}
+	set := func(name, value string) {
+		if value != "" {
+			claims[name] = value
+		}
+	}
+	for _, s := range strings.Fields(scope) {
+		switch s {
+		case oidcScopeProfile:
+			name := user.DisplayName
+			if name == "" {
+				name = user.Name
+			}
+			set("name", name)
+			set("locale", user.Locale)
+			set("zoneinfo", user.Timezone)
+			set("picture", user.AvatarURL)
+			claims["updated_at"] = user.UpdatedAt.Unix()
+		case oidcScopeEmail:
+			claims["email"] = user.Email
+			claims["email_verified"] = user.EmailVerified
+		case oidcScopePhone:
+			set("phone_number", user.Phone)
+		}
+	}
+	return claims
+}
+
+// grantedScope оставляет в запрошенных областях только поддерживаемые, без повторов
+func grantedScope(scope string) string {
+	requested := strings.Fields(scope)
+	granted := make([]string, 0, len(oidcScopes))
+	for _, s := range oidcScopes {
+		if contains(requested, s) {
+			granted = append(granted, s)
+		}
+	}
+	return strings.Join(granted, " ")
+}
+
+// normalizeRedirectURIs проверяет адреса возврата и удаляет повторы
+// Адрес должен быть абсолютным URL http или https без фрагмента
+func normalizeRedirectURIs(uris []string) ([]string, bool) {
+	if len(uris) == 0 || len(uris) > maxOIDCRedirectURIs {
+		return nil, false
+	}
+	result := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Fragment != "" ||
+			strings.Contains(uri, "#") {
+			return nil, false
+		}
+		if !contains(result, uri) {
+			result = append(result, uri)
+		}
+	}
+	return result, true
+}
+
+// withQuery добавляет параметры к адресу, сохраняя его собственные параметры
+func withQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// validPKCE проверяет длину и алфавит code_verifier или code_challenge (RFC 7636, 4.1)
+func validPKCE(value string) bool {
+	if len(value) < minPKCELength || len(value) > maxPKCELength {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("-._~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyPKCE проверяет, что code_verifier соответствует code_challenge по методу S256
+func verifyPKCE(verifier, challenge string) bool {
+	if !validPKCE(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// oidcClientTenant извлекает арендатора из идентификатора клиента
+func oidcClientTenant(clientID string) (string, bool) {
+	tenantID, random, ok := strings.Cut(clientID, ".")
+	if !ok || random == "" || !tenant.Valid(tenantID) {
+		return "", false
+	}
+	return tenantID, true
+}
+
+// contains сообщает, что строка есть в списке
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// TestPKCE проверяет проверку code_verifier по методу S256
+func TestPKCE(t *testing.T) {
+	verifier := "Mx9~pL2.qR7-vT4_wZ8kN3jH6gF1dS5aB0cE9yU2iO7"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	if !validPKCE(challenge) || !verifyPKCE(verifier, challenge) {
+		t.Errorf("code_verifier должен соответствовать code_challenge")
+	}
+	if verifyPKCE(verifier+"x", challenge) {
+		t.Errorf("Другой code_verifier не должен проходить проверку")
+	}
+	if verifyPKCE("short", challenge) || validPKCE(strings.Repeat("a", 129)) || validPKCE(strings.Repeat("a", 42)+"!") {
+		t.Errorf("Значения недопустимой длины или с недопустимыми символами не должны проходить проверку")
+	}
+}
+
+// TestOIDCTokens проверяет, что ID-токен подписан ключом из JWKS и содержит утверждения выданных областей
+func TestOIDCTokens(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	s, err := NewOIDCService(nil, nil, nil, config.OIDCConfig{Issuer: "https://id.example.com", KeyEncryptionKey: key},
+		"", nil)
+	if err != nil {
+		t.Fatalf("Ошибка создания сервиса: %v", err)
+	}
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Ошибка создания ключа: %v", err)
+	}
+	now := time.Now()
+	s.keys.keys = []oidcSigningKey{{kid: "test", key: private, createdAt: now}}
+
+	user := &model.User{ID: 7, TenantID: "acme", Name: "Иван", Email: "ivan@example.com", EmailVerified: true,
+		Phone: "+79990000000"}
+	code := &model.OIDCAuthorizationCode{Scope: grantedScope("email openid unknown openid"), Nonce: "n-1", AuthTime: now}
+	if code.Scope != "openid email" {
+		t.Fatalf("Неожиданные выданные области: %q", code.Scope)
+	}
+	tokens, err := s.issueTokens(context.Background(), user, "acme.client", code, now)
+	if err != nil {
+		t.Fatalf("Ошибка выдачи токенов: %v", err)
+	}
+
+	jwks, err := s.JWKS(context.Background())
+	if err != nil || len(jwks.Keys) != 1 {
+		t.Fatalf("Неожиданный набор ключей: %+v, %v", jwks, err)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].E)
+	public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokens.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != jwks.Keys[0].Kid {
+			t.Errorf("Неожиданный kid: %v", token.Header["kid"])
+		}
+		return public, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer("https://id.example.com"), jwt.WithAudience("acme.client"))
+	if err != nil {
+		t.Fatalf("ID-токен не проходит проверку: %v", err)
+	}
+	if claims["sub"] != "7" || claims["nonce"] != "n-1" || claims["tenant_id"] != "acme" ||
+		claims["email"] != "ivan@example.com" || claims["email_verified"] != true {
+		t.Errorf("Неожиданные утверждения ID-токена: %v", claims)
+	}
+	if _, ok := claims["phone_number"]; ok {
+		t.Errorf("Утверждения невыданной области phone не должны попадать в ID-токен")
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+)
+
+// Параметры ключей подписи провайдера OpenID Connect
+const (
+	oidcKeyBits          = 2048            // Длина ключа RSA
+	oidcKeyCheckInterval = 5 * time.Minute // Интервал проверки необходимости смены ключа
+)
+
+// oidcSigningKey - расшифрованный ключ подписи
+type oidcSigningKey struct {
+	kid       string          // Идентификатор ключа
+	key       *rsa.PrivateKey // Закрытый ключ
+	createdAt time.Time       // Дата и время создания
+}
+
+// oidcKeySet хранит ключи подписи токенов провайдера OpenID Connect и меняет их
+// Ключи хранятся в базе данных в зашифрованном виде и общие для всех реплик: новый ключ создается,
+// когда самый новый ключ старше интервала смены, а замененный ключ удаляется после истечения
+// срока действия подписанных им токенов
+type oidcKeySet struct {
+	repo      *postgres.OIDCRepository // Репозиторий ключей подписи
+	aead      cipher.AEAD              // Шифр закрытых ключей в базе данных
+	rotation  time.Duration            // Интервал смены ключа
+	retention time.Duration            // Время хранения замененного ключа (срок действия токенов)
+	logger    *log.Logger              // Логгер для записи смены ключей
+	now       func() time.Time         // Текущее время (подменяется в тестах)
+
+	mu   sync.RWMutex     // Защищает keys
+	keys []oidcSigningKey // Загруженные ключи, начиная с самого старого
+}
+
+// newOIDCKeySet создает набор ключей подписи
+func newOIDCKeySet(repo *postgres.OIDCRepository, aead cipher.AEAD, rotation, retention time.Duration,
+	logger *log.Logger) *oidcKeySet {
+	return &oidcKeySet{
+		repo:      repo,
+		aead:      aead,
+		rotation:  rotation,
+		retention: retention,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// run периодически меняет ключи до отмены контекста
+func (k *oidcKeySet) run(ctx context.Context) {
+	ticker := time.NewTicker(oidcKeyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := k.rotate(ctx); err != nil && ctx.Err() == nil {
+			k.logger.Printf("Ошибка смены ключей подписи OpenID Connect: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rotate создает новый ключ, если действующий старше интервала смены, удаляет ключи,
+// которыми больше не подписаны действующие токены, и обновляет загруженные ключи
+func (k *oidcKeySet) rotate(ctx context.Context) error {
+	now := k.now()
+	stored, err := k.repo.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(stored) == 0 || !stored[len(stored)-1].CreatedAt.After(now.Add(-k.rotation)) {
+		key, err := k.generate(now)
+		if err != nil {
+			return err
+		}
+		// Другая реплика могла создать ключ одновременно; тогда ключ не сохраняется и берется ее ключ
+		created, err := k.repo.CreateSigningKey(ctx, key, now.Add(-k.rotation))
+		if err != nil {
+			return err
+		}
+		if created {
+			oidcMetrics.Add("key_rotations", 1)
+			k.logger.Printf("Создан ключ подписи OpenID Connect %s", key.KID)
+		}
+		if stored, err = k.repo.ListSigningKeys(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Ключ удаляется, если его заменил ключ, созданный раньше срока действия токенов назад
+	kept := stored[:0]
+	for i, key := range stored {
+		if i < len(stored)-1 && stored[i+1].CreatedAt.Add(k.retention).Before(now) {
+			if err := k.repo.DeleteSigningKey(ctx, key.KID); err != nil {
+				return err
+			}
+			k.logger.Printf("Удален ключ подписи OpenID Connect %s", key.KID)
+			continue
+		}
+		kept = append(kept, key)
+	}
+
+	return k.load(kept)
+}
+
+// reload перечитывает ключи из базы данных без их смены
+// Используется, если токен подписан ключом, созданным другой репликой
+func (k *oidcKeySet) reload(ctx context.Context) error {
+	stored, err := k.repo.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	return k.load(stored)
+}
+
+// load расшифровывает ключи и заменяет загруженные
+// Уже загруженные ключи повторно не расшифровываются
+func (k *oidcKeySet) load(stored []model.OIDCSigningKey) error {
+	k.mu.RLock()
+	loaded := make(map[string]oidcSigningKey, len(k.keys))
+	for _, key := range k.keys {
+		loaded[key.kid] = key
+	}
+	k.mu.RUnlock()
+
+	keys := make([]oidcSigningKey, 0, len(stored))
+	for _, s := range stored {
+		if key, ok := loaded[s.KID]; ok {
+			keys = append(keys, key)
+			continue
+		}
+		der, err := open(k.aead, s.PrivateKeyEncrypted, []byte(s.KID))
+		if err != nil {
+			return fmt.Errorf("ключ подписи %s: %w", s.KID, err)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return fmt.Errorf("ключ подписи %s: %w", s.KID, err)
+		}
+		private, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("ключ подписи %s: ожидался ключ RSA", s.KID)
+		}
+		keys = append(keys, oidcSigningKey{kid: s.KID, key: private, createdAt: s.CreatedAt})
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// generate создает новый ключ RSA и шифрует его для хранения
+func (k *oidcKeySet) generate(now time.Time) (model.OIDCSigningKey, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return model.OIDCSigningKey{}, err
+	}
+	kid := hex.EncodeToString(buf)
+
+	private, err := rsa.GenerateKey(rand.Reader, oidcKeyBits)
+	if err != nil {
+		return model.OIDCSigningKey{}, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return model.OIDCSigningKey{}, err
+	}
+	// Идентификатор ключа участвует в шифровании, чтобы зашифрованный ключ нельзя было выдать за другой
+	encrypted, err := seal(k.aead, der, []byte(kid))
+	if err != nil {
+		return model.OIDCSigningKey{}, err
+	}
+
+	return model.OIDCSigningKey{KID: kid, PrivateKeyEncrypted: encrypted, CreatedAt: now}, nil
+}
+
+// signing возвращает самый новый ключ для подписи токенов
+// Если ключи еще не загружены, они загружаются и при необходимости создаются
+func (k *oidcKeySet) signing(ctx context.Context) (oidcSigningKey, error) {
+	k.mu.RLock()
+	n := len(k.keys)
+	k.mu.RUnlock()
+	if n == 0 {
+		if err := k.rotate(ctx); err != nil {
+			return oidcSigningKey{}, err
+		}
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.keys) == 0 {
+		return oidcSigningKey{}, errors.New("нет ключей подписи OpenID Connect")
+	}
+	return k.keys[len(k.keys)-1], nil
+}
+
+// public возвращает открытый ключ по идентификатору
+// Неизвестный ключ мог быть создан другой репликой, поэтому ключи перечитываются один раз
+func (k *oidcKeySet) public(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if key := k.find(kid); key != nil {
+		return key, nil
+	}
+	if err := k.reload(ctx); err != nil {
+		return nil, err
+	}
+	if key := k.find(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("неизвестный ключ подписи %q", kid)
+}
+
+// find ищет открытый ключ среди загруженных
+func (k *oidcKeySet) find(kid string) *rsa.PublicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.kid == kid {
+			return &key.key.PublicKey
+		}
+	}
+	return nil
+}
+
+// jwks возвращает открытые ключи в формате JSON Web Key Set
+func (k *oidcKeySet) jwks(ctx context.Context) (*model.JWKSet, error) {
+	if _, err := k.signing(ctx); err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	set := &model.JWKSet{Keys: make([]model.JWK, 0, len(k.keys))}
+	for _, key := range k.keys {
+		set.Keys = append(set.Keys, model.JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: key.kid,
+			N:   base64.RawURLEncoding.EncodeToString(key.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.key.E)).Bytes()),
+		})
+	}
+	return set, nil
+}
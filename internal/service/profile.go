@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"time"
+	_ "time/tzdata" // База часовых поясов для проверки timezone в образах без tzdata
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// Ограничения полей профиля и метаданных пользователя
+const (
+	maxDisplayNameLength = 100  // Максимальная длина отображаемого имени в символах
+	maxLocaleLength      = 35   // Максимальная длина тега языка
+	maxTimezoneLength    = 64   // Максимальная длина имени часового пояса
+	maxAvatarURLLength   = 2048 // Максимальная длина URL аватара
+	maxMetadataKeys      = 50   // Максимальное количество ключей метаданных
+	maxMetadataSize      = 8192 // Максимальный размер метаданных в формате JSON, байт
+)
+
+var (
+	// phonePattern - номер телефона в формате E.164: "+", код страны и не более 15 цифр
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	// metadataKeyPattern - допустимые ключи метаданных
+	metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// validUserCreate проверяет поля профиля, метаданные, роль и начальное состояние нового пользователя
+// Язык приводится к каноническому тегу BCP 47, пустая роль заменяется ролью member, пустое состояние - active
+// Новый пользователь может быть только ожидающим активации или активным
+func validUserCreate(user *model.UserCreate) bool {
+	if user.Role == "" {
+		user.Role = model.UserRoleMember
+	}
+	if !model.ValidUserRole(user.Role) {
+		return false
+	}
+	if user.Status == "" {
+		user.Status = model.UserStatusActive
+	}
+	if user.Status != model.UserStatusPending && user.Status != model.UserStatusActive {
+		return false
+	}
+
+	locale, ok := normalizeLocale(user.Locale)
+	if !ok {
+		return false
+	}
+	user.Locale = locale
+
+	return validDisplayName(user.DisplayName) && validPhone(user.Phone) && validTimezone(user.Timezone) &&
+		validAvatarURL(user.AvatarURL) && validMetadata(user.Metadata)
+}
+
+// validUserUpdate проверяет переданные поля профиля, метаданные и роль обновления
+// Пустые строки допустимы и очищают поле
+func validUserUpdate(user *model.UserUpdate) bool {
+	if user.Role != "" && !model.ValidUserRole(user.Role) {
+		return false
+	}
+
+	if user.Locale != nil {
+		locale, ok := normalizeLocale(*user.Locale)
+		if !ok {
+			return false
+		}
+		user.Locale = &locale
+	}
+
+	return (user.DisplayName == nil || validDisplayName(*user.DisplayName)) &&
+		(user.Phone == nil || validPhone(*user.Phone)) &&
+		(user.Timezone == nil || validTimezone(*user.Timezone)) &&
+		(user.AvatarURL == nil || validAvatarURL(*user.AvatarURL)) &&
+		validMetadata(user.Metadata)
+}
+
+// validDisplayName проверяет длину отображаемого имени
+func validDisplayName(name string) bool {
+	return utf8.RuneCountInString(name) <= maxDisplayNameLength
+}
+
+// validPhone проверяет, что телефон пуст или записан в формате E.164
+func validPhone(phone string) bool {
+	return phone == "" || phonePattern.MatchString(phone)
+}
+
+// normalizeLocale разбирает тег языка BCP 47 и возвращает его каноническую запись
+// Пустая строка возвращается без изменений
+func normalizeLocale(locale string) (string, bool) {
+	if locale == "" {
+		return "", true
+	}
+	tag, err := language.Parse(locale)
+	if err != nil || len(tag.String()) > maxLocaleLength {
+		return "", false
+	}
+	return tag.String(), true
+}
+
+// validTimezone проверяет, что строка пуста или является именем часового пояса из базы IANA
+func validTimezone(name string) bool {
+	if name == "" {
+		return true
+	}
+	// "Local" принимается LoadLocation, но зависит от настроек сервера
+	if name == "Local" || len(name) > maxTimezoneLength {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// validAvatarURL проверяет, что URL аватара пуст или абсолютный с протоколом http или https
+func validAvatarURL(raw string) bool {
+	if raw == "" {
+		return true
+	}
+	if len(raw) > maxAvatarURLLength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validMetadata проверяет количество и имена ключей метаданных и их размер в формате JSON
+func validMetadata(metadata map[string]interface{}) bool {
+	if len(metadata) > maxMetadataKeys {
+		return false
+	}
+	for key := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return false
+		}
+	}
+	data, err := json.Marshal(metadata)
+	return err == nil && len(data) <= maxMetadataSize
+}
+
+// validUserFilter проверяет порядок сортировки, состояние и ключи метаданных фильтра списка
+func validUserFilter(filter model.UserFilter) bool {
+	if filter.Limit < 0 || filter.Offset < 0 {
+		return false
+	}
+	if filter.Status != "" && !model.ValidUserStatus(filter.Status) {
+		return false
+	}
+	switch filter.Sort {
+	case "", model.UserSortID, model.UserSortUpdatedAt:
+	default:
+		return false
+	}
+	for key := range filter.Metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return false
+		}
+	}
+	for _, key := range filter.MetadataKeys {
+		if !metadataKeyPattern.MatchString(key) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/janson/usermicroservice/internal/model"
+)
+
+// TestValidUserCreate проверяет валидацию полей профиля и метаданных нового пользователя
+func TestValidUserCreate(t *testing.T) {
+	tests := []struct {
+		name string
+		user model.UserCreate
+		want bool
+	}{
+		{"только обязательные поля", model.UserCreate{}, true},
+		{"полный профиль", model.UserCreate{
+			DisplayName: "Иван",
+			Phone:       "+79991234567",
+			Locale:      "ru-RU",
+			Timezone:    "Europe/Moscow",
+			AvatarURL:   "https://example.com/avatar.png",
+			Metadata:    map[string]interface{}{"department": "sales", "level": 3},
+		}, true},
+		{"телефон без +", model.UserCreate{Phone: "79991234567"}, false},
+		{"слишком длинный телефон", model.UserCreate{Phone: "+1234567890123456"}, false},
+		{"некорректный язык", model.UserCreate{Locale: "not a locale"}, false},
+		{"неизвестный часовой пояс", model.UserCreate{Timezone: "Mars/Olympus"}, false},
+		{"часовой пояс Local", model.UserCreate{Timezone: "Local"}, false},
+		{"относительный URL аватара", model.UserCreate{AvatarURL: "/avatar.png"}, false},
+		{"URL аватара с другой схемой", model.UserCreate{AvatarURL: "ftp://example.com/a.png"}, false},
+		{"некорректный ключ метаданных", model.UserCreate{Metadata: map[string]interface{}{"a b": 1}}, false},
+		{"роль администратора", model.UserCreate{Role: model.UserRoleAdmin}, true},
+		{"неизвестная роль", model.UserCreate{Role: "owner"}, false},
+		{"ожидает активации", model.UserCreate{Status: model.UserStatusPending}, true},
+		{"создание приостановленным", model.UserCreate{Status: model.UserStatusSuspended}, false},
+		{"слишком большие метаданные", model.UserCreate{
+			Metadata: map[string]interface{}{"blob": strings.Repeat("x", maxMetadataSize)},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			if got := validUserCreate(&user); got != tt.want {
+				t.Errorf("validUserCreate() = %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidUserUpdateNormalizesLocale проверяет приведение языка к канонической записи и очистку полей пустой строкой
+func TestValidUserUpdateNormalizesLocale(t *testing.T) {
+	locale := "EN_us"
+	update := model.UserUpdate{Locale: &locale}
+	if !validUserUpdate(&update) {
+		t.Fatalf("Корректный тег отклонен")
+	}
+	if *update.Locale != "en-US" {
+		t.Errorf("Ожидался канонический тег en-US, получено %q", *update.Locale)
+	}
+
+	empty := ""
+	update = model.UserUpdate{Phone: &empty, Timezone: &empty, AvatarURL: &empty}
+	if !validUserUpdate(&update) {
+		t.Errorf("Пустые строки должны очищать поля профиля")
+	}
+}
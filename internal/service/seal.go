@@ -0,0 +1,47 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// newAEAD создает шифр AES-256-GCM из ключа в Base64
+// Используется для секретов, которые хранятся в базе данных зашифрованными (секреты TOTP, ключи подписи)
+func newAEAD(encodedKey string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal шифрует данные; результат - случайный nonce, за которым следует шифротекст
+// additionalData привязывает шифротекст к владельцу: расшифровать его можно только с теми же данными
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open расшифровывает данные, зашифрованные seal
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	size := aead.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.New("зашифрованные данные повреждены")
+	}
+	plaintext, err := aead.Open(nil, sealed[:size], sealed[size:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("расшифровка: %w", err)
+	}
+	return plaintext, nil
+}
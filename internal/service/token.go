@@ -0,0 +1,14 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// hashToken возвращает SHA-256 токена в шестнадцатеричном виде для хранения и поиска в базе данных
+// Ключи API, приглашения, параметры state, секреты клиентов и коды авторизации содержат 256 случайных бит,
+// поэтому перебор невозможен и медленный хэш с солью не нужен: одинаковый токен всегда дает одинаковый хэш
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
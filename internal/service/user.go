@@ -3,31 +3,49 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository"
 	"github.com/janson/usermicroservice/internal/repository/postgres"
 )
 
 // UserService обрабатывает бизнес-логику, связанную с пользователями
 // Этот слой служит промежуточным звеном между обработчиками HTTP и репозиторием данных
 type UserService struct {
-	repo *postgres.UserRepository // Репозиторий для доступа к данным пользователей
+	repo   repository.UserRepository  // Репозиторий для доступа к данным пользователей
+	audit  repository.AuditRepository // Репозиторий журнала аудита изменений
+	groups *postgres.GroupRepository  // Репозиторий групп для удаления участия удаляемых пользователей
+	tx     repository.Transactor      // Менеджер транзакций для атомарных операций
 }
 
 // NewUserService создает новый сервис пользователей
 // repo - репозиторий пользователей для работы с данными
-func NewUserService(repo *postgres.UserRepository) *UserService {
+// audit - репозиторий журнала аудита
+// groups - репозиторий групп
+// tx - менеджер транзакций
+func NewUserService(repo repository.UserRepository, audit repository.AuditRepository, groups *postgres.GroupRepository,
+	tx repository.Transactor) *UserService {
 	return &UserService{
-		repo: repo,
+		repo:   repo,
+		audit:  audit,
+		groups: groups,
+		tx:     tx,
 	}
 }
 
 // Определение стандартных ошибок для сервиса пользователей
 var (
-	ErrUserNotFound = errors.New("user not found")     // Пользователь не найден
-	ErrInvalidInput = errors.New("invalid input data") // Некорректные входные данные
+	ErrUserNotFound            = errors.New("user not found")                        // Пользователь не найден
+	ErrInvalidInput            = errors.New("invalid input data")                    // Некорректные входные данные
+	ErrEmailTaken              = errors.New("email is already in use")               // Электронная почта уже используется у арендатора
+	ErrInvalidStatusTransition = errors.New("user status transition is not allowed") // Недопустимый переход состояния учетной записи
 )
 
+// maxStatusReasonLength - максимальная длина причины изменения состояния учетной записи в символах
+const maxStatusReasonLength = 500
+
 // Create создает нового пользователя
 // ctx - контекст операции
 // user - данные для создания пользователя
@@ -36,9 +54,25 @@ func (s *UserService) Create(ctx context.Context, user model.UserCreate) (*model
 	if user.Name == "" || user.Email == "" {
 		return nil, ErrInvalidInput
 	}
+	if !validUserCreate(&user) {
+		return nil, ErrInvalidInput
+	}
 
 	// Делегирование операции создания репозиторию
-	return s.repo.Create(ctx, user)
+	var created *model.User
+	err := s.tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = s.repo.Create(ctx, user)
+		return err
+	})
+	if errors.Is(err, postgres.ErrDuplicate) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
 }
 
 // GetByID получает пользователя по ID
@@ -58,11 +92,41 @@ func (s *UserService) GetByID(ctx context.Context, id int64) (*model.User, error
 	return user, nil
 }
 
-// GetAll получает всех пользователей
+// GetByEmail получает пользователя по электронной почте
+// ctx - контекст операции
+// email - электронная почта пользователя
+func (s *UserService) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// GetAll получает страницу пользователей и общее количество пользователей
 // ctx - контекст операции
-func (s *UserService) GetAll(ctx context.Context) ([]model.User, error) {
-	// Простая передача вызова к репозиторию
-	return s.repo.GetAll(ctx)
+// filter - параметры выборки
+func (s *UserService) GetAll(ctx context.Context, filter model.UserFilter) ([]model.User, int, error) {
+	if !validUserFilter(filter) {
+		return nil, 0, ErrInvalidInput
+	}
+
+	users, err := s.repo.GetAll(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
 }
 
 // Update обновляет информацию о пользователе
@@ -71,11 +135,22 @@ func (s *UserService) GetAll(ctx context.Context) ([]model.User, error) {
 // user - данные для обновления
 func (s *UserService) Update(ctx context.Context, id int64, user model.UserUpdate) (*model.User, error) {
 	// Должно быть обновлено хотя бы одно поле
-	if user.Name == "" && user.Email == "" {
+	if user.IsEmpty() {
+		return nil, ErrInvalidInput
+	}
+	if !validUserUpdate(&user) {
 		return nil, ErrInvalidInput
 	}
 
-	updatedUser, err := s.repo.Update(ctx, id, user)
+	var updatedUser *model.User
+	err := s.tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		updatedUser, err = s.repo.Update(ctx, id, user)
+		return err
+	})
+	if errors.Is(err, postgres.ErrDuplicate) {
+		return nil, ErrEmailTaken
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -88,20 +163,100 @@ func (s *UserService) Update(ctx context.Context, id int64, user model.UserUpdat
 	return updatedUser, nil
 }
 
+// Suspend приостанавливает активную учетную запись пользователя
+// ctx - контекст операции
+// id - идентификатор пользователя
+// reason - причина приостановки для журнала аудита
+func (s *UserService) Suspend(ctx context.Context, id int64, reason string) (*model.User, error) {
+	return s.changeStatus(ctx, id, model.UserStatusChange{Status: model.UserStatusSuspended, Reason: reason})
+}
+
+// Reactivate активирует учетную запись: ожидающую активации, приостановленную или заблокированную
+// ctx - контекст операции
+// id - идентификатор пользователя
+// reason - причина активации для журнала аудита
+func (s *UserService) Reactivate(ctx context.Context, id int64, reason string) (*model.User, error) {
+	return s.changeStatus(ctx, id, model.UserStatusChange{Status: model.UserStatusActive, Reason: reason})
+}
+
+// changeStatus переводит учетную запись в другое состояние с проверкой допустимости перехода
+func (s *UserService) changeStatus(ctx context.Context, id int64, change model.UserStatusChange) (*model.User, error) {
+	change.Reason = strings.TrimSpace(change.Reason)
+	if utf8.RuneCountInString(change.Reason) > maxStatusReasonLength {
+		return nil, ErrInvalidInput
+	}
+
+	var updatedUser *model.User
+	err := s.tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		updatedUser, err = s.repo.ChangeStatus(ctx, id, change)
+		return err
+	})
+	if errors.Is(err, postgres.ErrStatusTransition) {
+		return nil, ErrInvalidStatusTransition
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if updatedUser == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return updatedUser, nil
+}
+
 // Delete удаляет пользователя по ID
+// Проверка существования, исключение из групп и удаление выполняются в одной транзакции
 // ctx - контекст операции
 // id - идентификатор пользователя
 func (s *UserService) Delete(ctx context.Context, id int64) error {
-	// Сначала проверяем, существует ли пользователь
-	user, err := s.repo.GetByID(ctx, id)
+	return s.tx.WithTx(ctx, func(ctx context.Context) error {
+		// Сначала проверяем, существует ли пользователь
+		user, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if user == nil {
+			return ErrUserNotFound
+		}
+
+		// Участие в группах удаляется вместе с пользователем
+		if err := s.groups.RemoveUser(ctx, id); err != nil {
+			return err
+		}
+
+		// Делегируем операцию удаления репозиторию
+		return s.repo.Delete(ctx, id)
+	})
+}
+
+// History получает историю изменений пользователя, начиная с самых новых записей
+// История доступна и после удаления пользователя; ErrUserNotFound возвращается, если у пользователя
+// нет записей в журнале и его нет в хранилище
+// ctx - контекст операции
+// id - идентификатор пользователя
+// limit, offset - параметры постраничной выборки
+// Возвращает записи страницы и общее количество записей
+func (s *UserService) History(ctx context.Context, id int64, limit, offset int) ([]model.AuditEntry, int, error) {
+	entries, total, err := s.audit.ListByUser(ctx, id, limit, offset)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	if user == nil {
-		return ErrUserNotFound
+	// Пустая история бывает и у существующего пользователя (например, созданного до появления журнала),
+	// поэтому ошибка возвращается, только если пользователя нет
+	if total == 0 {
+		user, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if user == nil {
+			return nil, 0, ErrUserNotFound
+		}
+		return []model.AuditEntry{}, 0, nil
 	}
 
-	// Делегируем операцию удаления репозиторию
-	return s.repo.Delete(ctx, id)
+	return entries, total, nil
 }
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// TestUserStatusTransitions проверяет допустимые переходы состояния учетной записи и проверку причины
+func TestUserStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{model.UserStatusPending, model.UserStatusActive, true},
+		{model.UserStatusActive, model.UserStatusSuspended, true},
+		{model.UserStatusActive, model.UserStatusLocked, true},
+		{model.UserStatusSuspended, model.UserStatusActive, true},
+		{model.UserStatusLocked, model.UserStatusActive, true},
+		{model.UserStatusSuspended, model.UserStatusDeleted, true},
+		{model.UserStatusPending, model.UserStatusSuspended, false},
+		{model.UserStatusActive, model.UserStatusActive, false},
+		{model.UserStatusSuspended, model.UserStatusLocked, false},
+		{model.UserStatusDeleted, model.UserStatusActive, false},
+	}
+	for _, tt := range tests {
+		if got := model.CanTransitionUserStatus(tt.from, tt.to); got != tt.want {
+			t.Errorf("Переход %s -> %s: получено %v, ожидалось %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	if model.ValidUserStatus(model.UserStatusDeleted) {
+		t.Errorf("Состояние deleted не должно храниться у пользователя")
+	}
+
+	svc := NewUserService(nil, nil, nil, nil)
+	_, err := svc.Suspend(context.Background(), 1, strings.Repeat("п", maxStatusReasonLength+1))
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Слишком длинная причина: ожидалась ошибка %v, получено %v", ErrInvalidInput, err)
+	}
+}
+
+// fakeUserRepository - хранилище пользователей в памяти для тестов сервисов
+type fakeUserRepository struct {
+	users map[int64]*model.User
+}
+
+func (r *fakeUserRepository) Create(ctx context.Context, user model.UserCreate) (*model.User, error) {
+	created := &model.User{ID: int64(len(r.users) + 1), Name: user.Name, Email: user.Email, Role: model.UserRoleMember,
+		Status: model.UserStatusActive, EmailVerified: user.EmailVerified, TenantID: requestinfo.FromContext(ctx).Tenant()}
+	r.users[created.ID] = created
+	return created, nil
+}
+
+func (r *fakeUserRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	return r.users[id], nil
+}
+
+func (r *fakeUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeUserRepository) GetAll(ctx context.Context, filter model.UserFilter) ([]model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeUserRepository) Count(ctx context.Context, filter model.UserFilter) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (r *fakeUserRepository) Update(ctx context.Context, id int64, user model.UserUpdate) (*model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeUserRepository) ChangeStatus(ctx context.Context, id int64, change model.UserStatusChange) (*model.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeUserRepository) Delete(ctx context.Context, id int64) error {
+	return errors.New("not implemented")
+}
+
+// fakeTransactor выполняет функцию без транзакции
+type fakeTransactor struct{}
+
+func (fakeTransactor) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// fakeAuditRepository - журнал аудита в памяти с записями по пользователям
+type fakeAuditRepository struct {
+	entries map[int64][]model.AuditEntry
+}
+
+func (r *fakeAuditRepository) ListByUser(ctx context.Context, userID int64, limit, offset int) ([]model.AuditEntry, int, error) {
+	entries := r.entries[userID]
+	total := len(entries)
+	if offset > total {
+		offset = total
+	}
+	if offset+limit < total {
+		entries = entries[:offset+limit]
+	}
+	return entries[offset:], total, nil
+}
+
+// TestUserHistory проверяет историю существующего, удаленного и несуществующего пользователя
+func TestUserHistory(t *testing.T) {
+	users := &fakeUserRepository{users: map[int64]*model.User{
+		1: {ID: 1, Email: "ivan@example.com"},
+		2: {ID: 2, Email: "old@example.com"},
+	}}
+	audit := &fakeAuditRepository{entries: map[int64][]model.AuditEntry{
+		1: {{ID: 3, Action: model.AuditActionUpdate}, {ID: 1, Action: model.AuditActionCreate}},
+		// Удаленный пользователь: записи в журнале остаются
+		5: {{ID: 4, Action: model.AuditActionDelete}},
+	}}
+	svc := NewUserService(users, audit, nil, nil)
+	ctx := context.Background()
+
+	entries, total, err := svc.History(ctx, 1, 1, 0)
+	if err != nil || total != 2 || len(entries) != 1 || entries[0].ID != 3 {
+		t.Errorf("История пользователя 1: %+v, всего %d, ошибка %v", entries, total, err)
+	}
+
+	entries, total, err = svc.History(ctx, 5, 10, 0)
+	if err != nil || total != 1 || len(entries) != 1 {
+		t.Errorf("История удаленного пользователя: %+v, всего %d, ошибка %v", entries, total, err)
+	}
+
+	// Пользователь без записей в журнале (например, созданный до его появления) получает пустую страницу
+	entries, total, err = svc.History(ctx, 2, 10, 0)
+	if err != nil || total != 0 || entries == nil || len(entries) != 0 {
+		t.Errorf("История пользователя без записей: %+v, всего %d, ошибка %v", entries, total, err)
+	}
+
+	if _, _, err := svc.History(ctx, 9, 10, 0); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("История несуществующего пользователя: ожидалась ошибка %v, получено %v", ErrUserNotFound, err)
+	}
+}
+
+// TestDiffUsers проверяет различия состояний пользователя для журнала аудита
+func TestDiffUsers(t *testing.T) {
+	before := &model.User{ID: 1, Name: "Иван", Email: "old@example.com", Role: model.UserRoleMember,
+		UpdatedBy: "admin@example.com", TenantID: "acme"}
+	after := *before
+	after.Email = "new@example.com"
+	after.UpdatedBy = "other@example.com"
+	after.UpdatedAt = before.UpdatedAt.Add(time.Minute)
+
+	diff, err := model.DiffUsers(before, &after)
+	if err != nil {
+		t.Fatalf("Ошибка вычисления различий: %v", err)
+	}
+	// Служебные поля не попадают в журнал
+	if len(diff) != 1 || diff["email"].Before != "old@example.com" || diff["email"].After != "new@example.com" {
+		t.Errorf("Изменение почты: получено %+v", diff)
+	}
+
+	diff, err = model.DiffUsers(before, before)
+	if err != nil || len(diff) != 0 {
+		t.Errorf("Без изменений: получено %+v, ошибка %v", diff, err)
+	}
+
+	// У созданного пользователя нет значений до изменения, у удаленного - после
+	created, err := model.DiffUsers(nil, before)
+	if err != nil || created["name"].Before != nil || created["name"].After != "Иван" {
+		t.Errorf("Создание: получено %+v, ошибка %v", created, err)
+	}
+	if _, ok := created["tenant_id"]; ok {
+		t.Errorf("Арендатор не должен попадать в журнал: %+v", created)
+	}
+	deleted, err := model.DiffUsers(before, nil)
+	if err != nil || deleted["email"].Before != "old@example.com" || deleted["email"].After != nil {
+		t.Errorf("Удаление: получено %+v, ошибка %v", deleted, err)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/repository/postgres"
+	"github.com/janson/usermicroservice/internal/webhook"
+)
+
+// ErrWebhookNotFound возвращается, если подписка на вебхуки не найдена
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+
+// knownEventTypes - типы событий, на которые можно подписаться
+var knownEventTypes = map[string]bool{
+	model.EventUserCreated: true,
+	model.EventUserUpdated: true,
+	model.EventUserDeleted: true,
+}
+
+// deliveriesLimit - количество последних попыток доставки, возвращаемых по подписке
+const deliveriesLimit = 100
+
+// WebhookService обрабатывает бизнес-логику подписок на вебхуки
+type WebhookService struct {
+	repo          *postgres.WebhookRepository // Репозиторий подписок и журнала доставок
+	allowInsecure bool                        // Разрешены ли получатели по http и во внутренних сетях
+}
+
+// NewWebhookService создает новый сервис вебхуков
+// repo - репозиторий подписок
+// cfg - настройки вебхуков
+func NewWebhookService(repo *postgres.WebhookRepository, cfg config.WebhooksConfig) *WebhookService {
+	return &WebhookService{
+		repo:          repo,
+		allowInsecure: cfg.AllowInsecureTargets,
+	}
+}
+
+// Create создает новую подписку
+// Если секрет не передан, генерируется случайный секрет, который возвращается только в ответе на создание
+// ctx - контекст операции
+// sub - данные подписки
+func (s *WebhookService) Create(ctx context.Context, sub model.WebhookSubscriptionCreate) (*model.WebhookSubscription, error) {
+	if !webhook.ValidURL(sub.URL, s.allowInsecure) || !validEventTypes(sub.EventTypes) {
+		return nil, ErrInvalidInput
+	}
+
+	if sub.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			return nil, err
+		}
+		sub.Secret = secret
+	}
+
+	return s.repo.Create(ctx, sub)
+}
+
+// GetByID получает подписку по ID
+// ctx - контекст операции
+// id - идентификатор подписки
+func (s *WebhookService) GetByID(ctx context.Context, id int64) (*model.WebhookSubscription, error) {
+	sub, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if sub == nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	return sub, nil
+}
+
+// GetAll получает все подписки
+// ctx - контекст операции
+func (s *WebhookService) GetAll(ctx context.Context) ([]model.WebhookSubscription, error) {
+	return s.repo.GetAll(ctx)
+}
+
+// Update обновляет подписку
+// ctx - контекст операции
+// id - идентификатор подписки
+// update - изменяемые поля
+func (s *WebhookService) Update(ctx context.Context, id int64, update model.WebhookSubscriptionUpdate) (*model.WebhookSubscription, error) {
+	if update.URL == nil && update.Secret == nil && update.EventTypes == nil && update.Active == nil {
+		return nil, ErrInvalidInput
+	}
+
+	sub, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.URL != nil {
+		if !webhook.ValidURL(*update.URL, s.allowInsecure) {
+			return nil, ErrInvalidInput
+		}
+		sub.URL = *update.URL
+	}
+	if update.Secret != nil {
+		if *update.Secret == "" {
+			return nil, ErrInvalidInput
+		}
+		sub.Secret = *update.Secret
+	}
+	if update.EventTypes != nil {
+		if !validEventTypes(*update.EventTypes) {
+			return nil, ErrInvalidInput
+		}
+		sub.EventTypes = *update.EventTypes
+	}
+	if update.Active != nil {
+		sub.Active = *update.Active
+	}
+
+	updated, err := s.repo.Update(ctx, *sub)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated == nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	return updated, nil
+}
+
+// Delete удаляет подписку
+// ctx - контекст операции
+// id - идентификатор подписки
+func (s *WebhookService) Delete(ctx context.Context, id int64) error {
+	deleted, err := s.repo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// Deliveries получает журнал последних попыток доставки по подписке
+// ctx - контекст операции
+// id - идентификатор подписки
+func (s *WebhookService) Deliveries(ctx context.Context, id int64) ([]model.WebhookDelivery, error) {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListDeliveries(ctx, id, deliveriesLimit)
+}
+
+// validEventTypes проверяет, что все типы событий известны сервису
+func validEventTypes(types []string) bool {
+	for _, t := range types {
+		if !knownEventTypes[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// generateSecret генерирует случайный секрет для подписи вебхуков
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,145 @@
+package tenant
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/janson/usermicroservice/internal/config"
+)
+
+// Значения по умолчанию для определения арендатора
+const (
+	DefaultHeader = "X-Tenant-ID" // Заголовок с ID арендатора
+	DefaultClaim  = "tenant_id"   // Утверждение токена с ID арендатора
+)
+
+// Ошибки определения арендатора
+var (
+	ErrMissingTenant = errors.New("tenant is not specified")            // Арендатор не передан и не задан по умолчанию
+	ErrInvalidTenant = errors.New("invalid tenant id")                  // ID арендатора имеет недопустимый формат
+	ErrInvalidToken  = errors.New("invalid bearer token")               // Токен не прошел проверку или не содержит арендатора
+	ErrMismatch      = errors.New("tenant header does not match token") // Заголовок и токен указывают разных арендаторов
+)
+
+// idPattern - допустимый формат ID арендатора (длина соответствует столбцу tenant_id)
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// requests - количество запросов по арендаторам, доступное по /debug/vars
+var requests = expvar.NewMap("tenant_requests")
+
+// Resolver определяет арендатора запроса по токену, заголовку или значению по умолчанию
+type Resolver struct {
+	header        string // Заголовок с ID арендатора
+	trustHeader   bool   // Принимать заголовок без токена
+	secret        []byte // Секрет HS256 для проверки токенов (nil - токены не проверяются)
+	claim         string // Утверждение токена с ID арендатора
+	defaultTenant string // Арендатор запросов без токена и заголовка
+}
+
+// NewResolver создает определитель арендатора из конфигурации
+// cfg - настройки разделения по арендаторам
+func NewResolver(cfg config.TenancyConfig) (*Resolver, error) {
+	if cfg.DefaultTenant != "" && !Valid(cfg.DefaultTenant) {
+		return nil, fmt.Errorf("tenancy.default_tenant: %w: %q", ErrInvalidTenant, cfg.DefaultTenant)
+	}
+
+	r := &Resolver{
+		header:        cfg.Header,
+		trustHeader:   cfg.TrustHeader,
+		claim:         cfg.JWTClaim,
+		defaultTenant: cfg.DefaultTenant,
+	}
+	if r.header == "" {
+		r.header = DefaultHeader
+	}
+	if r.claim == "" {
+		r.claim = DefaultClaim
+	}
+	if cfg.JWTSecret != "" {
+		r.secret = []byte(cfg.JWTSecret)
+	}
+
+	return r, nil
+}
+
+// Header возвращает имя заголовка, из которого читается ID арендатора
+func (r *Resolver) Header() string {
+	return r.header
+}
+
+// Resolve определяет арендатора по значению заголовка Authorization и заголовка арендатора
+// Порядок: утверждение проверенного токена Bearer, заголовок (если ему доверяют), арендатор по умолчанию
+// Если переданы и токен, и заголовок, они должны указывать одного арендатора
+// authorization - значение заголовка Authorization
+// header - значение заголовка арендатора
+func (r *Resolver) Resolve(authorization, header string) (string, error) {
+	if token, ok := bearerToken(authorization); ok && r.secret != nil {
+		tenantID, err := r.fromToken(token)
+		if err != nil {
+			return "", err
+		}
+		if header != "" && header != tenantID {
+			return "", ErrMismatch
+		}
+		return tenantID, nil
+	}
+
+	if header != "" && r.trustHeader {
+		if !Valid(header) {
+			return "", ErrInvalidTenant
+		}
+		return header, nil
+	}
+
+	if r.defaultTenant != "" {
+		return r.defaultTenant, nil
+	}
+	return "", ErrMissingTenant
+}
+
+// fromToken проверяет подпись и срок действия токена и извлекает из него арендатора
+func (r *Resolver) fromToken(token string) (string, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return r.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	// Токен второго шага входа (token_use=mfa) подписан тем же секретом, но не является токеном доступа
+	if use, _ := claims["token_use"].(string); use != "" && use != "access" {
+		return "", fmt.Errorf("%w: токен с назначением %q не является токеном доступа", ErrInvalidToken, use)
+	}
+
+	tenantID, _ := claims[r.claim].(string)
+	if !Valid(tenantID) {
+		return "", fmt.Errorf("%w: утверждение %q отсутствует или некорректно", ErrInvalidToken, r.claim)
+	}
+	return tenantID, nil
+}
+
+// Valid сообщает, что строка является допустимым ID арендатора:
+// строчные латинские буквы, цифры, "_" и "-", не более 64 символов
+func Valid(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// RecordRequest учитывает запрос арендатора в счетчиках tenant_requests
+func RecordRequest(tenantID string) {
+	requests.Add(tenantID, 1)
+}
+
+// bearerToken извлекает токен из значения заголовка Authorization вида "Bearer <token>"
+func bearerToken(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
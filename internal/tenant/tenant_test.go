@@ -0,0 +1,87 @@
+package tenant
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/janson/usermicroservice/internal/config"
+)
+
+// signToken подписывает тестовый токен секретом HS256
+func signToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Ошибка подписи токена: %v", err)
+	}
+	return token
+}
+
+// TestResolve проверяет порядок источников арендатора и отклонение некорректных запросов
+func TestResolve(t *testing.T) {
+	resolver, err := NewResolver(config.TenancyConfig{
+		Enabled:     true,
+		TrustHeader: true,
+		JWTSecret:   "secret",
+	})
+	if err != nil {
+		t.Fatalf("Ошибка создания определителя: %v", err)
+	}
+
+	valid := "Bearer " + signToken(t, "secret", jwt.MapClaims{"tenant_id": "acme", "exp": time.Now().Add(time.Hour).Unix()})
+	expired := "Bearer " + signToken(t, "secret", jwt.MapClaims{"tenant_id": "acme", "exp": time.Now().Add(-time.Hour).Unix()})
+	foreign := "Bearer " + signToken(t, "other", jwt.MapClaims{"tenant_id": "acme"})
+	noClaim := "Bearer " + signToken(t, "secret", jwt.MapClaims{"sub": "42"})
+	mfa := "Bearer " + signToken(t, "secret", jwt.MapClaims{"tenant_id": "acme", "token_use": "mfa"})
+
+	tests := []struct {
+		name          string
+		authorization string
+		header        string
+		want          string
+		wantErr       error
+	}{
+		{"токен", valid, "", "acme", nil},
+		{"токен и совпадающий заголовок", valid, "acme", "acme", nil},
+		{"токен и другой заголовок", valid, "globex", "", ErrMismatch},
+		{"просроченный токен", expired, "", "", ErrInvalidToken},
+		{"чужая подпись", foreign, "", "", ErrInvalidToken},
+		{"токен без арендатора", noClaim, "", "", ErrInvalidToken},
+		{"токен второго шага входа", mfa, "", "", ErrInvalidToken},
+		{"заголовок", "", "globex", "globex", nil},
+		{"некорректный заголовок", "", "Globex Inc", "", ErrInvalidTenant},
+		{"ничего не передано", "", "", "", ErrMissingTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(tt.authorization, tt.header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Ожидалась ошибка %v, получено %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Ожидался арендатор %q, получено %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestResolveDefaultTenant проверяет арендатора по умолчанию и недоверенный заголовок
+func TestResolveDefaultTenant(t *testing.T) {
+	resolver, err := NewResolver(config.TenancyConfig{Enabled: true, DefaultTenant: "main"})
+	if err != nil {
+		t.Fatalf("Ошибка создания определителя: %v", err)
+	}
+
+	got, err := resolver.Resolve("", "globex")
+	if err != nil || got != "main" {
+		t.Errorf("Без доверия к заголовку ожидался арендатор по умолчанию, получено %q, %v", got, err)
+	}
+
+	if _, err := NewResolver(config.TenancyConfig{DefaultTenant: "Main Tenant"}); !errors.Is(err, ErrInvalidTenant) {
+		t.Errorf("Ожидалась ошибка некорректного арендатора по умолчанию, получено %v", err)
+	}
+}
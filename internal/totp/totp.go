@@ -0,0 +1,104 @@
+// Package totp реализует одноразовые пароли на основе времени (TOTP, RFC 6238)
+// Используются параметры, которые поддерживают все распространенные приложения-аутентификаторы:
+// HMAC-SHA1, 6 цифр, шаг 30 секунд
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Параметры TOTP
+const (
+	Digits     = 6                // Число цифр кода
+	Period     = 30 * time.Second // Шаг времени
+	SecretSize = 20               // Размер секрета в байтах (160 бит, рекомендация RFC 4226)
+)
+
+// encoding - кодировка секрета для приложений-аутентификаторов (Base32 без дополнения)
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret генерирует случайный секрет
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret возвращает секрет в виде Base32 для ввода в приложение-аутентификатор вручную
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// Step возвращает номер шага времени для момента t
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code возвращает код для момента t
+func Code(secret []byte, t time.Time) string {
+	return codeAt(secret, Step(t))
+}
+
+// Validate проверяет код для момента t с допуском skew шагов в обе стороны (расхождение часов)
+// Возвращает номер шага, для которого код совпал: по нему вызывающая сторона отклоняет повторное
+// использование кода
+func Validate(secret []byte, code string, t time.Time, skew int) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	step := Step(t)
+	for i := -skew; i <= skew; i++ {
+		candidate := codeAt(secret, step+int64(i))
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(code)) == 1 {
+			return step + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// URI возвращает адрес otpauth:// для QR-кода приложения-аутентификатора
+// issuer - название сервиса, account - имя учетной записи (электронная почта)
+func URI(issuer, account string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: strings.ReplaceAll(query.Encode(), "+", "%20"),
+	}
+	return u.String()
+}
+
+// codeAt вычисляет код для номера шага (HOTP, RFC 4226)
+func codeAt(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Динамическое усечение: смещение задается младшими 4 битами последнего байта
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
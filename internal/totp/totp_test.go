@@ -0,0 +1,62 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCode проверяет коды по тестовым векторам RFC 6238 (SHA1, последние 6 цифр)
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := Code(secret, time.Unix(tt.unix, 0)); got != tt.want {
+			t.Errorf("Код для %d: получено %s, ожидалось %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+// TestValidate проверяет допуск расхождения часов и номер совпавшего шага
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	previous := Code(secret, now.Add(-Period))
+
+	step, ok := Validate(secret, previous, now, 1)
+	if !ok || step != Step(now)-1 {
+		t.Errorf("Код предыдущего шага должен приниматься с допуском 1: шаг %d, %v", step, ok)
+	}
+	if _, ok := Validate(secret, previous, now, 0); ok {
+		t.Errorf("Код предыдущего шага не должен приниматься без допуска")
+	}
+	if _, ok := Validate(secret, Code(secret, now.Add(-2*Period)), now, 1); ok {
+		t.Errorf("Код за пределами допуска не должен приниматься")
+	}
+	if _, ok := Validate(secret, "05047", now, 1); ok {
+		t.Errorf("Код неверной длины не должен приниматься")
+	}
+}
+
+// TestURI проверяет адрес otpauth:// для приложения-аутентификатора
+func TestURI(t *testing.T) {
+	uri := URI("User Service", "ivan@example.com", []byte("12345678901234567890"))
+	want := "otpauth://totp/User%20Service:ivan@example.com?algorithm=SHA1&digits=6&issuer=User%20Service" +
+		"&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if uri != want {
+		t.Errorf("Неожиданный адрес:\n%s\nожидалось:\n%s", uri, want)
+	}
+	if strings.Contains(EncodeSecret([]byte("1")), "=") {
+		t.Errorf("Секрет не должен содержать дополнение =")
+	}
+}
@@ -0,0 +1,346 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// Заголовки, которые получатель использует для проверки уведомления
+const (
+	HeaderSignature = "X-Webhook-Signature" // Подпись HMAC-SHA256 в формате "sha256=<hex>"
+	HeaderTimestamp = "X-Webhook-Timestamp" // Время отправки в секундах Unix, входит в подпись
+	HeaderEvent     = "X-Webhook-Event"     // Тип события
+	HeaderEventID   = "X-Webhook-Event-ID"  // ID события, используется получателем для дедупликации
+)
+
+// Значения по умолчанию для настроек доставки
+const (
+	defaultPollInterval     = time.Second
+	defaultBatchSize        = 20
+	defaultMaxAttempts      = 5
+	defaultInitialBackoff   = time.Second
+	defaultMaxBackoff       = time.Minute
+	defaultFailureThreshold = 10
+	defaultTimeout          = 10 * time.Second
+)
+
+// Store - хранилище подписок, очереди и журнала доставок, необходимое диспетчеру
+// Подписки выбираются в пределах арендатора из контекста (см. requestinfo),
+// очередь доставок обрабатывается для всех арендаторов
+// Реализуется postgres.WebhookRepository
+type Store interface {
+	ListActiveForEvent(ctx context.Context, eventType string) ([]model.WebhookSubscription, error)
+	GetByID(ctx context.Context, id int64) (*model.WebhookSubscription, error)
+	Enqueue(ctx context.Context, event model.Event, body []byte, subs []model.WebhookSubscription) error
+	ClaimTasks(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookTask, error)
+	CompleteTask(ctx context.Context, id int64) error
+	RetryTask(ctx context.Context, id int64, delay time.Duration, lastError string) error
+	RecordDelivery(ctx context.Context, delivery model.WebhookDelivery) error
+	RecordFailure(ctx context.Context, id int64, threshold int) (bool, error)
+	ResetFailures(ctx context.Context, id int64) error
+}
+
+// Dispatcher рассылает доменные события по подпискам партнеров
+// Реализует outbox.Publisher: ретранслятор outbox только ставит события в очередь доставки,
+// а HTTP запросы к получателям и повторы выполняет Run вне транзакции ретранслятора,
+// поэтому недоступный партнер не задерживает публикацию событий
+type Dispatcher struct {
+	store            Store            // Хранилище подписок
+	client           *http.Client     // HTTP клиент для отправки уведомлений
+	logger           *log.Logger      // Логгер для записи результатов доставки
+	pollInterval     time.Duration    // Интервал опроса очереди доставки
+	batchSize        int              // Максимальное число доставок, выполняемых одновременно
+	lease            time.Duration    // Время, на которое доставка закрепляется за экземпляром сервиса
+	maxAttempts      int              // Максимальное число попыток доставки одного события
+	initialBackoff   time.Duration    // Задержка перед второй попыткой
+	maxBackoff       time.Duration    // Верхняя граница задержки между попытками
+	failureThreshold int              // Число неудачных доставок подряд до отключения подписки
+	now              func() time.Time // Источник времени для заголовка X-Webhook-Timestamp
+}
+
+// NewDispatcher создает диспетчер вебхуков
+// store - хранилище подписок
+// cfg - настройки доставки (нулевые значения заменяются значениями по умолчанию)
+// logger - логгер для записи событий
+func NewDispatcher(store Store, cfg config.WebhooksConfig, logger *log.Logger) *Dispatcher {
+	d := &Dispatcher{
+		store:            store,
+		logger:           logger,
+		pollInterval:     cfg.PollInterval.Duration,
+		batchSize:        cfg.BatchSize,
+		maxAttempts:      cfg.MaxAttempts,
+		initialBackoff:   cfg.InitialBackoff.Duration,
+		maxBackoff:       cfg.MaxBackoff.Duration,
+		failureThreshold: cfg.FailureThreshold,
+		now:              time.Now,
+	}
+
+	if d.pollInterval <= 0 {
+		d.pollInterval = defaultPollInterval
+	}
+	if d.batchSize <= 0 {
+		d.batchSize = defaultBatchSize
+	}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = defaultMaxAttempts
+	}
+	if d.initialBackoff <= 0 {
+		d.initialBackoff = defaultInitialBackoff
+	}
+	if d.maxBackoff <= 0 {
+		d.maxBackoff = defaultMaxBackoff
+	}
+	if d.failureThreshold <= 0 {
+		d.failureThreshold = defaultFailureThreshold
+	}
+
+	timeout := cfg.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	d.client = newClient(timeout, cfg.AllowInsecureTargets)
+	// Запрос ограничен таймаутом, поэтому за это время доставка успевает завершиться и записать результат
+	d.lease = 2 * timeout
+
+	return d
+}
+
+// newClient создает HTTP клиент для отправки уведомлений
+// Клиент не следует перенаправлениям: ответ 3xx считается неудачной доставкой, иначе получатель мог бы
+// перенаправить запрос на внутренний адрес. Без allowInsecure соединения с внутренними адресами отклоняются
+// после разрешения имени, а прокси из окружения не используется, чтобы проверялся адрес самого получателя
+func newClient(timeout time.Duration, allowInsecure bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowInsecure {
+		dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second, Control: dialControl}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Publish ставит событие в очередь доставки всем активным подпискам арендатора события на его тип
+// Подписки выбираются в пределах арендатора события, поэтому партнеры одного арендатора
+// не получают события пользователей другого
+// Доставку выполняет Run; ошибка возвращается только при сбое хранилища, и тогда ретранслятор
+// повторит публикацию события
+func (d *Dispatcher) Publish(ctx context.Context, event model.Event) error {
+	ctx = requestinfo.WithInfo(ctx, requestinfo.Info{TenantID: event.TenantID})
+	subs, err := d.store.ListActiveForEvent(ctx, event.Type)
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return d.store.Enqueue(ctx, event, body, subs)
+}
+
+// Run доставляет события из очереди и блокируется до отмены контекста
+// Несколько экземпляров сервиса могут обрабатывать очередь одновременно: каждая доставка
+// закрепляется за одним из них
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain выполняет доставки, время которых наступило, пока очередь возвращает полные порции
+func (d *Dispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		processed, err := d.deliverDue(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.logger.Printf("Ошибка обработки очереди вебхуков: %v", err)
+			}
+			return
+		}
+		if processed < d.batchSize {
+			return
+		}
+	}
+}
+
+// deliverDue выбирает порцию доставок, время которых наступило, и выполняет их одновременно
+// Возвращает количество выбранных доставок
+func (d *Dispatcher) deliverDue(ctx context.Context) (int, error) {
+	tasks, err := d.store.ClaimTasks(ctx, d.batchSize, d.lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task model.WebhookTask) {
+			defer wg.Done()
+			if err := d.deliver(ctx, task); err != nil && ctx.Err() == nil {
+				d.logger.Printf("Ошибка доставки вебхука %d (событие %d): %v", task.SubscriptionID, task.EventID, err)
+			}
+		}(task)
+	}
+	wg.Wait()
+
+	return len(tasks), nil
+}
+
+// deliver выполняет одну попытку доставки из очереди
+// Неудачная попытка откладывается с экспоненциальной задержкой; после последней попытки доставка удаляется
+// из очереди и учитывается в счетчике неудачных доставок подписки
+func (d *Dispatcher) deliver(ctx context.Context, task model.WebhookTask) error {
+	ctx = requestinfo.WithInfo(ctx, requestinfo.Info{TenantID: task.TenantID})
+	sub, err := d.store.GetByID(ctx, task.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	if sub == nil || !sub.Active {
+		// Подписка удалена или отключена после постановки события в очередь
+		return d.store.CompleteTask(ctx, task.ID)
+	}
+
+	attempt := task.Attempts + 1
+	delivery := d.send(ctx, *sub, task, attempt)
+	if ctx.Err() != nil {
+		// Попытка прервана остановкой сервиса, доставка будет выполнена после окончания закрепления
+		return ctx.Err()
+	}
+	if err := d.store.RecordDelivery(ctx, delivery); err != nil {
+		d.logger.Printf("Ошибка записи журнала доставки вебхука %d: %v", sub.ID, err)
+	}
+
+	if delivery.Success {
+		if err := d.store.CompleteTask(ctx, task.ID); err != nil {
+			return err
+		}
+		if sub.FailureCount > 0 {
+			return d.store.ResetFailures(ctx, sub.ID)
+		}
+		return nil
+	}
+
+	if attempt < d.maxAttempts {
+		return d.store.RetryTask(ctx, task.ID, d.backoff(attempt), delivery.Error)
+	}
+
+	d.logger.Printf("Вебхук %d: событие %d не доставлено за %d попыток: %s", sub.ID, task.EventID, attempt, delivery.Error)
+	if err := d.store.CompleteTask(ctx, task.ID); err != nil {
+		return err
+	}
+	disabled, err := d.store.RecordFailure(ctx, sub.ID, d.failureThreshold)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		d.logger.Printf("Вебхук %d отключен после %d неудачных доставок подряд", sub.ID, d.failureThreshold)
+	}
+
+	return nil
+}
+
+// send выполняет одну попытку доставки и возвращает ее результат
+func (d *Dispatcher) send(ctx context.Context, sub model.WebhookSubscription, task model.WebhookTask, attempt int) model.WebhookDelivery {
+	delivery := model.WebhookDelivery{
+		SubscriptionID: sub.ID,
+		EventID:        task.EventID,
+		EventType:      task.EventType,
+		Attempt:        attempt,
+	}
+
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(task.Body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, task.EventType)
+	req.Header.Set(HeaderEventID, strconv.FormatInt(task.EventID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, task.Body))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	delivery.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("получатель ответил кодом %d", resp.StatusCode)
+	}
+
+	return delivery
+}
+
+// backoff возвращает задержку перед повтором с номером retry (начиная с 1)
+// Задержка растет экспоненциально и случайно выбирается из отрезка [d/2, d] ("equal jitter"),
+// чтобы повторы разных событий не приходили к получателю одновременно
+func (d *Dispatcher) backoff(retry int) time.Duration {
+	delay := d.initialBackoff
+	for i := 1; i < retry && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Sign вычисляет подпись уведомления для заголовка X-Webhook-Signature
+// Подписывается строка "<timestamp>.<тело запроса>" секретом подписки
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись уведомления на стороне получателя
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
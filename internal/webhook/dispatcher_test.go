@@ -0,0 +1,448 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/janson/usermicroservice/internal/config"
+	"github.com/janson/usermicroservice/internal/model"
+	"github.com/janson/usermicroservice/internal/requestinfo"
+)
+
+// fakeStore хранит подписки и очередь доставки в памяти и повторяет логику отключения,
+// разделения по арендаторам и порядка доставки из postgres.WebhookRepository
+type fakeStore struct {
+	mu         sync.Mutex
+	subs       []model.WebhookSubscription
+	tenants    map[int64]string // Арендаторы подписок по ID (нет записи - арендатор по умолчанию)
+	deliveries []model.WebhookDelivery
+	queue      []queuedTask
+	lastTaskID int64
+}
+
+// queuedTask - доставка в очереди fakeStore со временем следующей попытки
+type queuedTask struct {
+	task model.WebhookTask
+	next time.Time
+}
+
+// subscriptionTenant возвращает арендатора подписки
+func (s *fakeStore) subscriptionTenant(id int64) string {
+	if tenantID, ok := s.tenants[id]; ok {
+		return tenantID
+	}
+	return requestinfo.DefaultTenant
+}
+
+func (s *fakeStore) ListActiveForEvent(ctx context.Context, eventType string) ([]model.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := requestinfo.FromContext(ctx).Tenant()
+	var result []model.WebhookSubscription
+	for _, sub := range s.subs {
+		if s.subscriptionTenant(sub.ID) == tenantID && sub.Active && sub.Matches(eventType) {
+			result = append(result, sub)
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeStore) GetByID(ctx context.Context, id int64) (*model.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.subs {
+		if sub.ID == id && s.subscriptionTenant(id) == requestinfo.FromContext(ctx).Tenant() {
+			return &sub, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeStore) Enqueue(ctx context.Context, event model.Event, body []byte, subs []model.WebhookSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range subs {
+		queued := false
+		for _, q := range s.queue {
+			queued = queued || q.task.SubscriptionID == sub.ID && q.task.EventID == event.ID
+		}
+		if queued {
+			continue
+		}
+		s.lastTaskID++
+		s.queue = append(s.queue, queuedTask{task: model.WebhookTask{
+			ID:             s.lastTaskID,
+			TenantID:       requestinfo.FromContext(ctx).Tenant(),
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			AggregateID:    event.AggregateID,
+			EventType:      event.Type,
+			Body:           body,
+		}})
+	}
+	return nil
+}
+
+func (s *fakeStore) ClaimTasks(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var tasks []model.WebhookTask
+	for i, q := range s.queue {
+		if len(tasks) == limit {
+			break
+		}
+		blocked := false
+		for _, earlier := range s.queue[:i] {
+			blocked = blocked || earlier.task.SubscriptionID == q.task.SubscriptionID &&
+				earlier.task.AggregateID == q.task.AggregateID
+		}
+		if !blocked && !q.next.After(now) {
+			s.queue[i].next = now.Add(lease)
+			tasks = append(tasks, q.task)
+		}
+	}
+	return tasks, nil
+}
+
+func (s *fakeStore) CompleteTask(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, q := range s.queue {
+		if q.task.ID == id {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) RetryTask(ctx context.Context, id int64, delay time.Duration, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.queue {
+		if s.queue[i].task.ID == id {
+			s.queue[i].task.Attempts++
+			s.queue[i].next = time.Now().Add(delay)
+		}
+	}
+	return nil
+}
+
+// queued возвращает число доставок в очереди
+func (s *fakeStore) queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+func (s *fakeStore) RecordDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveries = append(s.deliveries, delivery)
+	return nil
+}
+
+func (s *fakeStore) RecordFailure(ctx context.Context, id int64, threshold int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.subs {
+		if s.subs[i].ID == id {
+			s.subs[i].FailureCount++
+			if s.subs[i].FailureCount >= threshold && s.subs[i].Active {
+				s.subs[i].Active = false
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s *fakeStore) ResetFailures(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.subs {
+		if s.subs[i].ID == id {
+			s.subs[i].FailureCount = 0
+		}
+	}
+	return nil
+}
+
+// newTestDispatcher создает диспетчер с минимальными задержками между повторами
+// Тестовые получатели работают на loopback, поэтому внутренние адреса разрешены
+func newTestDispatcher(store Store, maxAttempts, threshold int) *Dispatcher {
+	return NewDispatcher(store, config.WebhooksConfig{
+		MaxAttempts:          maxAttempts,
+		InitialBackoff:       config.Duration{Duration: time.Millisecond},
+		MaxBackoff:           config.Duration{Duration: 5 * time.Millisecond},
+		FailureThreshold:     threshold,
+		AllowInsecureTargets: true,
+	}, log.New(io.Discard, "", 0))
+}
+
+// processQueue выполняет доставки из очереди, пока она не опустеет
+func processQueue(t *testing.T, dispatcher *Dispatcher, store *fakeStore) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for store.queued() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Очередь не опустела, осталось доставок: %d", store.queued())
+		}
+		if _, err := dispatcher.deliverDue(context.Background()); err != nil {
+			t.Fatalf("Ошибка обработки очереди: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+var testEvent = model.Event{
+	ID:          42,
+	AggregateID: 7,
+	Type:        model.EventUserUpdated,
+	Payload:     []byte(`{"id":7,"name":"Test User"}`),
+	CreatedAt:   time.Unix(1700000000, 0).UTC(),
+}
+
+// TestDispatcherSignsAndRetries проверяет подпись уведомления и повтор после ошибки получателя
+func TestDispatcherSignsAndRetries(t *testing.T) {
+	const secret = "top-secret"
+	var calls int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify(secret, r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+			t.Errorf("Некорректная подпись: %s", r.Header.Get(HeaderSignature))
+		}
+		if r.Header.Get(HeaderEventID) != "42" {
+			t.Errorf("Ожидался ID события 42, получен %s", r.Header.Get(HeaderEventID))
+		}
+
+		// Первая попытка завершается ошибкой, вторая - успешно
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	store := &fakeStore{subs: []model.WebhookSubscription{
+		{ID: 1, URL: receiver.URL, Secret: secret, Active: true, FailureCount: 3},
+		{ID: 2, URL: receiver.URL, Secret: secret, Active: true, EventTypes: []string{model.EventUserDeleted}},
+	}}
+
+	dispatcher := newTestDispatcher(store, 3, 10)
+	// Повторная публикация события ретранслятором не создает вторую доставку
+	for i := 0; i < 2; i++ {
+		if err := dispatcher.Publish(context.Background(), testEvent); err != nil {
+			t.Fatalf("Ошибка публикации: %v", err)
+		}
+	}
+
+	// Публикация только ставит событие в очередь, не обращаясь к получателю
+	if calls != 0 || store.queued() != 1 {
+		t.Fatalf("После публикации ожидалась одна доставка в очереди без запросов, в очереди %d, запросов %d",
+			store.queued(), calls)
+	}
+
+	processQueue(t, dispatcher, store)
+
+	if calls != 2 {
+		t.Errorf("Ожидалось 2 запроса к получателю, выполнено %d", calls)
+	}
+	if len(store.deliveries) != 2 || store.deliveries[0].Success || !store.deliveries[1].Success {
+		t.Errorf("Ожидались неудачная и успешная попытки, получено %+v", store.deliveries)
+	}
+	if store.deliveries[1].Attempt != 2 || store.deliveries[1].StatusCode != http.StatusNoContent {
+		t.Errorf("Некорректная запись о второй попытке: %+v", store.deliveries[1])
+	}
+	if store.subs[0].FailureCount != 0 {
+		t.Errorf("Счетчик ошибок не сброшен после успешной доставки: %d", store.subs[0].FailureCount)
+	}
+}
+
+// TestDispatcherDisablesFailingSubscription проверяет отключение подписки после серии неудачных доставок
+func TestDispatcherDisablesFailingSubscription(t *testing.T) {
+	var calls int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	store := &fakeStore{subs: []model.WebhookSubscription{
+		{ID: 1, URL: receiver.URL, Secret: "s", Active: true},
+	}}
+	dispatcher := newTestDispatcher(store, 2, 2)
+
+	for i := 0; i < 3; i++ {
+		event := testEvent
+		event.ID = int64(i + 1)
+		if err := dispatcher.Publish(context.Background(), event); err != nil {
+			t.Fatalf("Ошибка публикации: %v", err)
+		}
+	}
+	processQueue(t, dispatcher, store)
+
+	// События одного пользователя доставляются по порядку: две доставки по две попытки,
+	// третья доставка не выполняется - подписка уже отключена
+	if calls != 4 {
+		t.Errorf("Ожидалось 4 запроса к получателю, выполнено %d", calls)
+	}
+	if store.subs[0].Active {
+		t.Error("Подписка не отключена после превышения порога ошибок")
+	}
+	for i, delivery := range store.deliveries {
+		if want := int64(i/2 + 1); delivery.EventID != want {
+			t.Errorf("Попытка %d относится к событию %d, ожидалось %d", i+1, delivery.EventID, want)
+		}
+	}
+}
+
+// TestDispatcherDeliversWithinEventTenant проверяет, что событие получают только подписки арендатора события
+func TestDispatcherDeliversWithinEventTenant(t *testing.T) {
+	var acmeCalls, globexCalls int32
+
+	acme := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&acmeCalls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer acme.Close()
+	globex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&globexCalls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer globex.Close()
+
+	store := &fakeStore{
+		subs: []model.WebhookSubscription{
+			{ID: 1, URL: acme.URL, Secret: "s", Active: true},
+			{ID: 2, URL: globex.URL, Secret: "s", Active: true},
+		},
+		tenants: map[int64]string{1: "acme", 2: "globex"},
+	}
+
+	event := testEvent
+	event.TenantID = "acme"
+	dispatcher := newTestDispatcher(store, 1, 10)
+	if err := dispatcher.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Ошибка публикации: %v", err)
+	}
+	processQueue(t, dispatcher, store)
+
+	if acmeCalls != 1 || globexCalls != 0 {
+		t.Errorf("Ожидался один запрос к получателю acme и ни одного к globex, выполнено %d и %d", acmeCalls, globexCalls)
+	}
+}
+
+// TestDispatcherRefusesInternalTargets проверяет, что без allow_insecure_targets уведомление
+// не отправляется на loopback, даже если адрес подписки прошел проверку раньше
+func TestDispatcherRefusesInternalTargets(t *testing.T) {
+	var calls int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	store := &fakeStore{subs: []model.WebhookSubscription{
+		{ID: 1, URL: receiver.URL, Secret: "s", Active: true},
+	}}
+	dispatcher := NewDispatcher(store, config.WebhooksConfig{MaxAttempts: 1}, log.New(io.Discard, "", 0))
+
+	if err := dispatcher.Publish(context.Background(), testEvent); err != nil {
+		t.Fatalf("Ошибка публикации: %v", err)
+	}
+	processQueue(t, dispatcher, store)
+
+	if calls != 0 {
+		t.Errorf("Получатель на loopback вызван %d раз", calls)
+	}
+	if len(store.deliveries) != 1 || store.deliveries[0].Success ||
+		!strings.Contains(store.deliveries[0].Error, ErrForbiddenTarget.Error()) {
+		t.Errorf("Ожидалась неудачная доставка с ошибкой %q, получено %+v", ErrForbiddenTarget, store.deliveries)
+	}
+}
+
+// TestDispatcherDoesNotFollowRedirects проверяет, что перенаправление получателя считается неудачной доставкой
+func TestDispatcherDoesNotFollowRedirects(t *testing.T) {
+	var internalCalls int32
+
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&internalCalls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer internal.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusTemporaryRedirect))
+	defer receiver.Close()
+
+	store := &fakeStore{subs: []model.WebhookSubscription{
+		{ID: 1, URL: receiver.URL, Secret: "s", Active: true},
+	}}
+	dispatcher := newTestDispatcher(store, 1, 10)
+
+	if err := dispatcher.Publish(context.Background(), testEvent); err != nil {
+		t.Fatalf("Ошибка публикации: %v", err)
+	}
+	processQueue(t, dispatcher, store)
+
+	if internalCalls != 0 {
+		t.Errorf("Диспетчер последовал перенаправлению, адрес перенаправления вызван %d раз", internalCalls)
+	}
+	if len(store.deliveries) != 1 || store.deliveries[0].Success ||
+		store.deliveries[0].StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("Ожидалась неудачная доставка с кодом %d, получено %+v", http.StatusTemporaryRedirect, store.deliveries)
+	}
+}
+
+// TestValidURL проверяет отказ в подписке на http, localhost и адреса внутренних сетей
+func TestValidURL(t *testing.T) {
+	tests := []struct {
+		url           string
+		allowInsecure bool
+		want          bool
+	}{
+		{"https://partner.example.com/hooks", false, true},
+		{"https://203.0.113.10:8443/hooks", false, true},
+		{"http://partner.example.com/hooks", false, false},
+		{"https://localhost/hooks", false, false},
+		{"https://api.localhost./hooks", false, false},
+		{"https://127.0.0.1:6060/debug/vars", false, false},
+		{"https://[::1]/hooks", false, false},
+		{"https://[::ffff:127.0.0.1]/hooks", false, false},
+		{"https://169.254.169.254/latest/meta-data", false, false},
+		{"https://10.0.0.5/hooks", false, false},
+		{"https://192.168.1.1/hooks", false, false},
+		{"https://0.0.0.0/hooks", false, false},
+		{"partner.example.com/hooks", false, false},
+		{"http://127.0.0.1:9000/hooks", true, true},
+		{"ftp://127.0.0.1/hooks", true, false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidURL(tt.url, tt.allowInsecure); got != tt.want {
+			t.Errorf("ValidURL(%q, %t) = %t, ожидалось %t", tt.url, tt.allowInsecure, got, tt.want)
+		}
+	}
+}
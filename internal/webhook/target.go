@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// ErrForbiddenTarget возвращается при попытке соединения с адресом, на который уведомления не отправляются
+var ErrForbiddenTarget = errors.New("webhook target address is not allowed")
+
+// ValidURL проверяет URL подписки при создании и изменении
+// Допускаются только https и внешние адреса: loopback, частные сети и localhost запрещены, чтобы подписка
+// не позволяла обращаться к внутренним сервисам от имени сервиса пользователей
+// allowInsecure разрешает http и внутренние адреса (для разработки и тестов)
+func ValidURL(raw string, allowInsecure bool) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if allowInsecure {
+		return u.Scheme == "http" || u.Scheme == "https"
+	}
+	if u.Scheme != "https" {
+		return false
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return false
+	}
+	return true
+}
+
+// dialControl проверяет адрес перед установкой соединения, то есть уже после разрешения имени:
+// имя, которое разрешается во внутренний адрес (в том числе после смены записи DNS), отклоняется
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, addr)
+	}
+	return nil
+}
+
+// publicAddr проверяет, что адрес не относится к loopback, частным, link-local, multicast и неуказанным адресам
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() && !addr.IsMulticast() && !addr.IsUnspecified()
+}
@@ -1,6 +1,4 @@
--- Миграция для отката заполнения таблицы тестовыми данными
--- Выполняется при откате базы данных
+-- Откат пустой миграции 002 не изменяет данные
+-- Тестовые пользователи удаляются вручную (userctl users delete)
 
--- Удаление тестовых пользователей, добавленных в миграции seed
-DELETE FROM users
-WHERE email IN ('john@example.com', 'jane@example.com', 'test@example.com');
+SELECT 1;
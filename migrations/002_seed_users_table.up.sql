@@ -1,9 +1,5 @@
--- Миграция для заполнения таблицы пользователей тестовыми данными
--- Выполняется при обновлении базы данных
+-- Миграция больше не добавляет тестовых пользователей
+-- Тестовые данные перенесены в фикстуры internal/seed и добавляются явно командой userctl seed,
+-- поэтому в production не попадают. Версия сохранена, чтобы не нарушать нумерацию примененных миграций
 
--- Вставка тестовых пользователей при первом запуске приложения
-INSERT INTO users (name, email, created_at)
-VALUES
-  ('John Doe', 'john@example.com', NOW()),   -- Тестовый пользователь 1
-  ('Jane Doe', 'jane@example.com', NOW()),   -- Тестовый пользователь 2
-  ('Test User', 'test@example.com', NOW());  -- Тестовый пользователь 3
+SELECT 1;
@@ -0,0 +1,5 @@
+-- Миграция для отката создания таблицы исходящих событий
+-- Выполняется при откате базы данных
+
+-- Удаление таблицы outbox (если существует)
+DROP TABLE IF EXISTS outbox;
@@ -0,0 +1,18 @@
+-- Миграция для создания таблицы исходящих событий (transactional outbox)
+-- Выполняется при обновлении базы данных
+
+-- События записываются в одной транзакции с изменением пользователя
+-- и затем публикуются фоновым ретранслятором
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,                                  -- Порядковый номер события, определяет порядок доставки
+    aggregate_id BIGINT NOT NULL,                              -- ID пользователя, к которому относится событие
+    event_type VARCHAR(100) NOT NULL,                          -- Тип события (UserCreated, UserUpdated, UserDeleted)
+    payload JSONB NOT NULL,                                    -- Данные события
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(), -- Дата и время возникновения события
+    published_at TIMESTAMP WITH TIME ZONE,                     -- Дата и время успешной публикации (NULL - еще не опубликовано)
+    attempts INT NOT NULL DEFAULT 0,                           -- Количество неудачных попыток публикации
+    last_error TEXT                                            -- Текст последней ошибки публикации
+);
+
+-- Частичный индекс для быстрого поиска неопубликованных событий
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox(id) WHERE published_at IS NULL;
@@ -0,0 +1,6 @@
+-- Миграция для отката создания таблиц вебхуков
+-- Выполняется при откате базы данных
+
+-- Удаление журнала доставок и подписок (если существуют)
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
@@ -0,0 +1,31 @@
+-- Миграция для создания таблиц подписок на вебхуки и журнала доставок
+-- Выполняется при обновлении базы данных
+
+-- Подписки партнеров на события пользователей
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id BIGSERIAL PRIMARY KEY,                                  -- Уникальный идентификатор подписки
+    url VARCHAR(2048) NOT NULL,                                -- URL получателя уведомлений
+    secret VARCHAR(255) NOT NULL,                              -- Секрет для подписи HMAC-SHA256
+    event_types TEXT[] NOT NULL DEFAULT '{}',                  -- Типы событий (пустой массив - все события)
+    active BOOLEAN NOT NULL DEFAULT TRUE,                      -- Признак активности подписки
+    failure_count INT NOT NULL DEFAULT 0,                      -- Количество неудачных доставок подряд
+    disabled_at TIMESTAMP WITH TIME ZONE,                      -- Дата автоматического отключения после серии ошибок
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW() -- Дата и время создания подписки
+);
+
+-- Журнал попыток доставки вебхуков
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,                                                          -- Уникальный идентификатор попытки
+    subscription_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE, -- Подписка, по которой выполнялась доставка
+    event_id BIGINT NOT NULL,                                                          -- ID события из таблицы outbox
+    event_type VARCHAR(100) NOT NULL,                                                  -- Тип события
+    attempt INT NOT NULL,                                                              -- Номер попытки (начиная с 1)
+    status_code INT,                                                                   -- HTTP код ответа получателя (NULL - ответ не получен)
+    error TEXT,                                                                        -- Текст ошибки доставки
+    duration_ms BIGINT NOT NULL,                                                       -- Длительность запроса в миллисекундах
+    success BOOLEAN NOT NULL,                                                          -- Признак успешной доставки
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()                         -- Дата и время попытки
+);
+
+-- Индекс для выборки журнала доставок по подписке
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON webhook_deliveries(subscription_id, id);
@@ -0,0 +1,6 @@
+-- Миграция для отката создания журнала аудита
+-- Выполняется при откате базы данных
+
+-- Удаление журнала аудита и функции защиты от изменений (если существуют)
+DROP TABLE IF EXISTS user_audit;
+DROP FUNCTION IF EXISTS user_audit_forbid_change();
@@ -0,0 +1,30 @@
+-- Миграция для создания журнала аудита изменений пользователей
+-- Выполняется при обновлении базы данных
+
+-- Журнал аудита: одна запись на каждое создание, изменение и удаление пользователя
+-- Внешний ключ на users не создается, чтобы история сохранялась после удаления пользователя
+CREATE TABLE IF NOT EXISTS user_audit (
+    id BIGSERIAL PRIMARY KEY,                                  -- Уникальный идентификатор записи
+    user_id BIGINT NOT NULL,                                   -- ID измененного пользователя
+    action VARCHAR(20) NOT NULL,                               -- Действие: create, update, delete
+    actor VARCHAR(255) NOT NULL DEFAULT '',                    -- Инициатор изменения
+    request_id VARCHAR(100) NOT NULL DEFAULT '',               -- ID HTTP запроса
+    ip VARCHAR(64) NOT NULL DEFAULT '',                        -- IP-адрес клиента
+    diff JSONB NOT NULL,                                       -- Измененные поля в формате {"поле": {"before": ..., "after": ...}}
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW() -- Дата и время изменения
+);
+
+-- Индекс для постраничного чтения истории пользователя
+CREATE INDEX IF NOT EXISTS user_audit_user_idx ON user_audit(user_id, id);
+
+-- Журнал допускает только добавление записей
+CREATE OR REPLACE FUNCTION user_audit_forbid_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'user_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS user_audit_append_only ON user_audit;
+CREATE TRIGGER user_audit_append_only
+    BEFORE UPDATE OR DELETE ON user_audit
+    FOR EACH ROW EXECUTE FUNCTION user_audit_forbid_change();
@@ -0,0 +1,6 @@
+-- Миграция для отката добавления времени последнего изменения пользователя
+-- Выполняется при откате базы данных
+
+DROP TRIGGER IF EXISTS users_updated_at ON users;
+DROP FUNCTION IF EXISTS users_set_updated_at();
+ALTER TABLE users DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,22 @@
+-- Миграция для добавления времени последнего изменения пользователя
+-- Выполняется при обновлении базы данных
+
+-- Существующим пользователям время изменения заполняется временем создания
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE;
+UPDATE users SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE users ALTER COLUMN updated_at SET DEFAULT NOW();
+ALTER TABLE users ALTER COLUMN updated_at SET NOT NULL;
+
+-- Время изменения обновляется триггером при любом изменении строки,
+-- в том числе при изменениях в обход репозитория
+CREATE OR REPLACE FUNCTION users_set_updated_at() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at := NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_updated_at ON users;
+CREATE TRIGGER users_updated_at
+    BEFORE UPDATE ON users
+    FOR EACH ROW EXECUTE FUNCTION users_set_updated_at();
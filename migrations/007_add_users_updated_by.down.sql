@@ -0,0 +1,5 @@
+-- Миграция для отката добавления инициатора последнего изменения пользователя
+-- Выполняется при откате базы данных
+
+DROP INDEX IF EXISTS users_updated_at_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS updated_by;
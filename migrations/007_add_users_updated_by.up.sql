@@ -0,0 +1,17 @@
+-- Миграция для добавления инициатора последнего изменения пользователя
+-- Выполняется при обновлении базы данных
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_by VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Существующим пользователям инициатор заполняется из последней записи журнала аудита
+UPDATE users u
+SET updated_by = a.actor
+FROM (
+    SELECT DISTINCT ON (user_id) user_id, actor
+    FROM user_audit
+    ORDER BY user_id, id DESC
+) a
+WHERE a.user_id = u.id AND u.updated_by = '';
+
+-- Индекс для инкрементальной синхронизации по времени изменения (updated_since)
+CREATE INDEX IF NOT EXISTS users_updated_at_idx ON users(updated_at, id);
@@ -0,0 +1,12 @@
+-- Миграция для отката добавления профиля пользователя и метаданных
+-- Выполняется при откате базы данных
+
+DROP INDEX IF EXISTS users_metadata_idx;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_metadata_object;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS metadata,
+    DROP COLUMN IF EXISTS avatar_url,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS locale,
+    DROP COLUMN IF EXISTS phone,
+    DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,17 @@
+-- Миграция для добавления профиля пользователя и произвольных метаданных
+-- Выполняется при обновлении базы данных
+
+-- Поля профиля необязательны, пустая строка означает, что значение не задано
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(100) NOT NULL DEFAULT ''; -- Отображаемое имя
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone VARCHAR(16) NOT NULL DEFAULT '';         -- Телефон в формате E.164
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT '';        -- Язык (тег BCP 47)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT '';      -- Часовой пояс IANA
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url VARCHAR(2048) NOT NULL DEFAULT '';  -- URL аватара
+
+-- Метаданные - JSON объект с произвольными атрибутами, размер ограничивается сервисом
+ALTER TABLE users ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_metadata_object;
+ALTER TABLE users ADD CONSTRAINT users_metadata_object CHECK (jsonb_typeof(metadata) = 'object');
+
+-- Индекс для фильтрации списка по наличию ключей и вхождению значений метаданных
+CREATE INDEX IF NOT EXISTS users_metadata_idx ON users USING GIN (metadata);
@@ -0,0 +1,20 @@
+-- Миграция для отката разделения пользователей по арендаторам
+-- Выполняется при откате базы данных
+-- Откат завершится ошибкой, если одна электронная почта используется у нескольких арендаторов
+
+DROP POLICY IF EXISTS user_audit_tenant_isolation ON user_audit;
+DROP POLICY IF EXISTS users_tenant_isolation ON users;
+ALTER TABLE user_audit DISABLE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS user_audit_tenant_user_idx;
+CREATE INDEX IF NOT EXISTS user_audit_user_idx ON user_audit(user_id, id);
+DROP INDEX IF EXISTS users_tenant_updated_at_idx;
+CREATE INDEX IF NOT EXISTS users_updated_at_idx ON users(updated_at, id);
+
+DROP INDEX IF EXISTS users_tenant_email_idx;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+CREATE INDEX IF NOT EXISTS users_email_idx ON users(email);
+
+ALTER TABLE user_audit DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,30 @@
+-- Миграция для разделения пользователей по арендаторам (tenant)
+-- Выполняется при обновлении базы данных
+
+-- Существующие пользователи и записи аудита относятся к арендатору по умолчанию
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE user_audit ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+-- Электронная почта уникальна в пределах арендатора
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+DROP INDEX IF EXISTS users_email_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_email_idx ON users(tenant_id, email);
+
+-- Индексы списка и истории дополняются арендатором, так как все запросы выполняются в его пределах
+DROP INDEX IF EXISTS users_updated_at_idx;
+CREATE INDEX IF NOT EXISTS users_tenant_updated_at_idx ON users(tenant_id, updated_at, id);
+DROP INDEX IF EXISTS user_audit_user_idx;
+CREATE INDEX IF NOT EXISTS user_audit_tenant_user_idx ON user_audit(tenant_id, user_id, id);
+
+-- Политики row-level security ограничивают строки арендатором из параметра сеанса app.tenant_id
+-- Политики действуют только после ALTER TABLE ... ENABLE ROW LEVEL SECURITY и не применяются
+-- к владельцу таблицы (см. раздел "Арендаторы" в readme.md)
+DROP POLICY IF EXISTS users_tenant_isolation ON users;
+CREATE POLICY users_tenant_isolation ON users
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+DROP POLICY IF EXISTS user_audit_tenant_isolation ON user_audit;
+CREATE POLICY user_audit_tenant_isolation ON user_audit
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,6 @@
+-- Миграция для отката создания групп пользователей
+-- Выполняется при откате базы данных
+
+-- Удаление участников и групп (если существуют)
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
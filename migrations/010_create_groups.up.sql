@@ -0,0 +1,42 @@
+-- Миграция для создания групп пользователей и участия в группах
+-- Выполняется при обновлении базы данных
+
+-- Группы (команды) пользователей арендатора
+CREATE TABLE IF NOT EXISTS groups (
+    id BIGSERIAL PRIMARY KEY,                                   -- Уникальный идентификатор группы
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',           -- Арендатор группы
+    name VARCHAR(100) NOT NULL,                                 -- Название группы
+    description VARCHAR(500) NOT NULL DEFAULT '',               -- Описание группы
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(), -- Дата и время создания группы
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()  -- Дата и время последнего изменения группы
+);
+
+-- Название группы уникально в пределах арендатора
+CREATE UNIQUE INDEX IF NOT EXISTS groups_tenant_name_idx ON groups(tenant_id, name);
+
+-- Участники групп
+-- Участие удаляется вместе с группой; при удалении пользователя его участие удаляет сервис
+-- пользователей в транзакции удаления, внешний ключ не позволяет оставить участие удаленного пользователя
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE, -- Группа
+    user_id BIGINT NOT NULL REFERENCES users(id),                     -- Участник группы
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',                 -- Арендатор группы и пользователя
+    role VARCHAR(20) NOT NULL DEFAULT 'member'                        -- Роль участника: owner, admin, member
+        CONSTRAINT group_members_role_check CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),       -- Дата и время добавления в группу
+    PRIMARY KEY (group_id, user_id)
+);
+
+-- Индекс для выборки групп пользователя и удаления участия пользователя
+CREATE INDEX IF NOT EXISTS group_members_user_idx ON group_members(user_id);
+
+-- Политики row-level security по аналогии с users и user_audit
+DROP POLICY IF EXISTS groups_tenant_isolation ON groups;
+CREATE POLICY groups_tenant_isolation ON groups
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+DROP POLICY IF EXISTS group_members_tenant_isolation ON group_members;
+CREATE POLICY group_members_tenant_isolation ON group_members
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
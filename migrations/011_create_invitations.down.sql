@@ -0,0 +1,8 @@
+-- Миграция для отката приглашений пользователей
+-- Выполняется при откате базы данных
+
+DROP TABLE IF EXISTS invitations;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS email_verified,
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,39 @@
+-- Миграция для приглашений пользователей по электронной почте
+-- Выполняется при обновлении базы данных
+
+-- Роль пользователя в организации арендатора и признак подтвержденной электронной почты
+-- Существующие пользователи получают роль member, их почта считается неподтвержденной
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'member';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('admin', 'member'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Приглашения: в таблице хранится только хэш токена, сам токен отправляется приглашенному в письме
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGSERIAL PRIMARY KEY,                                   -- Уникальный идентификатор приглашения
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',           -- Арендатор, в который приглашается пользователь
+    email VARCHAR(100) NOT NULL,                                -- Электронная почта приглашенного
+    role VARCHAR(20) NOT NULL                                   -- Роль, которую получит пользователь
+        CONSTRAINT invitations_role_check CHECK (role IN ('admin', 'member')),
+    token_hash CHAR(64) NOT NULL,                               -- SHA-256 токена приглашения в шестнадцатеричном виде
+    invited_by VARCHAR(255) NOT NULL DEFAULT '',                -- Инициатор приглашения
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,               -- Срок действия приглашения
+    accepted_at TIMESTAMP WITH TIME ZONE,                       -- Дата принятия приглашения
+    revoked_at TIMESTAMP WITH TIME ZONE,                        -- Дата отзыва приглашения
+    user_id BIGINT,                                             -- Пользователь, созданный при принятии
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()  -- Дата и время создания приглашения
+);
+
+-- Поиск приглашения по токену при принятии
+CREATE UNIQUE INDEX IF NOT EXISTS invitations_token_hash_idx ON invitations(token_hash);
+
+-- Выборка действующих приглашений арендатора и приглашений на одну почту
+CREATE INDEX IF NOT EXISTS invitations_tenant_pending_idx ON invitations(tenant_id, email)
+    WHERE accepted_at IS NULL AND revoked_at IS NULL;
+
+-- Политика row-level security по аналогии с users
+-- Токен приглашения начинается с ID арендатора, поэтому принятие приглашения тоже выполняется в его пределах
+DROP POLICY IF EXISTS invitations_tenant_isolation ON invitations;
+CREATE POLICY invitations_tenant_isolation ON invitations
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
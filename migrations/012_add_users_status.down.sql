@@ -0,0 +1,7 @@
+-- Миграция для отката состояния учетной записи пользователя
+-- Выполняется при откате базы данных
+
+ALTER TABLE user_audit DROP COLUMN IF EXISTS reason;
+DROP INDEX IF EXISTS users_tenant_status_idx;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users DROP COLUMN IF EXISTS status;
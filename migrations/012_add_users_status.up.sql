@@ -0,0 +1,15 @@
+-- Миграция для состояния учетной записи пользователя
+-- Выполняется при обновлении базы данных
+
+-- Состояние учетной записи: pending (ожидает активации), active, suspended (приостановлена администратором),
+-- locked (заблокирована системой). Удаленные пользователи удаляются из таблицы, состояние deleted не хранится
+-- Существующие пользователи считаются активными
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN ('pending', 'active', 'suspended', 'locked'));
+
+-- Фильтр списка пользователей по состоянию
+CREATE INDEX IF NOT EXISTS users_tenant_status_idx ON users(tenant_id, status);
+
+-- Причина изменения в журнале аудита (например, приостановки учетной записи), пустая строка - не указана
+ALTER TABLE user_audit ADD COLUMN IF NOT EXISTS reason TEXT NOT NULL DEFAULT '';
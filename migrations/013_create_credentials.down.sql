@@ -0,0 +1,5 @@
+-- Миграция для отката паролей пользователей и учета неудачных попыток входа
+-- Выполняется при откате базы данных
+
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS user_credentials;
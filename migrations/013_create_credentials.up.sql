@@ -0,0 +1,36 @@
+-- Миграция для паролей пользователей и учета неудачных попыток входа
+-- Выполняется при обновлении базы данных
+
+-- Пароли пользователей: хранится только хэш bcrypt
+-- Пароль хранится отдельно от users, чтобы его изменение не меняло updated_at пользователя и не попадало
+-- в выборки пользователей; пользователь без строки в таблице войти по паролю не может
+CREATE TABLE IF NOT EXISTS user_credentials (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE, -- Пользователь
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',                   -- Арендатор пользователя
+    password_hash VARCHAR(100) NOT NULL,                                -- Хэш пароля bcrypt
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()          -- Дата и время последней смены пароля
+);
+
+-- Учет неудачных попыток входа по учетной записи (электронной почте) и по IP-адресу клиента
+-- Учет по электронной почте ведется и для несуществующих пользователей, чтобы ответ не раскрывал их наличие
+CREATE TABLE IF NOT EXISTS login_attempts (
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',    -- Арендатор, в пределах которого выполняется вход
+    scope VARCHAR(20) NOT NULL                           -- Область учета: account или ip
+        CONSTRAINT login_attempts_scope_check CHECK (scope IN ('account', 'ip')),
+    key VARCHAR(255) NOT NULL,                           -- Электронная почта в нижнем регистре или IP-адрес
+    failures INTEGER NOT NULL DEFAULT 0,                 -- Число неудачных попыток подряд в пределах окна учета
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,   -- Время последней неудачной попытки
+    locked_until TIMESTAMP WITH TIME ZONE,               -- Окончание временной блокировки
+    PRIMARY KEY (tenant_id, scope, key)
+);
+
+-- Политики row-level security по аналогии с users
+DROP POLICY IF EXISTS user_credentials_tenant_isolation ON user_credentials;
+CREATE POLICY user_credentials_tenant_isolation ON user_credentials
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+DROP POLICY IF EXISTS login_attempts_tenant_isolation ON login_attempts;
+CREATE POLICY login_attempts_tenant_isolation ON login_attempts
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,5 @@
+-- Миграция для отката двухфакторной аутентификации
+-- Выполняется при откате базы данных
+
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
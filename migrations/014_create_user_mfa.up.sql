@@ -0,0 +1,36 @@
+-- Миграция для двухфакторной аутентификации (TOTP) и кодов восстановления
+-- Выполняется при обновлении базы данных
+
+-- Секреты TOTP пользователей, зашифрованные ключом auth.mfa_encryption_key (AES-256-GCM)
+-- Секрет без confirmed_at ожидает подтверждения кодом из приложения и при входе не запрашивается
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE, -- Пользователь
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',                   -- Арендатор пользователя
+    secret_encrypted BYTEA NOT NULL,                                    -- Зашифрованный секрет (nonce + шифротекст)
+    confirmed_at TIMESTAMP WITH TIME ZONE,                              -- Дата подтверждения (включения)
+    last_used_step BIGINT NOT NULL DEFAULT 0,                           -- Шаг времени последнего принятого кода
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()          -- Дата и время начала подключения
+);
+
+-- Одноразовые коды восстановления: хранится только SHA-256 кода
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,                                       -- Уникальный идентификатор кода
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- Пользователь
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',               -- Арендатор пользователя
+    code_hash CHAR(64) NOT NULL,                                    -- SHA-256 кода в шестнадцатеричном виде
+    used_at TIMESTAMP WITH TIME ZONE                                -- Дата использования
+);
+
+-- Поиск кода восстановления пользователя при входе
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_idx ON user_recovery_codes(user_id, code_hash);
+
+-- Политики row-level security по аналогии с users
+DROP POLICY IF EXISTS user_mfa_tenant_isolation ON user_mfa;
+CREATE POLICY user_mfa_tenant_isolation ON user_mfa
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+DROP POLICY IF EXISTS user_recovery_codes_tenant_isolation ON user_recovery_codes;
+CREATE POLICY user_recovery_codes_tenant_isolation ON user_recovery_codes
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,4 @@
+-- Миграция для отката ключей API межсервисного доступа
+-- Выполняется при откате базы данных
+
+DROP TABLE IF EXISTS api_keys;
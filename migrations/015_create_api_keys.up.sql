@@ -0,0 +1,32 @@
+-- Миграция для ключей API межсервисного доступа
+-- Выполняется при обновлении базы данных
+
+-- Ключи API: хранится только хэш ключа, сам ключ показывается один раз при создании
+-- Префикс хранится открыто и позволяет узнать ключ в списке и в журнале аудита
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,                                   -- Уникальный идентификатор ключа
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',           -- Арендатор, в пределах которого действует ключ
+    name VARCHAR(100) NOT NULL,                                 -- Название ключа (например, имя сервиса)
+    prefix VARCHAR(16) NOT NULL,                                -- Открытый префикс ключа
+    key_hash CHAR(64) NOT NULL,                                 -- SHA-256 ключа в шестнадцатеричном виде
+    scopes TEXT[] NOT NULL,                                     -- Разрешения ключа
+    created_by VARCHAR(255) NOT NULL DEFAULT '',                -- Инициатор создания ключа
+    expires_at TIMESTAMP WITH TIME ZONE,                        -- Срок действия (NULL - бессрочный)
+    last_used_at TIMESTAMP WITH TIME ZONE,                      -- Время последнего использования
+    revoked_at TIMESTAMP WITH TIME ZONE,                        -- Дата отзыва
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()  -- Дата и время создания ключа
+);
+
+-- Поиск ключа при проверке запроса и уникальность префикса
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_key_hash_idx ON api_keys(key_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_prefix_idx ON api_keys(prefix);
+
+-- Выборка действующих ключей арендатора
+CREATE INDEX IF NOT EXISTS api_keys_tenant_active_idx ON api_keys(tenant_id, id) WHERE revoked_at IS NULL;
+
+-- Политика row-level security по аналогии с users
+-- Ключ содержит ID арендатора, поэтому проверка ключа тоже выполняется в его пределах
+DROP POLICY IF EXISTS api_keys_tenant_isolation ON api_keys;
+CREATE POLICY api_keys_tenant_isolation ON api_keys
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
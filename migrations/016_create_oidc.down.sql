@@ -0,0 +1,6 @@
+-- Миграция для отката провайдера OpenID Connect
+-- Выполняется при откате базы данных
+
+DROP TABLE IF EXISTS oidc_signing_keys;
+DROP TABLE IF EXISTS oidc_authorization_codes;
+DROP TABLE IF EXISTS oidc_clients;
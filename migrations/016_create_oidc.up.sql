@@ -0,0 +1,54 @@
+-- Миграция для провайдера OpenID Connect
+-- Выполняется при обновлении базы данных
+
+-- Зарегистрированные клиенты (приложения), которые входят через провайдер
+-- Для конфиденциальных клиентов хранится только хэш секрета, публичные клиенты проходят только проверку PKCE
+CREATE TABLE IF NOT EXISTS oidc_clients (
+    id BIGSERIAL PRIMARY KEY,                                  -- Уникальный идентификатор регистрации
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',          -- Арендатор, пользователи которого входят в приложение
+    client_id VARCHAR(100) NOT NULL,                           -- Идентификатор клиента (начинается с ID арендатора)
+    secret_hash CHAR(64),                                      -- SHA-256 секрета клиента (NULL - публичный клиент)
+    name VARCHAR(100) NOT NULL,                                -- Название приложения
+    redirect_uris TEXT[] NOT NULL,                             -- Разрешенные адреса возврата
+    created_by VARCHAR(255) NOT NULL DEFAULT '',               -- Инициатор регистрации
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW() -- Дата и время регистрации
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS oidc_clients_client_id_idx ON oidc_clients(client_id);
+CREATE INDEX IF NOT EXISTS oidc_clients_tenant_idx ON oidc_clients(tenant_id, id);
+
+-- Коды авторизации: хранится только хэш кода, код удаляется при обмене на токены
+CREATE TABLE IF NOT EXISTS oidc_authorization_codes (
+    code_hash CHAR(64) PRIMARY KEY,                                 -- SHA-256 кода авторизации
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',               -- Арендатор пользователя
+    client_id VARCHAR(100) NOT NULL,                                -- Клиент, которому выдан код
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- Вошедший пользователь
+    redirect_uri TEXT NOT NULL,                                     -- Адрес возврата из запроса авторизации
+    scope TEXT NOT NULL,                                            -- Запрошенные области через пробел
+    nonce TEXT NOT NULL DEFAULT '',                                 -- Значение nonce для ID-токена
+    code_challenge VARCHAR(128) NOT NULL,                           -- Значение PKCE code_challenge (S256)
+    auth_time TIMESTAMP WITH TIME ZONE NOT NULL,                    -- Время входа пользователя
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL                    -- Срок действия кода
+);
+
+CREATE INDEX IF NOT EXISTS oidc_authorization_codes_expires_idx ON oidc_authorization_codes(tenant_id, expires_at);
+
+-- Ключи подписи токенов RS256 общие для всех арендаторов; закрытый ключ хранится зашифрованным
+-- ключом oidc.key_encryption_key. Таблица не ограничивается арендатором, политика row-level security не нужна
+CREATE TABLE IF NOT EXISTS oidc_signing_keys (
+    kid VARCHAR(32) PRIMARY KEY,                               -- Идентификатор ключа в JWKS
+    private_key_encrypted BYTEA NOT NULL,                      -- Закрытый ключ PKCS#8, зашифрованный AES-256-GCM
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW() -- Дата и время создания ключа
+);
+
+-- Политики row-level security по аналогии с users
+-- Идентификатор клиента начинается с ID арендатора, поэтому авторизация и обмен кода выполняются в его пределах
+DROP POLICY IF EXISTS oidc_clients_tenant_isolation ON oidc_clients;
+CREATE POLICY oidc_clients_tenant_isolation ON oidc_clients
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+DROP POLICY IF EXISTS oidc_authorization_codes_tenant_isolation ON oidc_authorization_codes;
+CREATE POLICY oidc_authorization_codes_tenant_isolation ON oidc_authorization_codes
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
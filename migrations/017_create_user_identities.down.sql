@@ -0,0 +1,5 @@
+-- Миграция для отката входа через внешних поставщиков удостоверений
+-- Выполняется при откате базы данных
+
+DROP TABLE IF EXISTS identity_login_states;
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,44 @@
+-- Миграция для входа через внешних поставщиков удостоверений (OpenID Connect)
+-- Выполняется при обновлении базы данных
+
+-- Внешние учетные записи, привязанные к пользователям
+-- Учетная запись поставщика определяется парой (provider, subject); к пользователю привязывается
+-- не более одной учетной записи каждого поставщика
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGSERIAL PRIMARY KEY,                                        -- Уникальный идентификатор привязки
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',                -- Арендатор пользователя
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,  -- Пользователь
+    provider VARCHAR(64) NOT NULL,                                   -- Имя поставщика из конфигурации
+    subject VARCHAR(255) NOT NULL,                                   -- Идентификатор пользователя у поставщика (утверждение sub)
+    email VARCHAR(255) NOT NULL DEFAULT '',                          -- Электронная почта у поставщика при привязке
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),      -- Дата и время привязки
+    last_login_at TIMESTAMP WITH TIME ZONE                           -- Время последнего входа через поставщика
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_identities_subject_idx ON user_identities(tenant_id, provider, subject);
+CREATE UNIQUE INDEX IF NOT EXISTS user_identities_user_provider_idx ON user_identities(user_id, provider);
+
+-- Незавершенные входы через поставщика: хранится только хэш параметра state,
+-- запись удаляется при возврате пользователя от поставщика
+CREATE TABLE IF NOT EXISTS identity_login_states (
+    state_hash CHAR(64) PRIMARY KEY,                  -- SHA-256 параметра state
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default', -- Арендатор, в который выполняется вход
+    provider VARCHAR(64) NOT NULL,                    -- Имя поставщика
+    nonce VARCHAR(64) NOT NULL,                       -- Значение nonce для проверки ID-токена
+    code_verifier VARCHAR(128) NOT NULL,              -- Значение PKCE code_verifier
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL      -- Срок действия
+);
+
+CREATE INDEX IF NOT EXISTS identity_login_states_expires_idx ON identity_login_states(tenant_id, expires_at);
+
+-- Политики row-level security по аналогии с users
+-- Параметр state начинается с ID арендатора, поэтому возврат от поставщика выполняется в его пределах
+DROP POLICY IF EXISTS user_identities_tenant_isolation ON user_identities;
+CREATE POLICY user_identities_tenant_isolation ON user_identities
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+DROP POLICY IF EXISTS identity_login_states_tenant_isolation ON identity_login_states;
+CREATE POLICY identity_login_states_tenant_isolation ON identity_login_states
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
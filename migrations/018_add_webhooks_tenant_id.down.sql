@@ -0,0 +1,10 @@
+-- Миграция для отката разделения подписок на вебхуки и исходящих событий по арендаторам
+-- Выполняется при откате базы данных
+
+DROP POLICY IF EXISTS webhook_subscriptions_tenant_isolation ON webhook_subscriptions;
+ALTER TABLE webhook_subscriptions DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS webhook_subscriptions_tenant_idx;
+
+ALTER TABLE outbox DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE webhook_subscriptions DROP COLUMN IF EXISTS tenant_id;
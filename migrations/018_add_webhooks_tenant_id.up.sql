@@ -0,0 +1,17 @@
+-- Миграция для разделения подписок на вебхуки и исходящих событий по арендаторам
+-- Выполняется при обновлении базы данных
+
+-- Существующие подписки и события относятся к арендатору по умолчанию
+-- Событие рассылается только подпискам арендатора пользователя, к которому оно относится
+ALTER TABLE webhook_subscriptions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+-- Список подписок арендатора
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_tenant_idx ON webhook_subscriptions(tenant_id, id);
+
+-- Политика row-level security по аналогии с users
+-- Диспетчер выбирает подписки в пределах арендатора события
+DROP POLICY IF EXISTS webhook_subscriptions_tenant_isolation ON webhook_subscriptions;
+CREATE POLICY webhook_subscriptions_tenant_isolation ON webhook_subscriptions
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
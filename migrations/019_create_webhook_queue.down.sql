@@ -0,0 +1,4 @@
+-- Миграция для удаления очереди доставки вебхуков
+-- Выполняется при откате базы данных
+
+DROP TABLE IF EXISTS webhook_queue;
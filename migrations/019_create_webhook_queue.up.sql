@@ -0,0 +1,26 @@
+-- Миграция для создания очереди доставки вебхуков
+-- Выполняется при обновлении базы данных
+
+-- Ожидающие доставки событий по подпискам
+-- Ретранслятор outbox только добавляет сюда строки, HTTP запросы к получателям выполняет отдельный
+-- обработчик вне транзакции outbox; строка удаляется после успешной доставки или последней попытки
+CREATE TABLE IF NOT EXISTS webhook_queue (
+    id BIGSERIAL PRIMARY KEY,                                                               -- Уникальный идентификатор доставки
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',                                       -- Арендатор события и подписки
+    subscription_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE, -- Подписка получателя
+    event_id BIGINT NOT NULL,                                                               -- ID события из таблицы outbox
+    aggregate_id BIGINT NOT NULL,                                                           -- ID пользователя, к которому относится событие
+    event_type VARCHAR(100) NOT NULL,                                                       -- Тип события
+    body JSONB NOT NULL,                                                                    -- Тело уведомления
+    attempts INT NOT NULL DEFAULT 0,                                                        -- Число выполненных попыток
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),                        -- Время следующей попытки
+    last_error TEXT,                                                                        -- Ошибка последней попытки
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()                              -- Дата и время постановки в очередь
+);
+
+-- Повторная публикация события ретранслятором не создает вторую доставку
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_queue_event_idx ON webhook_queue(subscription_id, event_id);
+
+-- Выборка доставок, время которых наступило, и проверка порядка событий одного пользователя
+CREATE INDEX IF NOT EXISTS webhook_queue_next_attempt_idx ON webhook_queue(next_attempt_at);
+CREATE INDEX IF NOT EXISTS webhook_queue_aggregate_idx ON webhook_queue(subscription_id, aggregate_id, id);
@@ -0,0 +1,4 @@
+-- Миграция для отката учета отвязанных учетных записей внешних поставщиков
+-- Выполняется при откате базы данных
+
+DROP TABLE IF EXISTS user_identity_unlinks;
@@ -0,0 +1,18 @@
+-- Миграция для учета отвязанных учетных записей внешних поставщиков
+-- Выполняется при обновлении базы данных
+
+-- Пары (пользователь, поставщик), отвязанные пользователем или администратором
+-- Вход через этого поставщика больше не привязывает учетную запись к пользователю по почте автоматически
+CREATE TABLE IF NOT EXISTS user_identity_unlinks (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- Пользователь
+    provider VARCHAR(64) NOT NULL,                                  -- Имя поставщика из конфигурации
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',               -- Арендатор пользователя
+    unlinked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),    -- Время последней отвязки
+    PRIMARY KEY (user_id, provider)
+);
+
+-- Политика row-level security по аналогии с user_identities
+DROP POLICY IF EXISTS user_identity_unlinks_tenant_isolation ON user_identity_unlinks;
+CREATE POLICY user_identity_unlinks_tenant_isolation ON user_identity_unlinks
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,9 @@
+-- Миграция для отката повторов публикации и отложенных событий outbox
+-- Выполняется при откате базы данных
+
+DROP INDEX IF EXISTS outbox_pending_aggregate_idx;
+DROP INDEX IF EXISTS outbox_pending_idx;
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox(id) WHERE published_at IS NULL;
+
+ALTER TABLE outbox DROP COLUMN IF EXISTS dead_at;
+ALTER TABLE outbox DROP COLUMN IF EXISTS next_attempt_at;
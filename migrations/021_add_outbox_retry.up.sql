@@ -0,0 +1,12 @@
+-- Миграция для повторов публикации и отложенных событий outbox
+-- Выполняется при обновлении базы данных
+
+-- Неудачное событие повторяется не раньше next_attempt_at, поэтому не занимает порции ретранслятора,
+-- а после исчерпания попыток откладывается (dead_at) и больше не выбирается
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(); -- Время следующей попытки публикации
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead_at TIMESTAMP WITH TIME ZONE;                               -- Время откладывания события (NULL - публикуется)
+
+-- Индексы ожидающих публикации событий: порядок выборки и поиск более ранних событий пользователя
+DROP INDEX IF EXISTS outbox_unpublished_idx;
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox(id) WHERE published_at IS NULL AND dead_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_pending_aggregate_idx ON outbox(aggregate_id, id) WHERE published_at IS NULL AND dead_at IS NULL;
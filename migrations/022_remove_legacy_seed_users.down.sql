@@ -0,0 +1,4 @@
+-- Откат удаления тестовых пользователей прежней миграции 002 не восстанавливает их
+-- Тестовые пользователи добавляются явно командой userctl seed -profile dev
+
+SELECT 1;
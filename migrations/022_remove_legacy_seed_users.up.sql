@@ -0,0 +1,30 @@
+-- Миграция для удаления тестовых пользователей, которых добавляла прежняя версия миграции 002
+-- Выполняется при обновлении базы данных
+
+-- Удаляются только пользователи арендатора по умолчанию, которые полностью совпадают с прежними тестовыми
+-- данными и ни разу не использовались: без записей в журнале аудита, участия в группах, пароля и привязанных
+-- учетных записей. Пользователи, созданные командой userctl seed, имеют запись create в журнале и не удаляются.
+-- Событие UserDeleted в outbox не записывается: о создании этих пользователей потребители тоже не узнавали
+WITH legacy AS (
+    DELETE FROM users u
+    WHERE u.tenant_id = 'default'
+      AND (u.name, u.email) IN (
+          ('John Doe', 'john@example.com'),
+          ('Jane Doe', 'jane@example.com'),
+          ('Test User', 'test@example.com')
+      )
+      AND NOT EXISTS (SELECT 1 FROM user_audit a WHERE a.user_id = u.id)
+      AND NOT EXISTS (SELECT 1 FROM group_members m WHERE m.user_id = u.id)
+      AND NOT EXISTS (SELECT 1 FROM user_credentials c WHERE c.user_id = u.id)
+      AND NOT EXISTS (SELECT 1 FROM user_identities i WHERE i.user_id = u.id)
+    RETURNING u.id, u.name, u.email, u.tenant_id
+)
+INSERT INTO user_audit (user_id, action, actor, diff, tenant_id, reason)
+SELECT id, 'delete', 'migration:022_remove_legacy_seed_users',
+       jsonb_build_object(
+           'id', jsonb_build_object('before', id),
+           'name', jsonb_build_object('before', name),
+           'email', jsonb_build_object('before', email)
+       ),
+       tenant_id, 'тестовый пользователь прежней миграции 002'
+FROM legacy;
@@ -0,0 +1,11 @@
+// Package migrations содержит SQL миграции схемы базы данных
+// Файлы встраиваются в исполняемые файлы сервиса и утилиты userctl,
+// поэтому миграции не зависят от рабочего каталога процесса
+package migrations
+
+import "embed"
+
+// FS содержит файлы миграций в формате golang-migrate (<версия>_<имя>.up.sql / .down.sql)
+//
+//go:embed *.sql
+var FS embed.FS
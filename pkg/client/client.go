@@ -0,0 +1,265 @@
+// Package client предоставляет типизированный Go клиент для REST API микросервиса пользователей
+//
+// Пример использования:
+//
+//	c := client.New("http://localhost:8080", client.WithToken(token))
+//	user, err := c.CreateUser(ctx, client.UserCreate{Name: "Test User", Email: "test@example.com"})
+//	if errors.Is(err, client.ErrInvalidInput) {
+//		// некорректные входные данные
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Значения по умолчанию для повторов идемпотентных запросов
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 200 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+	defaultTimeout        = 30 * time.Second
+)
+
+// Client выполняет запросы к API микросервиса пользователей
+// Безопасен для одновременного использования из нескольких горутин
+type Client struct {
+	baseURL        string                                    // Базовый URL сервиса без завершающего "/"
+	httpClient     *http.Client                              // HTTP клиент для выполнения запросов
+	token          func(ctx context.Context) (string, error) // Источник токена авторизации
+	tenant         string                                    // ID арендатора для заголовка X-Tenant-ID (пусто - не передается)
+	userAgent      string                                    // Значение заголовка User-Agent
+	maxAttempts    int                                       // Максимальное число попыток идемпотентного запроса
+	initialBackoff time.Duration                             // Задержка перед первым повтором
+	maxBackoff     time.Duration                             // Максимальная задержка между повторами
+}
+
+// Option настраивает клиент при создании
+type Option func(*Client)
+
+// WithHTTPClient задает HTTP клиент (например, с собственным транспортом или таймаутом)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken задает статический токен, передаваемый в заголовке "Authorization: Bearer <token>"
+func WithToken(token string) Option {
+	return WithTokenSource(func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// WithTokenSource задает функцию, возвращающую токен для каждого запроса
+// Используется, когда токен периодически обновляется
+func WithTokenSource(source func(ctx context.Context) (string, error)) Option {
+	return func(c *Client) {
+		c.token = source
+	}
+}
+
+// WithTenant задает арендатора, передаваемого в заголовке X-Tenant-ID
+// Нужен, если сервис принимает арендатора из заголовка; при авторизации токеном арендатор берется из токена
+func WithTenant(tenantID string) Option {
+	return func(c *Client) {
+		c.tenant = tenantID
+	}
+}
+
+// WithRetry настраивает повторы идемпотентных запросов (GET, PUT, DELETE)
+// maxAttempts - общее число попыток (1 - без повторов)
+// initialBackoff - задержка перед первым повтором, каждая следующая удваивается
+// maxBackoff - верхняя граница задержки
+func WithRetry(maxAttempts int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxAttempts = maxAttempts
+		c.initialBackoff = initialBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithUserAgent задает заголовок User-Agent
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New создает клиент API
+// baseURL - адрес сервиса, например "http://localhost:8080"
+// opts - дополнительные настройки
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		httpClient:     &http.Client{Timeout: defaultTimeout},
+		userAgent:      "usermicroservice-go-client",
+		maxAttempts:    defaultMaxAttempts,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.maxAttempts < 1 {
+		c.maxAttempts = 1
+	}
+
+	return c
+}
+
+// do выполняет запрос и декодирует JSON ответ в out
+// Идемпотентные запросы повторяются при сетевых ошибках и ответах 429, 502, 503, 504
+// method - HTTP метод
+// path - путь относительно базового URL, включая строку запроса
+// in - тело запроса (nil - без тела)
+// out - значение для декодирования ответа (nil - ответ не декодируется)
+// Возвращает заголовки успешного ответа
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) (http.Header, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	attempts := 1
+	if isIdempotent(method) {
+		attempts = c.maxAttempts
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			if err := sleep(ctx, c.backoff(attempt-1)); err != nil {
+				return nil, err
+			}
+		}
+
+		header, retry, err := c.doOnce(ctx, method, path, body, out)
+		if err == nil {
+			return header, nil
+		}
+		if !retry || ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// doOnce выполняет одну попытку запроса
+// Возвращает признак того, что ошибку имеет смысл повторить
+func (c *Client) doOnce(ctx context.Context, method, path string, body []byte, out interface{}) (http.Header, bool, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, false, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.tenant != "" {
+		req.Header.Set("X-Tenant-ID", c.tenant)
+	}
+
+	if c.token != nil {
+		token, err := c.token(ctx)
+		if err != nil {
+			return nil, false, fmt.Errorf("получение токена: %w", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		apiErr := &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+			RequestID:  resp.Header.Get("X-Request-ID"),
+		}
+		return nil, isRetryableStatus(resp.StatusCode), apiErr
+	}
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, false, fmt.Errorf("декодирование ответа: %w", err)
+		}
+	}
+
+	return resp.Header, false, nil
+}
+
+// backoff возвращает задержку перед повтором с номером retry (начиная с 1) со случайным разбросом
+func (c *Client) backoff(retry int) time.Duration {
+	delay := c.initialBackoff
+	for i := 1; i < retry && delay < c.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.maxBackoff {
+		delay = c.maxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// isIdempotent сообщает, можно ли безопасно повторить запрос с этим методом
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRetryableStatus сообщает, является ли код ответа временной ошибкой
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// sleep ожидает указанное время или отмену контекста
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
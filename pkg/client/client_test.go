@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient создает клиент с минимальными задержками между повторами
+func newTestClient(url string, opts ...Option) *Client {
+	opts = append([]Option{WithRetry(3, time.Millisecond, 2*time.Millisecond)}, opts...)
+	return New(url, opts...)
+}
+
+// TestGetUserRetriesAndInjectsToken проверяет повтор идемпотентного запроса и передачу токена
+func TestGetUserRetriesAndInjectsToken(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret-token" {
+			t.Errorf("Ожидался заголовок авторизации, получен %q", got)
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(User{ID: 7, Name: "Test User", Email: "test@example.com"})
+	}))
+	defer server.Close()
+
+	user, err := newTestClient(server.URL, WithToken("secret-token")).GetUser(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	if user.ID != 7 || user.Email != "test@example.com" {
+		t.Errorf("Получен неожиданный пользователь: %+v", user)
+	}
+	if calls != 3 {
+		t.Errorf("Ожидалось 3 попытки, выполнено %d", calls)
+	}
+}
+
+// TestCreateUserIsNotRetried проверяет, что неидемпотентный запрос не повторяется
+func TestCreateUserIsNotRetried(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(server.URL).CreateUser(context.Background(), UserCreate{Name: "a", Email: "b"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Ожидалась ошибка APIError с кодом 503, получено %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Ожидалась 1 попытка, выполнено %d", calls)
+	}
+}
+
+// TestTypedErrors проверяет сопоставление кодов ответа с ошибками сервиса
+func TestTypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "req-1")
+		if r.Method == http.MethodPut {
+			http.Error(w, "Некорректные входные данные", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := newTestClient(server.URL)
+
+	err := c.DeleteUser(context.Background(), 1)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Ожидалась ErrUserNotFound, получено %v", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RequestID != "req-1" || apiErr.Message != "Пользователь не найден" {
+		t.Errorf("Некорректные данные ошибки: %+v", apiErr)
+	}
+
+	if _, err := c.UpdateUser(context.Background(), 1, UserUpdate{}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Ожидалась ErrInvalidInput, получено %v", err)
+	}
+}
+
+// TestUpdateUserClearsMetadata проверяет, что указатель на пустой словарь отправляется как "metadata": {},
+// а nil не передает метаданные
+func TestUpdateUserClearsMetadata(t *testing.T) {
+	var bodies []map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Некорректное тело запроса: %v", err)
+		}
+		bodies = append(bodies, body)
+		json.NewEncoder(w).Encode(User{ID: 1})
+	}))
+	defer server.Close()
+
+	c := newTestClient(server.URL)
+	empty := map[string]interface{}{}
+	if _, err := c.UpdateUser(context.Background(), 1, UserUpdate{Metadata: &empty}); err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	if _, err := c.UpdateUser(context.Background(), 1, UserUpdate{Name: "Иван"}); err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+
+	if got := string(bodies[0]["metadata"]); got != "{}" {
+		t.Errorf("Ожидались пустые метаданные {}, отправлено %q", got)
+	}
+	if _, ok := bodies[1]["metadata"]; ok {
+		t.Errorf("Без метаданных поле metadata не должно отправляться: %v", bodies[1])
+	}
+}
+
+// TestListUsersIterator проверяет постраничный обход списка пользователей
+func TestListUsersIterator(t *testing.T) {
+	const total = 5
+	var pages int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pages, 1)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		users := []User{}
+		for id := offset + 1; id <= total && id <= offset+limit; id++ {
+			users = append(users, User{ID: int64(id), Email: fmt.Sprintf("user%d@example.com", id)})
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		json.NewEncoder(w).Encode(users)
+	}))
+	defer server.Close()
+
+	it := newTestClient(server.URL).ListUsers(context.Background(), ListUsersOptions{PageSize: 2})
+	var ids []int64
+	for it.Next() {
+		ids = append(ids, it.User().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Ошибка обхода: %v", err)
+	}
+
+	if len(ids) != total || ids[0] != 1 || ids[total-1] != total {
+		t.Errorf("Получены неожиданные ID: %v", ids)
+	}
+	if pages != 3 {
+		t.Errorf("Ожидалось 3 запроса страниц, выполнено %d", pages)
+	}
+	if it.Total() != total {
+		t.Errorf("Ожидалось общее количество %d, получено %d", total, it.Total())
+	}
+}
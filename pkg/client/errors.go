@@ -0,0 +1,46 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Ошибки, соответствующие ошибкам сервиса пользователей
+// Проверяются через errors.Is на ошибке, возвращенной методами клиента
+var (
+	ErrUserNotFound = errors.New("user not found")     // Пользователь не найден (404)
+	ErrInvalidInput = errors.New("invalid input data") // Некорректные входные данные (400)
+	ErrUnauthorized = errors.New("unauthorized")       // Отсутствует или недействителен токен (401, 403)
+	ErrConflict     = errors.New("conflict")           // Конфликт с текущим состоянием: почта занята, недопустимое изменение состояния (409)
+)
+
+// APIError описывает ответ сервиса с кодом ошибки
+type APIError struct {
+	StatusCode int    // HTTP код ответа
+	Message    string // Текст ошибки из тела ответа
+	RequestID  string // ID запроса из заголовка X-Request-ID для поиска в логах сервиса
+}
+
+// Error возвращает описание ошибки
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("user api: %d %s (request_id=%s)", e.StatusCode, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("user api: %d %s", e.StatusCode, e.Message)
+}
+
+// Is сопоставляет код ответа с ошибками сервиса для errors.Is
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUserNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrInvalidInput:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	}
+	return false
+}
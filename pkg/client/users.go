@@ -0,0 +1,267 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultPageSize - размер страницы итератора по умолчанию (максимум, допустимый сервисом)
+const defaultPageSize = 100
+
+// User представляет пользователя
+// Поля профиля необязательны: пустая строка означает, что значение не задано
+type User struct {
+	ID            int64                  `json:"id"`             // Уникальный идентификатор пользователя
+	TenantID      string                 `json:"tenant_id"`      // Арендатор, которому принадлежит пользователь
+	Name          string                 `json:"name"`           // Имя пользователя
+	Email         string                 `json:"email"`          // Электронная почта
+	DisplayName   string                 `json:"display_name"`   // Отображаемое имя
+	Phone         string                 `json:"phone"`          // Телефон в формате E.164
+	Locale        string                 `json:"locale"`         // Язык в виде тега BCP 47
+	Timezone      string                 `json:"timezone"`       // Часовой пояс IANA
+	AvatarURL     string                 `json:"avatar_url"`     // URL аватара
+	Metadata      map[string]interface{} `json:"metadata"`       // Произвольные атрибуты
+	Role          string                 `json:"role"`           // Роль в организации арендатора: admin или member
+	EmailVerified bool                   `json:"email_verified"` // Электронная почта подтверждена принятием приглашения
+	Status        string                 `json:"status"`         // Состояние учетной записи: pending, active, suspended или locked
+	CreatedAt     time.Time              `json:"created_at"`     // Дата и время создания
+	UpdatedAt     time.Time              `json:"updated_at"`     // Дата и время последнего изменения
+	UpdatedBy     string                 `json:"updated_by"`     // Инициатор последнего изменения
+}
+
+// UserCreate содержит данные для создания пользователя
+// Обязательны только имя и электронная почта
+type UserCreate struct {
+	Name        string                 `json:"name"`                   // Имя пользователя
+	Email       string                 `json:"email"`                  // Электронная почта
+	DisplayName string                 `json:"display_name,omitempty"` // Отображаемое имя
+	Phone       string                 `json:"phone,omitempty"`        // Телефон в формате E.164
+	Locale      string                 `json:"locale,omitempty"`       // Язык
+	Timezone    string                 `json:"timezone,omitempty"`     // Часовой пояс
+	AvatarURL   string                 `json:"avatar_url,omitempty"`   // URL аватара
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`     // Метаданные
+	Role        string                 `json:"role,omitempty"`         // Роль (пусто - member)
+	Status      string                 `json:"status,omitempty"`       // Начальное состояние: pending или active (пусто - active)
+}
+
+// UserUpdate содержит изменяемые поля пользователя
+// Пустые имя и почта и nil поля профиля не изменяются, указатель на пустую строку очищает поле профиля
+// Метаданные заменяются целиком: nil не изменяет их, указатель на пустой словарь очищает
+type UserUpdate struct {
+	Name        string                  `json:"name,omitempty"`         // Новое имя
+	Email       string                  `json:"email,omitempty"`        // Новая электронная почта
+	DisplayName *string                 `json:"display_name,omitempty"` // Новое отображаемое имя
+	Phone       *string                 `json:"phone,omitempty"`        // Новый телефон
+	Locale      *string                 `json:"locale,omitempty"`       // Новый язык
+	Timezone    *string                 `json:"timezone,omitempty"`     // Новый часовой пояс
+	AvatarURL   *string                 `json:"avatar_url,omitempty"`   // Новый URL аватара
+	Metadata    *map[string]interface{} `json:"metadata,omitempty"`     // Новые метаданные
+	Role        string                  `json:"role,omitempty"`         // Новая роль
+}
+
+// CreateUser создает нового пользователя
+// Запрос не повторяется автоматически, так как не является идемпотентным
+func (c *Client) CreateUser(ctx context.Context, user UserCreate) (*User, error) {
+	var created User
+	if _, err := c.do(ctx, http.MethodPost, "/users", user, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetUser получает пользователя по ID
+func (c *Client) GetUser(ctx context.Context, id int64) (*User, error) {
+	var user User
+	if _, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/%d", id), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUser обновляет переданные поля пользователя
+func (c *Client) UpdateUser(ctx context.Context, id int64, update UserUpdate) (*User, error) {
+	var user User
+	if _, err := c.do(ctx, http.MethodPut, fmt.Sprintf("/users/%d", id), update, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser удаляет пользователя
+func (c *Client) DeleteUser(ctx context.Context, id int64) error {
+	_, err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/users/%d", id), nil, nil)
+	return err
+}
+
+// SuspendUser приостанавливает активную учетную запись пользователя
+// reason - причина для журнала аудита (может быть пустой)
+// Если учетная запись не активна, возвращается ошибка ErrConflict
+func (c *Client) SuspendUser(ctx context.Context, id int64, reason string) (*User, error) {
+	return c.changeUserStatus(ctx, fmt.Sprintf("/users/%d/suspend", id), reason)
+}
+
+// ReactivateUser активирует ожидающую активации, приостановленную или заблокированную учетную запись
+// reason - причина для журнала аудита (может быть пустой)
+// Если учетная запись уже активна, возвращается ошибка ErrConflict
+func (c *Client) ReactivateUser(ctx context.Context, id int64, reason string) (*User, error) {
+	return c.changeUserStatus(ctx, fmt.Sprintf("/users/%d/reactivate", id), reason)
+}
+
+// changeUserStatus выполняет запрос изменения состояния учетной записи
+func (c *Client) changeUserStatus(ctx context.Context, path, reason string) (*User, error) {
+	body := struct {
+		Reason string `json:"reason,omitempty"`
+	}{Reason: reason}
+
+	var user User
+	if _, err := c.do(ctx, http.MethodPost, path, body, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsersPage получает одну страницу пользователей, отсортированных по ID
+// limit - размер страницы (1..100)
+// offset - смещение от начала списка
+// Возвращает пользователей страницы и общее количество пользователей
+func (c *Client) ListUsersPage(ctx context.Context, limit, offset int) ([]User, int, error) {
+	return c.listUsersPage(ctx, limit, offset, ListUsersOptions{})
+}
+
+// listUsersPage получает одну страницу пользователей с учетом фильтра и сортировки из opts
+func (c *Client) listUsersPage(ctx context.Context, limit, offset int, opts ListUsersOptions) ([]User, int, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+	if !opts.UpdatedSince.IsZero() {
+		query.Set("updated_since", opts.UpdatedSince.Format(time.RFC3339Nano))
+	}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
+	}
+	for key, value := range opts.Metadata {
+		query.Set("metadata."+key, value)
+	}
+	for _, key := range opts.HasMetadata {
+		query.Add("has_metadata", key)
+	}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+
+	var users []User
+	header, err := c.do(ctx, http.MethodGet, "/users?"+query.Encode(), nil, &users)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, _ := strconv.Atoi(header.Get("X-Total-Count"))
+	return users, total, nil
+}
+
+// Порядок сортировки списка пользователей
+const (
+	SortByID        = "id"         // По ID (по умолчанию)
+	SortByUpdatedAt = "updated_at" // По времени последнего изменения, затем по ID
+)
+
+// ListUsersOptions настраивает итератор ListUsers
+// Для инкрементальной синхронизации задается UpdatedSince с временем предыдущей синхронизации
+// и Sort = SortByUpdatedAt
+type ListUsersOptions struct {
+	PageSize     int               // Размер запрашиваемой страницы (0 - 100)
+	UpdatedSince time.Time         // Только пользователи, измененные начиная с этого момента (нулевое значение - все)
+	Sort         string            // Порядок сортировки: SortByID или SortByUpdatedAt (пустая строка - SortByID)
+	Metadata     map[string]string // Только пользователи с указанными значениями ключей метаданных
+	HasMetadata  []string          // Только пользователи, у которых заданы все указанные ключи метаданных
+	Status       string            // Только пользователи в указанном состоянии учетной записи (пустая строка - в любом)
+}
+
+// ListUsers возвращает итератор по всем пользователям
+// Страницы запрашиваются по мере обхода:
+//
+//	it := c.ListUsers(ctx, client.ListUsersOptions{})
+//	for it.Next() {
+//		user := it.User()
+//	}
+//	if err := it.Err(); err != nil {
+//		// ошибка получения страницы
+//	}
+func (c *Client) ListUsers(ctx context.Context, opts ListUsersOptions) *UserIterator {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	return &UserIterator{
+		ctx:      ctx,
+		client:   c,
+		pageSize: pageSize,
+		opts:     opts,
+	}
+}
+
+// UserIterator обходит список пользователей постранично
+// Не предназначен для одновременного использования из нескольких горутин
+type UserIterator struct {
+	ctx      context.Context
+	client   *Client
+	pageSize int
+	opts     ListUsersOptions // Фильтр и сортировка списка
+	offset   int              // Смещение следующей страницы
+	page     []User           // Текущая страница
+	index    int              // Позиция текущего пользователя в странице
+	total    int              // Общее количество пользователей по данным последней страницы
+	done     bool             // Достигнут конец списка
+	err      error            // Ошибка получения страницы
+}
+
+// Next переходит к следующему пользователю и сообщает, есть ли он
+func (it *UserIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	if it.index+1 < len(it.page) {
+		it.index++
+		return true
+	}
+
+	if it.done {
+		return false
+	}
+
+	page, total, err := it.client.listUsersPage(it.ctx, it.pageSize, it.offset, it.opts)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.page, it.index, it.total = page, 0, total
+	it.offset += len(page)
+	if len(page) < it.pageSize || it.offset >= total {
+		it.done = true
+	}
+
+	return len(page) > 0
+}
+
+// User возвращает текущего пользователя
+// Вызывается только после Next, вернувшего true
+func (it *UserIterator) User() User {
+	return it.page[it.index]
+}
+
+// Total возвращает общее количество пользователей по данным последней полученной страницы
+func (it *UserIterator) Total() int {
+	return it.total
+}
+
+// Err возвращает ошибку, прервавшую обход
+func (it *UserIterator) Err() error {
+	return it.err
+}
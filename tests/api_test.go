@@ -4,23 +4,63 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+
 	"github.com/janson/usermicroservice/internal/model"
 )
 
 // Базовый URL для тестового API
 var baseURL = "http://localhost:8080"
 
-// Инициализация базового URL из переменных окружения
+// Секрет подписи токенов доступа (auth.jwt_secret из config.json)
+var jwtSecret = "dev-only-jwt-secret-change-me"
+
+// ID администратора, от имени которого выполняются запросы
+// Сервис проверяет учетную запись пользователя токена, поэтому администратор должен существовать и быть активным:
+// userctl users create -name "API Test" -email api-test@example.com -role admin
+var adminUserID = "1"
+
+// Инициализация базового URL, секрета и администратора из переменных окружения
 func init() {
 	if envURL := os.Getenv("API_URL"); envURL != "" {
 		baseURL = envURL
 		fmt.Printf("Используется URL из переменной окружения: %s\n", baseURL)
 	}
+	if secret := os.Getenv("AUTH_JWT_SECRET"); secret != "" {
+		jwtSecret = secret
+	}
+	if id := os.Getenv("API_TEST_USER_ID"); id != "" {
+		adminUserID = id
+	}
+}
+
+// newRequest создает запрос с токеном доступа администратора арендатора default
+func newRequest(t *testing.T, method, url string, body io.Reader) *http.Request {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatalf("Ошибка создания запроса: %v", err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":       adminUserID,
+		"tenant_id": "default",
+		"email":     "api-test@example.com",
+		"role":      model.UserRoleAdmin,
+		"token_use": "access",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatalf("Ошибка подписи токена: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
 }
 
 // Структура для хранения созданного пользователя между тестами
@@ -81,11 +121,10 @@ func TestCreateUser(t *testing.T) {
 		t.Fatalf("Ошибка маршалинга JSON: %v", err)
 	}
 
-	resp, err := http.Post(
-		fmt.Sprintf("%s/users", baseURL),
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	req := newRequest(t, http.MethodPost, fmt.Sprintf("%s/users", baseURL), bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("Ошибка запроса: %v", err)
 	}
@@ -122,7 +161,7 @@ func TestGetUser(t *testing.T) {
 		t.Skip("Пропуск теста: не найден ID пользователя")
 	}
 
-	resp, err := http.Get(fmt.Sprintf("%s/users/%d", baseURL, createdUserID))
+	resp, err := http.DefaultClient.Do(newRequest(t, http.MethodGet, fmt.Sprintf("%s/users/%d", baseURL, createdUserID), nil))
 	if err != nil {
 		t.Fatalf("Ошибка запроса: %v", err)
 	}
@@ -144,7 +183,7 @@ func TestGetUser(t *testing.T) {
 
 // TestGetAllUsers проверяет получение всех пользователей
 func TestGetAllUsers(t *testing.T) {
-	resp, err := http.Get(fmt.Sprintf("%s/users", baseURL))
+	resp, err := http.DefaultClient.Do(newRequest(t, http.MethodGet, fmt.Sprintf("%s/users", baseURL), nil))
 	if err != nil {
 		t.Fatalf("Ошибка запроса: %v", err)
 	}
@@ -179,15 +218,7 @@ func TestUpdateUser(t *testing.T) {
 		t.Fatalf("Ошибка маршалинга JSON: %v", err)
 	}
 
-	req, err := http.NewRequest(
-		http.MethodPut,
-		fmt.Sprintf("%s/users/%d", baseURL, createdUserID),
-		bytes.NewBuffer(jsonData),
-	)
-	if err != nil {
-		t.Fatalf("Ошибка создания запроса: %v", err)
-	}
-
+	req := newRequest(t, http.MethodPut, fmt.Sprintf("%s/users/%d", baseURL, createdUserID), bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}
@@ -211,20 +242,26 @@ func TestUpdateUser(t *testing.T) {
 	}
 }
 
+// TestUnauthenticated проверяет, что запрос без токена доступа отклоняется
+func TestUnauthenticated(t *testing.T) {
+	resp, err := http.Get(fmt.Sprintf("%s/users", baseURL))
+	if err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Ожидался код состояния %d, получен %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
 // TestDeleteUser проверяет удаление пользователя
 func TestDeleteUser(t *testing.T) {
 	if createdUserID == 0 {
 		t.Skip("Пропуск теста: не найден ID пользователя")
 	}
 
-	req, err := http.NewRequest(
-		http.MethodDelete,
-		fmt.Sprintf("%s/users/%d", baseURL, createdUserID),
-		nil,
-	)
-	if err != nil {
-		t.Fatalf("Ошибка создания запроса: %v", err)
-	}
+	req := newRequest(t, http.MethodDelete, fmt.Sprintf("%s/users/%d", baseURL, createdUserID), nil)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)